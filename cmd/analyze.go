@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"strings"
+
 	"goforge/pkg/analyzer"
 
 	"github.com/urfave/cli/v2"
@@ -16,25 +18,182 @@ func AnalyzeCommand() *cli.Command {
 			{
 				Name:  "structure",
 				Usage: "Analyze project structure and architecture",
+				Flags: []cli.Flag{
+					excludeFlag(),
+					fromFileFlag(),
+					refFlag(),
+					&cli.BoolFlag{
+						Name:  "churn",
+						Usage: "Rank hotspots by git churn and complexity (requires a git repository)",
+					},
+				},
 				Action: func(c *cli.Context) error {
-					path := c.Args().First()
-					if path == "" {
-						path = "."
-					}
-					return analyzer.AnalyzeStructure(path)
+					return forEachProject(c, true, func(path string) error {
+						return analyzer.AnalyzeStructure(path, analyzer.StructureOptions{
+							Exclude: c.StringSlice("exclude"),
+							Churn:   c.Bool("churn"),
+						})
+					})
 				},
 			},
 			{
 				Name:  "quality",
 				Usage: "Analyze code quality and suggest improvements",
+				Flags: []cli.Flag{
+					excludeFlag(),
+					fromFileFlag(),
+					refFlag(),
+					&cli.BoolFlag{
+						Name:    "verbose",
+						Aliases: []string{"v"},
+						Usage:   "List the low-severity findings too, such as shadowed variables and magic numbers",
+					},
+					&cli.StringSliceFlag{
+						Name:  "enable",
+						Usage: "Report only this rule (" + strings.Join(analyzer.Rules(), ", ") + "); repeatable",
+					},
+					&cli.StringSliceFlag{
+						Name:  "disable",
+						Usage: "Do not report this rule; repeatable",
+					},
+					&cli.StringFlag{
+						Name:  "weights",
+						Usage: "Grade weights, e.g. 'complexity=0.4,docs=0.2,duplication=0.2,formatting=0.2'",
+					},
+					&cli.StringFlag{
+						Name:  "fail-below",
+						Usage: "Fail if the overall grade is worse than this (A-F)",
+					},
+					&cli.StringFlag{
+						Name:  "fail-on",
+						Usage: "Fail if any finding is this severe: error (high severity) or warning (medium or high)",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the results as JSON",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					weights, err := analyzer.ParseGradeWeights(c.String("weights"))
+					if err != nil {
+						return err
+					}
+					// JSON results name their path, so they need no header
+					return forEachProject(c, !c.Bool("json"), func(path string) error {
+						return analyzer.AnalyzeQuality(path, analyzer.QualityOptions{
+							Exclude:   c.StringSlice("exclude"),
+							Enable:    c.StringSlice("enable"),
+							Disable:   c.StringSlice("disable"),
+							Verbose:   c.Bool("verbose"),
+							Weights:   weights,
+							FailBelow: c.String("fail-below"),
+							FailOn:    c.String("fail-on"),
+							JSON:      c.Bool("json"),
+						})
+					})
+				},
+			},
+			{
+				Name:  "fix",
+				Usage: "Apply safe fixes (gofmt, goimports) to the source files in place",
+				Flags: []cli.Flag{
+					excludeFlag(),
+					fromFileFlag(),
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Print a diff of the fixes without changing any file",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					paths, err := pathArgs(c, ".")
+					if err != nil {
+						return err
+					}
+					return forEachPath(paths, true, func(path string) error {
+						return analyzer.Fix(path, analyzer.FixOptions{
+							Exclude: c.StringSlice("exclude"),
+							DryRun:  c.Bool("dry-run"),
+						})
+					})
+				},
+			},
+			{
+				Name:  "api-surface",
+				Usage: "Record the exported API in a baseline file and report breaking changes against it",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "baseline",
+						Value: "api.json",
+						Usage: "File the exported API is recorded in; it is created when missing",
+					},
+					&cli.BoolFlag{
+						Name:  "check",
+						Usage: "Fail (exit code 2) on removed or changed symbols, or when there is no baseline",
+					},
+					&cli.BoolFlag{
+						Name:  "update",
+						Usage: "Record the current API in the baseline after comparing",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the changes as JSON",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					path := c.Args().First()
 					if path == "" {
 						path = "."
 					}
-					return analyzer.AnalyzeQuality(path)
+					return analyzer.AnalyzeAPISurface(path, analyzer.APISurfaceOptions{
+						Baseline: c.String("baseline"),
+						Check:    c.Bool("check"),
+						Update:   c.Bool("update"),
+						JSON:     c.Bool("json"),
+					})
+				},
+			},
+			{
+				Name:  "interfaces",
+				Usage: "Report interfaces, their implementers, and oversized or unused interfaces",
+				Flags: []cli.Flag{
+					excludeFlag(),
+					fromFileFlag(),
+					refFlag(),
+					&cli.IntFlag{
+						Name:  "max-methods",
+						Value: 5,
+						Usage: "Flag interfaces with more methods than this",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return forEachProject(c, true, func(path string) error {
+						return analyzer.AnalyzeInterfaces(path, c.StringSlice("exclude"), c.Int("max-methods"))
+					})
+				},
+			},
+			{
+				Name:  "receivers",
+				Usage: "Report types whose methods mix value and pointer receivers",
+				Flags: []cli.Flag{
+					excludeFlag(),
+					fromFileFlag(),
+					refFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					return forEachProject(c, true, func(path string) error {
+						return analyzer.AnalyzeReceivers(path, c.StringSlice("exclude"))
+					})
 				},
 			},
 		},
 	}
 }
+
+// excludeFlag returns the repeatable flag for skipping files during analysis.
+func excludeFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:    "exclude",
+		Aliases: []string{"e"},
+		Usage:   "Glob pattern of files or directories to skip (e.g. '*.pb.go', 'mocks/'); repeatable",
+	}
+}
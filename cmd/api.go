@@ -2,17 +2,22 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"goforge/pkg/analyzer"
 	"goforge/pkg/dependency"
 	"goforge/pkg/docs"
+	"goforge/pkg/exitcode"
+	"goforge/pkg/safewrite"
 
 	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/slog"
 )
 
 // APICommand returns the CLI command for starting the API server.
@@ -25,12 +30,34 @@ func APICommand() *cli.Command {
 				Name:    "port",
 				Aliases: []string{"p"},
 				Value:   "8080",
+				EnvVars: []string{"GOFORGE_PORT"},
 				Usage:   "Port to run the API server on",
 			},
+			&cli.StringFlag{
+				Name:  "root",
+				Usage: "Confine request paths to this directory; a .goforgeignore file in it lists further off-limits directories",
+			},
+			&cli.BoolFlag{
+				Name:  "metrics",
+				Usage: "Serve Prometheus metrics (request counts, durations, in-flight analyses) at " + metricsPath,
+			},
+			logFormatFlag(),
 		},
 		Action: func(c *cli.Context) error {
 			port := c.String("port")
-			return startAPIServer(port)
+			guard, err := newPathGuard(c.String("root"))
+			if err != nil {
+				return err
+			}
+			log, err := newServerLog(c)
+			if err != nil {
+				return err
+			}
+			var metrics *apiMetrics
+			if c.Bool("metrics") {
+				metrics = newAPIMetrics()
+			}
+			return startAPIServer(port, guard, metrics, log)
 		},
 	}
 }
@@ -46,22 +73,177 @@ type SuccessResponse struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-// startAPIServer starts the API server on the specified port.
-func startAPIServer(port string) error {
-	fmt.Printf("Starting API server on port %s...\n", port)
+// ignoreFile lists directories under the API root that requests may not touch.
+const ignoreFile = ".goforgeignore"
 
-	// Define API routes
-	http.HandleFunc("/api/health", healthCheckHandler)
-	http.HandleFunc("/api/analyze/structure", analyzeStructureHandler)
-	http.HandleFunc("/api/analyze/quality", analyzeQualityHandler)
-	http.HandleFunc("/api/dependency/check", checkDependenciesHandler)
-	http.HandleFunc("/api/docs/generate", generateDocsHandler)
+// guardedParams are the form fields holding filesystem paths.
+var guardedParams = []string{"path", "output"}
+
+// maxFormMemory is how much of a multipart form is kept in memory; larger
+// parts go to temporary files.
+const maxFormMemory = 32 << 20
+
+// parseForm parses the request's form, either URL-encoded or multipart as the
+// web UI posts it. ParseForm alone leaves a multipart body unparsed while
+// making r.Form non-nil, so that FormValue never reads the body either.
+func parseForm(r *http.Request) error {
+	err := r.ParseMultipartForm(maxFormMemory)
+	if errors.Is(err, http.ErrNotMultipart) {
+		return r.ParseForm()
+	}
+	return err
+}
+
+// pathGuard confines request paths to a root directory, minus ignored directories.
+type pathGuard struct {
+	root    string
+	ignored []string
+}
+
+// newPathGuard returns a guard for root, or nil when root is empty.
+func newPathGuard(root string) (*pathGuard, error) {
+	if root == "" {
+		return nil, nil
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for root: %w", err)
+	}
+	absRoot, err = filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid root: %w", err)
+	}
+
+	guard := &pathGuard{root: absRoot}
+
+	data, err := os.ReadFile(filepath.Join(absRoot, ignoreFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", ignoreFile, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern := strings.Trim(filepath.ToSlash(line), "/")
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in %s: %w", line, ignoreFile, err)
+		}
+		guard.ignored = append(guard.ignored, pattern)
+	}
+
+	return guard, nil
+}
+
+// resolve maps a request path to an absolute path inside the root, rejecting
+// paths that escape it or fall under an ignored directory.
+func (g *pathGuard) resolve(p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(g.root, p)
+	}
+	p = filepath.Clean(p)
+
+	// Follow symlinks for paths that exist so links cannot escape the root
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		p = real
+	}
+
+	rel, err := filepath.Rel(g.root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside the API root", p)
+	}
+	if rel == "." {
+		return p, nil
+	}
+
+	// Match each leading part of the path, e.g. a, a/b, a/b/c
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		for _, pattern := range g.ignored {
+			// Patterns without a slash match a directory name at any depth
+			candidate := prefix
+			if !strings.Contains(pattern, "/") {
+				candidate = parts[i]
+			}
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return "", fmt.Errorf("path %s is excluded by %s", rel, ignoreFile)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// confine wraps a handler so its path parameters are checked against the
+// guard and replaced with their resolved absolute paths. A nil guard allows
+// any path.
+func (g *pathGuard) confine(next http.HandlerFunc) http.HandlerFunc {
+	if g == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := parseForm(r); err != nil {
+			sendError(w, "Failed to parse form data", http.StatusBadRequest)
+			return
+		}
+
+		for _, param := range guardedParams {
+			value := r.Form.Get(param)
+			if value == "" {
+				continue
+			}
+			resolved, err := g.resolve(value)
+			if err != nil {
+				sendError(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			r.Form.Set(param, resolved)
+		}
+
+		next(w, r)
+	}
+}
+
+// startAPIServer starts the API server on the specified port. When guard is
+// non-nil, request paths are confined to its root; when metrics is non-nil,
+// the endpoints are instrumented and the metrics are served.
+func startAPIServer(port string, guard *pathGuard, metrics *apiMetrics, log *serverLog) error {
+	log.infof("Starting API server on port %s...", port)
+
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux, guard, metrics, log)
 
 	// Start the server
 	addr := ":" + port
-	fmt.Printf("API server is running at http://localhost%s\n", addr)
-	fmt.Println("Press Ctrl+C to stop")
-	return http.ListenAndServe(addr, nil)
+	log.listening("API server", addr)
+	return http.ListenAndServe(addr, log.logRequests(mux))
+}
+
+// registerAPIRoutes mounts the /api/* endpoints, and the metrics endpoint
+// when metrics is non-nil, on mux.
+func registerAPIRoutes(mux *http.ServeMux, guard *pathGuard, metrics *apiMetrics, log *serverLog) {
+	if guard != nil {
+		log.infof("Request paths are confined to %s (%d ignored patterns)", guard.root, len(guard.ignored))
+	}
+
+	// Define API routes
+	mux.HandleFunc("/api/health", metrics.instrument("/api/health", false, healthCheckHandler))
+	analyses := map[string]http.HandlerFunc{
+		"/api/analyze/structure": analyzeStructureHandler,
+		"/api/analyze/quality":   analyzeQualityHandler,
+		"/api/dependency/check":  checkDependenciesHandler,
+		"/api/docs/generate":     generateDocsHandler,
+	}
+	for route, handler := range analyses {
+		mux.HandleFunc(route, metrics.instrument(route, true, guard.confine(handler)))
+	}
+	if metrics != nil {
+		mux.Handle(metricsPath, metrics.handler())
+		log.infof("Serving Prometheus metrics at %s", metricsPath)
+	}
 }
 
 // healthCheckHandler handles health check requests.
@@ -90,7 +272,7 @@ func analyzeStructureHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse the request
-	err := r.ParseForm()
+	err := parseForm(r)
 	if err != nil {
 		sendError(w, "Failed to parse form data", http.StatusBadRequest)
 		return
@@ -117,7 +299,10 @@ func analyzeStructureHandler(w http.ResponseWriter, r *http.Request) {
 	defer func() { os.Stdout = oldStdout }()
 
 	// Run the analysis
-	err = analyzer.AnalyzeStructure(path)
+	err = analyzer.AnalyzeStructure(path, analyzer.StructureOptions{
+		Exclude: r.Form["exclude"],
+		Churn:   r.Form.Get("churn") == "true",
+	})
 	if err != nil {
 		sendError(w, fmt.Sprintf("Failed to analyze structure: %v", err), http.StatusInternalServerError)
 		return
@@ -150,7 +335,7 @@ func analyzeQualityHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse the request
-	err := r.ParseForm()
+	err := parseForm(r)
 	if err != nil {
 		sendError(w, "Failed to parse form data", http.StatusBadRequest)
 		return
@@ -177,7 +362,10 @@ func analyzeQualityHandler(w http.ResponseWriter, r *http.Request) {
 	defer func() { os.Stdout = oldStdout }()
 
 	// Run the analysis
-	err = analyzer.AnalyzeQuality(path)
+	err = analyzer.AnalyzeQuality(path, analyzer.QualityOptions{
+		Exclude: r.Form["exclude"],
+		Verbose: r.Form.Get("verbose") == "true",
+	})
 	if err != nil {
 		sendError(w, fmt.Sprintf("Failed to analyze quality: %v", err), http.StatusInternalServerError)
 		return
@@ -210,7 +398,7 @@ func checkDependenciesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse the request
-	err := r.ParseForm()
+	err := parseForm(r)
 	if err != nil {
 		sendError(w, "Failed to parse form data", http.StatusBadRequest)
 		return
@@ -237,8 +425,9 @@ func checkDependenciesHandler(w http.ResponseWriter, r *http.Request) {
 	defer func() { os.Stdout = oldStdout }()
 
 	// Run the dependency check
-	err = dependency.CheckOutdated(path)
-	if err != nil {
+	// Outdated dependencies are a policy failure, not a failed check
+	err = dependency.CheckOutdated(path, dependency.OutdatedOptions{Retries: dependency.DefaultRetries})
+	if err != nil && !exitcode.IsPolicy(err) {
 		sendError(w, fmt.Sprintf("Failed to check dependencies: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -270,7 +459,7 @@ func generateDocsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse the request
-	err := r.ParseForm()
+	err := parseForm(r)
 	if err != nil {
 		sendError(w, "Failed to parse form data", http.StatusBadRequest)
 		return
@@ -292,9 +481,20 @@ func generateDocsHandler(w http.ResponseWriter, r *http.Request) {
 		format = "markdown" // Default to markdown
 	}
 
+	// Existing documentation is only replaced on request, except in the
+	// default scratch directory
+	write := safewrite.Options{Force: r.FormValue("force") == "true"}
 	outputDir := r.FormValue("output")
 	if outputDir == "" {
 		outputDir = filepath.Join(os.TempDir(), "goforge-docs")
+		write.Force = true
+	}
+	// Inline returns the generated files in the response instead of
+	// writing them
+	var collector *safewrite.Collector
+	if r.FormValue("inline") == "true" {
+		collector = &safewrite.Collector{}
+		write.Collect = collector
 	}
 
 	// Create a temporary file to capture output
@@ -314,9 +514,9 @@ func generateDocsHandler(w http.ResponseWriter, r *http.Request) {
 	// Generate the documentation
 	var docErr error
 	if docType == "api" {
-		docErr = docs.GenerateAPIDoc(path, outputDir, format)
+		docErr = docs.GenerateAPIDoc(path, outputDir, format, write)
 	} else {
-		docErr = docs.GenerateUserDoc(path, outputDir, format)
+		docErr = docs.GenerateUserDoc(path, outputDir, format, write)
 	}
 
 	if docErr != nil {
@@ -333,12 +533,16 @@ func generateDocsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send the response
+	data := map[string]interface{}{
+		"output":    string(output),
+		"directory": outputDir,
+	}
+	if collector != nil {
+		data["files"] = collector.Files()
+	}
 	response := SuccessResponse{
 		Message: "Documentation generated successfully",
-		Data: map[string]interface{}{
-			"output":    string(output),
-			"directory": outputDir,
-		},
+		Data:    data,
 	}
 
 	sendJSON(w, response, http.StatusOK)
@@ -351,7 +555,7 @@ func sendJSON(w http.ResponseWriter, data interface{}, status int) {
 
 	err := json.NewEncoder(w).Encode(data)
 	if err != nil {
-		log.Printf("Failed to encode JSON response: %v", err)
+		slog.Error("failed to encode JSON response", "error", err)
 	}
 }
 
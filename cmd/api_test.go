@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newModule writes a minimal module under a temporary directory and returns
+// the directory.
+func newModule(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.20\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// multipartRequest builds a POST to target with fields encoded as
+// multipart/form-data, the way the web UI posts its forms.
+func multipartRequest(t *testing.T, target string, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestConfineMultipartForm(t *testing.T) {
+	root := newModule(t)
+	guard, err := newPathGuard(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+		path   string
+	}{
+		{
+			name:   "multipart inside root",
+			req:    multipartRequest(t, "/api/analyze/structure", map[string]string{"path": root}),
+			status: http.StatusOK,
+			path:   resolvedRoot,
+		},
+		{
+			name:   "multipart outside root",
+			req:    multipartRequest(t, "/api/analyze/structure", map[string]string{"path": t.TempDir()}),
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "url-encoded inside root",
+			req:    urlEncodedRequest("/api/analyze/structure", url.Values{"path": {root}}),
+			status: http.StatusOK,
+			path:   resolvedRoot,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := guard.confine(func(w http.ResponseWriter, r *http.Request) {
+				got = r.FormValue("path")
+				w.WriteHeader(http.StatusOK)
+			})
+			rec := httptest.NewRecorder()
+			handler(rec, tt.req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body)
+			}
+			if got != tt.path {
+				t.Errorf("path = %q, want %q", got, tt.path)
+			}
+		})
+	}
+}
+
+func TestAnalyzeStructureHandlerMultipart(t *testing.T) {
+	root := newModule(t)
+	guard, err := newPathGuard(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := multipartRequest(t, "/api/analyze/structure", map[string]string{"path": root})
+	guard.confine(analyzeStructureHandler)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusOK, rec.Body)
+	}
+	var response SuccessResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Message != "Project structure analyzed successfully" {
+		t.Errorf("message = %q", response.Message)
+	}
+}
+
+// urlEncodedRequest builds a POST to target with form as its
+// application/x-www-form-urlencoded body.
+func urlEncodedRequest(target string, form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
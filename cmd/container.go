@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"goforge/pkg/config"
 	"goforge/pkg/container"
 
 	"github.com/urfave/cli/v2"
@@ -26,17 +31,148 @@ func ContainerCommand() *cli.Command {
 					&cli.StringFlag{
 						Name:    "base",
 						Aliases: []string{"b"},
-						Value:   "golang:alpine",
-						Usage:   "Base Docker image",
+						EnvVars: []string{"GOFORGE_DOCKER_BASE"},
+						Usage:   "Base Docker image (default golang:<go.mod version>-alpine)",
+					},
+					&cli.BoolFlag{
+						Name:  "pin-digest",
+						Usage: "Pin the base and runtime images to their current digests (requires docker buildx)",
+					},
+					&cli.StringFlag{
+						Name:  "runtime-image",
+						Value: container.DefaultRuntime,
+						Usage: "Final-stage image: alpine, distroless, or scratch",
+					},
+					&cli.StringFlag{
+						Name:  "main",
+						Usage: "Main package to build (e.g. ./cmd/server) when the project has several",
+					},
+					&cli.BoolFlag{
+						Name:  "all-mains",
+						Usage: "Generate a Dockerfile per main package under cmd/, named after --output with the binary appended (Dockerfile.api, ...)",
+					},
+					&cli.BoolFlag{
+						Name:  "bake",
+						Usage: "With --all-mains, also generate a docker-bake.hcl that builds every image",
+					},
+					&cli.StringFlag{
+						Name:  "healthcheck-path",
+						Usage: "HTTP path of the HEALTHCHECK (default: the health route detected in source)",
+					},
+					&cli.BoolFlag{
+						Name:  "no-healthcheck",
+						Usage: "Do not add a HEALTHCHECK instruction",
+					},
+					&cli.StringFlag{
+						Name:  "version-var",
+						Value: container.DefaultLinkerVars.Version,
+						Usage: "Variable that receives the git tag via -ldflags -X (empty to skip)",
+					},
+					&cli.StringFlag{
+						Name:  "revision-var",
+						Value: container.DefaultLinkerVars.Revision,
+						Usage: "Variable that receives the git commit via -ldflags -X (empty to skip)",
+					},
+					&cli.StringFlag{
+						Name:  "created-var",
+						Value: container.DefaultLinkerVars.Created,
+						Usage: "Variable that receives the build time via -ldflags -X (empty to skip)",
 					},
+					&cli.BoolFlag{
+						Name:  "vendor",
+						Usage: "Build from the vendor directory with -mod=vendor instead of downloading modules",
+					},
+					&cli.BoolFlag{
+						Name:  "vendor-create",
+						Usage: "Run 'go mod vendor' first when vendor/ is missing or out of date (implies --vendor)",
+					},
+					&cli.StringFlag{
+						Name:  "goprivate",
+						Usage: "GOPRIVATE patterns of private modules set in the builder stage, e.g. 'github.com/acme/*'",
+					},
+					&cli.StringFlag{
+						Name:  "gonosumdb",
+						Usage: "GONOSUMDB patterns of modules not checked against the checksum database (default: those of --goprivate)",
+					},
+					&cli.StringFlag{
+						Name: "private-auth",
+						Usage: "Credentials for private module downloads, mounted as a BuildKit secret and never stored in a layer: " +
+							"'netrc' mounts secret id \"" + container.NetrcSecretID + "\" as /root/.netrc " +
+							"(build with --secret id=" + container.NetrcSecretID + ",src=$HOME/.netrc); " +
+							"'token' reads an HTTPS token for the --goprivate hosts from secret id \"" + container.TokenSecretID + "\" " +
+							"(build with --secret id=" + container.TokenSecretID + ",env=GITHUB_TOKEN)",
+					},
+					nonrootFlag(),
+					envFlag("Environment variable to set in the image (KEY=VALUE); repeatable"),
+					portFlag(),
+					templatesFlag(),
+					&cli.StringSliceFlag{
+						Name: "update",
+						Usage: "Update the existing Dockerfile at --output instead of regenerating it, keeping comments and other lines: " +
+							strings.Join(container.DockerfileUpdates, ", ") + "; repeatable",
+					},
+					&cli.BoolFlag{
+						Name:    "yes",
+						Aliases: []string{"y"},
+						Usage:   "With --update, apply the changes without asking for confirmation",
+					},
+					forceFlag(),
+					diffFlag(),
+					jsonFilesFlag(),
 				},
-				Action: func(c *cli.Context) error {
+				Action: jsonFiles(func(c *cli.Context) error {
 					path := c.Args().First()
 					if path == "" {
 						path = "."
 					}
-					return container.GenerateDockerfile(path, c.String("output"), c.String("base"))
-				},
+					if c.IsSet("update") {
+						if c.Bool("all-mains") {
+							return fmt.Errorf("--update edits a single Dockerfile and cannot be combined with --all-mains")
+						}
+						return container.UpdateDockerfile(path, c.String("output"), container.DockerfileUpdateOptions{
+							Updates: c.StringSlice("update"),
+							Yes:     c.Bool("yes"),
+							Options: writeOptions(c),
+						})
+					}
+					env, err := container.ParseEnv(c.StringSlice("env"))
+					if err != nil {
+						return err
+					}
+					templates, err := containerTemplates(c, path)
+					if err != nil {
+						return err
+					}
+					opts := container.DockerfileOptions{
+						BaseImage: c.String("base"),
+						PinDigest: c.Bool("pin-digest"),
+						Main:      c.String("main"),
+						Runtime:   c.String("runtime-image"),
+						NonRoot:   c.Bool("nonroot"),
+						Env:       env,
+						Ports:     c.IntSlice("port"),
+
+						HealthCheckPath: c.String("healthcheck-path"),
+						NoHealthCheck:   c.Bool("no-healthcheck"),
+						LinkerVars: container.LinkerVars{
+							Version:  c.String("version-var"),
+							Revision: c.String("revision-var"),
+							Created:  c.String("created-var"),
+						},
+						Vendor:       c.Bool("vendor"),
+						VendorCreate: c.Bool("vendor-create"),
+						Private: container.PrivateModules{
+							GoPrivate: c.String("goprivate"),
+							GoNoSumDB: c.String("gonosumdb"),
+							Auth:      c.String("private-auth"),
+						},
+						AllMains:  c.Bool("all-mains"),
+						Bake:      c.Bool("bake"),
+						Templates: templates,
+						Options:   writeOptions(c),
+					}
+					return container.GenerateDockerfile(path, c.String("output"), opts)
+				}),
 			},
 			{
 				Name:  "kubernetes",
@@ -53,15 +189,808 @@ func ContainerCommand() *cli.Command {
 						Aliases: []string{"i"},
 						Usage:   "Docker image to use in Kubernetes manifests",
 					},
+					&cli.BoolFlag{
+						Name:  "all-mains",
+						Usage: "Generate a Deployment and Service per main package under cmd/, in one subdirectory each; --image is then the repository prefix",
+					},
+					&cli.StringFlag{
+						Name:  "spec",
+						Usage: "YAML spec listing several services (name, image, port, replicas); one subdirectory per service",
+					},
+					&cli.StringFlag{
+						Name:  "kind",
+						Value: container.KindDeployment,
+						Usage: "Workload kind: " + strings.Join(container.WorkloadKinds, ", "),
+					},
+					&cli.IntFlag{
+						Name:  "replicas",
+						Value: container.DefaultReplicas,
+						Usage: "Number of Deployment or StatefulSet replicas",
+					},
+					&cli.StringFlag{
+						Name:  "cpu-request",
+						Usage: "CPU request, e.g. 250m (default " + container.DefaultResources.CPURequest + ")",
+					},
+					&cli.StringFlag{
+						Name:  "cpu-limit",
+						Usage: "CPU limit, e.g. 1 (default " + container.DefaultResources.CPULimit + ")",
+					},
+					&cli.StringFlag{
+						Name:  "memory-request",
+						Usage: "Memory request, e.g. 256Mi (default " + container.DefaultResources.MemoryRequest + ")",
+					},
+					&cli.StringFlag{
+						Name:  "memory-limit",
+						Usage: "Memory limit, e.g. 1Gi (default " + container.DefaultResources.MemoryLimit + ")",
+					},
+					&cli.BoolFlag{
+						Name:  "no-limits",
+						Usage: "Omit the CPU and memory limits",
+					},
+					&cli.StringFlag{
+						Name:  "from-profile",
+						Usage: "Suggest the memory request from the live heap in this heap profile",
+					},
+					&cli.StringSliceFlag{
+						Name:  "volume-claim",
+						Usage: "StatefulSet volume claim template (NAME:MOUNT_PATH:SIZE, e.g. data:/var/lib/app:10Gi); repeatable",
+					},
+					&cli.StringFlag{
+						Name:  "storage-class",
+						Usage: "Storage class of the StatefulSet volume claims (default: the cluster's default class)",
+					},
+					&cli.StringFlag{
+						Name:  "schedule",
+						Usage: "CronJob schedule in cron syntax, e.g. \"0 3 * * *\" or @daily",
+					},
+					&cli.StringFlag{
+						Name:  "concurrency-policy",
+						Value: container.DefaultConcurrencyPolicy,
+						Usage: "CronJob concurrency policy: Allow, Forbid, or Replace",
+					},
+					&cli.IntFlag{
+						Name:  "completions",
+						Value: container.DefaultCompletions,
+						Usage: "Successful pods a Job needs to complete",
+					},
+					&cli.IntFlag{
+						Name:  "parallelism",
+						Value: container.DefaultParallelism,
+						Usage: "Pods a Job runs at once",
+					},
+					&cli.IntFlag{
+						Name:  "backoff-limit",
+						Value: container.DefaultBackoffLimit,
+						Usage: "Retries before a Job is marked failed",
+					},
+					&cli.IntFlag{
+						Name:  "termination-grace-period",
+						Value: container.DefaultGracePeriod,
+						Usage: "Seconds pods get to shut down after SIGTERM before they are killed",
+					},
+					&cli.StringFlag{
+						Name:    "namespace",
+						Aliases: []string{"n"},
+						Usage:   "Namespace for all resources; a Namespace manifest is generated for it",
+					},
+					&cli.StringSliceFlag{
+						Name:  "label",
+						Usage: "Label to add to every resource and pod (key=value); repeatable",
+					},
+					&cli.StringSliceFlag{
+						Name:  "annotation",
+						Usage: "Annotation to add to every resource (key=value); repeatable",
+					},
+					&cli.StringFlag{
+						Name:  "service-type",
+						Usage: "Service type: " + strings.Join(container.ServiceTypes, ", ") + " (default " + container.ServiceClusterIP + ")",
+					},
+					&cli.StringSliceFlag{
+						Name:  "service-annotation",
+						Usage: "Annotation to add to the Service only, e.g. for a cloud load balancer (key=value); repeatable",
+					},
+					&cli.StringSliceFlag{
+						Name:  "port-name",
+						Usage: "Name of a container port (PORT=NAME, e.g. 9090=metrics), overriding the default; repeatable",
+					},
+					&cli.StringFlag{
+						Name:  "health-path",
+						Usage: "HTTP liveness probe path (default: the health route detected in source)",
+					},
+					&cli.StringFlag{
+						Name:  "ready-path",
+						Usage: "HTTP readiness probe path (default: the detected readiness route, else --health-path)",
+					},
+					&cli.IntFlag{
+						Name:  "probe-port",
+						Usage: "Port to probe (default: the first application port)",
+					},
+					&cli.StringFlag{
+						Name:  "probe",
+						Usage: "Probe type: http, tcp, or exec:<command> (default: http when a health route is known, else tcp)",
+					},
+					&cli.BoolFlag{
+						Name:  "no-probes",
+						Usage: "Omit liveness and readiness probes",
+					},
+					&cli.StringSliceFlag{
+						Name:  "config",
+						Usage: "Environment variable to put in the generated ConfigMap, overriding detection; repeatable",
+					},
+					&cli.StringSliceFlag{
+						Name:  "secret",
+						Usage: "Environment variable to put in the generated Secret, overriding detection; repeatable",
+					},
+					nonrootFlag(),
+					envFlag("Environment variable to set on the container (KEY=VALUE); repeatable"),
+					portFlag(),
+					templatesFlag(),
+					forceFlag(),
+					diffFlag(),
+					jsonFilesFlag(),
+				},
+				Action: jsonFiles(func(c *cli.Context) error {
+					meta, err := k8sMetadata(c)
+					if err != nil {
+						return err
+					}
+					if spec := c.String("spec"); spec != "" {
+						templates, err := containerTemplates(c, filepath.Dir(spec))
+						if err != nil {
+							return err
+						}
+						return container.GenerateFromSpec(spec, c.String("output"), meta, c.Bool("no-probes"), templates, writeOptions(c))
+					}
+					path := c.Args().First()
+					if path == "" {
+						path = "."
+					}
+					templates, err := containerTemplates(c, path)
+					if err != nil {
+						return err
+					}
+					env, err := container.ParseEnv(c.StringSlice("env"))
+					if err != nil {
+						return err
+					}
+					kind, command, err := container.ParseProbe(c.String("probe"))
+					if err != nil {
+						return err
+					}
+					claims, err := container.ParseVolumeClaims(c.StringSlice("volume-claim"))
+					if err != nil {
+						return err
+					}
+					serviceAnnotations, err := container.ParseAnnotations(c.StringSlice("service-annotation"))
+					if err != nil {
+						return err
+					}
+					portNames, err := container.ParsePortNames(c.StringSlice("port-name"))
+					if err != nil {
+						return err
+					}
+					replicas := c.Int("replicas")
+					gracePeriod := c.Int("termination-grace-period")
+					opts := container.KubernetesOptions{
+						Image: c.String("image"),
+						Env:   env,
+						Ports: c.IntSlice("port"),
+						Service: container.ServiceOptions{
+							Type:        c.String("service-type"),
+							Annotations: serviceAnnotations,
+							PortNames:   portNames,
+						},
+						NonRoot:     c.Bool("nonroot"),
+						Replicas:    &replicas,
+						GracePeriod: &gracePeriod,
+						Probes: container.ProbeOptions{
+							Disabled:   c.Bool("no-probes"),
+							Kind:       kind,
+							HealthPath: c.String("health-path"),
+							ReadyPath:  c.String("ready-path"),
+							Port:       c.Int("probe-port"),
+							Command:    command,
+						},
+						ConfigKeys: c.StringSlice("config"),
+						SecretKeys: c.StringSlice("secret"),
+						Metadata:   meta,
+						WorkloadOptions: container.WorkloadOptions{
+							Kind:              c.String("kind"),
+							VolumeClaims:      claims,
+							StorageClass:      c.String("storage-class"),
+							Schedule:          c.String("schedule"),
+							ConcurrencyPolicy: c.String("concurrency-policy"),
+							Completions:       c.Int("completions"),
+							Parallelism:       c.Int("parallelism"),
+							BackoffLimit:      c.Int("backoff-limit"),
+						},
+						Resources: container.Resources{
+							CPURequest:    c.String("cpu-request"),
+							CPULimit:      c.String("cpu-limit"),
+							MemoryRequest: c.String("memory-request"),
+							MemoryLimit:   c.String("memory-limit"),
+							NoLimits:      c.Bool("no-limits"),
+							FromProfile:   c.String("from-profile"),
+						},
+						AllMains:  c.Bool("all-mains"),
+						Templates: templates,
+						Options:   writeOptions(c),
+					}
+					return container.GenerateKubernetesManifests(path, c.String("output"), opts)
+				}),
+			},
+			{
+				Name:  "cloudrun",
+				Usage: "Generate a Google Cloud Run service from the same model as the Kubernetes manifests",
+				Flags: append(serverlessFlags(container.CloudRunFile, container.DefaultCloudRunResources),
+					&cli.IntFlag{
+						Name:  "max-instances",
+						Usage: "Most instances the service scales out to (default: Cloud Run's)",
+					},
+				),
+				Action: jsonFiles(func(c *cli.Context) error {
+					path := c.Args().First()
+					if path == "" {
+						path = "."
+					}
+					opts, err := serverlessOptions(c, path)
+					if err != nil {
+						return err
+					}
+					return container.GenerateCloudRun(path, c.String("output"), container.CloudRunOptions{
+						ServerlessOptions: opts,
+						MaxInstances:      c.Int("max-instances"),
+					})
+				}),
+			},
+			{
+				Name:  "ecs",
+				Usage: "Generate an AWS ECS task definition for Fargate from the same model as the Kubernetes manifests",
+				Flags: append(serverlessFlags(container.ECSFile, container.DefaultECSResources),
+					&cli.StringFlag{
+						Name:  "execution-role",
+						Usage: "ARN of the task execution role that pulls the image, writes logs, and reads secrets (default: a placeholder)",
+					},
+					&cli.StringFlag{
+						Name:    "region",
+						EnvVars: []string{"AWS_REGION"},
+						Usage:   "AWS region of the logs and secrets (default: a placeholder)",
+					},
+				),
+				Action: jsonFiles(func(c *cli.Context) error {
+					path := c.Args().First()
+					if path == "" {
+						path = "."
+					}
+					opts, err := serverlessOptions(c, path)
+					if err != nil {
+						return err
+					}
+					return container.GenerateECS(path, c.String("output"), container.ECSOptions{
+						ServerlessOptions: opts,
+						ExecutionRole:     c.String("execution-role"),
+						Region:            c.String("region"),
+					})
+				}),
+			},
+			{
+				Name:  "ci",
+				Usage: "Generate a CI pipeline that builds the image with buildx and pushes it",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "provider",
+						Value: container.CIGitHub,
+						Usage: "CI provider: " + strings.Join(container.CIProviders, " or "),
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Pipeline file (default .github/workflows/docker.yml or .gitlab-ci.yml in the project)",
+					},
+					&cli.StringFlag{
+						Name:  "registry",
+						Usage: "Registry host, logged into with the REGISTRY_USERNAME and REGISTRY_PASSWORD secrets (default: the provider's registry and token)",
+					},
+					&cli.StringFlag{
+						Name:  "image",
+						Usage: "Image name in the registry, e.g. team/app (default: the repository path, or the directory name with --registry)",
+					},
+					&cli.StringFlag{
+						Name:  "platforms",
+						Value: strings.Join(container.DefaultPlatforms, ","),
+						Usage: "Comma-separated target platforms",
+					},
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+						Value:   "Dockerfile",
+						Usage:   "Dockerfile to build, relative to the project",
+					},
+					templatesFlag(),
+					forceFlag(),
+					diffFlag(),
+					jsonFilesFlag(),
+				},
+				Action: jsonFiles(func(c *cli.Context) error {
+					path := c.Args().First()
+					if path == "" {
+						path = "."
+					}
+					platforms, err := container.ParsePlatforms(c.String("platforms"))
+					if err != nil {
+						return err
+					}
+					templates, err := containerTemplates(c, path)
+					if err != nil {
+						return err
+					}
+					return container.GenerateCI(path, c.String("output"), container.CIOptions{
+						Provider:   c.String("provider"),
+						Registry:   c.String("registry"),
+						Image:      c.String("image"),
+						Platforms:  platforms,
+						Dockerfile: c.String("file"),
+						Templates:  templates,
+						Options:    writeOptions(c),
+					})
+				}),
+			},
+			{
+				Name:  "skaffold",
+				Usage: "Generate a skaffold.yaml that builds the Dockerfile and deploys the manifests, with dev and prod profiles",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Configuration file (default skaffold.yaml in the project)",
+					},
+					&cli.StringFlag{
+						Name:    "image",
+						Aliases: []string{"i"},
+						Usage:   "Image name, as passed to 'container kubernetes' (default: the directory name); with --all-mains, the repository prefix",
+					},
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+						Value:   "Dockerfile",
+						Usage:   "Dockerfile to build, relative to the project; with --all-mains, each service builds it with its binary appended",
+					},
+					&cli.StringFlag{
+						Name:  "manifests",
+						Usage: "Directory of the Kubernetes manifests, relative to the project (default: a Helm chart in the project, else kubernetes)",
+					},
+					&cli.StringFlag{
+						Name:  "chart",
+						Usage: "Helm chart to deploy instead of the manifests, relative to the project",
+					},
+					&cli.BoolFlag{
+						Name:  "all-mains",
+						Usage: "Build an image per main package under cmd/ and deploy the manifests of 'container kubernetes --all-mains'",
+					},
+					&cli.StringFlag{
+						Name:  "platforms",
+						Value: strings.Join(container.DefaultPlatforms, ","),
+						Usage: "Comma-separated target platforms of the prod profile",
+					},
+					templatesFlag(),
+					forceFlag(),
+					diffFlag(),
+					jsonFilesFlag(),
+				},
+				Action: jsonFiles(func(c *cli.Context) error {
+					path := c.Args().First()
+					if path == "" {
+						path = "."
+					}
+					platforms, err := container.ParsePlatforms(c.String("platforms"))
+					if err != nil {
+						return err
+					}
+					templates, err := containerTemplates(c, path)
+					if err != nil {
+						return err
+					}
+					return container.GenerateSkaffold(path, c.String("output"), container.SkaffoldOptions{
+						Image:      c.String("image"),
+						Dockerfile: c.String("file"),
+						Manifests:  c.String("manifests"),
+						Chart:      c.String("chart"),
+						AllMains:   c.Bool("all-mains"),
+						Platforms:  platforms,
+						Templates:  templates,
+						Options:    writeOptions(c),
+					})
+				}),
+			},
+			{
+				Name:  "dev",
+				Usage: "Generate " + container.DevComposeFile + " and " + container.DevDockerfileName + " that rebuild the app in a container as the source changes",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "main",
+						Usage: "Main package to run, e.g. ./cmd/server (default: the only one)",
+					},
+					&cli.StringFlag{
+						Name:    "base",
+						Aliases: []string{"b"},
+						EnvVars: []string{"GOFORGE_DOCKER_BASE"},
+						Usage:   "Go image to run in (default golang:<go.mod version>-alpine)",
+					},
+					&cli.StringFlag{
+						Name:  "watcher",
+						Value: container.WatcherAir,
+						Usage: "File watcher: 'air' (github.com/air-verse/air) or 'loop' (a polling shell loop)",
+					},
+					&cli.BoolFlag{
+						Name:  "no-services",
+						Usage: "Leave out the databases, caches, and brokers detected from go.mod",
+					},
+					&cli.StringFlag{
+						Name:    "service-user",
+						EnvVars: []string{"GOFORGE_DEV_USER"},
+						Usage:   "User the backing services are set up with (default: app)",
+					},
+					&cli.StringFlag{
+						Name:    "service-password",
+						EnvVars: []string{"GOFORGE_DEV_PASSWORD"},
+						Usage:   "Password the backing services are set up with (default: app)",
+					},
+					&cli.BoolFlag{
+						Name:  "run",
+						Usage: "Start the environment with docker compose up, removing its containers on Ctrl+C",
+					},
+					envFlag("Environment variable to set in the app container (KEY=VALUE); repeatable"),
+					portFlag(),
+					templatesFlag(),
+					forceFlag(),
+					diffFlag(),
+					jsonFilesFlag(),
+				},
+				Action: jsonFiles(func(c *cli.Context) error {
+					path := c.Args().First()
+					if path == "" {
+						path = "."
+					}
+					env, err := container.ParseEnv(c.StringSlice("env"))
+					if err != nil {
+						return err
+					}
+					templates, err := containerTemplates(c, path)
+					if err != nil {
+						return err
+					}
+					return container.GenerateDev(path, container.DevOptions{
+						Main:            c.String("main"),
+						BaseImage:       c.String("base"),
+						Watcher:         c.String("watcher"),
+						Env:             env,
+						Ports:           c.IntSlice("port"),
+						NoServices:      c.Bool("no-services"),
+						ServiceUser:     c.String("service-user"),
+						ServicePassword: c.String("service-password"),
+						Run:             c.Bool("run"),
+						Templates:       templates,
+						Options:         writeOptions(c),
+					})
+				}),
+			},
+			{
+				Name:  "templates",
+				Usage: "Manage the templates of the container generators",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "export",
+						Usage: "Write the built-in templates to a directory as a starting point for overrides",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "output",
+								Aliases: []string{"o"},
+								Value:   "templates",
+								Usage:   "Directory to write the templates to",
+							},
+							forceFlag(),
+							diffFlag(),
+							jsonFilesFlag(),
+						},
+						Action: jsonFiles(func(c *cli.Context) error {
+							return container.ExportTemplates(c.String("output"), writeOptions(c))
+						}),
+					},
+				},
+			},
+			{
+				Name:  "build",
+				Usage: "Build the image with docker buildx or podman, generating a Dockerfile if missing",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "platforms",
+						Value: strings.Join(container.DefaultPlatforms, ","),
+						Usage: "Comma-separated target platforms",
+					},
+					&cli.StringFlag{
+						Name:    "tag",
+						Aliases: []string{"t"},
+						Usage:   "Image tag (default <dir>:latest)",
+					},
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+						Usage:   "Dockerfile path, generated when missing (default <dir>/Dockerfile)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "build-arg",
+						Usage: "Build argument (KEY=VALUE); repeatable",
+					},
+					&cli.StringSliceFlag{
+						Name: "secret",
+						Usage: "BuildKit secret passed through to the build, e.g. id=" + container.NetrcSecretID + ",src=$HOME/.netrc " +
+							"or id=" + container.TokenSecretID + ",env=GITHUB_TOKEN; repeatable",
+					},
+					&cli.BoolFlag{
+						Name:  "no-cache",
+						Usage: "Do not use the build cache",
+					},
+					&cli.BoolFlag{
+						Name:  "push",
+						Usage: "Push the image to its registry after a successful build",
+					},
+					&cli.BoolFlag{
+						Name:  "scan",
+						Usage: "Scan the built image for vulnerabilities with trivy or grype",
+					},
+					severityThresholdFlag(),
+					allowlistFlag(),
+					templatesFlag(),
 				},
 				Action: func(c *cli.Context) error {
 					path := c.Args().First()
 					if path == "" {
 						path = "."
 					}
-					return container.GenerateKubernetesManifests(path, c.String("output"), c.String("image"))
+					platforms, err := container.ParsePlatforms(c.String("platforms"))
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					templates, err := containerTemplates(c, path)
+					if err != nil {
+						return err
+					}
+					buildArgs, err := container.ParseBuildArgs(c.StringSlice("build-arg"))
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					opts := container.BuildOptions{
+						Dockerfile: c.String("file"),
+						Tag:        c.String("tag"),
+						Platforms:  platforms,
+						BuildArgs:  buildArgs,
+						Secrets:    c.StringSlice("secret"),
+						NoCache:    c.Bool("no-cache"),
+						Push:       c.Bool("push"),
+						Templates:  templates,
+					}
+					if c.Bool("scan") {
+						opts.Scan = &container.ScanOptions{
+							Threshold: c.String("severity-threshold"),
+							Allowlist: c.String("allowlist"),
+						}
+					}
+					return container.BuildImage(path, opts)
+				},
+			},
+			{
+				Name:      "scan",
+				Usage:     "Scan an image for vulnerabilities with trivy or grype, or lint a Dockerfile",
+				ArgsUsage: "<image|Dockerfile>",
+				Flags: []cli.Flag{
+					severityThresholdFlag(),
+					allowlistFlag(),
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the results as JSON",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					image := c.Args().First()
+					if image == "" {
+						return cli.Exit("an image or Dockerfile is required, e.g. goforge container scan repo/app:v1", 1)
+					}
+					if container.IsDockerfile(image) {
+						return container.LintDockerfile(image, container.DockerfileLintOptions{
+							Threshold: c.String("severity-threshold"),
+							JSON:      c.Bool("json"),
+						})
+					}
+					opts := container.ScanOptions{
+						Threshold: c.String("severity-threshold"),
+						Allowlist: c.String("allowlist"),
+						JSON:      c.Bool("json"),
+					}
+					return container.ScanImage(image, opts)
 				},
 			},
 		},
 	}
 }
+
+// severityThresholdFlag returns the flag setting the lowest severity that
+// fails an image scan.
+func severityThresholdFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "severity-threshold",
+		Value: container.DefaultSeverityThreshold,
+		Usage: "Fail when vulnerabilities reach this severity: low, medium, high, or critical",
+	}
+}
+
+// allowlistFlag returns the flag naming the accepted vulnerabilities file.
+func allowlistFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "allowlist",
+		Usage: "File of accepted vulnerability IDs (one per line, # comments) that do not fail the scan",
+	}
+}
+
+// envFlag returns the repeatable flag for passing KEY=VALUE environment variables.
+func envFlag(usage string) cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:  "env",
+		Usage: usage,
+	}
+}
+
+// portFlag returns the repeatable flag overriding the detected listening ports.
+func portFlag() cli.Flag {
+	return &cli.IntSliceFlag{
+		Name:    "port",
+		Aliases: []string{"p"},
+		Usage:   "Port the application listens on, overriding detection; repeatable (first is used for the Service)",
+	}
+}
+
+// k8sMetadata reads the namespace, label, and annotation flags.
+func k8sMetadata(c *cli.Context) (container.Metadata, error) {
+	labels, err := container.ParseLabels(c.StringSlice("label"))
+	if err != nil {
+		return container.Metadata{}, err
+	}
+	annotations, err := container.ParseAnnotations(c.StringSlice("annotation"))
+	if err != nil {
+		return container.Metadata{}, err
+	}
+	return container.Metadata{
+		Namespace:   c.String("namespace"),
+		Labels:      labels,
+		Annotations: annotations,
+	}, nil
+}
+
+// serverlessFlags returns the flags shared by the Cloud Run and ECS
+// generators, which describe the app like the Kubernetes manifests.
+func serverlessFlags(output string, defaults container.Resources) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Value:   output,
+			Usage:   "Output file path",
+		},
+		&cli.StringFlag{
+			Name:    "image",
+			Aliases: []string{"i"},
+			Usage:   "Docker image to deploy (default <project>:latest)",
+		},
+		&cli.StringFlag{
+			Name:  "cpu",
+			Usage: "CPU of the container, e.g. 1 or 500m (default " + defaults.CPULimit + ")",
+		},
+		&cli.StringFlag{
+			Name:  "memory",
+			Usage: "Memory of the container, e.g. 512Mi or 2Gi (default " + defaults.MemoryLimit + ")",
+		},
+		&cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "Label to add (key=value); repeatable",
+		},
+		&cli.StringFlag{
+			Name:  "health-path",
+			Usage: "HTTP liveness probe path (default: the health route detected in source)",
+		},
+		&cli.StringFlag{
+			Name:  "ready-path",
+			Usage: "HTTP readiness probe path (default: the detected readiness route, else --health-path)",
+		},
+		&cli.StringFlag{
+			Name:  "probe",
+			Usage: "Probe type: http, tcp, or exec:<command> (default: http when a health route is known, else tcp)",
+		},
+		&cli.BoolFlag{
+			Name:  "no-probes",
+			Usage: "Omit the probes and health checks",
+		},
+		&cli.StringSliceFlag{
+			Name:  "config",
+			Usage: "Environment variable to add as a plain value, overriding detection; repeatable",
+		},
+		&cli.StringSliceFlag{
+			Name:  "secret",
+			Usage: "Environment variable to read from a secret, overriding detection; repeatable",
+		},
+		envFlag("Environment variable to set on the container (KEY=VALUE); repeatable"),
+		portFlag(),
+		templatesFlag(),
+		forceFlag(),
+		diffFlag(),
+		jsonFilesFlag(),
+	}
+}
+
+// serverlessOptions reads the flags of serverlessFlags.
+func serverlessOptions(c *cli.Context, path string) (container.ServerlessOptions, error) {
+	templates, err := containerTemplates(c, path)
+	if err != nil {
+		return container.ServerlessOptions{}, err
+	}
+	env, err := container.ParseEnv(c.StringSlice("env"))
+	if err != nil {
+		return container.ServerlessOptions{}, err
+	}
+	labels, err := container.ParseLabels(c.StringSlice("label"))
+	if err != nil {
+		return container.ServerlessOptions{}, err
+	}
+	kind, command, err := container.ParseProbe(c.String("probe"))
+	if err != nil {
+		return container.ServerlessOptions{}, err
+	}
+	return container.ServerlessOptions{
+		Image: c.String("image"),
+		Env:   env,
+		Ports: c.IntSlice("port"),
+		Probes: container.ProbeOptions{
+			Disabled:   c.Bool("no-probes"),
+			Kind:       kind,
+			HealthPath: c.String("health-path"),
+			ReadyPath:  c.String("ready-path"),
+			Command:    command,
+		},
+		ConfigKeys: c.StringSlice("config"),
+		SecretKeys: c.StringSlice("secret"),
+		CPU:        c.String("cpu"),
+		Memory:     c.String("memory"),
+		Labels:     labels,
+		Templates:  templates,
+		Options:    writeOptions(c),
+	}, nil
+}
+
+// nonrootFlag returns the flag for running as an unprivileged user.
+func nonrootFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "nonroot",
+		Value: true,
+		Usage: "Run as an unprivileged user; use --nonroot=false for images that need root",
+	}
+}
+
+// templatesFlag returns the flag naming the directory of template overrides.
+func templatesFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "templates",
+		EnvVars: []string{"GOFORGE_TEMPLATES"},
+		Usage:   "Directory of template overrides (dockerfile.tmpl, deployment.yaml.tmpl, ...; see 'container templates export') (default: container.templates in .goforge.yaml)",
+	}
+}
+
+// containerTemplates returns the template overrides of the --templates flag,
+// or else of the .goforge.yaml of the project at path.
+func containerTemplates(c *cli.Context, path string) (container.Templates, error) {
+	if dir := c.String("templates"); dir != "" {
+		return container.Templates{Dir: dir}, nil
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return container.Templates{}, err
+	}
+	return container.Templates{Dir: cfg.Path(cfg.Container.Templates)}, nil
+}
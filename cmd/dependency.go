@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"os"
+
 	"goforge/pkg/dependency"
 
 	"github.com/urfave/cli/v2"
@@ -16,36 +18,113 @@ func DependencyCommand() *cli.Command {
 			{
 				Name:  "check",
 				Usage: "Check for outdated dependencies",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "recursive",
+						Aliases: []string{"r"},
+						Usage:   "Check every module (go.mod) under the directory",
+					},
+					&cli.BoolFlag{
+						Name:  "direct-only",
+						Usage: "Only report dependencies required directly, without // indirect, in go.mod",
+					},
+					&cli.StringFlag{
+						Name:  "sort",
+						Value: dependency.SortName,
+						Usage: "Order of the dependencies: name, or age (oldest current version first)",
+					},
+					retriesFlag(),
+					refFlag(),
+				},
 				Action: func(c *cli.Context) error {
-					path := c.Args().First()
-					if path == "" {
-						path = "."
+					path, cleanup, err := projectPath(c)
+					if err != nil {
+						return err
+					}
+					defer cleanup()
+					opts := dependency.OutdatedOptions{
+						Retries:    c.Int("retries"),
+						DirectOnly: c.Bool("direct-only"),
+						Sort:       c.String("sort"),
 					}
-					return dependency.CheckOutdated(path)
+					if c.Bool("recursive") {
+						return dependency.CheckOutdatedRecursive(path, opts)
+					}
+					return dependency.CheckOutdated(path, opts)
+				},
+			},
+			{
+				Name:  "tree",
+				Usage: "Show the module dependency tree from go mod graph",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:    "depth",
+						Aliases: []string{"d"},
+						Usage:   "Show this many levels below the main module (0 for all)",
+					},
+					refFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					path, cleanup, err := projectPath(c)
+					if err != nil {
+						return err
+					}
+					defer cleanup()
+					tree, err := dependency.BuildTree(path, c.Int("depth"))
+					if err != nil {
+						return err
+					}
+					dependency.PrintTree(os.Stdout, tree)
+					return nil
 				},
 			},
 			{
 				Name:  "update",
 				Usage: "Update dependencies to latest versions",
+				Flags: []cli.Flag{retriesFlag()},
 				Action: func(c *cli.Context) error {
 					path := c.Args().First()
 					if path == "" {
 						path = "."
 					}
-					return dependency.Update(path)
+					return dependency.Update(path, c.Int("retries"))
 				},
 			},
 			{
 				Name:  "security",
-				Usage: "Check dependencies for security vulnerabilities",
+				Usage: "Check dependencies for security vulnerabilities using govulncheck",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Write a vulnerability report to this file",
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   "json",
+						Usage:   "Report format (json, sarif)",
+					},
+					refFlag(),
+				},
 				Action: func(c *cli.Context) error {
-					path := c.Args().First()
-					if path == "" {
-						path = "."
+					path, cleanup, err := projectPath(c)
+					if err != nil {
+						return err
 					}
-					return dependency.CheckSecurity(path)
+					defer cleanup()
+					return dependency.CheckSecurity(path, c.String("output"), c.String("format"))
 				},
 			},
 		},
 	}
 }
+
+// retriesFlag returns the flag bounding retries of transient module proxy failures.
+func retriesFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:  "retries",
+		Value: dependency.DefaultRetries,
+		Usage: "Retry network failures against the module proxy this many times",
+	}
+}
@@ -0,0 +1,4 @@
+// Package cmd defines the goforge commands and their flags. Each command
+// parses its arguments and calls the package that does the work, such as
+// analyzer or container.
+package cmd
@@ -21,22 +21,33 @@ func DocsCommand() *cli.Command {
 						Name:    "output",
 						Aliases: []string{"o"},
 						Value:   "api-docs",
-						Usage:   "Output directory for API documentation",
+						Usage:   "Output directory for API documentation; with several paths, one subdirectory each; " + outputPlaceholders,
 					},
 					&cli.StringFlag{
 						Name:    "format",
 						Aliases: []string{"f"},
 						Value:   "html",
+						EnvVars: []string{"GOFORGE_DOCS_FORMAT"},
 						Usage:   "Output format (html, markdown)",
 					},
+					forceFlag(),
+					diffFlag(),
+					jsonFilesFlag(),
+					fromFileFlag(),
 				},
-				Action: func(c *cli.Context) error {
-					path := c.Args().First()
-					if path == "" {
-						path = "."
+				Action: jsonFiles(func(c *cli.Context) error {
+					paths, err := pathArgs(c, ".")
+					if err != nil {
+						return err
 					}
-					return docs.GenerateAPIDoc(path, c.String("output"), c.String("format"))
-				},
+					outputs, err := outputDirs(expandOutputPath(c.String("output")), paths)
+					if err != nil {
+						return err
+					}
+					return forEachPath(paths, true, func(path string) error {
+						return docs.GenerateAPIDoc(path, outputs[path], c.String("format"), writeOptions(c))
+					})
+				}),
 			},
 			{
 				Name:  "user",
@@ -46,22 +57,78 @@ func DocsCommand() *cli.Command {
 						Name:    "output",
 						Aliases: []string{"o"},
 						Value:   "user-docs",
-						Usage:   "Output directory for user documentation",
+						Usage:   "Output directory for user documentation; with several paths, one subdirectory each; " + outputPlaceholders,
 					},
 					&cli.StringFlag{
 						Name:    "format",
 						Aliases: []string{"f"},
 						Value:   "html",
+						EnvVars: []string{"GOFORGE_DOCS_FORMAT"},
 						Usage:   "Output format (html, markdown)",
 					},
+					forceFlag(),
+					diffFlag(),
+					jsonFilesFlag(),
+					fromFileFlag(),
 				},
-				Action: func(c *cli.Context) error {
+				Action: jsonFiles(func(c *cli.Context) error {
+					paths, err := pathArgs(c, ".")
+					if err != nil {
+						return err
+					}
+					outputs, err := outputDirs(expandOutputPath(c.String("output")), paths)
+					if err != nil {
+						return err
+					}
+					return forEachPath(paths, true, func(path string) error {
+						return docs.GenerateUserDoc(path, outputs[path], c.String("format"), writeOptions(c))
+					})
+				}),
+			},
+			{
+				Name:      "cli",
+				Usage:     "Generate a Markdown command reference for a urfave/cli app",
+				ArgsUsage: "[binary or main package directory]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Value:   "CLI.md",
+						Usage:   "Output file for the command reference; " + outputPlaceholders,
+					},
+					forceFlag(),
+					diffFlag(),
+					jsonFilesFlag(),
+				},
+				Action: jsonFiles(func(c *cli.Context) error {
+					app := c.Args().First()
+					if app == "" {
+						app = "."
+					}
+					return docs.GenerateCLIDoc(app, expandOutputPath(c.String("output")), writeOptions(c))
+				}),
+			},
+			{
+				Name:      "readme",
+				Usage:     "Generate a starter README for a Go module",
+				ArgsUsage: "[module directory]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Output file for the README (default: README.md in the module root); " + outputPlaceholders,
+					},
+					forceFlag(),
+					diffFlag(),
+					jsonFilesFlag(),
+				},
+				Action: jsonFiles(func(c *cli.Context) error {
 					path := c.Args().First()
 					if path == "" {
 						path = "."
 					}
-					return docs.GenerateUserDoc(path, c.String("output"), c.String("format"))
-				},
+					return docs.GenerateReadme(path, expandOutputPath(c.String("output")), writeOptions(c))
+				}),
 			},
 		},
 	}
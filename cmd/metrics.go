@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsPath is the route serving Prometheus metrics.
+const metricsPath = "/metrics"
+
+// knownMethods are the HTTP methods counted under their own name.
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// apiMetrics records the throughput and latency of the API endpoints.
+type apiMetrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+// newAPIMetrics returns metrics registered alongside the standard Go runtime
+// and process collectors.
+func newAPIMetrics() *apiMetrics {
+	m := &apiMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "goforge_api_requests_total",
+			Help: "API requests by route, method, and outcome (success or error).",
+		}, []string{"route", "method", "outcome"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "goforge_api_request_duration_seconds",
+			Help: "API request durations by route and outcome.",
+			// Analyses take from milliseconds to minutes
+			Buckets: prometheus.ExponentialBuckets(0.005, 4, 10),
+		}, []string{"route", "outcome"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "goforge_api_analyses_in_flight",
+			Help: "Analyses currently running.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.duration,
+		m.inFlight,
+	)
+	return m
+}
+
+// handler serves the metrics in the Prometheus exposition format.
+func (m *apiMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// instrument wraps the handler of route so its requests are counted and
+// timed by outcome. Analyses are also tracked while they run. Nil metrics
+// leave the handler unchanged.
+func (m *apiMetrics) instrument(route string, analysis bool, next http.HandlerFunc) http.HandlerFunc {
+	if m == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if analysis {
+			m.inFlight.Inc()
+			defer m.inFlight.Dec()
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		outcome := "success"
+		if recorder.status >= http.StatusBadRequest {
+			outcome = "error"
+		}
+		m.requests.WithLabelValues(route, methodLabel(r.Method), outcome).Inc()
+		m.duration.WithLabelValues(route, outcome).Observe(time.Since(start).Seconds())
+	}
+}
+
+// methodLabel returns the method label of a request. Clients can send any
+// token as the method, so other methods share one label instead of each
+// adding a series.
+func methodLabel(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+	return "other"
+}
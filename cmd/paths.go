@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// fromFileFlag returns the flag that reads more paths from a file.
+func fromFileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "from-file",
+		Usage: "Also process the paths listed in this file, one per line ('-' reads stdin)",
+	}
+}
+
+// pathArgs returns the paths a command works on: its arguments followed by
+// the paths listed in --from-file, or fallback when there are none and
+// fallback is not empty.
+func pathArgs(c *cli.Context, fallback string) ([]string, error) {
+	paths := c.Args().Slice()
+	if name := c.String("from-file"); name != "" {
+		listed, err := readPathList(name)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, listed...)
+	}
+	if len(paths) == 0 && fallback != "" {
+		paths = []string{fallback}
+	}
+	return paths, nil
+}
+
+// readPathList reads one path per line from the file name, or stdin when
+// name is "-". Blank lines and lines starting with # are skipped, so the
+// output of find or git ls-files can be passed as is.
+func readPathList(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open path list: %w", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			paths = append(paths, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read path list: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, cli.Exit(fmt.Sprintf("No paths listed in %s", name), 1)
+	}
+	return paths, nil
+}
+
+// forEachPath runs fn on every path. With several paths, the output of each
+// one is preceded by a "==> path <==" header unless header is false, and a
+// failure does not stop the remaining paths: their errors are joined, each
+// prefixed with its path.
+func forEachPath(paths []string, header bool, fn func(path string) error) error {
+	if len(paths) == 1 {
+		return fn(paths[0])
+	}
+
+	var errs []error
+	for i, path := range paths {
+		if header {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("==> %s <==\n", path)
+		}
+		if err := fn(path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// forEachProject is forEachPath over the command's paths, "." by default,
+// with repository URLs cloned like projectPath does.
+func forEachProject(c *cli.Context, header bool, fn func(path string) error) error {
+	paths, err := pathArgs(c, ".")
+	if err != nil {
+		return err
+	}
+	return forEachPath(paths, header, func(path string) error {
+		dir, cleanup, err := resolveProject(c, path)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		return fn(dir)
+	})
+}
+
+// outputDirs returns the output directory of each path: output itself for a
+// single path, else a subdirectory of output named after the path's base
+// name, which must then be unique.
+func outputDirs(output string, paths []string) (map[string]string, error) {
+	dirs := make(map[string]string)
+	if len(paths) == 1 {
+		dirs[paths[0]] = output
+		return dirs, nil
+	}
+
+	owners := make(map[string]string)
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		name := filepath.Base(absPath)
+		if other, ok := owners[name]; ok {
+			return nil, cli.Exit(fmt.Sprintf("%s and %s would both be written to %s; process them separately", other, path, filepath.Join(output, name)), 1)
+		}
+		owners[name] = path
+		dirs[path] = filepath.Join(output, name)
+	}
+	return dirs, nil
+}
+
+// outputPlaceholders describes the placeholders of expandOutputPath for
+// flag usages.
+const outputPlaceholders = "{timestamp} (to the second) and {date} expand to the time of the run"
+
+// expandOutputPath expands the {timestamp} (20060102-150405) and {date}
+// (2006-01-02) placeholders of an --output path with the current local
+// time, so that repeated runs keep their outputs instead of overwriting
+// them. Runs within the same second get the same path.
+func expandOutputPath(pattern string) string {
+	now := time.Now()
+	return strings.NewReplacer(
+		"{timestamp}", now.Format("20060102-150405"),
+		"{date}", now.Format("2006-01-02"),
+	).Replace(pattern)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"goforge/pkg/analyzer"
+
+	"github.com/urfave/cli/v2"
+)
+
+// PRCheckCommand returns the CLI command that checks the changes of a branch.
+func PRCheckCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "pr-check",
+		Usage:     "Check only the Go code changed since a base ref: diff coverage, new TODOs, complexity, and docs",
+		ArgsUsage: "[path]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "base",
+				Required: true,
+				Usage:    "Git ref the branch is compared with (e.g. main or origin/main)",
+			},
+			&cli.Float64Flag{
+				Name:    "threshold",
+				Aliases: []string{"t"},
+				Value:   80.0,
+				EnvVars: []string{"GOFORGE_COVERAGE_THRESHOLD"},
+				Usage:   "Lowest passing coverage percentage of the changed lines",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-tests",
+				Usage: "Skip the diff coverage check, which runs the tests",
+			},
+			&cli.IntFlag{
+				Name:  "max-todos",
+				Value: 5,
+				Usage: "Most new TODO, FIXME, XXX, or HACK comments that pass",
+			},
+			&cli.IntFlag{
+				Name:  "max-complexity",
+				Value: 10,
+				Usage: "Highest passing cyclomatic complexity of a changed function",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			path := c.Args().First()
+			if path == "" {
+				path = "."
+			}
+			return analyzer.PRCheck(path, analyzer.PRCheckOptions{
+				Base:          c.String("base"),
+				Threshold:     c.Float64("threshold"),
+				SkipTests:     c.Bool("skip-tests"),
+				MaxTODOs:      c.Int("max-todos"),
+				MaxComplexity: c.Int("max-complexity"),
+			})
+		},
+	}
+}
@@ -1,6 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
 	"goforge/pkg/profiler"
 
 	"github.com/urfave/cli/v2"
@@ -16,58 +24,581 @@ func ProfileCommand() *cli.Command {
 			{
 				Name:  "cpu",
 				Usage: "Profile CPU usage",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:    "output",
 						Aliases: []string{"o"},
 						Value:   "cpu.pprof",
-						Usage:   "Output file for CPU profile",
+						Usage:   "Output file for CPU profile; " + outputPlaceholders,
 					},
+					outDirFlag(),
 					&cli.IntFlag{
 						Name:    "duration",
 						Aliases: []string{"d"},
 						Value:   30,
 						Usage:   "Duration in seconds to run the profile",
 					},
-				},
+					envFlag("Environment variable for the target binary (KEY=VALUE); repeatable"),
+				}, podFlags()...),
 				Action: func(c *cli.Context) error {
-					target := c.Args().First()
-					if target == "" {
-						return cli.Exit("Please specify a binary to profile", 1)
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					output, err := captureOutput(c, "cpu")
+					if err != nil {
+						return err
 					}
-					return profiler.CPUProfile(target, c.String("output"), c.Int("duration"))
+					if c.IsSet("k8s-pod") {
+						err = profiler.CPUProfilePod(ctx, podTarget(c), output, c.Int("duration"))
+					} else {
+						target := c.Args().First()
+						if target == "" {
+							return cli.Exit("Please specify a binary to profile or --k8s-pod", 1)
+						}
+						err = profiler.CPUProfile(ctx, target, output, c.Int("duration"), c.StringSlice("env"))
+					}
+					return finishCapture(c, err)
 				},
 			},
 			{
 				Name:  "memory",
 				Usage: "Profile memory usage",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:    "output",
 						Aliases: []string{"o"},
 						Value:   "mem.pprof",
-						Usage:   "Output file for memory profile",
+						Usage:   "Output file for memory profile; " + outputPlaceholders,
 					},
+					outDirFlag(),
+					envFlag("Environment variable for the target binary (KEY=VALUE); repeatable"),
+				}, podFlags()...),
+				Action: func(c *cli.Context) error {
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					output, err := captureOutput(c, "mem")
+					if err != nil {
+						return err
+					}
+					if c.IsSet("k8s-pod") {
+						err = profiler.MemoryProfilePod(ctx, podTarget(c), output)
+					} else {
+						target := c.Args().First()
+						if target == "" {
+							return cli.Exit("Please specify a binary to profile or --k8s-pod", 1)
+						}
+						err = profiler.MemoryProfile(ctx, target, output, c.StringSlice("env"))
+					}
+					return finishCapture(c, err)
+				},
+			},
+			{
+				Name:  "alloc",
+				Usage: "Profile allocations and show the allocation hot spots",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Value:   "allocs.pprof",
+						Usage:   "Output file for allocation profile; " + outputPlaceholders,
+					},
+					outDirFlag(),
+					&cli.StringFlag{
+						Name:  "sample",
+						Value: "space",
+						Usage: "Rank hot spots by allocated bytes (space) or allocation count (objects)",
+					},
+					&cli.IntFlag{
+						Name:    "count",
+						Aliases: []string{"n"},
+						Value:   20,
+						Usage:   "Number of hot spots to show",
+					},
+					envFlag("Environment variable for the target binary (KEY=VALUE); repeatable"),
+				}, podFlags()...),
+				Action: func(c *cli.Context) error {
+					if !profiler.ValidAllocSample(c.String("sample")) {
+						return cli.Exit("--sample must be space or objects", 1)
+					}
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					output, err := captureOutput(c, "alloc")
+					if err != nil {
+						return err
+					}
+					target := c.Args().First()
+					if c.IsSet("k8s-pod") {
+						err = profiler.AllocProfilePod(ctx, podTarget(c), output)
+						target = ""
+					} else {
+						if target == "" {
+							return cli.Exit("Please specify a binary to profile or --k8s-pod", 1)
+						}
+						err = profiler.AllocProfile(ctx, target, output, c.StringSlice("env"))
+					}
+					if err = finishCapture(c, err); err != nil {
+						return err
+					}
+					return profiler.AllocHotspots(ctx, output, target, c.String("sample"), c.Int("count"))
+				},
+			},
+			{
+				Name:  "all",
+				Usage: "Capture several profiles in a single run of the target",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "cpu",
+						Usage: "Output file for the CPU profile; " + outputPlaceholders,
+					},
+					&cli.StringFlag{
+						Name:  "mem",
+						Usage: "Output file for the memory profile; " + outputPlaceholders,
+					},
+					&cli.StringFlag{
+						Name:  "block",
+						Usage: "Output file for the blocking profile; " + outputPlaceholders,
+					},
+					&cli.StringFlag{
+						Name:  "mutex",
+						Usage: "Output file for the mutex contention profile; " + outputPlaceholders,
+					},
+					&cli.IntFlag{
+						Name:  "memprofilerate",
+						Usage: "Sample an allocation every this many bytes, passed to the target (1 records every allocation; default: the runtime's 512 KiB)",
+					},
+					&cli.IntFlag{
+						Name:    "duration",
+						Aliases: []string{"d"},
+						Usage:   "Seconds after which the target is interrupted to write its profiles (default: wait for it to exit)",
+					},
+					outDirFlag(),
+					typesFlag(),
+					envFlag("Environment variable for the target binary (KEY=VALUE); repeatable"),
 				},
 				Action: func(c *cli.Context) error {
 					target := c.Args().First()
 					if target == "" {
 						return cli.Exit("Please specify a binary to profile", 1)
 					}
-					return profiler.MemoryProfile(target, c.String("output"))
+					opts, err := captureOptions(c)
+					if err != nil {
+						return err
+					}
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					return finishCapture(c, profiler.CaptureMultiple(ctx, target, opts))
+				},
+			},
+			{
+				Name:      "run",
+				Usage:     "Build a main package with profiling added and run it, as go run would",
+				ArgsUsage: "[-- program arguments...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "pkg",
+						Value: ".",
+						Usage: "Main package to build and profile",
+					},
+					&cli.StringFlag{
+						Name:  "cpu",
+						Usage: "Output file for the CPU profile; " + outputPlaceholders,
+					},
+					&cli.StringFlag{
+						Name:  "mem",
+						Usage: "Output file for the memory profile; " + outputPlaceholders,
+					},
+					&cli.StringFlag{
+						Name:  "block",
+						Usage: "Output file for the blocking profile; " + outputPlaceholders,
+					},
+					&cli.StringFlag{
+						Name:  "mutex",
+						Usage: "Output file for the mutex contention profile; " + outputPlaceholders,
+					},
+					&cli.IntFlag{
+						Name:  "memprofilerate",
+						Usage: "Sample an allocation every this many bytes (1 records every allocation; default: the runtime's 512 KiB)",
+					},
+					&cli.IntFlag{
+						Name:     "duration",
+						Aliases:  []string{"d"},
+						Required: true,
+						Usage:    "Seconds to profile the program for before it writes the profiles and exits",
+					},
+					outDirFlag(),
+					typesFlag(),
+					envFlag("Environment variable for the program (KEY=VALUE); repeatable"),
+				},
+				Action: func(c *cli.Context) error {
+					opts, err := captureOptions(c)
+					if err != nil {
+						return err
+					}
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					return finishCapture(c, profiler.ProfileGoRun(ctx, c.String("pkg"), profiler.GoRunOptions{
+						CaptureOptions: opts,
+						Args:           c.Args().Slice(),
+					}))
 				},
 			},
 			{
 				Name:  "visualize",
 				Usage: "Visualize profile data",
+				Flags: []cli.Flag{
+					binaryFlag(),
+					&cli.StringFlag{
+						Name:  "type",
+						Value: "cpu",
+						Usage: "Profile type to pick when given an output directory (cpu, mem, alloc, block, mutex)",
+					},
+					&cli.IntFlag{
+						Name:    "nodecount",
+						Aliases: []string{"lines"},
+						Usage:   "Show only the top N entries (default: all)",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					profile := c.Args().First()
 					if profile == "" {
-						return cli.Exit("Please specify a profile file to visualize", 1)
+						return cli.Exit("Please specify a profile file or output directory to visualize", 1)
 					}
-					return profiler.Visualize(profile)
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					return profiler.Visualize(ctx, os.Stdout, profile, profiler.VisualizeOptions{
+						Binary:    c.String("binary"),
+						Type:      c.String("type"),
+						NodeCount: c.Int("nodecount"),
+					})
 				},
 			},
+			{
+				Name:  "top",
+				Usage: "Show the most expensive functions in a profile",
+				Flags: []cli.Flag{
+					binaryFlag(),
+					&cli.IntFlag{
+						Name:    "count",
+						Aliases: []string{"n"},
+						Value:   20,
+						Usage:   "Number of entries to show",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					profile := c.Args().First()
+					if profile == "" {
+						return cli.Exit("Please specify a profile file", 1)
+					}
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					return profiler.Top(ctx, profile, c.String("binary"), c.Int("count"))
+				},
+			},
+			{
+				Name:      "list",
+				Usage:     "Show annotated source for functions matching a regular expression",
+				ArgsUsage: "<profile> <regex>",
+				Flags:     []cli.Flag{binaryFlag()},
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 2 {
+						return cli.Exit("Please specify a profile file and a function regular expression", 1)
+					}
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					return profiler.List(ctx, c.Args().Get(0), c.String("binary"), c.Args().Get(1))
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "Compare a profile against a base profile",
+				ArgsUsage: "<base> <profile>",
+				Flags:     []cli.Flag{binaryFlag()},
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 2 {
+						return cli.Exit("Please specify a base profile and a profile to compare", 1)
+					}
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					return profiler.Diff(ctx, c.Args().Get(0), c.Args().Get(1), c.String("binary"))
+				},
+			},
+			{
+				Name:  "trace-report",
+				Usage: "Summarize goroutines, blocking, GC pauses, and proc utilization from an execution trace",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "block-threshold",
+						Value: 10 * time.Millisecond,
+						Usage: "Report goroutines blocked longer than this",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the report as JSON",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					traceFile := c.Args().First()
+					if traceFile == "" {
+						return cli.Exit("Please specify a trace file to analyze", 1)
+					}
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					return profiler.TraceReportFile(ctx, traceFile, c.Duration("block-threshold"), c.Bool("json"))
+				},
+			},
+			{
+				Name:  "alloc-report",
+				Usage: "Rank heap profile allocations by package and call path root",
+				Flags: []cli.Flag{
+					&cli.Int64Flag{
+						Name:  "min-objects",
+						Value: 1000000,
+						Usage: "Flag call paths allocating at least this many objects as pooling candidates",
+					},
+					&cli.Int64Flag{
+						Name:  "max-size",
+						Value: 256,
+						Usage: "Largest average object size in bytes for a pooling candidate",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the report as JSON",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					profileFile := c.Args().First()
+					if profileFile == "" {
+						return cli.Exit("Please specify a heap profile to analyze", 1)
+					}
+					return profiler.AllocReportFile(profileFile, c.Int64("min-objects"), c.Int64("max-size"), c.Bool("json"))
+				},
+			},
+			{
+				Name:  "bench-compare",
+				Usage: "Compare benchmark results between a git ref and the current tree",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "ref",
+						Aliases:  []string{"r"},
+						Required: true,
+						Usage:    "Git ref to compare against (branch, tag, or commit)",
+					},
+					&cli.StringFlag{
+						Name:    "bench",
+						Aliases: []string{"b"},
+						Value:   ".",
+						Usage:   "Regular expression selecting the benchmarks to run",
+					},
+					&cli.IntFlag{
+						Name:    "count",
+						Aliases: []string{"c"},
+						Value:   5,
+						Usage:   "Number of times to run each benchmark (passed to go test -count)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					pkg := c.Args().First()
+					if pkg == "" {
+						pkg = "."
+					}
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					return profiler.BenchCompare(ctx, pkg, c.String("ref"), c.String("bench"), c.Int("count"))
+				},
+			},
+			{
+				Name:  "benchreport",
+				Usage: "Run benchmarks with -benchmem and report time, bytes, and allocations per op",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "pkg",
+						Value: "./...",
+						Usage: "Packages to benchmark",
+					},
+					&cli.StringFlag{
+						Name:    "bench",
+						Aliases: []string{"b"},
+						Value:   ".",
+						Usage:   "Regular expression selecting the benchmarks to run",
+					},
+					&cli.IntFlag{
+						Name:    "count",
+						Aliases: []string{"c"},
+						Value:   5,
+						Usage:   "Number of times to run each benchmark (passed to go test -count)",
+					},
+					&cli.StringFlag{
+						Name:  "sort",
+						Value: "ns",
+						Usage: "Sort the report by ns, bytes, allocs, or name",
+					},
+					&cli.StringFlag{
+						Name:  "baseline",
+						Usage: "Saved 'go test -bench' output to compare against, with deltas and significance",
+					},
+					&cli.StringFlag{
+						Name:  "save",
+						Usage: "Save the raw benchmark output to this file for use as a later --baseline",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					ctx, cancel := profileContext(c)
+					defer cancel()
+					return profiler.BenchReport(ctx, profiler.BenchReportOptions{
+						Packages: c.String("pkg"),
+						Bench:    c.String("bench"),
+						Count:    c.Int("count"),
+						Sort:     c.String("sort"),
+						Baseline: c.String("baseline"),
+						Save:     c.String("save"),
+					})
+				},
+			},
+		},
+	}
+}
+
+// outDirFlag returns the flag for collecting captures in an output directory.
+func outDirFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "out-dir",
+		Usage: "Directory collecting timestamped captures and an index.html (instead of --output)",
+	}
+}
+
+// captureOutput returns the file a capture command writes to: a fresh
+// timestamped file with --out-dir, or the expanded --output file otherwise.
+func captureOutput(c *cli.Context, profileType string) (string, error) {
+	outDir := c.String("out-dir")
+	if outDir == "" {
+		return expandOutputPath(c.String("output")), nil
+	}
+	if c.IsSet("output") {
+		return "", cli.Exit("--output and --out-dir cannot be used together", 1)
+	}
+	return profiler.NextCapturePath(outDir, profileType)
+}
+
+// typesFlag returns the flag selecting the profiles that profile all and
+// profile run capture into --out-dir.
+func typesFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:  "types",
+		Value: cli.NewStringSlice("cpu", "mem"),
+		Usage: "Profiles to capture into --out-dir: " + strings.Join(multiTypes, ", "),
+	}
+}
+
+// multiTypes are the profiles profile all and profile run capture, named
+// like their --out-dir captures.
+var multiTypes = []string{"cpu", "mem", "block", "mutex"}
+
+// captureOptions returns the outputs of the profiles that profile all and
+// profile run capture in one run: the --cpu, --mem, --block, and --mutex
+// files, or with --out-dir a fresh timestamped file in it for each of
+// --types.
+func captureOptions(c *cli.Context) (profiler.CaptureOptions, error) {
+	opts := profiler.CaptureOptions{
+		MemProfileRate: c.Int("memprofilerate"),
+		Duration:       time.Duration(c.Int("duration")) * time.Second,
+		Env:            c.StringSlice("env"),
+	}
+	outputs := map[string]*string{"cpu": &opts.CPU, "mem": &opts.Mem, "block": &opts.Block, "mutex": &opts.Mutex}
+
+	outDir := c.String("out-dir")
+	if outDir == "" {
+		if c.IsSet("types") {
+			return opts, cli.Exit("--types only applies with --out-dir", 1)
+		}
+		for name, output := range outputs {
+			*output = expandOutputPath(c.String(name))
+		}
+		return opts, nil
+	}
+	for _, name := range multiTypes {
+		if c.IsSet(name) {
+			return opts, cli.Exit("--"+name+" and --out-dir cannot be used together; select the profiles with --types", 1)
+		}
+	}
+	for _, profileType := range c.StringSlice("types") {
+		output, ok := outputs[profileType]
+		if !ok {
+			return opts, cli.Exit(fmt.Sprintf("invalid profile type %q (expected %s)", profileType, strings.Join(multiTypes, ", ")), 1)
+		}
+		path, err := profiler.NextCapturePath(outDir, profileType)
+		if err != nil {
+			return opts, err
+		}
+		*output = path
+	}
+	return opts, nil
+}
+
+// finishCapture regenerates the --out-dir index after a successful capture.
+func finishCapture(c *cli.Context, err error) error {
+	if err != nil || c.String("out-dir") == "" {
+		return err
+	}
+	return profiler.WriteIndex(c.String("out-dir"))
+}
+
+// binaryFlag returns the flag for passing the profiled executable to pprof.
+func binaryFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "binary",
+		Usage: "Executable that produced the profile, used to symbolize addresses",
+	}
+}
+
+// podFlags returns the flags for profiling a pod's net/http/pprof endpoint
+// through a kubectl port-forward.
+func podFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "k8s-pod",
+			Usage: "Profile this Kubernetes pod instead of a local binary",
+		},
+		&cli.StringFlag{
+			Name:  "namespace",
+			Value: "default",
+			Usage: "Namespace of the pod",
 		},
+		&cli.StringFlag{
+			Name:  "container",
+			Usage: "Container that serves pprof, for pods with several containers",
+		},
+		&cli.IntFlag{
+			Name:  "port",
+			Value: 6060,
+			Usage: "Pod port serving net/http/pprof",
+		},
+	}
+}
+
+// podTarget builds the pod target from the pod flags.
+func podTarget(c *cli.Context) profiler.PodTarget {
+	return profiler.PodTarget{
+		Pod:       c.String("k8s-pod"),
+		Namespace: c.String("namespace"),
+		Container: c.String("container"),
+		Port:      c.Int("port"),
+	}
+}
+
+// profileContext returns a context that is canceled on SIGINT/SIGTERM or when
+// the global --timeout elapses. Ctrl+C stops a capture cleanly with or
+// without a timeout.
+func profileContext(c *cli.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+
+	lineage := c.Lineage()
+	timeout := lineage[len(lineage)-1].Duration("timeout")
+	if timeout <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
 	}
 }
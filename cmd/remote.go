@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+
+	"github.com/urfave/cli/v2"
+)
+
+// projectPath returns the directory a command works on: its first argument,
+// "." by default, or a temporary clone when the argument is a repository URL.
+// The cleanup function removes the clone.
+func projectPath(c *cli.Context) (string, func(), error) {
+	path := c.Args().First()
+	if path == "" {
+		path = "."
+	}
+	return resolveProject(c, path)
+}
+
+// resolveProject returns path, or a temporary clone of it at --ref when it
+// is a repository URL. The cleanup function removes the clone.
+func resolveProject(c *cli.Context, path string) (string, func(), error) {
+	if !isRepoURL(path) {
+		if c.String("ref") != "" {
+			return "", nil, cli.Exit("--ref requires a repository URL", 1)
+		}
+		return path, func() {}, nil
+	}
+	return fetchRepo(path, c.String("ref"))
+}
+
+// isRepoURL reports whether path names a remote git repository.
+func isRepoURL(path string) bool {
+	return strings.Contains(path, "://") || strings.HasPrefix(path, "git@")
+}
+
+// fetchRepo shallow-clones the repository at url into a temporary directory,
+// checking out ref (a branch, tag, or commit) or the default branch when
+// ref is empty. The cleanup function removes the directory.
+func fetchRepo(url, ref string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "goforge-repo-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	if ref == "" {
+		ref = "HEAD"
+	}
+	logging.Infof("Fetching %s at %s...\n", url, ref)
+
+	// Fetching a single ref works for commits as well as branches and tags
+	steps := [][]string{
+		{"init", "-q"},
+		{"remote", "add", "origin", url},
+		{"fetch", "-q", "--depth", "1", "origin", ref},
+		{"checkout", "-q", "FETCH_HEAD"},
+	}
+	for _, args := range steps {
+		cmd := proc.Command("git", args...)
+		cmd.Dir = dir
+		// Never stop to ask for credentials
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to fetch %s at %s: %w\nOutput: %s", url, ref, err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	return dir, cleanup, nil
+}
+
+// refFlag returns the flag selecting the ref of a remote repository.
+func refFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "ref",
+		Usage: "Branch, tag, or commit to check out when the path is a repository URL",
+	}
+}
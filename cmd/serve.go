@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+// ServeCommand returns the CLI command for serving the web interface and the
+// API together.
+func ServeCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "Start the web interface and the API server on one port",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "port",
+				Aliases: []string{"p"},
+				Value:   "8080",
+				EnvVars: []string{"GOFORGE_PORT"},
+				Usage:   "Port to serve the web interface and API on",
+			},
+			&cli.StringFlag{
+				Name:  "root",
+				Usage: "Confine request paths to this directory; a .goforgeignore file in it lists further off-limits directories",
+			},
+			&cli.BoolFlag{
+				Name:  "metrics",
+				Usage: "Serve Prometheus metrics (request counts, durations, in-flight analyses) at " + metricsPath,
+			},
+			logFormatFlag(),
+		},
+		Action: func(c *cli.Context) error {
+			guard, err := newPathGuard(c.String("root"))
+			if err != nil {
+				return err
+			}
+			log, err := newServerLog(c)
+			if err != nil {
+				return err
+			}
+			var metrics *apiMetrics
+			if c.Bool("metrics") {
+				metrics = newAPIMetrics()
+			}
+			return startCombinedServer(c.String("port"), guard, metrics, log)
+		},
+	}
+}
+
+// startCombinedServer serves the web interface and the /api/* routes from
+// one mux, so the forms reach the API on their own origin.
+func startCombinedServer(port string, guard *pathGuard, metrics *apiMetrics, log *serverLog) error {
+	log.infof("Starting web interface and API server on port %s...", port)
+
+	// Create temporary directory for static files
+	tempDir, err := os.MkdirTemp("", "goforge-web")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create static files
+	createStaticFiles(tempDir)
+
+	mux := http.NewServeMux()
+	registerWebRoutes(mux, tempDir)
+	registerAPIRoutes(mux, guard, metrics, log)
+	// Unknown API routes get a JSON error rather than the home page
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		sendError(w, "Not found", http.StatusNotFound)
+	})
+
+	// Start the server
+	addr := ":" + port
+	log.listening("GoForge", addr)
+	return http.ListenAndServe(addr, log.logRequests(mux))
+}
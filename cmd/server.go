@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"goforge/pkg/logging"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/slog"
+)
+
+// serverLog logs the lifecycle and requests of the API and web servers.
+// Text mode keeps the plain startup messages; JSON mode turns everything,
+// including the standard log package, into structured records.
+type serverLog struct {
+	*slog.Logger
+	json bool
+}
+
+// newServerLog returns the server logger for the --log-format flag.
+func newServerLog(c *cli.Context) (*serverLog, error) {
+	format := c.String("log-format")
+	// Request logs go to stderr in text mode so results on stdout stay clean
+	out := os.Stderr
+	if format == logging.FormatJSON {
+		out = os.Stdout
+	}
+
+	logger, err := logging.NewLogger(out, format)
+	if err != nil {
+		return nil, cli.Exit(err.Error(), 1)
+	}
+	slog.SetDefault(logger)
+	return &serverLog{Logger: logger, json: format == logging.FormatJSON}, nil
+}
+
+// infof prints a progress message in text mode or logs it in JSON mode.
+func (l *serverLog) infof(format string, args ...any) {
+	if l.json {
+		l.Info(fmt.Sprintf(format, args...))
+		return
+	}
+	logging.Infof(format+"\n", args...)
+}
+
+// listening announces that a server accepts connections on addr.
+func (l *serverLog) listening(name string, addr string) {
+	if l.json {
+		l.Info(name+" is running", "addr", addr)
+		return
+	}
+	fmt.Printf("%s is running at http://localhost%s\n", name, addr)
+	logging.Infoln("Press Ctrl+C to stop")
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status before writing it.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests wraps next so every request is logged with its method, path,
+// status, and duration in seconds.
+func (l *serverLog) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		l.Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration", time.Since(start).Seconds())
+	})
+}
+
+// logFormatFlag returns the flag selecting the server log format.
+func logFormatFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "log-format",
+		Value:   logging.FormatText,
+		EnvVars: []string{"GOFORGE_LOG_FORMAT"},
+		Usage:   "Log format: text, or json for structured logs (level, ts, msg, method, path, status, duration)",
+	}
+}
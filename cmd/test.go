@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"fmt"
+
+	"goforge/pkg/config"
 	"goforge/pkg/testing"
 
 	"github.com/urfave/cli/v2"
@@ -26,15 +29,82 @@ func TestCommand() *cli.Command {
 						Aliases: []string{"t"},
 						Usage:   "Generate table-driven tests",
 					},
+					&cli.BoolFlag{
+						Name:  "include-unexported",
+						Usage: "Also generate unit tests for unexported functions and methods, and the methods of unexported types",
+					},
+					&cli.StringFlag{
+						Name:  "only",
+						Usage: "Only generate tests for the functions whose names match this regexp (methods match as Type.Method)",
+					},
+					&cli.StringFlag{
+						Name:  "exclude",
+						Usage: "Skip the functions whose names match this regexp (methods match as Type.Method)",
+					},
+					&cli.BoolFlag{
+						Name:  "fuzz",
+						Usage: "Generate fuzz tests for the exported functions with fuzzable parameters",
+					},
+					&cli.BoolFlag{
+						Name:  "examples",
+						Usage: "Generate example functions for the exported functions and methods",
+					},
+					&cli.BoolFlag{
+						Name:  "run-examples",
+						Usage: "Build and run the package's code to fill in the Output comments of the examples; only use on code you trust",
+					},
+					&cli.BoolFlag{
+						Name:  "golden",
+						Usage: "Generate tests comparing the output of functions returning []byte or string, or writing to an io.Writer, with golden files in testdata (go test -update rewrites them)",
+					},
+					&cli.StringFlag{
+						Name:  "style",
+						Usage: "Unit test style: std, or testify to call the functions and check the results with require and assert (default: test.style in .goforge.yaml, else std)",
+					},
+					&cli.StringFlag{
+						Name:  "pattern",
+						Usage: "Output path pattern with {dir}, {name}, and {pkg} placeholders (default \"" + testing.DefaultPattern + "\")",
+					},
+					&cli.BoolFlag{
+						Name:    "force",
+						Aliases: []string{"f"},
+						Usage:   "Overwrite existing test files",
+					},
+					diffFlag(),
+					fromFileFlag(),
 				},
 				Action: func(c *cli.Context) error {
-					path := c.Args().First()
-					if path == "" {
+					paths, err := pathArgs(c, "")
+					if err != nil {
+						return err
+					}
+					if len(paths) == 0 {
 						return cli.Exit("Please specify a file or directory to generate tests for", 1)
 					}
-					output := c.String("output")
-					table := c.Bool("table")
-					return testing.GenerateTests(path, output, table)
+					return forEachPath(paths, true, func(path string) error {
+						style := c.String("style")
+						if style == "" {
+							cfg, err := config.Load(path)
+							if err != nil {
+								return err
+							}
+							style = cfg.Test.Style
+						}
+						return testing.GenerateTests(path, testing.GenerateOptions{
+							OutputDir:         c.String("output"),
+							Pattern:           c.String("pattern"),
+							Options:           writeOptions(c),
+							Table:             c.Bool("table"),
+							IncludeUnexported: c.Bool("include-unexported"),
+							Only:              c.String("only"),
+							Exclude:           c.String("exclude"),
+							Style:             style,
+							Golden:            c.Bool("golden"),
+							Fuzz:              c.Bool("fuzz"),
+							Examples:          c.Bool("examples"),
+							RunExamples:       c.Bool("run-examples"),
+						})
+					})
 				},
 			},
 			{
@@ -45,13 +115,188 @@ func TestCommand() *cli.Command {
 						Name:    "threshold",
 						Aliases: []string{"t"},
 						Value:   80.0,
+						EnvVars: []string{"GOFORGE_COVERAGE_THRESHOLD"},
 						Usage:   "Coverage threshold percentage",
 					},
 					&cli.StringFlag{
 						Name:    "output",
 						Aliases: []string{"o"},
 						Value:   "coverage.html",
-						Usage:   "Output file for coverage report",
+						Usage:   "Output file for coverage report; " + outputPlaceholders,
+					},
+					&cli.StringFlag{
+						Name:  "diff",
+						Usage: "Apply the threshold to the lines changed since this git ref (e.g. main)",
+					},
+					&cli.BoolFlag{
+						Name:  "race",
+						Usage: "Run the tests with the race detector",
+					},
+					&cli.StringFlag{
+						Name:  "covermode",
+						Usage: "Coverage profile mode: set, count, or atomic (default: atomic with --race, else set)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "exclude-pattern",
+						Usage: "Files or packages to leave out of the coverage (e.g. '*.pb.go', './cmd/...'); repeatable",
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   testing.FormatText,
+						Usage:   "Report format (text, json)",
+					},
+					&cli.IntFlag{
+						Name:  "least-covered",
+						Value: testing.DefaultLeastCovered,
+						Usage: "Number of least-covered functions to list",
+					},
+					&cli.BoolFlag{
+						Name:  "soft",
+						Usage: "Warn instead of exiting with code 2 when a threshold is missed",
+					},
+					&cli.BoolFlag{
+						Name:  "terminal",
+						Usage: "Print the least-covered files with their covered lines in green and uncovered lines in red",
+					},
+					&cli.IntFlag{
+						Name:  "terminal-files",
+						Value: testing.DefaultTerminalFiles,
+						Usage: "Number of least-covered files --terminal prints",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					path := c.Args().First()
+					if path == "" {
+						path = "."
+					}
+					cfg, err := config.Load(path)
+					if err != nil {
+						return err
+					}
+					terminal := 0
+					if c.Bool("terminal") {
+						terminal = c.Int("terminal-files")
+						if terminal < 1 {
+							return fmt.Errorf("invalid number of files %d (expected at least 1)", terminal)
+						}
+					}
+					return testing.AnalyzeCoverage(path, testing.CoverageOptions{
+						Threshold:         c.Float64("threshold"),
+						Output:            expandOutputPath(c.String("output")),
+						DiffBase:          c.String("diff"),
+						Race:              c.Bool("race"),
+						CoverMode:         c.String("covermode"),
+						Exclude:           c.StringSlice("exclude-pattern"),
+						Format:            c.String("format"),
+						LeastCovered:      c.Int("least-covered"),
+						PackageThresholds: cfg.Coverage.Packages,
+						Soft:              c.Bool("soft"),
+						Terminal:          terminal,
+					})
+				},
+			},
+			{
+				Name:  "run",
+				Usage: "Run the tests with a per-package summary, optionally after go vet and with the race detector",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "race",
+						Usage: "Run the tests with the race detector",
+					},
+					&cli.BoolFlag{
+						Name:  "vet",
+						Usage: "Run go vet first and include its findings",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "Time limit of each package's tests, passed to go test -timeout (default: go test's 10m)",
+					},
+					&cli.BoolFlag{
+						Name:    "verbose",
+						Aliases: []string{"v"},
+						Usage:   "Print the output of every test, not only of failing ones",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					path := c.Args().First()
+					if path == "" {
+						path = "."
+					}
+					return testing.RunTests(path, testing.RunOptions{
+						Race:    c.Bool("race"),
+						Vet:     c.Bool("vet"),
+						Timeout: c.Duration("timeout"),
+						Verbose: c.Bool("verbose"),
+					})
+				},
+			},
+			{
+				Name:  "parallelize",
+				Usage: "Insert t.Parallel() into tests and subtests that do not change process-wide state",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "check",
+						Usage: "Report the tests that could run in parallel without changing any file",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					path := c.Args().First()
+					if path == "" {
+						path = "."
+					}
+					return testing.Parallelize(path, testing.ParallelizeOptions{Check: c.Bool("check")})
+				},
+			},
+			{
+				Name:  "changed",
+				Usage: "Run the tests of the packages affected by the changes since a git ref",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "since",
+						Required: true,
+						Usage:    "Git ref the changes are compared with (e.g. main or origin/main)",
+					},
+					&cli.BoolFlag{
+						Name:  "race",
+						Usage: "Run the tests with the race detector",
+					},
+					&cli.BoolFlag{
+						Name:  "vet",
+						Usage: "Run go vet on the selected packages first and include its findings",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "Time limit of each package's tests, passed to go test -timeout (default: go test's 10m)",
+					},
+					&cli.BoolFlag{
+						Name:    "verbose",
+						Aliases: []string{"v"},
+						Usage:   "Print the output of every test, not only of failing ones",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					path := c.Args().First()
+					if path == "" {
+						path = "."
+					}
+					return testing.RunChangedTests(path, c.String("since"), testing.RunOptions{
+						Race:    c.Bool("race"),
+						Vet:     c.Bool("vet"),
+						Timeout: c.Duration("timeout"),
+						Verbose: c.Bool("verbose"),
+					})
+				},
+			},
+			{
+				Name:  "flaky",
+				Usage: "Run the tests several times and report those that do not pass consistently",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:    "count",
+						Aliases: []string{"n"},
+						Value:   testing.DefaultFlakyRuns,
+						Usage:   "Number of times to run each test",
 					},
 				},
 				Action: func(c *cli.Context) error {
@@ -59,7 +304,7 @@ func TestCommand() *cli.Command {
 					if path == "" {
 						path = "."
 					}
-					return testing.AnalyzeCoverage(path, c.Float64("threshold"), c.String("output"))
+					return testing.AnalyzeFlaky(path, c.Int("count"))
 				},
 			},
 		},
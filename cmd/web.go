@@ -21,19 +21,25 @@ func WebCommand() *cli.Command {
 				Name:    "port",
 				Aliases: []string{"p"},
 				Value:   "8081",
+				EnvVars: []string{"GOFORGE_PORT"},
 				Usage:   "Port to run the web interface on",
 			},
+			logFormatFlag(),
 		},
 		Action: func(c *cli.Context) error {
 			port := c.String("port")
-			return startWebServer(port)
+			log, err := newServerLog(c)
+			if err != nil {
+				return err
+			}
+			return startWebServer(port, log)
 		},
 	}
 }
 
 // startWebServer starts the web interface on the specified port.
-func startWebServer(port string) error {
-	fmt.Printf("Starting web interface on port %s...\n", port)
+func startWebServer(port string, log *serverLog) error {
+	log.infof("Starting web interface on port %s...", port)
 
 	// Create temporary directory for static files
 	tempDir, err := os.MkdirTemp("", "goforge-web")
@@ -45,43 +51,37 @@ func startWebServer(port string) error {
 	// Create static files
 	createStaticFiles(tempDir)
 
-	// Define routes
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		renderTemplate(w, filepath.Join(tempDir, "templates/index.html"), nil)
-	})
+	mux := http.NewServeMux()
+	registerWebRoutes(mux, tempDir)
+	log.infof("The forms need the API on this origin; use 'goforge serve' to run both on one port")
 
-	http.HandleFunc("/analyze", func(w http.ResponseWriter, r *http.Request) {
-		renderTemplate(w, filepath.Join(tempDir, "templates/analyze.html"), nil)
-	})
-
-	http.HandleFunc("/dependency", func(w http.ResponseWriter, r *http.Request) {
-		renderTemplate(w, filepath.Join(tempDir, "templates/dependency.html"), nil)
-	})
-
-	http.HandleFunc("/profile", func(w http.ResponseWriter, r *http.Request) {
-		renderTemplate(w, filepath.Join(tempDir, "templates/profile.html"), nil)
-	})
-
-	http.HandleFunc("/container", func(w http.ResponseWriter, r *http.Request) {
-		renderTemplate(w, filepath.Join(tempDir, "templates/container.html"), nil)
-	})
-
-	http.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
-		renderTemplate(w, filepath.Join(tempDir, "templates/test.html"), nil)
-	})
+	// Start the server
+	addr := ":" + port
+	log.listening("Web interface", addr)
+	return http.ListenAndServe(addr, log.logRequests(mux))
+}
 
-	http.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
-		renderTemplate(w, filepath.Join(tempDir, "templates/docs.html"), nil)
-	})
+// registerWebRoutes mounts the pages and static files created in dir by
+// createStaticFiles on mux.
+func registerWebRoutes(mux *http.ServeMux, dir string) {
+	pages := map[string]string{
+		"/":           "index.html",
+		"/analyze":    "analyze.html",
+		"/dependency": "dependency.html",
+		"/profile":    "profile.html",
+		"/container":  "container.html",
+		"/test":       "test.html",
+		"/docs":       "docs.html",
+	}
+	for route, page := range pages {
+		templatePath := filepath.Join(dir, "templates", page)
+		mux.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+			renderTemplate(w, templatePath, nil)
+		})
+	}
 
 	// Serve static files
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(filepath.Join(tempDir, "static")))))
-
-	// Start the server
-	addr := ":" + port
-	fmt.Printf("Web interface is running at http://localhost%s\n", addr)
-	fmt.Println("Press Ctrl+C to stop")
-	return http.ListenAndServe(addr, nil)
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(filepath.Join(dir, "static")))))
 }
 
 // renderTemplate renders the specified template.
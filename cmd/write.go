@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"goforge/pkg/safewrite"
+
+	"github.com/urfave/cli/v2"
+)
+
+// forceFlag returns the flag allowing generators to overwrite existing files.
+func forceFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "force",
+		Usage: "Overwrite existing files",
+	}
+}
+
+// diffFlag returns the flag that shows what a generator would change
+// without writing anything.
+func diffFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "diff",
+		Usage: "Print a unified diff against the existing files instead of writing them",
+	}
+}
+
+// jsonFilesFlag returns the flag that prints the generated files as JSON
+// instead of writing them; the command's action must be wrapped with
+// jsonFiles.
+func jsonFilesFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "json",
+		Usage: `Print the generated files as JSON ({"files": {"<path>": "<content>"}}) instead of writing them`,
+	}
+}
+
+// collectorKey is the context key of the Collector of a --json run.
+type collectorKey struct{}
+
+// writeOptions returns how generated files treat existing ones.
+func writeOptions(c *cli.Context) safewrite.Options {
+	collector, _ := c.Context.Value(collectorKey{}).(*safewrite.Collector)
+	return safewrite.Options{
+		Force:   c.Bool("force"),
+		Diff:    c.Bool("diff"),
+		Collect: collector,
+	}
+}
+
+// jsonFiles wraps the action of a generator so that with --json it collects
+// the files the action generates and prints them as JSON. Everything else
+// the action prints goes to stderr, leaving only the JSON on stdout.
+func jsonFiles(action cli.ActionFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		if !c.Bool("json") {
+			return action(c)
+		}
+		if c.Bool("diff") {
+			return fmt.Errorf("--json cannot be combined with --diff")
+		}
+
+		collector := &safewrite.Collector{}
+		c.Context = context.WithValue(c.Context, collectorKey{}, collector)
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		err := action(c)
+		os.Stdout = stdout
+		if err != nil {
+			return err
+		}
+		return collector.WriteJSON(os.Stdout)
+	}
+}
@@ -1,10 +1,21 @@
+// GoForge is a development companion for Go projects: it analyzes code
+// quality, checks dependencies, profiles programs, generates tests,
+// documentation, and container files, and serves the same tools over an
+// API and a web interface. Run goforge help for the commands.
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 
 	"goforge/cmd"
+	"goforge/pkg/docs"
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+	"goforge/pkg/safewrite"
+	"goforge/pkg/workerpool"
 
 	"github.com/urfave/cli/v2"
 )
@@ -19,14 +30,72 @@ func main() {
 			cmd.ProfileCommand(),
 			cmd.ContainerCommand(),
 			cmd.TestCommand(),
+			cmd.PRCheckCommand(),
 			cmd.DocsCommand(),
 			cmd.APICommand(),
 			cmd.WebCommand(),
+			cmd.ServeCommand(),
+		},
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				EnvVars: []string{"GOFORGE_QUIET"},
+				Usage:   "Print only errors and final results",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the files generators would write, or their diffs against existing files, without writing anything",
+			},
+			&cli.DurationFlag{
+				Name:    "timeout",
+				EnvVars: []string{"GOFORGE_TIMEOUT"},
+				Usage:   "Kill the external commands a run starts (go, git, docker, ...) once it has taken this long (e.g. 10m); 0 means no timeout",
+			},
+			&cli.IntFlag{
+				Name:    "jobs",
+				Aliases: []string{"j"},
+				EnvVars: []string{"GOFORGE_JOBS"},
+				Usage:   "Run at most this many tasks at once, such as modules checked or files analyzed; 1 runs them in order (default: GOMAXPROCS)",
+			},
+			&cli.BoolFlag{
+				Name:   docs.HelpMarkdownFlag,
+				Hidden: true,
+				Usage:  "Print the command reference as Markdown",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			logging.SetQuiet(c.Bool("quiet"))
+			safewrite.SetDryRun(c.Bool("dry-run"))
+			if c.Int("jobs") < 0 {
+				return fmt.Errorf("--jobs cannot be negative")
+			}
+			workerpool.SetJobs(c.Int("jobs"))
+			c.Context = proc.SetTimeout(c.Duration("timeout"))
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			if !c.Bool(docs.HelpMarkdownFlag) {
+				return cli.ShowAppHelp(c)
+			}
+			markdown, err := c.App.ToMarkdown()
+			if err != nil {
+				return err
+			}
+			fmt.Print(markdown)
+			return nil
 		},
 	}
 
+	// Exit codes: 0 success, 1 runtime error, 2 policy failure
 	err := app.Run(os.Args)
+	if killed := proc.Err(); killed != nil {
+		// Whatever the run made of its killed command, its results are
+		// incomplete
+		err = killed
+	}
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		os.Exit(exitcode.Code(err))
 	}
 }
@@ -0,0 +1,342 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+	"goforge/pkg/safewrite"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/tools/go/packages"
+)
+
+// Kinds of the symbols in an API surface.
+const (
+	SymbolConst  = "const"
+	SymbolVar    = "var"
+	SymbolFunc   = "func"
+	SymbolType   = "type"
+	SymbolMethod = "method"
+	SymbolField  = "field"
+)
+
+// Surface is the exported API of a module: the exported symbols of every
+// package other than commands and internal packages, by import path.
+type Surface struct {
+	Packages map[string][]Symbol `json:"packages"`
+}
+
+// Symbol is one exported declaration. Methods and fields are named
+// Type.Name. Struct types are recorded without their fields, which are
+// symbols of their own, so adding a field is not a change of the type.
+type Symbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Signature string `json:"signature"`
+}
+
+// APIChange is a symbol added, removed, or changed between two surfaces.
+type APIChange struct {
+	Package string `json:"package"`
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	// Old is empty for an added symbol, New for a removed one.
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// APIDiff is the difference between two surfaces. Removals and changes
+// break the API's users; additions do not.
+type APIDiff struct {
+	Added   []APIChange `json:"added"`
+	Removed []APIChange `json:"removed"`
+	Changed []APIChange `json:"changed"`
+}
+
+// Breaking reports whether the diff removes or changes any symbol.
+func (d APIDiff) Breaking() bool {
+	return len(d.Removed) > 0 || len(d.Changed) > 0
+}
+
+// APISurface loads the packages under path and returns their exported API.
+func APISurface(path string) (Surface, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Surface{}, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	pkgs, err := newLoader(absPath).load()
+	if err != nil {
+		return Surface{}, err
+	}
+
+	surface := Surface{Packages: make(map[string][]Symbol)}
+	for _, pkg := range pkgs {
+		if pkg.Name == "main" || isInternal(pkg.PkgPath) {
+			continue
+		}
+		if symbols := packageSymbols(pkg); len(symbols) > 0 {
+			surface.Packages[pkg.PkgPath] = symbols
+		}
+	}
+	return surface, nil
+}
+
+// isInternal reports whether an import path is an internal package, which
+// other modules cannot import.
+func isInternal(pkgPath string) bool {
+	return slices.Contains(strings.Split(pkgPath, "/"), "internal")
+}
+
+// packageSymbols returns the exported symbols of pkg, sorted by name.
+func packageSymbols(pkg *packages.Package) []Symbol {
+	qualifier := types.RelativeTo(pkg.Types)
+	typeString := func(t types.Type) string { return types.TypeString(t, qualifier) }
+
+	var symbols []Symbol
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+
+		switch obj := obj.(type) {
+		case *types.Const:
+			symbols = append(symbols, Symbol{name, SymbolConst, "const " + name + " " + typeString(obj.Type())})
+		case *types.Var:
+			symbols = append(symbols, Symbol{name, SymbolVar, "var " + name + " " + typeString(obj.Type())})
+		case *types.Func:
+			symbols = append(symbols, Symbol{name, SymbolFunc, "func " + name + strings.TrimPrefix(typeString(obj.Type()), "func")})
+		case *types.TypeName:
+			symbols = append(symbols, typeSymbols(obj, typeString)...)
+		}
+	}
+
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Name < symbols[j].Name })
+	return symbols
+}
+
+// typeSymbols returns the symbols of an exported type: the type, and its
+// exported methods and struct fields.
+func typeSymbols(obj *types.TypeName, typeString func(types.Type) string) []Symbol {
+	name := obj.Name()
+	if obj.IsAlias() {
+		return []Symbol{{name, SymbolType, "type " + name + " = " + typeString(obj.Type())}}
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return nil
+	}
+
+	declared := "type " + name
+	if params := named.TypeParams(); params.Len() > 0 {
+		var list []string
+		for i := 0; i < params.Len(); i++ {
+			param := params.At(i)
+			list = append(list, param.Obj().Name()+" "+typeString(param.Constraint()))
+		}
+		declared += "[" + strings.Join(list, ", ") + "]"
+	}
+
+	var symbols []Symbol
+	if strct, ok := named.Underlying().(*types.Struct); ok {
+		symbols = append(symbols, Symbol{name, SymbolType, declared + " struct"})
+		for i := 0; i < strct.NumFields(); i++ {
+			field := strct.Field(i)
+			if !field.Exported() {
+				continue
+			}
+			fieldType := typeString(field.Type())
+			if field.Embedded() {
+				fieldType = "embedded " + fieldType
+			}
+			symbols = append(symbols, Symbol{name + "." + field.Name(), SymbolField, "field " + name + "." + field.Name() + " " + fieldType})
+		}
+	} else {
+		// Interfaces are recorded whole: a new method breaks implementers
+		symbols = append(symbols, Symbol{name, SymbolType, declared + " " + typeString(named.Underlying())})
+	}
+
+	for i := 0; i < named.NumMethods(); i++ {
+		method := named.Method(i)
+		if !method.Exported() {
+			continue
+		}
+		sig := method.Type().(*types.Signature)
+		receiver := name
+		if _, ok := sig.Recv().Type().(*types.Pointer); ok {
+			receiver = "*" + name
+		}
+		signature := "func (" + receiver + ") " + method.Name() + strings.TrimPrefix(typeString(sig), "func")
+		symbols = append(symbols, Symbol{name + "." + method.Name(), SymbolMethod, signature})
+	}
+	return symbols
+}
+
+// Diff returns the symbols added, removed, and changed from old to current,
+// ordered by package and name. A removed package removes all its symbols.
+func Diff(old Surface, current Surface) APIDiff {
+	diff := APIDiff{Added: []APIChange{}, Removed: []APIChange{}, Changed: []APIChange{}}
+
+	pkgPaths := make(map[string]bool)
+	for pkgPath := range old.Packages {
+		pkgPaths[pkgPath] = true
+	}
+	for pkgPath := range current.Packages {
+		pkgPaths[pkgPath] = true
+	}
+	sorted := make([]string, 0, len(pkgPaths))
+	for pkgPath := range pkgPaths {
+		sorted = append(sorted, pkgPath)
+	}
+	sort.Strings(sorted)
+
+	for _, pkgPath := range sorted {
+		before := symbolsByName(old.Packages[pkgPath])
+		after := symbolsByName(current.Packages[pkgPath])
+
+		for _, symbol := range old.Packages[pkgPath] {
+			now, ok := after[symbol.Name]
+			switch {
+			case !ok:
+				diff.Removed = append(diff.Removed, APIChange{pkgPath, symbol.Name, symbol.Kind, symbol.Signature, ""})
+			case now.Signature != symbol.Signature || now.Kind != symbol.Kind:
+				diff.Changed = append(diff.Changed, APIChange{pkgPath, symbol.Name, now.Kind, symbol.Signature, now.Signature})
+			}
+		}
+		for _, symbol := range current.Packages[pkgPath] {
+			if _, ok := before[symbol.Name]; !ok {
+				diff.Added = append(diff.Added, APIChange{pkgPath, symbol.Name, symbol.Kind, "", symbol.Signature})
+			}
+		}
+	}
+	return diff
+}
+
+// symbolsByName indexes symbols by name.
+func symbolsByName(symbols []Symbol) map[string]Symbol {
+	byName := make(map[string]Symbol, len(symbols))
+	for _, symbol := range symbols {
+		byName[symbol.Name] = symbol
+	}
+	return byName
+}
+
+// APISurfaceOptions configures AnalyzeAPISurface.
+type APISurfaceOptions struct {
+	// Baseline is the JSON file the surface is recorded in.
+	Baseline string
+	// Check fails with a policy error when the API breaks, and when there
+	// is no baseline to compare against.
+	Check bool
+	// Update records the current surface in the baseline after comparing.
+	Update bool
+	// JSON prints the diff as JSON.
+	JSON bool
+}
+
+// AnalyzeAPISurface compares the exported API of the module at path with
+// the baseline file and reports the symbols added, removed, and changed.
+// Without a baseline, it records one.
+func AnalyzeAPISurface(path string, opts APISurfaceOptions) error {
+	if !opts.JSON {
+		logging.Infoln("Analyzing the exported API at:", path)
+	}
+
+	surface, err := APISurface(path)
+	if err != nil {
+		return err
+	}
+	record := func() error {
+		content, err := json.MarshalIndent(surface, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode API surface: %w", err)
+		}
+		written, err := safewrite.Options{Force: true}.Write(safewrite.File{Path: opts.Baseline, Data: append(content, '\n')})
+		if err != nil || !written {
+			return err
+		}
+		symbols := 0
+		for _, pkgSymbols := range surface.Packages {
+			symbols += len(pkgSymbols)
+		}
+		logging.Infof("Recorded %d exported symbols of %d packages in %s\n", symbols, len(surface.Packages), opts.Baseline)
+		return nil
+	}
+
+	content, err := os.ReadFile(opts.Baseline)
+	if os.IsNotExist(err) {
+		if opts.Check {
+			return fmt.Errorf("baseline %s does not exist; record it by running without --check", opts.Baseline)
+		}
+		return record()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read baseline: %w", err)
+	}
+	var baseline Surface
+	if err := json.Unmarshal(content, &baseline); err != nil {
+		return fmt.Errorf("failed to parse baseline %s: %w", opts.Baseline, err)
+	}
+
+	diff := Diff(baseline, surface)
+	if opts.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diff); err != nil {
+			return err
+		}
+	} else {
+		printAPIDiff(diff, opts.Baseline)
+	}
+
+	if opts.Update {
+		if err := record(); err != nil {
+			return err
+		}
+	}
+	if opts.Check && diff.Breaking() {
+		return exitcode.Policyf("%d breaking API changes (%d removed, %d changed)", len(diff.Removed)+len(diff.Changed), len(diff.Removed), len(diff.Changed))
+	}
+	return nil
+}
+
+// printAPIDiff lists the changes, breaking ones first.
+func printAPIDiff(diff APIDiff, baseline string) {
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed) == 0 {
+		fmt.Printf("The exported API matches %s\n", baseline)
+		return
+	}
+
+	fmt.Printf("\nAPI changes since %s: %d removed, %d changed (breaking), %d added\n", baseline, len(diff.Removed), len(diff.Changed), len(diff.Added))
+	if len(diff.Removed) > 0 {
+		fmt.Println("\nRemoved (breaking):")
+		for _, change := range diff.Removed {
+			fmt.Printf("- %s: %s\n", change.Package, change.Old)
+		}
+	}
+	if len(diff.Changed) > 0 {
+		fmt.Println("\nChanged (breaking):")
+		for _, change := range diff.Changed {
+			fmt.Printf("- %s: %s\n", change.Package, change.Name)
+			fmt.Printf("    was: %s\n", change.Old)
+			fmt.Printf("    now: %s\n", change.New)
+		}
+	}
+	if len(diff.Added) > 0 {
+		fmt.Println("\nAdded:")
+		for _, change := range diff.Added {
+			fmt.Printf("- %s: %s\n", change.Package, change.New)
+		}
+	}
+	if diff.Breaking() {
+		logging.Infoln("\nRecord the new API with --update once the breaking changes are intended (e.g. for a new major version).")
+	}
+}
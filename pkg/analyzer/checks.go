@@ -0,0 +1,236 @@
+package analyzer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"goforge/pkg/workerpool"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/tools/go/packages"
+)
+
+// check is one analyzer check and the rules of the findings it reports.
+type check struct {
+	rules []string
+	// typed checks need the packages loaded and type-checked.
+	typed bool
+	run   func(loader *packageLoader, exclude []string, pkgs []*packages.Package) ([]Finding, error)
+}
+
+// checks are the checks RunAll runs.
+var checks = []check{
+	{
+		rules: []string{RuleComplexity},
+		run: func(loader *packageLoader, exclude []string, _ []*packages.Package) ([]Finding, error) {
+			return findComplexFunctions(loader, exclude)
+		},
+	},
+	{
+		rules: []string{RulePackageDoc},
+		run: func(loader *packageLoader, exclude []string, _ []*packages.Package) ([]Finding, error) {
+			return checkPackageDocs(loader, exclude)
+		},
+	},
+	{
+		rules: []string{RuleHardcodedSecret},
+		run: func(loader *packageLoader, exclude []string, _ []*packages.Package) ([]Finding, error) {
+			return findHardcodedSecrets(loader, exclude)
+		},
+	},
+	{
+		rules: []string{RuleMagicNumber},
+		run: func(loader *packageLoader, exclude []string, _ []*packages.Package) ([]Finding, error) {
+			return findMagicNumbers(loader, exclude)
+		},
+	},
+	{
+		rules: []string{RuleInitFunction, RuleGlobalState},
+		run: func(loader *packageLoader, exclude []string, _ []*packages.Package) ([]Finding, error) {
+			return findGlobalState(loader, exclude)
+		},
+	},
+	{
+		rules: []string{RuleMixedReceivers},
+		run: func(loader *packageLoader, exclude []string, _ []*packages.Package) ([]Finding, error) {
+			return findMixedReceivers(loader, exclude)
+		},
+	},
+	{
+		rules: []string{RuleSilentRecover},
+		run: func(loader *packageLoader, exclude []string, _ []*packages.Package) ([]Finding, error) {
+			return findSilentRecovers(loader, exclude)
+		},
+	},
+	{
+		rules: []string{RuleShadowedVariable},
+		typed: true,
+		run: func(loader *packageLoader, exclude []string, pkgs []*packages.Package) ([]Finding, error) {
+			return findShadowed(pkgs, loader.dir, exclude), nil
+		},
+	},
+	{
+		rules: []string{RuleUnusedVariable},
+		typed: true,
+		run: func(loader *packageLoader, exclude []string, pkgs []*packages.Package) ([]Finding, error) {
+			return findUnusedLocals(pkgs, loader.dir, exclude), nil
+		},
+	},
+	{
+		rules: []string{RuleContextInStruct, RuleNilContext, RuleUnusedContext},
+		typed: true,
+		run: func(loader *packageLoader, exclude []string, pkgs []*packages.Package) ([]Finding, error) {
+			return findContextMisuse(pkgs, loader.dir, exclude), nil
+		},
+	},
+}
+
+// Rules returns the name of every rule the checks report.
+func Rules() []string {
+	var rules []string
+	for _, c := range checks {
+		rules = append(rules, c.rules...)
+	}
+	return rules
+}
+
+// RunAll runs the checks of the enabled rules, or of every rule when
+// enabled is empty, on the Go files under path and returns their findings
+// ordered by position. When the packages do not type-check, the findings of
+// the checks that need no types are returned along with the error.
+func RunAll(path string, enabled []string) ([]Finding, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	rules, err := selectRules(enabled, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	findings, typeErr, err := runChecks(newLoader(absPath), nil, rules)
+	if err != nil {
+		return nil, err
+	}
+	if typeErr != nil {
+		return findings, fmt.Errorf("skipped type-based checks: %w", typeErr)
+	}
+	return findings, nil
+}
+
+// selectRules returns the rules to run: those in enable, or all of them
+// when it is empty, except those in disable.
+func selectRules(enable []string, disable []string) (map[string]bool, error) {
+	all := Rules()
+	for _, rule := range append(append([]string{}, enable...), disable...) {
+		if !slices.Contains(all, rule) {
+			return nil, fmt.Errorf("unknown rule %q (expected one of %s)", rule, strings.Join(all, ", "))
+		}
+	}
+
+	if len(enable) == 0 {
+		enable = all
+	}
+	rules := make(map[string]bool)
+	for _, rule := range enable {
+		rules[rule] = true
+	}
+	for _, rule := range disable {
+		delete(rules, rule)
+	}
+	return rules, nil
+}
+
+// runChecks runs the checks reporting any of rules on the code of loader,
+// as many at once as --jobs allows, and keeps the findings of those rules.
+// The packages are only loaded when a type-based check runs; typeErr
+// explains why such checks were skipped.
+func runChecks(loader *packageLoader, exclude []string, rules map[string]bool) (findings []Finding, typeErr error, err error) {
+	var selected []check
+	typed := false
+	for _, c := range checks {
+		if slices.ContainsFunc(c.rules, func(rule string) bool { return rules[rule] }) {
+			selected = append(selected, c)
+			typed = typed || c.typed
+		}
+	}
+
+	type result struct {
+		findings []Finding
+		err      error
+	}
+	results := make([]result, len(selected))
+	workerpool.Run(len(selected), func(i int) {
+		var pkgs []*packages.Package
+		if selected[i].typed {
+			var loadErr error
+			if pkgs, loadErr = loader.load(); loadErr != nil {
+				return
+			}
+		}
+		results[i].findings, results[i].err = selected[i].run(loader, exclude, pkgs)
+	})
+	if typed {
+		_, typeErr = loader.load()
+	}
+
+	findings = []Finding{}
+	for _, result := range results {
+		if result.err != nil {
+			return nil, nil, result.err
+		}
+		for _, finding := range result.findings {
+			if rules[finding.Rule] {
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	sortFindings(findings)
+	return findings, typeErr, nil
+}
+
+// printFindings prints the number of findings of each rule that ran and
+// lists them. Low-severity findings are only listed when verbose is set.
+func printFindings(findings []Finding, rules map[string]bool, verbose bool) {
+	counts := make(map[string]int)
+	for _, finding := range findings {
+		counts[finding.Rule]++
+	}
+
+	fmt.Println("\nFindings:")
+	for _, rule := range Rules() {
+		if rules[rule] {
+			fmt.Printf("- %s: %d\n", rule, counts[rule])
+		}
+	}
+
+	hidden := 0
+	for i, finding := range findings {
+		if finding.Severity == "low" && !verbose {
+			hidden++
+			continue
+		}
+		if i == hidden {
+			fmt.Println()
+		}
+		fmt.Printf("  %s: %s (%s)\n", finding.Position(), finding.Message, finding.Rule)
+	}
+	if hidden > 0 {
+		fmt.Printf("  Run with --verbose to list the %d low-severity findings\n", hidden)
+	}
+}
+
+// printSeverities prints the number of findings of each severity.
+func printSeverities(findings []Finding) {
+	counts := make(map[string]int)
+	for _, finding := range findings {
+		counts[finding.Severity]++
+	}
+
+	fmt.Println("\nFindings by severity:")
+	for _, severity := range Severities {
+		fmt.Printf("- %s: %d\n", severity, counts[severity])
+	}
+}
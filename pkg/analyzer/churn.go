@@ -0,0 +1,165 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+	"time"
+
+	"goforge/pkg/proc"
+)
+
+// maxHotspots is the number of hotspots listed by the structure analysis.
+const maxHotspots = 10
+
+// commitMarker starts the header line of each commit in the git log output.
+const commitMarker = "commit "
+
+// FileHistory is the git history of one file.
+type FileHistory struct {
+	Commits      int
+	LastModified time.Time
+}
+
+// Hotspot is a file that changes often and is complex.
+type Hotspot struct {
+	File         string
+	Commits      int
+	Complexity   int
+	LastModified time.Time
+}
+
+// Score ranks hotspots: churn weighted by complexity.
+func (h Hotspot) Score() int {
+	return h.Commits * h.Complexity
+}
+
+// FileChurn returns the number of commits touching each file under path,
+// keyed by slash-separated path relative to path. Renames are followed, so
+// a file's count includes commits made under its earlier names.
+func FileChurn(path string) (map[string]int, error) {
+	history, err := fileHistory(path)
+	if err != nil {
+		return nil, err
+	}
+
+	churn := make(map[string]int, len(history))
+	for file, h := range history {
+		churn[file] = h.Commits
+	}
+	return churn, nil
+}
+
+// fileHistory reads the commit count and last commit date of every file
+// under path in one pass over git log, newest commit first.
+func fileHistory(path string) (map[string]*FileHistory, error) {
+	cmd := proc.Command("git", "log", "--relative", "-M", "--name-status", "--format="+commitMarker+"%cI")
+	cmd.Dir = path
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed (is %s in a git repository?): %w\n%s", path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	history := make(map[string]*FileHistory)
+	// renamedTo maps an earlier file name to its current one
+	renamedTo := make(map[string]string)
+	current := func(name string) string {
+		if newer, ok := renamedTo[name]; ok {
+			return newer
+		}
+		return name
+	}
+
+	var date time.Time
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, commitMarker); ok {
+			date, _ = time.Parse(time.RFC3339, value)
+			continue
+		}
+
+		// "M\tfile" or "R087\told\tnew"
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		name := current(fields[len(fields)-1])
+		if strings.HasPrefix(fields[0], "R") && len(fields) == 3 {
+			renamedTo[fields[1]] = name
+		}
+
+		h, ok := history[name]
+		if !ok {
+			// The newest commit touching a file comes first
+			h = &FileHistory{LastModified: date}
+			history[name] = h
+		}
+		h.Commits++
+	}
+
+	return history, scanner.Err()
+}
+
+// findHotspots combines file churn with the complexity of each file and
+// returns the highest-scoring files.
+func findHotspots(history map[string]*FileHistory, complexity map[string]int) []Hotspot {
+	var hotspots []Hotspot
+	for file, c := range complexity {
+		h, ok := history[file]
+		if !ok || c == 0 {
+			continue
+		}
+		hotspots = append(hotspots, Hotspot{
+			File:         file,
+			Commits:      h.Commits,
+			Complexity:   c,
+			LastModified: h.LastModified,
+		})
+	}
+
+	sort.Slice(hotspots, func(i, j int) bool {
+		if hotspots[i].Score() != hotspots[j].Score() {
+			return hotspots[i].Score() > hotspots[j].Score()
+		}
+		return hotspots[i].File < hotspots[j].File
+	})
+	if len(hotspots) > maxHotspots {
+		hotspots = hotspots[:maxHotspots]
+	}
+	return hotspots
+}
+
+// fileComplexity returns the total cyclomatic complexity of the functions in
+// a file, or zero when it cannot be parsed.
+func fileComplexity(absPath string, path string) int {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, nil, 0)
+	if err != nil {
+		return 0
+	}
+
+	total := 0
+	for _, fn := range functionComplexities(absPath, fset, file) {
+		total += fn.Complexity
+	}
+	return total
+}
+
+// printHotspots prints the files most worth attention.
+func printHotspots(hotspots []Hotspot) {
+	fmt.Println("\nHotspots (commits x complexity):")
+	if len(hotspots) == 0 {
+		fmt.Println("- None found")
+	}
+	for _, h := range hotspots {
+		fmt.Printf("- %s: score %d (%d commits, complexity %d, last modified %s)\n",
+			h.File, h.Score(), h.Commits, h.Complexity, h.LastModified.Format(time.DateOnly))
+	}
+}
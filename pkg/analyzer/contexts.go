@@ -0,0 +1,134 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Rules of the context.Context misuse check.
+const (
+	RuleContextInStruct = "context-in-struct"
+	RuleNilContext      = "nil-context"
+	RuleUnusedContext   = "unused-context"
+)
+
+// contextSeverities are the severities of the context rules.
+var contextSeverities = map[string]string{
+	RuleContextInStruct: "medium",
+	RuleNilContext:      "high",
+	RuleUnusedContext:   "medium",
+}
+
+// findContextMisuse reports context.Context values stored in struct fields,
+// nil passed where a context is expected, and functions that take a named
+// context parameter but never use it. A parameter named _ is taken as a
+// deliberate signature match and not reported.
+func findContextMisuse(pkgs []*packages.Package, absPath string, exclude []string) []Finding {
+	findings := []Finding{}
+
+	for _, pkg := range pkgs {
+		info := pkg.TypesInfo
+		report := func(rule string, pos token.Pos, format string, args ...any) {
+			findings = append(findings, newFinding(absPath, pkg.Fset, pos, rule, contextSeverities[rule], format, args...))
+		}
+
+		for _, file := range pkg.Syntax {
+			if skipFile(absPath, pkg.Fset.Position(file.Pos()).Filename, exclude) {
+				continue
+			}
+
+			ast.Inspect(file, func(n ast.Node) bool {
+				switch node := n.(type) {
+				case *ast.StructType:
+					for _, field := range node.Fields.List {
+						if isContext(info.TypeOf(field.Type)) {
+							report(RuleContextInStruct, field.Pos(), "context.Context stored in a struct field; pass it as the first parameter instead")
+						}
+					}
+
+				case *ast.CallExpr:
+					sig, ok := info.TypeOf(node.Fun).(*types.Signature)
+					if !ok {
+						return true
+					}
+					for i, arg := range node.Args {
+						if i >= sig.Params().Len() || (sig.Variadic() && i >= sig.Params().Len()-1) {
+							break
+						}
+						if isContext(sig.Params().At(i).Type()) && info.Types[arg].IsNil() {
+							report(RuleNilContext, arg.Pos(), "nil passed as a context; use context.TODO() or context.Background()")
+						}
+					}
+
+				case *ast.FuncDecl:
+					if node.Body == nil {
+						return true
+					}
+					for _, param := range contextParams(info, node.Type) {
+						if !usesObject(info, node.Body, param) {
+							report(RuleUnusedContext, param.Pos(), "%s takes context %s but never uses it", node.Name.Name, param.Name())
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	sortFindings(findings)
+	return findings
+}
+
+// isContext reports whether t is context.Context.
+func isContext(t types.Type) bool {
+	named, ok := unalias(t).(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == "context" && obj.Name() == "Context"
+}
+
+// unalias returns the type an alias such as type Ctx = context.Context
+// stands for. Newer versions of go/types give aliases a type of their own,
+// types.Alias, whose Rhs method returns the aliased type.
+func unalias(t types.Type) types.Type {
+	for {
+		alias, ok := t.(interface{ Rhs() types.Type })
+		if !ok {
+			return t
+		}
+		t = alias.Rhs()
+	}
+}
+
+// contextParams returns the named context.Context parameters of a function.
+func contextParams(info *types.Info, fn *ast.FuncType) []*types.Var {
+	var params []*types.Var
+	for _, field := range fn.Params.List {
+		if !isContext(info.TypeOf(field.Type)) {
+			continue
+		}
+		for _, name := range field.Names {
+			if obj, ok := info.Defs[name].(*types.Var); ok && name.Name != "_" {
+				params = append(params, obj)
+			}
+		}
+	}
+	return params
+}
+
+// usesObject reports whether any identifier in body refers to obj.
+func usesObject(info *types.Info, body *ast.BlockStmt, obj types.Object) bool {
+	used := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && info.Uses[ident] == obj {
+			used = true
+		}
+		return !used
+	})
+	return used
+}
@@ -0,0 +1,77 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/exp/slices"
+)
+
+// Severities are the severities of findings, most severe first.
+var Severities = []string{"high", "medium", "low"}
+
+// FailOnLevels maps the levels of --fail-on to the least severe finding
+// that fails the analysis: error fails on high-severity findings, and
+// warning on medium-severity ones too.
+var FailOnLevels = map[string]string{
+	"error":   "high",
+	"warning": "medium",
+}
+
+// Finding is a problem reported by a check at a position in the source.
+type Finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	// File is relative to the analyzed path.
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	Message string `json:"message"`
+}
+
+// Position returns the finding's file:line:col.
+func (f Finding) Position() string {
+	return fmt.Sprintf("%s:%d:%d", f.File, f.Line, f.Col)
+}
+
+// newFinding returns a finding at pos with its file relative to absPath.
+func newFinding(absPath string, fset *token.FileSet, pos token.Pos, rule string, severity string, format string, args ...any) Finding {
+	position := fset.Position(pos)
+	file := position.Filename
+	if rel, err := filepath.Rel(absPath, file); err == nil {
+		file = rel
+	}
+	return Finding{
+		Rule:     rule,
+		Severity: severity,
+		File:     filepath.ToSlash(file),
+		Line:     position.Line,
+		Col:      position.Column,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// AtLeast reports whether the finding is as severe as severity or more.
+func (f Finding) AtLeast(severity string) bool {
+	rank := slices.Index(Severities, f.Severity)
+	return rank >= 0 && rank <= slices.Index(Severities, severity)
+}
+
+// sortFindings orders findings by file, line, column, and rule.
+func sortFindings(findings []Finding) {
+	sort.Slice(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Col != b.Col {
+			return a.Col < b.Col
+		}
+		return a.Rule < b.Rule
+	})
+}
@@ -0,0 +1,123 @@
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/safewrite"
+
+	"golang.org/x/tools/imports"
+)
+
+// fixer is an automatic fix that returns the rewritten source of a file.
+type fixer struct {
+	name string
+	fix  func(path string, src []byte) ([]byte, error)
+}
+
+// safeFixers only change formatting and imports, never behavior, and run in
+// this order.
+var safeFixers = []fixer{
+	{name: "gofmt", fix: fixFormat},
+	{name: "goimports", fix: fixImports},
+}
+
+// FixOptions configures Fix.
+type FixOptions struct {
+	Exclude []string
+	// DryRun prints a diff of the fixes instead of rewriting files.
+	DryRun bool
+}
+
+// Fix applies the safe automatic fixes (gofmt and goimports) to every Go file
+// under path, skipping vendored and generated code.
+func Fix(path string, opts FixOptions) error {
+	logging.Infoln("Applying safe fixes at:", path)
+
+	// Get absolute path
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	exclude := append([]string{"vendor/"}, opts.Exclude...)
+	fixed := 0
+	// The global --dry-run previews fixes like any generated file
+	opts.DryRun = opts.DryRun || safewrite.DryRun()
+
+	stats, err := walkGoFiles(absPath, exclude, nil, func(file string, info os.FileInfo) error {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(absPath, file)
+
+		out, applied, err := applyFixers(file, src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: skipping %s: %v\n", rel, err)
+			return nil
+		}
+		if len(applied) == 0 {
+			return nil
+		}
+		fixed++
+
+		if opts.DryRun {
+			fmt.Print(safewrite.UnifiedDiff(filepath.ToSlash(rel), src, out))
+			return nil
+		}
+		if err := os.WriteFile(file, out, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+		fmt.Printf("Fixed %s (%s)\n", rel, strings.Join(applied, ", "))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error walking directory: %w", err)
+	}
+
+	verb := "fixed"
+	if opts.DryRun {
+		verb = "would be fixed"
+	}
+	fmt.Printf("\n%d of %d files %s\n", fixed, stats.Files, verb)
+	printSkipped(stats)
+
+	return nil
+}
+
+// applyFixers runs every safe fixer over src and returns the result and the
+// names of the fixers that changed it.
+func applyFixers(path string, src []byte) ([]byte, []string, error) {
+	var applied []string
+	for _, f := range safeFixers {
+		out, err := f.fix(path, src)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		if !bytes.Equal(out, src) {
+			applied = append(applied, f.name)
+			src = out
+		}
+	}
+	return src, applied, nil
+}
+
+// fixFormat formats src like gofmt.
+func fixFormat(path string, src []byte) ([]byte, error) {
+	return format.Source(src)
+}
+
+// fixImports removes unused imports and adds missing ones like goimports.
+func fixImports(path string, src []byte) ([]byte, error) {
+	return imports.Process(path, src, &imports.Options{
+		Comments:  true,
+		TabIndent: true,
+		TabWidth:  8,
+	})
+}
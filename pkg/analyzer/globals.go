@@ -0,0 +1,136 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Rules of the global state check.
+const (
+	RuleInitFunction = "init-function"
+	RuleGlobalState  = "global-state"
+)
+
+// FindGlobalState reports init functions, whose side effects run on import,
+// and package-level variables of mutable types: maps, slices, and pointers,
+// declared with such a type or initialized with a literal, make, new, or &.
+// Both make packages hard to test in isolation. Values returned by other
+// calls are not reported, since their type is not known without type
+// checking; neither are blank variables or test files.
+func FindGlobalState(path string) ([]Finding, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return findGlobalState(newLoader(absPath), nil)
+}
+
+// findGlobalState checks every non-test Go file under absPath.
+func findGlobalState(loader *packageLoader, exclude []string) ([]Finding, error) {
+	absPath := loader.dir
+	findings := []Finding{}
+
+	_, err := walkGoFiles(absPath, exclude, nil, func(path string, info os.FileInfo) error {
+		if strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := loader.parseFile(path)
+		if err != nil {
+			// Unparseable files are reported by the other checks
+			return nil
+		}
+
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil && decl.Name.Name == "init" {
+					findings = append(findings, newFinding(absPath, loader.fset, decl.Pos(), RuleInitFunction, "low",
+						"init function runs side effects on import; initialize explicitly from main or a constructor"))
+				}
+
+			case *ast.GenDecl:
+				if decl.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range decl.Specs {
+					spec := spec.(*ast.ValueSpec)
+					for i, name := range spec.Names {
+						if name.Name == "_" {
+							continue
+						}
+						var value ast.Expr
+						if i < len(spec.Values) {
+							value = spec.Values[i]
+						}
+						kind := mutableKind(spec.Type, value)
+						if kind == "" {
+							continue
+						}
+						findings = append(findings, newFinding(absPath, loader.fset, name.Pos(), RuleGlobalState, "low",
+							"package-level %s %s is global mutable state; pass it in or keep it in a struct", kind, name.Name))
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory: %w", err)
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+// mutableKind returns "map", "slice", or "pointer" when a variable declared
+// with typ and value holds one, and "" otherwise. The declared type decides
+// when there is one.
+func mutableKind(typ ast.Expr, value ast.Expr) string {
+	if typ != nil {
+		return typeKind(typ)
+	}
+
+	switch value := astutil.Unparen(value).(type) {
+	case *ast.CompositeLit:
+		return typeKind(value.Type)
+	case *ast.UnaryExpr:
+		if value.Op == token.AND {
+			return "pointer"
+		}
+	case *ast.CallExpr:
+		fun, ok := value.Fun.(*ast.Ident)
+		if !ok || len(value.Args) == 0 {
+			return ""
+		}
+		switch fun.Name {
+		case "make":
+			return typeKind(value.Args[0])
+		case "new":
+			return "pointer"
+		}
+	}
+	return ""
+}
+
+// typeKind returns "map", "slice", or "pointer" for those type
+// expressions, and "" for any other.
+func typeKind(typ ast.Expr) string {
+	switch typ := astutil.Unparen(typ).(type) {
+	case *ast.MapType:
+		return "map"
+	case *ast.ArrayType:
+		if typ.Len == nil {
+			return "slice"
+		}
+	case *ast.StarExpr:
+		return "pointer"
+	}
+	return ""
+}
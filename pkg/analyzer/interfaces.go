@@ -0,0 +1,169 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"goforge/pkg/logging"
+)
+
+// manyInterfacesThreshold is the number of interfaces a concrete type must
+// implement before it is called out in the report.
+const manyInterfacesThreshold = 3
+
+// InterfaceInfo describes a declared interface and the types that satisfy it.
+type InterfaceInfo struct {
+	Name         string
+	Position     string
+	Methods      int
+	Implementers []string
+}
+
+// AnalyzeInterfaces reports declared interfaces, their implementers, interfaces
+// with more than maxMethods methods, and interfaces that nothing implements.
+func AnalyzeInterfaces(path string, exclude []string, maxMethods int) error {
+	logging.Infoln("Analyzing interfaces at:", path)
+
+	// Get absolute path
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	pkgs, err := newLoader(absPath).load()
+	if err != nil {
+		return err
+	}
+
+	// Collect named interfaces and concrete types declared in the project
+	var ifaces []*types.TypeName
+	var concrete []*types.TypeName
+
+	for _, pkg := range pkgs {
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			typeName, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || typeName.IsAlias() {
+				continue
+			}
+
+			named, ok := typeName.Type().(*types.Named)
+			if !ok || named.TypeParams().Len() > 0 {
+				continue
+			}
+
+			file := pkg.Fset.Position(typeName.Pos()).Filename
+			if skipFile(absPath, file, exclude) {
+				continue
+			}
+
+			if iface, ok := named.Underlying().(*types.Interface); ok {
+				// Constraint interfaces cannot be implemented by ordinary types
+				if iface.IsMethodSet() && iface.NumMethods() > 0 {
+					ifaces = append(ifaces, typeName)
+				}
+			} else {
+				concrete = append(concrete, typeName)
+			}
+		}
+	}
+
+	// Compute implements relationships for values and pointers
+	implementsCount := make(map[string]int)
+	var infos []InterfaceInfo
+
+	for _, ifaceName := range ifaces {
+		iface := ifaceName.Type().Underlying().(*types.Interface)
+		info := InterfaceInfo{
+			Name:     qualifiedName(ifaceName),
+			Position: relPosition(absPath, pkgs[0].Fset, ifaceName.Pos()),
+			Methods:  iface.NumMethods(),
+		}
+
+		for _, typeName := range concrete {
+			typ := typeName.Type()
+			switch {
+			case types.Implements(typ, iface):
+				info.Implementers = append(info.Implementers, qualifiedName(typeName))
+			case types.Implements(types.NewPointer(typ), iface):
+				info.Implementers = append(info.Implementers, "*"+qualifiedName(typeName))
+			default:
+				continue
+			}
+			implementsCount[qualifiedName(typeName)]++
+		}
+
+		infos = append(infos, info)
+	}
+
+	printInterfaceReport(infos, implementsCount, maxMethods)
+	return nil
+}
+
+// printInterfaceReport prints the interface listing and the flagged findings.
+func printInterfaceReport(infos []InterfaceInfo, implementsCount map[string]int, maxMethods int) {
+	fmt.Printf("\nInterfaces (%d):\n", len(infos))
+	if len(infos) == 0 {
+		fmt.Println("- No interfaces with methods found")
+		return
+	}
+
+	var fat, unimplemented []InterfaceInfo
+	for _, info := range infos {
+		fmt.Printf("- %s (%d methods) at %s\n", info.Name, info.Methods, info.Position)
+		if len(info.Implementers) > 0 {
+			fmt.Printf("    Implemented by: %s\n", strings.Join(info.Implementers, ", "))
+		} else {
+			unimplemented = append(unimplemented, info)
+		}
+		if info.Methods > maxMethods {
+			fat = append(fat, info)
+		}
+	}
+
+	fmt.Printf("\nFat Interfaces (more than %d methods):\n", maxMethods)
+	if len(fat) == 0 {
+		fmt.Println("- None")
+	}
+	for _, info := range fat {
+		fmt.Printf("- %s has %d methods; consider splitting it into smaller interfaces\n", info.Name, info.Methods)
+	}
+
+	fmt.Println("\nInterfaces Without Implementers (possibly dead):")
+	if len(unimplemented) == 0 {
+		fmt.Println("- None")
+	}
+	for _, info := range unimplemented {
+		fmt.Printf("- %s at %s\n", info.Name, info.Position)
+	}
+
+	// Concrete types that satisfy many interfaces
+	var names []string
+	for name, count := range implementsCount {
+		if count >= manyInterfacesThreshold {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if implementsCount[names[i]] != implementsCount[names[j]] {
+			return implementsCount[names[i]] > implementsCount[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	fmt.Printf("\nTypes Implementing %d or More Interfaces:\n", manyInterfacesThreshold)
+	if len(names) == 0 {
+		fmt.Println("- None")
+	}
+	for _, name := range names {
+		fmt.Printf("- %s implements %d interfaces\n", name, implementsCount[name])
+	}
+}
+
+// qualifiedName returns the package-qualified name of a type.
+func qualifiedName(typeName *types.TypeName) string {
+	return typeName.Pkg().Name() + "." + typeName.Name()
+}
@@ -0,0 +1,232 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// loadMode requests the syntax of the packages and the export data of their
+// dependencies; typeCheck adds the types.
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+	packages.NeedImports | packages.NeedExportFile
+
+// packageLoader loads the Go code under a directory for the analyses of one
+// run.
+// Parsing every file and type-checking the packages with go list are the
+// slow part of an analysis, so the loader does each at most once and hands
+// the result to every check that needs it. It is safe for concurrent use.
+type packageLoader struct {
+	dir string
+	// fset positions every parsed file, so findings of different files
+	// can share it
+	fset *token.FileSet
+
+	loadOnce sync.Once
+	pkgs     []*packages.Package
+	loadErr  error
+
+	mu    sync.Mutex
+	files map[string]*parsedFile
+}
+
+// parsedFile is the syntax of one file, parsed on first use.
+type parsedFile struct {
+	once sync.Once
+	file *ast.File
+	err  error
+}
+
+// newLoader returns a loader for the absolute directory absPath.
+func newLoader(absPath string) *packageLoader {
+	return &packageLoader{dir: absPath, fset: token.NewFileSet(), files: make(map[string]*parsedFile)}
+}
+
+// load loads and type-checks every package under the loader's
+// directory on the first call and returns the same packages, or error, on
+// every later one. The packages share their syntax with parseFile.
+func (l *packageLoader) load() ([]*packages.Package, error) {
+	l.loadOnce.Do(func() {
+		l.pkgs, l.loadErr = l.loadPackages()
+	})
+	return l.pkgs, l.loadErr
+}
+
+// parseFile returns the syntax of the Go file at path, with its comments,
+// positioned in l.fset. A file that does not parse returns what was parsed
+// along with the error.
+func (l *packageLoader) parseFile(path string) (*ast.File, error) {
+	return l.parseSource(path, nil)
+}
+
+// parseSource is parseFile for a caller that has read the file already;
+// src is only used if the file has not been parsed yet.
+func (l *packageLoader) parseSource(path string, src []byte) (*ast.File, error) {
+	l.mu.Lock()
+	parsed, ok := l.files[path]
+	if !ok {
+		parsed = &parsedFile{}
+		l.files[path] = parsed
+	}
+	l.mu.Unlock()
+
+	parsed.once.Do(func() {
+		// A nil []byte in the any parameter would parse as an empty file
+		var source any
+		if src != nil {
+			source = src
+		}
+		parsed.file, parsed.err = parser.ParseFile(l.fset, path, source, parser.ParseComments)
+	})
+	return parsed.file, parsed.err
+}
+
+// loadPackages parses and type-checks every package under the loader's
+// directory, taking the syntax of each file from parseSource.
+func (l *packageLoader) loadPackages() ([]*packages.Package, error) {
+	absPath := l.dir
+	cfg := &packages.Config{
+		Mode: loadMode,
+		Dir:  absPath,
+		Fset: l.fset,
+		ParseFile: func(_ *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			return l.parseSource(filename, src)
+		},
+	}
+
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+	typeCheck(cfg.Fset, pkgs)
+
+	// Report type errors on stderr, keeping JSON output clean, but keep
+	// going with what was loaded
+	var loaded []*packages.Package
+	for _, pkg := range pkgs {
+		for _, pkgErr := range pkg.Errors {
+			fmt.Fprintf(os.Stderr, "WARNING: %v\n", pkgErr)
+		}
+		if pkg.Types != nil {
+			loaded = append(loaded, pkg)
+		}
+	}
+
+	if len(loaded) == 0 {
+		return nil, fmt.Errorf("no Go packages found in %s", absPath)
+	}
+
+	return loaded, nil
+}
+
+// typeCheck type-checks the packages loaded from source, each after those of
+// them it imports, and reads their other imports from the export data go
+// list wrote. go/packages can only read the export data formats of the Go
+// releases before it, so the export data is read by the go/importer of the
+// toolchain GoForge was built with, which matches the go command next to it.
+func typeCheck(fset *token.FileSet, pkgs []*packages.Package) {
+	exports := make(map[string]string)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.ExportFile != "" {
+			exports[pkg.PkgPath] = pkg.ExportFile
+		}
+	})
+	fromExports := importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		file, ok := exports[path]
+		if !ok {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+		return os.Open(file)
+	})
+
+	roots := make(map[*packages.Package]bool)
+	for _, pkg := range pkgs {
+		roots[pkg] = true
+	}
+	checked := make(map[string]*types.Package)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !roots[pkg] || len(pkg.Syntax) == 0 {
+			return
+		}
+		config := types.Config{
+			Importer: importerFunc(func(path string) (*types.Package, error) {
+				if imported, ok := pkg.Imports[path]; ok {
+					path = imported.PkgPath
+				}
+				if done, ok := checked[path]; ok {
+					return done, nil
+				}
+				return fromExports.Import(path)
+			}),
+			Error: func(err error) {
+				if typeErr, ok := err.(types.Error); ok {
+					pkg.TypeErrors = append(pkg.TypeErrors, typeErr)
+					pkg.Errors = append(pkg.Errors, packages.Error{
+						Pos:  fset.Position(typeErr.Pos).String(),
+						Msg:  typeErr.Msg,
+						Kind: packages.TypeError,
+					})
+				}
+			},
+		}
+		info := &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Instances:  make(map[*ast.Ident]types.Instance),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Implicits:  make(map[ast.Node]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+			Scopes:     make(map[ast.Node]*types.Scope),
+		}
+		pkg.Types, _ = config.Check(pkg.PkgPath, fset, pkg.Syntax, info)
+		pkg.TypesInfo, pkg.Fset = info, fset
+		checked[pkg.PkgPath] = pkg.Types
+	})
+}
+
+// importerFunc is a types.Importer calling a function.
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+// skipFile reports whether a loaded file should be left out of a type-based check
+// because it matches an exclude pattern or is generated.
+func skipFile(absPath string, file string, exclude []string) bool {
+	rel, err := filepath.Rel(absPath, file)
+	if err != nil {
+		return false
+	}
+
+	// Check the file itself and every parent directory against the patterns
+	if isExcluded(rel, false, exclude) {
+		return true
+	}
+	for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+		if isExcluded(dir, true, exclude) {
+			return true
+		}
+	}
+
+	generated, err := isGenerated(file)
+	return err == nil && generated
+}
+
+// relPosition formats a source position relative to the project root.
+func relPosition(absPath string, fset *token.FileSet, pos token.Pos) string {
+	position := fset.Position(pos)
+	if rel, err := filepath.Rel(absPath, position.Filename); err == nil {
+		position.Filename = rel
+	}
+	return position.String()
+}
@@ -0,0 +1,133 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RuleMagicNumber reports unexplained numeric literals.
+const RuleMagicNumber = "magic-number"
+
+// commonNumbers are too ordinary to need a name.
+var commonNumbers = []float64{0, 1, 2, 10, 100}
+
+// FindMagicNumbers reports numeric literals in expressions that should be
+// named constants. Literals are accepted in const declarations, as the value
+// of a variable, field, or keyed element (which names them), as indexes and
+// array lengths, as file modes, as multiples of a time unit, in arguments to
+// make and strconv, and when they are 0, 1, 2, 10, or 100. Test files are
+// not checked.
+func FindMagicNumbers(path string) ([]Finding, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return findMagicNumbers(newLoader(absPath), nil)
+}
+
+// findMagicNumbers checks every non-test Go file under absPath.
+func findMagicNumbers(loader *packageLoader, exclude []string) ([]Finding, error) {
+	absPath := loader.dir
+	findings := []Finding{}
+
+	_, err := walkGoFiles(absPath, exclude, nil, func(path string, info os.FileInfo) error {
+		if strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := loader.parseFile(path)
+		if err != nil {
+			// Unparseable files are reported by the other checks
+			return nil
+		}
+
+		preorderStack(file, func(n ast.Node, stack []ast.Node) bool {
+			if decl, ok := n.(*ast.GenDecl); ok && decl.Tok == token.CONST {
+				return false
+			}
+			lit, ok := n.(*ast.BasicLit)
+			if !ok || (lit.Kind != token.INT && lit.Kind != token.FLOAT) {
+				return true
+			}
+			if !isMagicNumber(lit, stack) {
+				return true
+			}
+			findings = append(findings, newFinding(absPath, loader.fset, lit.Pos(), RuleMagicNumber, "low",
+				"magic number %s; give it a name with a constant", lit.Value))
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory: %w", err)
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+// isMagicNumber reports whether a numeric literal, whose ancestors are
+// stack, needs a name.
+func isMagicNumber(lit *ast.BasicLit, stack []ast.Node) bool {
+	// Octal literals such as 0644 are file modes
+	if lit.Kind == token.INT && len(lit.Value) > 1 && lit.Value[0] == '0' && !strings.ContainsAny(lit.Value[1:2], "xXbB") {
+		return false
+	}
+	value, _ := constant.Float64Val(constant.ToFloat(constant.MakeFromLiteral(lit.Value, lit.Kind, 0)))
+	for _, common := range commonNumbers {
+		if value == common {
+			return false
+		}
+	}
+
+	// Find the first ancestor that is not a sign or parentheses
+	var child ast.Node = lit
+	i := len(stack) - 1
+	for ; i >= 0; i-- {
+		if _, ok := stack[i].(*ast.ParenExpr); ok {
+			child = stack[i]
+			continue
+		}
+		if unary, ok := stack[i].(*ast.UnaryExpr); ok && (unary.Op == token.SUB || unary.Op == token.ADD) {
+			child = stack[i]
+			continue
+		}
+		break
+	}
+	if i < 0 {
+		return true
+	}
+
+	switch parent := stack[i].(type) {
+	case *ast.ValueSpec, *ast.AssignStmt, *ast.IndexExpr, *ast.SliceExpr, *ast.ArrayType:
+		return false
+	case *ast.KeyValueExpr:
+		return parent.Value != child
+	case *ast.BinaryExpr:
+		other := parent.X
+		if other == child {
+			other = parent.Y
+		}
+		// 30 * time.Second reads fine
+		if sel, ok := other.(*ast.SelectorExpr); ok && parent.Op == token.MUL {
+			if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "time" {
+				return false
+			}
+		}
+	case *ast.CallExpr:
+		switch fun := parent.Fun.(type) {
+		case *ast.Ident:
+			return fun.Name != "make"
+		case *ast.SelectorExpr:
+			if pkg, ok := fun.X.(*ast.Ident); ok && pkg.Name == "strconv" {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RulePackageDoc reports packages without a proper package comment.
+const RulePackageDoc = "package-doc"
+
+// packageDocs collects the package comments of one package.
+type packageDocs struct {
+	name string
+	// clause is the package clause of the package's first file, where a
+	// missing comment is reported.
+	clause token.Pos
+	docs   []*ast.CommentGroup
+}
+
+// CheckPackageDocs reports packages without a package comment and package
+// comments that do not start with "Package <name>". Commands are only
+// required to have a comment, which conventionally starts with the name of
+// the program rather than of the package.
+func CheckPackageDocs(path string) ([]Finding, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return checkPackageDocs(newLoader(absPath), nil)
+}
+
+// checkPackageDocs checks the package comments of every package under the
+// loader's directory.
+func checkPackageDocs(loader *packageLoader, exclude []string) ([]Finding, error) {
+	absPath := loader.dir
+	packages := make(map[string]*packageDocs)
+
+	_, err := walkGoFiles(absPath, exclude, nil, func(path string, info os.FileInfo) error {
+		if strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		// Only the package clause matters, so a file that fails to parse
+		// further on still counts
+		file, _ := loader.parseFile(path)
+		if file == nil || !file.Package.IsValid() {
+			// Unparseable files are reported by the other checks
+			return nil
+		}
+
+		key := filepath.Dir(path) + ":" + file.Name.Name
+		pkg, ok := packages[key]
+		if !ok {
+			pkg = &packageDocs{name: file.Name.Name, clause: file.Package}
+			packages[key] = pkg
+		}
+		if file.Doc != nil {
+			pkg.docs = append(pkg.docs, file.Doc)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory: %w", err)
+	}
+
+	findings := []Finding{}
+	for _, pkg := range packages {
+		if len(pkg.docs) == 0 {
+			findings = append(findings, newFinding(absPath, loader.fset, pkg.clause, RulePackageDoc, "medium",
+				"package %s has no package comment", pkg.name))
+			continue
+		}
+		if pkg.name == "main" {
+			continue
+		}
+		for _, doc := range pkg.docs {
+			if words := strings.Fields(doc.Text()); len(words) < 2 || words[0] != "Package" || words[1] != pkg.name {
+				findings = append(findings, newFinding(absPath, loader.fset, doc.Pos(), RulePackageDoc, "medium",
+					"package comment should start with \"Package %s\"", pkg.name))
+				break
+			}
+		}
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
@@ -0,0 +1,199 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/gitdiff"
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/testing"
+)
+
+// Rules of the findings PRCheck reports besides RuleComplexity.
+const (
+	// RuleNewTODO reports TODO, FIXME, XXX, and HACK comments on changed lines.
+	RuleNewTODO = "new-todo"
+	// RuleUndocumentedExport reports exported declarations on changed
+	// lines without a doc comment.
+	RuleUndocumentedExport = "undocumented-export"
+)
+
+// todoRe matches the markers of a comment left for later.
+var todoRe = regexp.MustCompile(`\b(TODO|FIXME|XXX|HACK)\b`)
+
+// PRCheckOptions configures PRCheck.
+type PRCheckOptions struct {
+	// Base is the git ref the branch is compared with, e.g. main.
+	Base string
+	// Threshold is the lowest passing coverage percentage of the changed
+	// lines.
+	Threshold float64
+	// SkipTests leaves out diff coverage, which runs the tests.
+	SkipTests bool
+	// MaxTODOs is the most new TODO comments that pass.
+	MaxTODOs int
+	// MaxComplexity is the highest passing cyclomatic complexity of a
+	// changed function.
+	MaxComplexity int
+}
+
+// PRCheck reports on the Go files changed since the merge base of opts.Base
+// and HEAD in the module containing path: the test coverage of the changed
+// lines, new TODO comments, changed functions that are too complex, and
+// exported declarations added or changed without a doc comment. It fails
+// with a policy error when any of them is over its limit.
+func PRCheck(path string, opts PRCheckOptions) error {
+	logging.Infof("Checking the changes since %s at: %s\n", opts.Base, path)
+
+	if opts.MaxTODOs < 0 {
+		return fmt.Errorf("maximum number of TODOs cannot be negative")
+	}
+	if opts.MaxComplexity < 1 {
+		return fmt.Errorf("maximum complexity must be at least 1")
+	}
+	root, err := module.FindRoot(path)
+	if err != nil {
+		return err
+	}
+	changed, err := gitdiff.ChangedLines(root, opts.Base)
+	if err != nil {
+		return err
+	}
+
+	findings, err := changedFindings(root, changed, opts.MaxComplexity)
+	if err != nil {
+		return err
+	}
+	var coverage *testing.DiffCoverage
+	if !opts.SkipTests {
+		logging.Infoln("Running the tests with coverage...")
+		if coverage, err = testing.MeasureDiffCoverage(root, opts.Base); err != nil {
+			return err
+		}
+	}
+
+	files := make([]string, 0, len(changed))
+	for file := range changed {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	fmt.Printf("\nChanged Go files: %d\n", len(files))
+	for _, file := range files {
+		fmt.Printf("- %s\n", file)
+	}
+
+	var failures []string
+	if coverage != nil {
+		testing.PrintDiffCoverage(coverage)
+		if coverage.Statements > 0 && coverage.Percent() < opts.Threshold {
+			failures = append(failures, fmt.Sprintf("diff coverage %.1f%% is below %.1f%%", coverage.Percent(), opts.Threshold))
+		}
+	}
+
+	todos := printRuleFindings(findings, RuleNewTODO, fmt.Sprintf("New TODOs (max %d)", opts.MaxTODOs))
+	if todos > opts.MaxTODOs {
+		failures = append(failures, fmt.Sprintf("%d new TODOs (max %d)", todos, opts.MaxTODOs))
+	}
+	if complex := printRuleFindings(findings, RuleComplexity, fmt.Sprintf("Changed functions above complexity %d", opts.MaxComplexity)); complex > 0 {
+		failures = append(failures, fmt.Sprintf("%d changed functions above complexity %d", complex, opts.MaxComplexity))
+	}
+	if undocumented := printRuleFindings(findings, RuleUndocumentedExport, "Undocumented exported declarations"); undocumented > 0 {
+		failures = append(failures, fmt.Sprintf("%d undocumented exported declarations", undocumented))
+	}
+
+	if len(failures) > 0 {
+		return exitcode.Policyf("PR check failed: %s", strings.Join(failures, "; "))
+	}
+	fmt.Println("\nSUCCESS: All PR checks passed")
+	return nil
+}
+
+// changedFindings returns the new TODOs, complex functions, and
+// undocumented exported declarations on the changed lines of each file,
+// keyed by path relative to root. Generated files are skipped.
+func changedFindings(root string, changed map[string][]int, maxComplexity int) ([]Finding, error) {
+	findings := []Finding{}
+	fset := token.NewFileSet()
+	for file, lines := range changed {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if generated, err := isGenerated(path); err != nil || generated {
+			continue
+		}
+		syntax, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse changed file: %w", err)
+		}
+
+		isChanged := make(map[int]bool, len(lines))
+		for _, line := range lines {
+			isChanged[line] = true
+		}
+		lineOf := func(pos token.Pos) int { return fset.Position(pos).Line }
+		tokenFile := fset.File(syntax.Pos())
+
+		for _, group := range syntax.Comments {
+			for _, comment := range group.List {
+				start := lineOf(comment.Slash)
+				for i, text := range strings.Split(comment.Text, "\n") {
+					if !isChanged[start+i] || !todoRe.MatchString(text) {
+						continue
+					}
+					pos := comment.Slash
+					if i > 0 {
+						pos = tokenFile.LineStart(start + i)
+					}
+					text = strings.TrimSpace(strings.Trim(strings.TrimSpace(text), "/*"))
+					findings = append(findings, newFinding(root, fset, pos, RuleNewTODO, "low", "%s", text))
+				}
+			}
+		}
+
+		eachFunction(syntax, func(fn *ast.FuncDecl, name string) {
+			for line := lineOf(fn.Pos()); line <= lineOf(fn.End()); line++ {
+				if !isChanged[line] {
+					continue
+				}
+				if complexity := cyclomatic(fn.Body); complexity > maxComplexity {
+					findings = append(findings, newFinding(root, fset, fn.Pos(), RuleComplexity, "medium",
+						"%s has cyclomatic complexity %d (above %d)", name, complexity, maxComplexity))
+				}
+				return
+			}
+		})
+
+		eachExported(syntax, func(name *ast.Ident, documented bool) {
+			if !documented && isChanged[lineOf(name.Pos())] {
+				findings = append(findings, newFinding(root, fset, name.Pos(), RuleUndocumentedExport, "medium",
+					"exported %s has no doc comment", name.Name))
+			}
+		})
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+// printRuleFindings lists the findings of one rule under title and returns
+// how many there are.
+func printRuleFindings(findings []Finding, rule string, title string) int {
+	var matched []Finding
+	for _, finding := range findings {
+		if finding.Rule == rule {
+			matched = append(matched, finding)
+		}
+	}
+
+	fmt.Printf("\n%s: %d\n", title, len(matched))
+	for _, finding := range matched {
+		fmt.Printf("  %s: %s\n", finding.Position(), finding.Message)
+	}
+	return len(matched)
+}
@@ -0,0 +1,456 @@
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// complexityThreshold is the cyclomatic complexity above which a function is listed.
+const complexityThreshold = 10
+
+// RuleComplexity reports functions above complexityThreshold.
+const RuleComplexity = "complexity"
+
+// duplicateWindow is the number of consecutive lines compared when looking for duplication.
+const duplicateWindow = 6
+
+// Grades in descending order, with the minimum score for each.
+var gradeScores = []struct {
+	Grade string
+	Min   float64
+}{
+	{"A", 90},
+	{"B", 80},
+	{"C", 70},
+	{"D", 60},
+	{"F", 0},
+}
+
+// GradeWeights sets how much each metric contributes to the overall grade.
+type GradeWeights struct {
+	Complexity  float64 `json:"complexity"`
+	Docs        float64 `json:"docs"`
+	Duplication float64 `json:"duplication"`
+	Formatting  float64 `json:"formatting"`
+}
+
+// DefaultGradeWeights weighs complexity and documentation above the rest.
+var DefaultGradeWeights = GradeWeights{
+	Complexity:  0.3,
+	Docs:        0.3,
+	Duplication: 0.2,
+	Formatting:  0.2,
+}
+
+// QualityReport holds the code quality metrics of a project.
+type QualityReport struct {
+	Files int `json:"files"`
+
+	// Cyclomatic complexity of every function
+	Functions         int                  `json:"functions"`
+	AverageComplexity float64              `json:"average_complexity"`
+	ComplexFunctions  []FunctionComplexity `json:"complex_functions"`
+
+	// Exported declarations with a doc comment
+	Exported    int     `json:"exported"`
+	Documented  int     `json:"documented"`
+	DocCoverage float64 `json:"doc_coverage_percent"`
+
+	// Percentage of lines inside blocks repeated elsewhere
+	DuplicatedLines int     `json:"duplicated_lines"`
+	TotalLines      int     `json:"total_lines"`
+	Duplication     float64 `json:"duplication_percent"`
+
+	// Files whose content differs from gofmt output
+	UnformattedFiles     []string `json:"unformatted_files"`
+	FormattingCompliance float64  `json:"formatting_compliance_percent"`
+
+	// Weights used by ComputeGrade; the zero value means DefaultGradeWeights
+	Weights GradeWeights `json:"weights"`
+}
+
+// FunctionComplexity is the cyclomatic complexity of one function.
+type FunctionComplexity struct {
+	Name       string `json:"name"`
+	Position   string `json:"position"`
+	Complexity int    `json:"complexity"`
+}
+
+// ParseGradeWeights parses "complexity=0.4,docs=0.2,..." into weights. Metrics
+// that are not listed keep their default weight.
+func ParseGradeWeights(spec string) (GradeWeights, error) {
+	weights := DefaultGradeWeights
+	if spec == "" {
+		return weights, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		weight, err := strconv.ParseFloat(value, 64)
+		if !ok || err != nil || weight < 0 {
+			return weights, fmt.Errorf("invalid weight %q (expected metric=number)", part)
+		}
+
+		switch name {
+		case "complexity":
+			weights.Complexity = weight
+		case "docs":
+			weights.Docs = weight
+		case "duplication":
+			weights.Duplication = weight
+		case "formatting":
+			weights.Formatting = weight
+		default:
+			return weights, fmt.Errorf("unknown metric %q (supported: complexity, docs, duplication, formatting)", name)
+		}
+	}
+
+	if weights.Complexity+weights.Docs+weights.Duplication+weights.Formatting == 0 {
+		return weights, fmt.Errorf("at least one weight must be positive")
+	}
+	return weights, nil
+}
+
+// ValidGrade reports whether grade is one of A through F.
+func ValidGrade(grade string) bool {
+	for _, g := range gradeScores {
+		if g.Grade == grade {
+			return true
+		}
+	}
+	return false
+}
+
+// GradeBelow reports whether grade is worse than minimum.
+func GradeBelow(grade string, minimum string) bool {
+	return strings.Compare(grade, minimum) > 0
+}
+
+// ComputeScore combines the report's metrics into a weighted score from 0 to 100.
+func ComputeScore(report QualityReport) float64 {
+	weights := report.Weights
+	if weights == (GradeWeights{}) {
+		weights = DefaultGradeWeights
+	}
+
+	// Average complexity of 5 or less is ideal; 15 or more scores nothing
+	complexity := clampScore(100 - (report.AverageComplexity-5)*10)
+	// Each percent of duplication costs 5 points
+	duplication := clampScore(100 - report.Duplication*5)
+
+	total := weights.Complexity + weights.Docs + weights.Duplication + weights.Formatting
+	score := weights.Complexity*complexity +
+		weights.Docs*report.DocCoverage +
+		weights.Duplication*duplication +
+		weights.Formatting*report.FormattingCompliance
+
+	return score / total
+}
+
+// ComputeGrade returns the letter grade (A–F) for the report's weighted score.
+func ComputeGrade(report QualityReport) string {
+	score := ComputeScore(report)
+	for _, g := range gradeScores {
+		if score >= g.Min {
+			return g.Grade
+		}
+	}
+	return "F"
+}
+
+// clampScore limits a score to the range 0–100.
+func clampScore(score float64) float64 {
+	return math.Max(0, math.Min(100, score))
+}
+
+// collectQuality measures every Go file under the loader's directory that
+// passes the exclude patterns and is not generated.
+func collectQuality(loader *packageLoader, exclude []string) (QualityReport, WalkStats, error) {
+	absPath := loader.dir
+	var report QualityReport
+	var complexitySum int
+	var formatted int
+	windows := make(map[string][]lineRef)
+	fileLines := make(map[string][]string)
+
+	stats, err := walkGoFiles(absPath, exclude, nil, func(path string, info os.FileInfo) error {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(absPath, path)
+
+		// Formatting compliance
+		if out, err := format.Source(src); err == nil && bytes.Equal(out, src) {
+			formatted++
+		} else {
+			report.UnformattedFiles = append(report.UnformattedFiles, rel)
+		}
+
+		file, err := loader.parseSource(path, src)
+		if err != nil {
+			// Unparseable files still count toward formatting and duplication
+			fmt.Fprintf(os.Stderr, "WARNING: %v\n", err)
+		} else {
+			for _, fn := range functionComplexities(absPath, loader.fset, file) {
+				report.Functions++
+				complexitySum += fn.Complexity
+				if fn.Complexity > complexityThreshold {
+					report.ComplexFunctions = append(report.ComplexFunctions, fn)
+				}
+			}
+			if !strings.HasSuffix(path, "_test.go") {
+				exported, documented := docCounts(file)
+				report.Exported += exported
+				report.Documented += documented
+			}
+		}
+
+		lines := normalizedLines(src)
+		fileLines[rel] = lines
+		addWindows(windows, rel, lines)
+		return nil
+	})
+	if err != nil {
+		return report, stats, err
+	}
+
+	report.Files = stats.Files
+	if report.Functions > 0 {
+		report.AverageComplexity = float64(complexitySum) / float64(report.Functions)
+	}
+	report.DocCoverage = 100
+	if report.Exported > 0 {
+		report.DocCoverage = float64(report.Documented) / float64(report.Exported) * 100
+	}
+	report.FormattingCompliance = 100
+	if stats.Files > 0 {
+		report.FormattingCompliance = float64(formatted) / float64(stats.Files) * 100
+	}
+	report.DuplicatedLines, report.TotalLines = countDuplicated(windows, fileLines)
+	if report.TotalLines > 0 {
+		report.Duplication = float64(report.DuplicatedLines) / float64(report.TotalLines) * 100
+	}
+
+	sort.Slice(report.ComplexFunctions, func(i, j int) bool {
+		return report.ComplexFunctions[i].Complexity > report.ComplexFunctions[j].Complexity
+	})
+
+	return report, stats, nil
+}
+
+// functionComplexities returns the cyclomatic complexity of each function in file.
+func functionComplexities(absPath string, fset *token.FileSet, file *ast.File) []FunctionComplexity {
+	var result []FunctionComplexity
+	eachFunction(file, func(fn *ast.FuncDecl, name string) {
+		result = append(result, FunctionComplexity{
+			Name:       name,
+			Position:   relPosition(absPath, fset, fn.Pos()),
+			Complexity: cyclomatic(fn.Body),
+		})
+	})
+	return result
+}
+
+// findComplexFunctions reports the functions whose cyclomatic complexity is
+// above complexityThreshold.
+func findComplexFunctions(loader *packageLoader, exclude []string) ([]Finding, error) {
+	absPath := loader.dir
+	findings := []Finding{}
+
+	_, err := walkGoFiles(absPath, exclude, nil, func(path string, info os.FileInfo) error {
+		file, err := loader.parseFile(path)
+		if err != nil {
+			// Unparseable files are reported by the other checks
+			return nil
+		}
+		eachFunction(file, func(fn *ast.FuncDecl, name string) {
+			if complexity := cyclomatic(fn.Body); complexity > complexityThreshold {
+				findings = append(findings, newFinding(absPath, loader.fset, fn.Pos(), RuleComplexity, "low",
+					"%s has cyclomatic complexity %d (above %d); consider breaking it down", name, complexity, complexityThreshold))
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory: %w", err)
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+// eachFunction calls fn for every function with a body in file, passing its
+// name qualified with the receiver type for methods.
+func eachFunction(file *ast.File, fn func(decl *ast.FuncDecl, name string)) {
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Body == nil {
+			continue
+		}
+
+		name := funcDecl.Name.Name
+		if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
+			name = receiverName(funcDecl.Recv.List[0].Type) + "." + name
+		}
+		fn(funcDecl, name)
+	}
+}
+
+// receiverName returns the type name of a method receiver.
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return "?"
+}
+
+// cyclomatic counts decision points in a function body, plus one.
+func cyclomatic(body *ast.BlockStmt) int {
+	complexity := 1
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			complexity++
+		case *ast.CaseClause:
+			// The default clause is not a decision
+			if n.List != nil {
+				complexity++
+			}
+		case *ast.CommClause:
+			if n.Comm != nil {
+				complexity++
+			}
+		case *ast.BinaryExpr:
+			if n.Op == token.LAND || n.Op == token.LOR {
+				complexity++
+			}
+		}
+		return true
+	})
+	return complexity
+}
+
+// docCounts returns the number of exported top-level declarations in file and
+// how many of them have a doc comment.
+func docCounts(file *ast.File) (int, int) {
+	exported, documented := 0, 0
+	eachExported(file, func(_ *ast.Ident, doc bool) {
+		exported++
+		if doc {
+			documented++
+		}
+	})
+	return exported, documented
+}
+
+// eachExported calls fn with the name of every exported declaration of
+// file that is part of the API, and whether it is documented.
+func eachExported(file *ast.File, fn func(name *ast.Ident, documented bool)) {
+	visit := func(name *ast.Ident, docs ...*ast.CommentGroup) {
+		if name.IsExported() {
+			fn(name, slices.ContainsFunc(docs, func(doc *ast.CommentGroup) bool { return doc != nil }))
+		}
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			// Methods on unexported types are not part of the API
+			if d.Recv != nil && len(d.Recv.List) > 0 && !ast.IsExported(receiverName(d.Recv.List[0].Type)) {
+				continue
+			}
+			visit(d.Name, d.Doc)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					visit(sp.Name, sp.Doc, d.Doc)
+				case *ast.ValueSpec:
+					// A documented group covers its members
+					for _, name := range sp.Names {
+						visit(name, sp.Doc, d.Doc)
+					}
+				}
+			}
+		}
+	}
+}
+
+// lineRef locates the first line of a window of normalized lines.
+type lineRef struct {
+	file  string
+	start int
+}
+
+// normalizedLines returns the significant lines of src with surrounding space
+// removed; blank lines, comments, and lone brackets are dropped.
+func normalizedLines(src []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") || strings.Trim(line, "{}()[],;") == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// addWindows records every window of duplicateWindow lines in a file.
+func addWindows(windows map[string][]lineRef, file string, lines []string) {
+	for i := 0; i+duplicateWindow <= len(lines); i++ {
+		key := strings.Join(lines[i:i+duplicateWindow], "\n")
+		windows[key] = append(windows[key], lineRef{file: file, start: i})
+	}
+}
+
+// countDuplicated returns the number of lines covered by a window that occurs
+// more than once, and the total number of significant lines.
+func countDuplicated(windows map[string][]lineRef, fileLines map[string][]string) (int, int) {
+	marked := make(map[string][]bool)
+	total := 0
+	for file, lines := range fileLines {
+		marked[file] = make([]bool, len(lines))
+		total += len(lines)
+	}
+
+	for _, refs := range windows {
+		if len(refs) < 2 {
+			continue
+		}
+		for _, ref := range refs {
+			for i := ref.start; i < ref.start+duplicateWindow; i++ {
+				marked[ref.file][i] = true
+			}
+		}
+	}
+
+	duplicated := 0
+	for _, lines := range marked {
+		for _, dup := range lines {
+			if dup {
+				duplicated++
+			}
+		}
+	}
+	return duplicated, total
+}
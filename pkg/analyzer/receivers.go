@@ -0,0 +1,172 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"goforge/pkg/logging"
+)
+
+// RuleMixedReceivers reports types whose methods mix value and pointer
+// receivers.
+const RuleMixedReceivers = "mixed-receivers"
+
+// receiverMethod is a method and the kind of its receiver.
+type receiverMethod struct {
+	name    string
+	pointer bool
+	pos     token.Pos
+}
+
+// CheckReceiverConsistency reports the types under path whose methods mix
+// value and pointer receivers. The method set of the value then lacks the
+// pointer methods, so the value satisfies fewer interfaces than the pointer,
+// and value methods work on a copy the pointer methods do not see. Each type
+// is reported once, at the first method of the less common kind, naming the
+// methods of that kind. Pointer-receiver Unmarshal*, GobDecode, and Scan
+// methods, which must modify the receiver, do not count as a mix.
+func CheckReceiverConsistency(path string) ([]Finding, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return findMixedReceivers(newLoader(absPath), nil)
+}
+
+// findMixedReceivers checks every non-test Go file under the loader's
+// directory, grouping the methods of each package by receiver base type.
+func findMixedReceivers(loader *packageLoader, exclude []string) ([]Finding, error) {
+	absPath := loader.dir
+	// Keyed by package directory and type name
+	methods := make(map[string][]receiverMethod)
+	var order []string
+
+	_, err := walkGoFiles(absPath, exclude, nil, func(path string, info os.FileInfo) error {
+		if strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := loader.parseFile(path)
+		if err != nil {
+			// Unparseable files are reported by the other checks
+			return nil
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || len(fn.Recv.List) == 0 {
+				continue
+			}
+			typeName, pointer := receiverBase(fn.Recv.List[0].Type)
+			if typeName == "" || (pointer && modifiesReceiver(fn.Name.Name)) {
+				continue
+			}
+			key := filepath.Dir(path) + "\x00" + typeName
+			if _, seen := methods[key]; !seen {
+				order = append(order, key)
+			}
+			methods[key] = append(methods[key], receiverMethod{name: fn.Name.Name, pointer: pointer, pos: fn.Pos()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []Finding{}
+	for _, key := range order {
+		var values, pointers []receiverMethod
+		for _, method := range methods[key] {
+			if method.pointer {
+				pointers = append(pointers, method)
+			} else {
+				values = append(values, method)
+			}
+		}
+		if len(values) == 0 || len(pointers) == 0 {
+			continue
+		}
+
+		// The less common kind is the odd one out; on a tie, the value
+		// methods, as a type with any pointer methods is used by pointer
+		odd, oddKind, usual, usualKind := values, "value", pointers, "pointer"
+		if len(pointers) < len(values) {
+			odd, oddKind, usual, usualKind = pointers, "pointer", values, "value"
+		}
+		for _, kind := range [][]receiverMethod{odd, usual} {
+			sort.Slice(kind, func(i, j int) bool { return kind[i].pos < kind[j].pos })
+		}
+
+		_, typeName, _ := strings.Cut(key, "\x00")
+		findings = append(findings, newFinding(absPath, loader.fset, odd[0].pos, RuleMixedReceivers, "medium",
+			"%s mixes receivers: %s on %s, %s on %s; use one kind for all its methods",
+			typeName, oddKind, methodNames(odd), usualKind, methodNames(usual)))
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+// receiverBase returns the name of a receiver's base type and whether the
+// receiver is a pointer, seeing through type parameters.
+func receiverBase(expr ast.Expr) (string, bool) {
+	pointer := false
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr, pointer = star.X, true
+	}
+	switch index := expr.(type) {
+	case *ast.IndexExpr:
+		expr = index.X
+	case *ast.IndexListExpr:
+		expr = index.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name, pointer
+	}
+	return "", false
+}
+
+// modifiesReceiver reports whether a method of this name implements an
+// interface that decodes into its receiver, so needs a pointer receiver
+// whatever the type's other methods use.
+func modifiesReceiver(name string) bool {
+	return strings.HasPrefix(name, "Unmarshal") || name == "GobDecode" || name == "Scan"
+}
+
+// methodNames lists the names of methods in order.
+func methodNames(methods []receiverMethod) string {
+	names := make([]string, len(methods))
+	for i, method := range methods {
+		names[i] = method.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// AnalyzeReceivers prints the types under path whose methods mix value and
+// pointer receivers, skipping files that match exclude.
+func AnalyzeReceivers(path string, exclude []string) error {
+	logging.Infoln("Analyzing method receivers at:", path)
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	findings, err := findMixedReceivers(newLoader(absPath), exclude)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nTypes Mixing Value and Pointer Receivers (%d):\n", len(findings))
+	if len(findings) == 0 {
+		fmt.Println("- None")
+	}
+	for _, finding := range findings {
+		fmt.Printf("- %s: %s\n", finding.Position(), finding.Message)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// RuleSilentRecover reports recovered panics that are neither logged nor
+// re-raised.
+const RuleSilentRecover = "silent-recover"
+
+// FindSilentRecovers reports recover() calls that swallow the panic: those
+// whose result is discarded, assigned to _, or kept in a variable that is
+// only compared with nil, unless the branch taken on a panic calls a
+// function or assigns a variable, as logging it or setting the returned
+// error does. Any other use of the recovered value, such as passing it to
+// a function, returning it, or storing it, counts as handling it. Test
+// files are not checked.
+func FindSilentRecovers(path string) ([]Finding, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return findSilentRecovers(newLoader(absPath), nil)
+}
+
+// findSilentRecovers checks every non-test Go file under absPath.
+func findSilentRecovers(loader *packageLoader, exclude []string) ([]Finding, error) {
+	absPath := loader.dir
+	findings := []Finding{}
+
+	_, err := walkGoFiles(absPath, exclude, nil, func(path string, info os.FileInfo) error {
+		if strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := loader.parseFile(path)
+		if err != nil {
+			// Unparseable files are reported by the other checks
+			return nil
+		}
+
+		preorderStack(file, func(n ast.Node, stack []ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || !isRecoverCall(call) {
+				return true
+			}
+			if message := silentRecover(call, stack); message != "" {
+				findings = append(findings, newFinding(absPath, loader.fset, call.Pos(), RuleSilentRecover, "high",
+					"%s; log it, return it as an error, or re-panic", message))
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory: %w", err)
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+// isRecoverCall reports whether call calls the recover builtin, rather
+// than a function of the package or a local variable named recover.
+func isRecoverCall(call *ast.CallExpr) bool {
+	ident, ok := astutil.Unparen(call.Fun).(*ast.Ident)
+	return ok && ident.Name == "recover" && ident.Obj == nil && len(call.Args) == 0
+}
+
+// silentRecover returns why the recover() call, whose ancestors are stack,
+// swallows the panic, or "" when the recovered value is handled.
+func silentRecover(call *ast.CallExpr, stack []ast.Node) string {
+	var expr ast.Expr = call
+	i := len(stack) - 1
+	for ; i >= 0; i-- {
+		if paren, ok := stack[i].(*ast.ParenExpr); ok {
+			expr = paren
+			continue
+		}
+		break
+	}
+	if i < 0 {
+		return ""
+	}
+	body := enclosingBody(stack[:i])
+
+	switch parent := stack[i].(type) {
+	case *ast.ExprStmt:
+		return "recover() discards the panic"
+	case *ast.AssignStmt:
+		if len(parent.Lhs) != len(parent.Rhs) {
+			return ""
+		}
+		for j, rhs := range parent.Rhs {
+			if rhs == expr {
+				return silentRecoveredValue(parent.Lhs[j], body)
+			}
+		}
+	case *ast.ValueSpec:
+		if len(parent.Names) != len(parent.Values) {
+			return ""
+		}
+		for j, value := range parent.Values {
+			if value == expr {
+				return silentRecoveredValue(parent.Names[j], body)
+			}
+		}
+	case *ast.BinaryExpr:
+		if !recoveredOnPanic(parent, stack[:i]) {
+			return "recover() is only compared with nil"
+		}
+	}
+	return ""
+}
+
+// silentRecoveredValue returns why the recovered value assigned to lhs in
+// body is swallowed, or "" when it is handled.
+func silentRecoveredValue(lhs ast.Expr, body *ast.BlockStmt) string {
+	ident, ok := lhs.(*ast.Ident)
+	switch {
+	case !ok:
+		// Stored in a field or an element
+		return ""
+	case ident.Name == "_":
+		return "recover() is assigned to _, discarding the panic"
+	case ident.Obj == nil || body == nil:
+		return ""
+	}
+
+	handled := false
+	preorderStack(body, func(n ast.Node, stack []ast.Node) bool {
+		use, ok := n.(*ast.Ident)
+		if handled || !ok || use == ident || use.Obj != ident.Obj {
+			return !handled
+		}
+		switch parent := stack[len(stack)-1].(type) {
+		case *ast.ValueSpec:
+			if slices.Contains(parent.Names, use) {
+				// The declaration of a variable assigned later
+				return true
+			}
+		case *ast.AssignStmt:
+			if isAssignedTo(parent, use) || assignedToBlank(parent, use) {
+				return true
+			}
+		case *ast.BinaryExpr:
+			if isNilComparison(parent) {
+				handled = recoveredOnPanic(parent, stack[:len(stack)-1])
+				return true
+			}
+		}
+		handled = true
+		return false
+	})
+	if handled {
+		return ""
+	}
+	return fmt.Sprintf("the recovered value %s is dropped", ident.Name)
+}
+
+// recoveredOnPanic reports whether the nil comparison of a recovered value,
+// whose ancestors are stack, leads to a branch that handles the panic. A
+// comparison outside an if condition, or checking for no panic, counts as
+// handled, since what happens next cannot be told apart.
+func recoveredOnPanic(cmp *ast.BinaryExpr, stack []ast.Node) bool {
+	if !isNilComparison(cmp) {
+		return true
+	}
+	var child ast.Node = cmp
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch parent := stack[i].(type) {
+		case *ast.ParenExpr:
+			child = parent
+			continue
+		case *ast.IfStmt:
+			if parent.Cond != child || cmp.Op != token.NEQ {
+				return true
+			}
+			return handlesPanic(parent.Body)
+		}
+		return true
+	}
+	return true
+}
+
+// handlesPanic reports whether block does anything with a panic: calls a
+// function, such as a logger or panic, or assigns a variable, such as the
+// returned error.
+func handlesPanic(block *ast.BlockStmt) bool {
+	handles := false
+	ast.Inspect(block, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr, *ast.SendStmt, *ast.IncDecStmt:
+			handles = true
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				if ident, ok := lhs.(*ast.Ident); !ok || ident.Name != "_" {
+					handles = true
+				}
+			}
+		}
+		return !handles
+	})
+	return handles
+}
+
+// isNilComparison reports whether cmp compares a value with nil.
+func isNilComparison(cmp *ast.BinaryExpr) bool {
+	if cmp.Op != token.EQL && cmp.Op != token.NEQ {
+		return false
+	}
+	for _, operand := range []ast.Expr{cmp.X, cmp.Y} {
+		if ident, ok := astutil.Unparen(operand).(*ast.Ident); ok && ident.Name == "nil" {
+			return true
+		}
+	}
+	return false
+}
+
+// isAssignedTo reports whether ident is assigned to by assign.
+func isAssignedTo(assign *ast.AssignStmt, ident *ast.Ident) bool {
+	return slices.Contains(assign.Lhs, ast.Expr(ident))
+}
+
+// assignedToBlank reports whether assign assigns ident to _.
+func assignedToBlank(assign *ast.AssignStmt, ident *ast.Ident) bool {
+	if len(assign.Lhs) != len(assign.Rhs) {
+		return false
+	}
+	for i, rhs := range assign.Rhs {
+		if rhs == ident {
+			blank, ok := assign.Lhs[i].(*ast.Ident)
+			return ok && blank.Name == "_"
+		}
+	}
+	return false
+}
+
+// enclosingBody returns the body of the innermost function in stack.
+func enclosingBody(stack []ast.Node) *ast.BlockStmt {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch fn := stack[i].(type) {
+		case *ast.FuncLit:
+			return fn.Body
+		case *ast.FuncDecl:
+			return fn.Body
+		}
+	}
+	return nil
+}
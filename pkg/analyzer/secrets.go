@@ -0,0 +1,173 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RuleHardcodedSecret reports credentials written into the source.
+const RuleHardcodedSecret = "hardcoded-secret"
+
+// secretNameRe matches identifiers that usually hold credentials.
+var secretNameRe = regexp.MustCompile(`(?i)(api_?key|secret|token|passw(or)?d|pwd|credential|private_?key|access_?key)`)
+
+// describesSecretRe matches names of things about a credential rather than
+// the credential itself, e.g. tokenEnv or passwordHeader.
+var describesSecretRe = regexp.MustCompile(`(?i)(env|var|header|name|field|param|path|file|url|prefix|type|kind|len|length|pattern|format|endpoint)$`)
+
+// secretPatterns match well-known credential formats in any string literal.
+var secretPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"an AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"a GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"a Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"a Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"a Stripe live key", regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{20,}\b`)},
+	{"a private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{"a URL with an embedded password", regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^/\s:@]+:[^/\s:@$%{]{3,}@`)},
+}
+
+// identifierLikeRe matches values that name something, such as the
+// environment variable "API_TOKEN" or the rule "hardcoded-secret", rather
+// than hold a secret.
+var identifierLikeRe = regexp.MustCompile(`^([A-Z][A-Z0-9_]*|[a-z]+([-_.][a-z]+)+)$`)
+
+// FindHardcodedSecrets reports string literals that look like credentials:
+// values in a well-known token format anywhere, and plausible secrets
+// assigned to or compared with variables, fields, and keys named like
+// apiKey, token, or password. Test files are only checked for the
+// well-known formats, since they commonly hold fake passwords.
+func FindHardcodedSecrets(path string) ([]Finding, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return findHardcodedSecrets(newLoader(absPath), nil)
+}
+
+// findHardcodedSecrets checks every Go file under absPath for secrets.
+func findHardcodedSecrets(loader *packageLoader, exclude []string) ([]Finding, error) {
+	absPath := loader.dir
+	findings := []Finding{}
+
+	_, err := walkGoFiles(absPath, exclude, nil, func(path string, info os.FileInfo) error {
+		file, err := loader.parseFile(path)
+		if err != nil {
+			// Unparseable files are reported by the other checks
+			return nil
+		}
+		isTest := strings.HasSuffix(path, "_test.go")
+
+		reported := make(map[*ast.BasicLit]bool)
+		report := func(lit *ast.BasicLit, format string, args ...any) {
+			if !reported[lit] {
+				reported[lit] = true
+				findings = append(findings, newFinding(absPath, loader.fset, lit.Pos(), RuleHardcodedSecret, "high", format, args...))
+			}
+		}
+		// named checks a literal assigned to or compared with something
+		// called name
+		named := func(name string, expr ast.Expr, verb string) {
+			lit, value := stringLit(expr)
+			if lit == nil || isTest || !secretNameRe.MatchString(name) || describesSecretRe.MatchString(name) || !plausibleSecret(value) {
+				return
+			}
+			report(lit, "%s is %s a hardcoded credential (%s); load it from the environment or a secret store", name, verb, redact(value))
+		}
+
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.AssignStmt:
+				if len(node.Lhs) == len(node.Rhs) {
+					for i, lhs := range node.Lhs {
+						named(exprName(lhs), node.Rhs[i], "set to")
+					}
+				}
+			case *ast.ValueSpec:
+				for i, name := range node.Names {
+					if i < len(node.Values) {
+						named(name.Name, node.Values[i], "set to")
+					}
+				}
+			case *ast.KeyValueExpr:
+				name := exprName(node.Key)
+				if _, key := stringLit(node.Key); key != "" {
+					name = key
+				}
+				named(name, node.Value, "set to")
+			case *ast.BinaryExpr:
+				if node.Op == token.EQL || node.Op == token.NEQ {
+					named(exprName(node.X), node.Y, "compared with")
+					named(exprName(node.Y), node.X, "compared with")
+				}
+			case *ast.BasicLit:
+				_, value := stringLit(node)
+				for _, pattern := range secretPatterns {
+					if match := pattern.re.FindString(value); match != "" {
+						report(node, "string contains %s (%s); load it from the environment or a secret store", pattern.kind, redact(match))
+						break
+					}
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory: %w", err)
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+// stringLit returns expr and its value when it is a string literal.
+func stringLit(expr ast.Expr) (*ast.BasicLit, string) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return nil, ""
+	}
+	value, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return nil, ""
+	}
+	return lit, value
+}
+
+// exprName returns the name of an identifier or the selected name of a
+// selector such as cfg.Password.
+func exprName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	return ""
+}
+
+// plausibleSecret reports whether a value assigned to a credential-named
+// variable could be a real secret. Short values, sentences, identifiers,
+// and templates are left alone.
+func plausibleSecret(value string) bool {
+	if len(value) < 8 || strings.ContainsAny(value, " \t\n%${}<>") {
+		return false
+	}
+	return !identifierLikeRe.MatchString(value)
+}
+
+// redact shows only the first characters of a secret.
+func redact(value string) string {
+	if len(value) <= 4 {
+		return `"..."`
+	}
+	return strconv.Quote(value[:4] + "...")
+}
@@ -0,0 +1,264 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/tools/go/packages"
+)
+
+// Rules of the variable checks.
+const (
+	RuleShadowedVariable = "shadowed-variable"
+	RuleUnusedVariable   = "unused-variable"
+)
+
+// findShadowed reports local variables that hide a variable of an enclosing
+// function scope which is read, before being assigned again, after the scope
+// of the inner one ends: a value meant for the outer variable may be lost. The 'x := x'
+// copy idiom is not reported.
+func findShadowed(pkgs []*packages.Package, absPath string, exclude []string) []Finding {
+	findings := []Finding{}
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			if skipFile(absPath, pkg.Fset.Position(file.Pos()).Filename, exclude) {
+				continue
+			}
+
+			copies := selfCopies(file)
+			accesses := localAccesses(pkg.TypesInfo, file)
+			ast.Inspect(file, func(n ast.Node) bool {
+				ident, ok := n.(*ast.Ident)
+				if !ok || ident.Name == "_" || copies[ident] {
+					return true
+				}
+
+				obj, ok := pkg.TypesInfo.Defs[ident].(*types.Var)
+				if !ok || obj.IsField() || obj.Parent() == nil {
+					return true
+				}
+
+				outer := lookupOuter(obj)
+				if outer == nil || !readAfter(accesses[outer], obj.Parent().End()) {
+					return true
+				}
+
+				findings = append(findings, newFinding(absPath, pkg.Fset, ident.Pos(), RuleShadowedVariable, "low",
+					"%s shadows declaration at %s", ident.Name, relPosition(absPath, pkg.Fset, outer.Pos())))
+				return true
+			})
+		}
+	}
+
+	sortFindings(findings)
+	return findings
+}
+
+// access is a read or a store of a local variable.
+type access struct {
+	pos   token.Pos
+	write bool
+}
+
+// localAccesses returns the reads and stores of each local variable of file.
+// An assignment stores once its right-hand side is evaluated, so its stores
+// are placed at the end of the statement.
+func localAccesses(info *types.Info, file *ast.File) map[types.Object][]access {
+	accesses := make(map[types.Object][]access)
+	preorderStack(file, func(n ast.Node, stack []ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		v, ok := info.Uses[ident].(*types.Var)
+		if !ok || v.IsField() || !isLocal(v) {
+			return true
+		}
+		a := access{pos: ident.Pos(), write: isWrite(info, ident, stack)}
+		if a.write {
+			for i := len(stack) - 1; i >= 0; i-- {
+				if assign, ok := stack[i].(*ast.AssignStmt); ok {
+					a.pos = assign.End()
+					break
+				}
+			}
+		}
+		accesses[v] = append(accesses[v], a)
+		return true
+	})
+	return accesses
+}
+
+// readAfter reports whether the first of the accesses at or after end is a
+// read, which sees the value the variable had when end was reached.
+func readAfter(accesses []access, end token.Pos) bool {
+	var first *access
+	for i, a := range accesses {
+		if a.pos >= end && (first == nil || a.pos < first.pos) {
+			first = &accesses[i]
+		}
+	}
+	return first != nil && !first.write
+}
+
+// lookupOuter returns the local variable that obj hides, if any. Package-level
+// and universe objects are not considered, since hiding them is routine.
+func lookupOuter(obj *types.Var) types.Object {
+	scope := obj.Parent().Parent()
+	if scope == nil {
+		return nil
+	}
+
+	_, outer := scope.LookupParent(obj.Name(), obj.Pos())
+	if _, ok := outer.(*types.Var); !ok {
+		return nil
+	}
+
+	// Only variables declared inside a function count
+	parent := outer.Parent()
+	if parent == nil || parent == types.Universe || parent == outer.Pkg().Scope() {
+		return nil
+	}
+
+	return outer
+}
+
+// selfCopies collects identifiers defined by 'x := x' style assignments.
+func selfCopies(file *ast.File) map[*ast.Ident]bool {
+	copies := make(map[*ast.Ident]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || assign.Tok != token.DEFINE || len(assign.Lhs) != len(assign.Rhs) {
+			return true
+		}
+		for i, lhs := range assign.Lhs {
+			left, ok := lhs.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			if right, ok := assign.Rhs[i].(*ast.Ident); ok && right.Name == left.Name {
+				copies[left] = true
+			}
+		}
+		return true
+	})
+	return copies
+}
+
+// findUnusedLocals reports local variables that are assigned but never
+// read, such as a counter that is only incremented. The compiler rejects
+// variables that are never used at all, but counts a field assignment, an
+// increment, or an op-assignment as a use. Parameters and named results are
+// not reported.
+func findUnusedLocals(pkgs []*packages.Package, absPath string, exclude []string) []Finding {
+	findings := []Finding{}
+
+	for _, pkg := range pkgs {
+		info := pkg.TypesInfo
+		for _, file := range pkg.Syntax {
+			if skipFile(absPath, pkg.Fset.Position(file.Pos()).Filename, exclude) {
+				continue
+			}
+
+			signature := make(map[*types.Var]bool)
+			writes := make(map[*types.Var]int)
+			reads := make(map[*types.Var]int)
+			preorderStack(file, func(n ast.Node, stack []ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.FuncType:
+					for _, list := range []*ast.FieldList{n.Params, n.Results} {
+						for _, field := range fieldsOf(list) {
+							for _, name := range field.Names {
+								if v, ok := info.Defs[name].(*types.Var); ok {
+									signature[v] = true
+								}
+							}
+						}
+					}
+				case *ast.Ident:
+					v, ok := info.Uses[n].(*types.Var)
+					if !ok || v.IsField() || !isLocal(v) {
+						return true
+					}
+					if isWrite(info, n, stack) {
+						writes[v]++
+					} else {
+						reads[v]++
+					}
+				}
+				return true
+			})
+
+			for v := range writes {
+				if reads[v] > 0 || signature[v] || v.Name() == "_" {
+					continue
+				}
+				findings = append(findings, newFinding(absPath, pkg.Fset, v.Pos(), RuleUnusedVariable, "medium",
+					"%s is assigned but never read", v.Name()))
+			}
+		}
+	}
+
+	sortFindings(findings)
+	return findings
+}
+
+// fieldsOf returns the fields of list, which may be nil.
+func fieldsOf(list *ast.FieldList) []*ast.Field {
+	if list == nil {
+		return nil
+	}
+	return list.List
+}
+
+// isLocal reports whether v is declared inside a function.
+func isLocal(v *types.Var) bool {
+	parent := v.Parent()
+	return parent != nil && parent != types.Universe && v.Pkg() != nil && parent != v.Pkg().Scope()
+}
+
+// isWrite reports whether ident, enclosed by stack, is only stored to: it is
+// assigned, incremented, or op-assigned, directly or through a field of a
+// struct value or an element of an array value. Stores through pointers,
+// slices, and maps are visible elsewhere, so they count as reads.
+func isWrite(info *types.Info, ident *ast.Ident, stack []ast.Node) bool {
+	var target ast.Expr = ident
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch parent := stack[i].(type) {
+		case *ast.ParenExpr:
+			target = parent
+		case *ast.SelectorExpr:
+			sel, ok := info.Selections[parent]
+			if parent.X != target || !ok || sel.Kind() != types.FieldVal || sel.Indirect() || isPointer(info.TypeOf(parent.X)) {
+				return false
+			}
+			target = parent
+		case *ast.IndexExpr:
+			if parent.X != target {
+				return false
+			}
+			if _, ok := info.TypeOf(parent.X).Underlying().(*types.Array); !ok {
+				return false
+			}
+			target = parent
+		case *ast.AssignStmt:
+			return slices.Contains(parent.Lhs, target)
+		case *ast.IncDecStmt:
+			return parent.X == target
+		case *ast.RangeStmt:
+			return parent.Key == target || parent.Value == target
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// isPointer reports whether t is a pointer type.
+func isPointer(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Pointer)
+	return ok
+}
@@ -0,0 +1,111 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const unusedSource = `package sample
+
+type point struct{ x, y int }
+
+func (p *point) move() { p.x++ }
+
+func count(items []string) (n int) {
+	seen := 0
+	for range items {
+		seen++
+	}
+	var total int
+	total += len(items)
+	var p point
+	p.x = 1
+	var arr [2]int
+	arr[0] = 1
+
+	var q point
+	q.move()
+	s := make([]int, 1)
+	s[0] = 1
+	ptr := &point{}
+	ptr.y = 2
+	used := len(items)
+	n = used
+	return
+}
+`
+
+const shadowSource = `package sample
+
+import "errors"
+
+func check(parts []string) error {
+	err := errors.New("outer")
+	if len(parts) > 0 {
+		err := errors.New("lost")
+		_ = err
+	}
+	if err != nil {
+		return err
+	}
+
+	var result error
+	if len(parts) > 1 {
+		result := errors.New("scoped")
+		_ = result
+	}
+	result = errors.New("reassigned")
+
+	walk := func(err error) error { return err }
+	err = walk(nil)
+	return errors.Join(err, result)
+}
+`
+
+func TestFindUnusedLocals(t *testing.T) {
+	want := []string{
+		"seen is assigned but never read",
+		"total is assigned but never read",
+		"p is assigned but never read",
+		"arr is assigned but never read",
+	}
+	checkFindings(t, unusedSource, RuleUnusedVariable, want)
+}
+
+func TestFindShadowed(t *testing.T) {
+	want := []string{
+		"err shadows declaration at sample.go:6:2",
+	}
+	checkFindings(t, shadowSource, RuleShadowedVariable, want)
+}
+
+// checkFindings runs rule on a module holding source and compares the
+// messages of its findings with want.
+func checkFindings(t *testing.T, source string, rule string, want []string) {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":    "module example.com/sample\n\ngo 1.20\n",
+		"sample.go": source,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	findings, err := RunAll(dir, []string{rule})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(findings) != len(want) {
+		t.Fatalf("got %d findings, want %d: %v", len(findings), len(want), findings)
+	}
+	for i, finding := range findings {
+		if finding.Message != want[i] {
+			t.Errorf("finding %d: got %q, want %q", i, finding.Message, want[i])
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package analyzer
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// generatedRe matches the standard header marking a file as generated.
+// See https://golang.org/s/generatedcode.
+var generatedRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// WalkStats holds counts of what a walk visited and skipped.
+type WalkStats struct {
+	Dirs      int
+	Files     int
+	Excluded  int
+	Generated int
+}
+
+// walkGoFiles walks the tree rooted at root and calls fn for every Go source file
+// that is not hidden, not matched by an exclude pattern, and not generated code.
+// Directories are reported through dirFn when it is non-nil.
+func walkGoFiles(root string, exclude []string, dirFn func(rel string), fn func(path string, info os.FileInfo) error) (WalkStats, error) {
+	var stats WalkStats
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden files and directories
+		if rel != "." && strings.HasPrefix(filepath.Base(path), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			if rel != "." && isExcluded(rel, true, exclude) {
+				stats.Excluded++
+				return filepath.SkipDir
+			}
+			stats.Dirs++
+			if dirFn != nil {
+				dirFn(rel)
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+
+		if isExcluded(rel, false, exclude) {
+			stats.Excluded++
+			return nil
+		}
+
+		generated, err := isGenerated(path)
+		if err != nil {
+			return err
+		}
+		if generated {
+			stats.Generated++
+			return nil
+		}
+
+		stats.Files++
+		return fn(path, info)
+	})
+
+	return stats, err
+}
+
+// isExcluded reports whether a slash-separated relative path matches any exclude
+// pattern. Patterns ending in "/" only match directories. Patterns without a
+// slash match against the base name at any depth; others match the full path.
+func isExcluded(rel string, isDir bool, patterns []string) bool {
+	rel = filepath.ToSlash(rel)
+	base := filepath.Base(rel)
+
+	for _, pattern := range patterns {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		pattern = strings.TrimSuffix(pattern, "/")
+		if pattern == "" || (dirOnly && !isDir) {
+			continue
+		}
+
+		target := rel
+		if !strings.Contains(pattern, "/") {
+			target = base
+		}
+
+		if matched, _ := filepath.Match(pattern, target); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isGenerated reports whether the file carries a "Code generated ... DO NOT EDIT."
+// comment before its package clause.
+func isGenerated(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			return false, nil
+		}
+		if generatedRe.MatchString(line) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// preorderStack walks the tree rooted at root like ast.Inspect, passing f
+// the enclosing nodes of each node, outermost first. The children of a node
+// are skipped when f returns false.
+func preorderStack(root ast.Node, f func(n ast.Node, stack []ast.Node) bool) {
+	var stack []ast.Node
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if !f(n, stack) {
+			return false
+		}
+		stack = append(stack, n)
+		return true
+	})
+}
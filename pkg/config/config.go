@@ -0,0 +1,100 @@
+// Package config reads the optional .goforge.yaml project configuration,
+// which holds project defaults for settings that are otherwise passed as
+// flags. Flags always take precedence over it.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the configuration file, looked up in the project
+// directory and its parents.
+const FileName = ".goforge.yaml"
+
+// Config is the content of a .goforge.yaml file.
+type Config struct {
+	Container Container `yaml:"container"`
+	Coverage  Coverage  `yaml:"coverage"`
+	Test      Test      `yaml:"test"`
+
+	// Dir is the directory of the file the configuration was read from, to
+	// which the paths in it are relative; it is empty when there is none.
+	Dir string `yaml:"-"`
+}
+
+// Container holds the defaults of the container commands.
+type Container struct {
+	// Templates is the directory of template overrides for the container
+	// generators.
+	Templates string `yaml:"templates"`
+}
+
+// Coverage holds the defaults of the coverage command.
+type Coverage struct {
+	// Packages maps package patterns, such as ./pkg/auth or ./pkg/auth/...,
+	// to the coverage each matching package must reach on its own.
+	Packages map[string]float64 `yaml:"packages"`
+}
+
+// Test holds the defaults of test generation.
+type Test struct {
+	// Style is the style of generated unit tests: std or testify.
+	Style string `yaml:"style"`
+}
+
+// Load reads the .goforge.yaml in path or the nearest parent directory that
+// has one. A project without one gets the zero Config.
+func Load(path string) (Config, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if info, err := os.Stat(absPath); err == nil && !info.IsDir() {
+		absPath = filepath.Dir(absPath)
+	}
+
+	for dir := absPath; ; dir = filepath.Dir(dir) {
+		file := filepath.Join(dir, FileName)
+		if _, err := os.Stat(file); err == nil {
+			return read(file)
+		}
+		if filepath.Dir(dir) == dir {
+			return Config{}, nil
+		}
+	}
+}
+
+// read parses one configuration file.
+func read(file string) (Config, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	// Reject unknown keys so typos don't silently fall back to defaults
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	var config Config
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	config.Dir = filepath.Dir(file)
+	return config, nil
+}
+
+// Path resolves a path from the configuration relative to its file; empty
+// stays empty.
+func (c Config) Path(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.Dir, path)
+}
@@ -0,0 +1,233 @@
+package container
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"goforge/pkg/module"
+
+	"golang.org/x/exp/slices"
+)
+
+// BackingService is a database, cache, or broker the application connects
+// to, run next to it in development.
+type BackingService struct {
+	// Name is the compose service name, which is also its host name.
+	Name  string
+	Image string
+	Port  int
+	// Command overrides the image's command arguments.
+	Command string
+	// Env configures the service's own container.
+	Env []EnvVar
+	// DataDir is where the service keeps its data, kept in a named volume;
+	// empty means the service keeps nothing worth keeping.
+	DataDir string
+	// HealthCheck is the command that reports the service ready, so the
+	// application starts only once it accepts connections.
+	HealthCheck string
+	// Connect are the variables the application may read to connect, in
+	// order of preference, with their values inside the compose network.
+	Connect []EnvVar
+	// modules are the module path prefixes of the clients that use it.
+	modules []string
+}
+
+// Development credentials of the backing services, used when DevOptions
+// leaves them empty; they never leave the developer's machine.
+const (
+	defaultServiceUser     = "app"
+	defaultServicePassword = "app"
+	devDatabase            = "app"
+)
+
+// backingServices returns the services detected from the client modules the
+// project requires, set up with user and password. Postgres comes before
+// MySQL, so DATABASE_URL points at Postgres when a project uses both.
+func backingServices(user string, password string) []BackingService {
+	postgresURL := (&url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(user, password),
+		Host:     "postgres:5432",
+		Path:     "/" + devDatabase,
+		RawQuery: "sslmode=disable",
+	}).String()
+	mysqlDSN := fmt.Sprintf("%s:%s@tcp(mysql:3306)/%s?parseTime=true", user, password, devDatabase)
+	amqpURL := (&url.URL{Scheme: "amqp", User: url.UserPassword(user, password), Host: "rabbitmq:5672", Path: "/"}).String()
+
+	return []BackingService{
+		{
+			Name:        "postgres",
+			Image:       "postgres:16-alpine",
+			Port:        5432,
+			Env:         []EnvVar{{"POSTGRES_USER", user}, {"POSTGRES_PASSWORD", password}, {"POSTGRES_DB", devDatabase}},
+			DataDir:     "/var/lib/postgresql/data",
+			HealthCheck: "pg_isready -U " + user,
+			Connect: []EnvVar{
+				{"DATABASE_URL", postgresURL},
+				{"POSTGRES_URL", postgresURL},
+				{"POSTGRES_DSN", fmt.Sprintf("host=postgres user=%s password=%s dbname=%s sslmode=disable", user, password, devDatabase)},
+				{"PGHOST", "postgres"},
+				{"PGUSER", user},
+				{"PGPASSWORD", password},
+				{"PGDATABASE", devDatabase},
+			},
+			modules: []string{"github.com/lib/pq", "github.com/jackc/pgx", "gorm.io/driver/postgres"},
+		},
+		{
+			Name:        "mysql",
+			Image:       "mysql:8.4",
+			Port:        3306,
+			Env:         []EnvVar{{"MYSQL_USER", user}, {"MYSQL_PASSWORD", password}, {"MYSQL_DATABASE", devDatabase}, {"MYSQL_ROOT_PASSWORD", password}},
+			DataDir:     "/var/lib/mysql",
+			HealthCheck: "mysqladmin ping -h 127.0.0.1 -u " + user + " -p" + password,
+			Connect: []EnvVar{
+				{"DATABASE_URL", mysqlDSN},
+				{"MYSQL_DSN", mysqlDSN},
+				{"MYSQL_URL", mysqlDSN},
+			},
+			modules: []string{"github.com/go-sql-driver/mysql", "gorm.io/driver/mysql"},
+		},
+		{
+			Name:        "mongo",
+			Image:       "mongo:7",
+			Port:        27017,
+			DataDir:     "/data/db",
+			HealthCheck: "mongosh --quiet --eval 'db.runCommand({ ping: 1 })'",
+			Connect: []EnvVar{
+				{"MONGODB_URI", "mongodb://mongo:27017/app"},
+				{"MONGO_URI", "mongodb://mongo:27017/app"},
+				{"MONGO_URL", "mongodb://mongo:27017/app"},
+			},
+			modules: []string{"go.mongodb.org/mongo-driver"},
+		},
+		{
+			Name:        "redis",
+			Image:       "redis:7-alpine",
+			Port:        6379,
+			HealthCheck: "redis-cli ping",
+			Connect: []EnvVar{
+				{"REDIS_URL", "redis://redis:6379/0"},
+				{"REDIS_ADDR", "redis:6379"},
+				{"REDIS_HOST", "redis"},
+			},
+			modules: []string{"github.com/redis/go-redis", "github.com/go-redis/redis", "github.com/gomodule/redigo"},
+		},
+		{
+			Name:        "rabbitmq",
+			Image:       "rabbitmq:3-management-alpine",
+			Port:        5672,
+			Env:         []EnvVar{{"RABBITMQ_DEFAULT_USER", user}, {"RABBITMQ_DEFAULT_PASS", password}},
+			DataDir:     "/var/lib/rabbitmq",
+			HealthCheck: "rabbitmq-diagnostics -q ping",
+			Connect: []EnvVar{
+				{"AMQP_URL", amqpURL},
+				{"RABBITMQ_URL", amqpURL},
+			},
+			modules: []string{"github.com/rabbitmq/amqp091-go", "github.com/streadway/amqp"},
+		},
+		{
+			Name:        "nats",
+			Image:       "nats:2-alpine",
+			Port:        4222,
+			Command:     "--http_port 8222",
+			HealthCheck: "wget -q --spider http://localhost:8222/healthz",
+			Connect:     []EnvVar{{"NATS_URL", "nats://nats:4222"}},
+			modules:     []string{"github.com/nats-io/nats.go"},
+		},
+	}
+}
+
+// DetectBackingServices returns the services whose client modules the
+// go.mod of the project at path requires directly, in a fixed order, set up
+// with user and password; empty means app. A project without go.mod has
+// none.
+func DetectBackingServices(path string, user string, password string) ([]BackingService, error) {
+	root, err := module.FindRoot(path)
+	if err != nil {
+		return nil, nil
+	}
+	requires, err := module.DirectRequires(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == "" {
+		user = defaultServiceUser
+	}
+	if password == "" {
+		password = defaultServicePassword
+	}
+
+	var services []BackingService
+	for _, service := range backingServices(user, password) {
+		if slices.ContainsFunc(service.modules, func(prefix string) bool { return requiresModule(requires, prefix) }) {
+			services = append(services, service)
+		}
+	}
+	return services, nil
+}
+
+// requiresModule reports whether requires holds the module prefix or one of
+// its major versions, e.g. github.com/jackc/pgx/v5.
+func requiresModule(requires map[string]bool, prefix string) bool {
+	for path := range requires {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// connectEnv returns the variables pointing the application at services:
+// for each service, the connection variables the project reads, or its
+// first one when it reads none. A variable already taken by an earlier
+// service or set explicitly is left alone.
+func connectEnv(services []BackingService, detected []string, explicit []EnvVar) []EnvVar {
+	taken := make(map[string]bool)
+	for _, env := range explicit {
+		taken[env.Name] = true
+	}
+
+	var env []EnvVar
+	for _, service := range services {
+		var wired []EnvVar
+		for _, connect := range service.Connect {
+			if slices.Contains(detected, connect.Name) && !taken[connect.Name] {
+				wired = append(wired, connect)
+			}
+		}
+		if len(wired) == 0 && !taken[service.Connect[0].Name] {
+			wired = service.Connect[:1]
+		}
+		for _, connect := range wired {
+			taken[connect.Name] = true
+		}
+		env = append(env, wired...)
+	}
+	return env
+}
+
+// printBackingServices lists the detected services and how the application
+// reaches them.
+func printBackingServices(services []BackingService, env []EnvVar) {
+	if len(services) == 0 {
+		return
+	}
+
+	fmt.Println("Backing services:")
+	for _, service := range services {
+		var names []string
+		for _, connect := range env {
+			if slices.ContainsFunc(service.Connect, func(c EnvVar) bool { return c == connect }) {
+				names = append(names, connect.Name)
+			}
+		}
+		if len(names) == 0 {
+			fmt.Printf("- %s (%s)\n", service.Name, service.Image)
+			continue
+		}
+		fmt.Printf("- %s (%s): %s\n", service.Name, service.Image, strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,160 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"goforge/pkg/safewrite"
+)
+
+// bakeFile is the name of the generated buildx bake file, written next to
+// the Dockerfiles.
+const bakeFile = "docker-bake.hcl"
+
+// bakeTargetRe matches a valid bake target name.
+var bakeTargetRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// BakeTemplate is a buildx bake file that builds the image of every main
+// package in one invocation, sharing the builder stage's cached layers.
+const BakeTemplate = `# Builds the image of every service for every platform; run
+#   docker buildx bake -f {{ .File }}
+# or build some of them with e.g. 'docker buildx bake -f {{ .File }} {{ (index .Targets 0).Name }}'.
+# Set IMAGE_PREFIX (e.g. registry.example.com/team/) and TAG to name the
+# images, and add --push to publish them.
+variable "IMAGE_PREFIX" {
+  default = ""
+}
+
+variable "TAG" {
+  default = "latest"
+}
+
+group "default" {
+  targets = [{{ range $i, $target := .Targets }}{{ if $i }}, {{ end }}"{{ $target.Name }}"{{ end }}]
+}
+{{- range .Targets }}
+
+target "{{ .Name }}" {
+  context    = "{{ $.Context }}"
+  dockerfile = "{{ .Dockerfile }}"
+  tags       = ["${IMAGE_PREFIX}{{ .Image }}:${TAG}"]
+  platforms  = [{{ $.Platforms }}]
+}
+{{- end }}
+`
+
+// dockerfileTarget is a Dockerfile to generate for one main package.
+type dockerfileTarget struct {
+	main   serviceMain
+	output string
+}
+
+// image returns the image name of the target's service: the project name
+// with the binary appended, e.g. shop-api.
+func (t dockerfileTarget) image(appName string) string {
+	return serviceName(appName, t.main.binary)
+}
+
+// serviceName names a service of a monorepo after the project and its
+// binary, e.g. shop-api.
+func serviceName(appName string, binary string) string {
+	return strings.ToLower(appName + "-" + binary)
+}
+
+// dockerfileTargets returns the Dockerfiles to generate: absOutput for the
+// main package, or with AllMains one per main package under cmd/, named
+// after absOutput with the binary appended.
+func dockerfileTargets(absPath string, absOutput string, opts DockerfileOptions) ([]dockerfileTarget, error) {
+	if !opts.AllMains {
+		if opts.Bake {
+			return nil, fmt.Errorf("--bake needs --all-mains")
+		}
+		pkg, binary, err := resolveMain(absPath, opts.Main)
+		if err != nil {
+			return nil, err
+		}
+		main := serviceMain{pkg: pkg, binary: binary, dir: absPath}
+		return []dockerfileTarget{{main: main, output: absOutput}}, nil
+	}
+
+	if opts.Main != "" {
+		return nil, fmt.Errorf("--main and --all-mains cannot be combined")
+	}
+	mains, err := findServiceMains(absPath)
+	if err != nil {
+		return nil, err
+	}
+	var targets []dockerfileTarget
+	for _, main := range mains {
+		if opts.Bake && !bakeTargetRe.MatchString(main.binary) {
+			return nil, fmt.Errorf("%s cannot be a bake target name (letters, digits, '-', and '_')", main.binary)
+		}
+		targets = append(targets, dockerfileTarget{main: main, output: absOutput + "." + main.binary})
+	}
+	return targets, nil
+}
+
+// BakeData holds data for the bake template.
+type BakeData struct {
+	// File is the bake file's name.
+	File string
+	// Context is the project directory, relative to the bake file.
+	Context string
+	// Platforms is the quoted, comma-separated list of platforms.
+	Platforms string
+	Targets   []BakeTarget
+}
+
+// BakeTarget is one target of the bake file. The Dockerfile is relative to
+// the context.
+type BakeTarget struct {
+	Name       string
+	Dockerfile string
+	Image      string
+}
+
+// renderBake renders the bake file building targets, next to their
+// Dockerfiles. Paths in it are relative, so it works from any checkout.
+func renderBake(absPath string, appName string, targets []dockerfileTarget, templates Templates) (safewrite.File, error) {
+	dir := filepath.Dir(targets[0].output)
+	context, err := filepath.Rel(dir, absPath)
+	if err != nil {
+		return safewrite.File{}, fmt.Errorf("failed to locate the project from %s: %w", dir, err)
+	}
+
+	data := BakeData{
+		File:    bakeFile,
+		Context: filepath.ToSlash(context),
+	}
+	var platforms []string
+	for _, platform := range DefaultPlatforms {
+		platforms = append(platforms, fmt.Sprintf("%q", platform))
+	}
+	data.Platforms = strings.Join(platforms, ", ")
+	for _, target := range targets {
+		// The Dockerfile is relative to the context
+		dockerfile, err := filepath.Rel(absPath, target.output)
+		if err != nil {
+			return safewrite.File{}, fmt.Errorf("failed to locate %s from the project: %w", target.output, err)
+		}
+		data.Targets = append(data.Targets, BakeTarget{
+			Name:       target.main.binary,
+			Dockerfile: filepath.ToSlash(dockerfile),
+			Image:      target.image(appName),
+		})
+	}
+
+	tmpl, err := templates.parse(template.New("bake"), TemplateBake)
+	if err != nil {
+		return safewrite.File{}, fmt.Errorf("failed to parse bake template: %w", err)
+	}
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return safewrite.File{}, fmt.Errorf("failed to execute bake template: %w", err)
+	}
+	return safewrite.File{Path: filepath.Join(dir, bakeFile), Data: content.Bytes()}, nil
+}
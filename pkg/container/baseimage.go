@@ -0,0 +1,115 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/proc"
+)
+
+// fallbackBaseImage is the builder image when go.mod has no usable go directive.
+const fallbackBaseImage = "golang:alpine"
+
+// golangTagRe captures the Go version of an official golang image tag.
+var golangTagRe = regexp.MustCompile(`^(?:docker\.io/)?(?:library/)?golang:(\d+\.\d+(?:\.\d+)?)`)
+
+// resolveBaseImage returns the builder image. Without an explicit image it
+// follows go.mod: the toolchain directive if set, else the go directive's
+// minor release. An explicit image whose Go version is older than go.mod
+// requires is kept, with a warning.
+func resolveBaseImage(absPath string, explicit string) (string, error) {
+	root, err := module.FindRoot(absPath)
+	if err != nil {
+		if explicit != "" {
+			return explicit, nil
+		}
+		logging.Infof("Note: no go.mod found, using %s (override with --base)\n", fallbackBaseImage)
+		return fallbackBaseImage, nil
+	}
+
+	goVersion, toolchain, err := module.GoVersion(root)
+	if err != nil {
+		return "", err
+	}
+
+	if explicit != "" {
+		warnOldBase(explicit, goVersion)
+		return explicit, nil
+	}
+
+	tag := goModTag(goVersion, toolchain)
+	if tag == "" {
+		logging.Infof("Note: go.mod has no go directive, using %s (override with --base)\n", fallbackBaseImage)
+		return fallbackBaseImage, nil
+	}
+
+	image := "golang:" + tag + "-alpine"
+	logging.Infof("Using builder image %s to match go.mod\n", image)
+	return image, nil
+}
+
+// goModTag returns the golang image tag matching go.mod: the toolchain
+// directive if set, else the go directive's minor release. It is empty when
+// go.mod sets neither.
+func goModTag(goVersion string, toolchain string) string {
+	if toolchain != "" || goVersion == "" {
+		return toolchain
+	}
+	// The floating minor tag always carries the latest patch release
+	return module.GoLanguage(goVersion)
+}
+
+// warnOldBase warns when a golang image tag provides an older Go than required.
+func warnOldBase(image string, required string) {
+	match := golangTagRe.FindStringSubmatch(image)
+	if match == nil || required == "" {
+		return
+	}
+	if olderGo(match[1], required) {
+		fmt.Fprintf(os.Stderr, "WARNING: base image %s provides Go %s, but go.mod requires go %s\n", image, match[1], required)
+	}
+}
+
+// olderGo reports whether the Go version of an image tag is older than
+// required.
+func olderGo(provided string, required string) bool {
+	// A minor tag such as 1.22 floats to the latest patch, so only the
+	// language version has to match
+	needed := required
+	if strings.Count(provided, ".") == 1 {
+		needed = module.GoLanguage(needed)
+	}
+	return module.CompareGoVersions(provided, needed) < 0
+}
+
+// pinDigest returns image@sha256:... for a registry image, resolving the
+// digest of its manifest list with docker buildx.
+func pinDigest(image string) (string, error) {
+	if image == "scratch" || strings.Contains(image, "@sha256:") {
+		return image, nil
+	}
+
+	if err := checkBuildx(); err != nil {
+		return "", fmt.Errorf("cannot pin %s: %w", image, err)
+	}
+
+	output, err := proc.Command("docker", "buildx", "imagetools", "inspect", "--format", "{{json .Manifest}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the digest of %s: %w", image, err)
+	}
+
+	var manifest struct {
+		Digest string `json:"digest"`
+	}
+	if err := json.Unmarshal(output, &manifest); err != nil || !strings.HasPrefix(manifest.Digest, "sha256:") {
+		return "", fmt.Errorf("unexpected manifest for %s: %s", image, strings.TrimSpace(string(output)))
+	}
+
+	logging.Infof("Pinned %s to %s\n", image, manifest.Digest)
+	return image + "@" + manifest.Digest, nil
+}
@@ -0,0 +1,250 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+	"goforge/pkg/safewrite"
+)
+
+// DefaultPlatforms are the platforms built when none are given.
+var DefaultPlatforms = []string{"linux/amd64", "linux/arm64"}
+
+// BuildOptions configures a multi-architecture image build.
+type BuildOptions struct {
+	// Dockerfile is the Dockerfile to build; it is generated with the
+	// default options when it does not exist.
+	Dockerfile string
+	Tag        string
+	Platforms  []string
+	BuildArgs  []EnvVar
+	// Secrets are passed to the build as --secret specs, e.g.
+	// "id=netrc,src=/home/me/.netrc". Unlike build arguments, they are
+	// never recorded in the image.
+	Secrets []string
+	NoCache bool
+	// Push uploads the image to its registry after a successful build;
+	// multi-platform images cannot be loaded into the local docker image
+	// store, so they are otherwise kept in the build cache only.
+	Push bool
+	// Scan scans the built image for vulnerabilities; nil skips the scan.
+	Scan *ScanOptions
+	// Templates overrides the built-in templates of a generated Dockerfile.
+	Templates Templates
+}
+
+// ParseBuildArgs parses KEY=VALUE build arguments.
+func ParseBuildArgs(pairs []string) ([]EnvVar, error) {
+	var args []EnvVar
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || !envNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid build argument %q (expected KEY=VALUE)", pair)
+		}
+		args = append(args, EnvVar{Name: name, Value: value})
+	}
+	return args, nil
+}
+
+// ParsePlatforms splits a comma-separated platform list such as
+// "linux/amd64,linux/arm64".
+func ParsePlatforms(spec string) ([]string, error) {
+	var platforms []string
+	for _, platform := range strings.Split(spec, ",") {
+		platform = strings.TrimSpace(platform)
+		if platform == "" {
+			continue
+		}
+		if goos, goarch, ok := strings.Cut(platform, "/"); !ok || goos == "" || goarch == "" {
+			return nil, fmt.Errorf("invalid platform %q (expected os/arch, e.g. linux/arm64)", platform)
+		}
+		platforms = append(platforms, platform)
+	}
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("no platforms given")
+	}
+	return platforms, nil
+}
+
+// BuildImage builds the project's image for every platform with docker
+// buildx, or with podman when docker is not installed. The build output is
+// streamed to the terminal, and a failed build exits with the runtime's status.
+func BuildImage(path string, opts BuildOptions) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	runtime, err := containerRuntime()
+	if err != nil {
+		return err
+	}
+
+	tag := opts.Tag
+	if tag == "" {
+		tag = strings.ToLower(filepath.Base(absPath)) + ":latest"
+	}
+
+	platforms := opts.Platforms
+	if len(platforms) == 0 {
+		platforms = DefaultPlatforms
+	}
+	// podman keeps a multi-platform build in a local manifest list
+	manifest := runtime == "podman" && len(platforms) > 1
+	if opts.Scan != nil && opts.Scan.Threshold != "" && !ValidSeverityThreshold(opts.Scan.Threshold) {
+		return fmt.Errorf("invalid severity threshold %q (expected low, medium, high, or critical)", opts.Scan.Threshold)
+	}
+	if opts.Scan != nil && !opts.Push && len(platforms) > 1 {
+		return fmt.Errorf("a multi-platform image is not stored locally, so it cannot be scanned; build one platform or add --push")
+	}
+
+	for _, secret := range opts.Secrets {
+		if !strings.HasPrefix(secret, "id=") && !strings.Contains(secret, ",id=") {
+			return fmt.Errorf("invalid secret %q (expected id=ID,src=PATH or id=ID,env=VARIABLE)", secret)
+		}
+	}
+
+	dockerfile := opts.Dockerfile
+	if dockerfile == "" {
+		dockerfile = filepath.Join(absPath, "Dockerfile")
+	}
+	if _, err := os.Stat(dockerfile); os.IsNotExist(err) {
+		if safewrite.DryRun() {
+			return fmt.Errorf("no Dockerfile at %s to build; a dry run does not generate one", dockerfile)
+		}
+		logging.Infof("No Dockerfile at %s, generating one\n", dockerfile)
+		if err := GenerateDockerfile(absPath, dockerfile, DockerfileOptions{Runtime: DefaultRuntime, NonRoot: true, LinkerVars: DefaultLinkerVars, Templates: opts.Templates}); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to read Dockerfile: %w", err)
+	}
+
+	logging.Infof("Building %s for %s with %s\n", tag, strings.Join(platforms, ", "), runtime)
+	if runtime == "docker" && !opts.Push && len(platforms) > 1 {
+		logging.Infoln("Note: multi-platform images are kept in the build cache; use --push to publish them")
+	}
+
+	var args []string
+	if runtime == "docker" {
+		args = buildxArgs(tag, dockerfile, platforms, opts.Push)
+		if !opts.Push && len(platforms) == 1 {
+			// Single-platform images can be loaded into the local image store
+			args = append(args, "--load")
+		}
+	} else {
+		args = podmanArgs(tag, dockerfile, platforms, manifest)
+	}
+	metadata, err := buildInfoArgs(absPath, dockerfile, opts.BuildArgs)
+	if err != nil {
+		return err
+	}
+	for _, arg := range append(metadata, opts.BuildArgs...) {
+		args = append(args, "--build-arg", arg.Name+"="+arg.Value)
+	}
+	for _, secret := range opts.Secrets {
+		args = append(args, "--secret", secret)
+	}
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	args = append(args, absPath)
+
+	if err := runRuntime(runtime, "build", args...); err != nil {
+		return err
+	}
+
+	// docker buildx pushes as part of the build; podman pushes separately
+	if opts.Push && runtime == "podman" {
+		pushArgs := []string{"push", tag}
+		if manifest {
+			pushArgs = []string{"manifest", "push", "--all", tag, "docker://" + tag}
+		}
+		if err := runRuntime(runtime, "push", pushArgs...); err != nil {
+			return err
+		}
+	}
+
+	if opts.Push {
+		fmt.Printf("\nPushed %s\n", tag)
+	} else {
+		fmt.Printf("\nBuilt %s\n", tag)
+	}
+
+	if opts.Scan != nil {
+		return ScanImage(tag, *opts.Scan)
+	}
+	return nil
+}
+
+// containerRuntime returns the container runtime to build with: docker with
+// its buildx plugin, or podman when docker is not installed.
+func containerRuntime() (string, error) {
+	if _, err := exec.LookPath("docker"); err == nil {
+		return "docker", checkBuildx()
+	}
+	if _, err := exec.LookPath("podman"); err == nil {
+		return "podman", nil
+	}
+	return "", fmt.Errorf("no container runtime found in PATH; install Docker (https://docs.docker.com/get-docker/) " +
+		"or Podman (https://podman.io/docs/installation)")
+}
+
+// runRuntime runs the container runtime with its output streamed to the
+// terminal. A non-zero exit is returned with the runtime's exit status.
+func runRuntime(runtime string, step string, args ...string) error {
+	cmd := proc.Command(runtime, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		err = fmt.Errorf("%s %s failed: %w", runtime, step, err)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			return exitcode.WithStatus(err, exitErr.ExitCode())
+		}
+		return err
+	}
+	return nil
+}
+
+// checkBuildx verifies that docker and its buildx plugin are installed.
+func checkBuildx() error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("docker not found in PATH; install Docker from https://docs.docker.com/get-docker/")
+	}
+
+	if output, err := proc.Command("docker", "buildx", "version").CombinedOutput(); err != nil {
+		return fmt.Errorf("docker buildx is not available (%s); install the buildx plugin "+
+			"(https://docs.docker.com/build/install-buildx/) and create a multi-platform builder with "+
+			"'docker buildx create --use'", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// buildxArgs returns the docker arguments for a buildx build, without the context.
+func buildxArgs(tag string, dockerfile string, platforms []string, push bool) []string {
+	args := []string{"buildx", "build", "--platform", strings.Join(platforms, ","), "-t", tag, "-f", dockerfile}
+	if push {
+		args = append(args, "--push")
+	}
+	return args
+}
+
+// podmanArgs returns the podman arguments for a build, without the context.
+// Multi-platform builds go into a manifest list named after the tag.
+func podmanArgs(tag string, dockerfile string, platforms []string, manifest bool) []string {
+	args := []string{"build", "--platform", strings.Join(platforms, ",")}
+	if manifest {
+		args = append(args, "--manifest", tag)
+	} else {
+		args = append(args, "-t", tag)
+	}
+	return append(args, "-f", dockerfile)
+}
@@ -0,0 +1,166 @@
+package container
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"goforge/pkg/proc"
+)
+
+// Build arguments carrying the build metadata into generated Dockerfiles.
+const (
+	argSource   = "SOURCE"
+	argVersion  = "VERSION"
+	argRevision = "REVISION"
+	argCreated  = "CREATED"
+)
+
+// BuildInfo is the version metadata of a build, read from git. It becomes
+// the image's OCI annotations and is linked into the binary.
+type BuildInfo struct {
+	// Source is the URL of the origin remote, without credentials; empty
+	// when the repository has no origin.
+	Source string
+	// Version is the nearest tag, or the abbreviated commit when untagged.
+	Version  string
+	Revision string
+	// Created is the build time in RFC 3339 format. Generated Dockerfiles
+	// default to the commit time, so regenerating them is reproducible.
+	Created string
+}
+
+// LinkerVars names the string variables set with -ldflags "-X", e.g.
+// "main.version". Empty names are not set.
+type LinkerVars struct {
+	Version  string
+	Revision string
+	Created  string
+}
+
+// DefaultLinkerVars are the variables goreleaser and most Go projects use.
+var DefaultLinkerVars = LinkerVars{Version: "main.version", Revision: "main.commit", Created: "main.date"}
+
+// readBuildInfo reads the build metadata of the git repository containing
+// absPath. It returns nil when absPath is not in a git repository or has no
+// commits.
+func readBuildInfo(absPath string) *BuildInfo {
+	git := func(args ...string) string {
+		cmd := proc.Command("git", args...)
+		cmd.Dir = absPath
+		output, err := cmd.Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	revision := git("rev-parse", "HEAD")
+	if revision == "" {
+		return nil
+	}
+	info := &BuildInfo{
+		Source:   sourceURL(git("remote", "get-url", "origin")),
+		Version:  git("describe", "--tags", "--always"),
+		Revision: revision,
+	}
+	if committed, err := time.Parse(time.RFC3339, git("log", "-1", "--format=%cI")); err == nil {
+		info.Created = committed.UTC().Format(time.RFC3339)
+	}
+	return info
+}
+
+// sourceURL turns a git remote into a browsable https URL. scp-style SSH
+// remotes such as git@github.com:org/repo.git are rewritten, and credentials
+// are dropped so tokens never end up in image labels.
+func sourceURL(remote string) string {
+	if remote == "" {
+		return ""
+	}
+
+	if !strings.Contains(remote, "://") {
+		// user@host:path
+		hostPart, path, ok := strings.Cut(remote, ":")
+		if !ok {
+			return ""
+		}
+		if _, host, ok := strings.Cut(hostPart, "@"); ok {
+			hostPart = host
+		}
+		remote = "https://" + hostPart + "/" + strings.TrimPrefix(path, "/")
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if u.Scheme == "ssh" || u.Scheme == "git" {
+		u.Scheme = "https"
+	}
+	u.User = nil
+	u.Host = u.Hostname()
+	u.Path = strings.TrimSuffix(u.Path, ".git")
+	return u.String()
+}
+
+// ldflags returns the -X flags setting vars from the build arguments.
+func (vars LinkerVars) ldflags() string {
+	var flags []string
+	for _, v := range []struct{ name, arg string }{
+		{vars.Version, argVersion},
+		{vars.Revision, argRevision},
+		{vars.Created, argCreated},
+	} {
+		if v.name != "" {
+			flags = append(flags, fmt.Sprintf("-X %s=${%s}", v.name, v.arg))
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+// buildInfoArgs returns fresh values for the build metadata arguments that
+// the Dockerfile declares and that the user has not set, so the labels
+// describe the commit being built rather than the one the Dockerfile was
+// generated from.
+func buildInfoArgs(absPath string, dockerfile string, userArgs []EnvVar) ([]EnvVar, error) {
+	info := readBuildInfo(absPath)
+	if info == nil {
+		return nil, nil
+	}
+
+	file, err := os.Open(dockerfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Dockerfile: %w", err)
+	}
+	defer file.Close()
+	instructions, err := ParseDockerfile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Dockerfile: %w", err)
+	}
+
+	declared := make(map[string]bool)
+	for _, inst := range instructions {
+		if inst.Command == "ARG" {
+			name, _, _ := strings.Cut(inst.Args, "=")
+			declared[strings.TrimSpace(name)] = true
+		}
+	}
+	for _, arg := range userArgs {
+		delete(declared, arg.Name)
+	}
+
+	var args []EnvVar
+	for _, arg := range []EnvVar{
+		{Name: argSource, Value: info.Source},
+		{Name: argVersion, Value: info.Version},
+		{Name: argRevision, Value: info.Revision},
+		{Name: argCreated, Value: time.Now().UTC().Format(time.RFC3339)},
+	} {
+		if declared[arg.Name] && arg.Value != "" {
+			args = append(args, arg)
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,297 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/safewrite"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CI providers a pipeline can be generated for.
+const (
+	CIGitHub = "github"
+	CIGitLab = "gitlab"
+)
+
+// CIProviders lists the supported CI providers.
+var CIProviders = []string{CIGitHub, CIGitLab}
+
+// ciFiles are the pipeline files of each provider, relative to the project.
+var ciFiles = map[string]string{
+	CIGitHub: filepath.Join(".github", "workflows", "docker.yml"),
+	CIGitLab: ".gitlab-ci.yml",
+}
+
+// registryRe matches a registry host with an optional port.
+var registryRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?(:[0-9]+)?$`)
+
+// imageNameRe matches an image repository name without registry or tag.
+var imageNameRe = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*(/[a-z0-9]+([._-][a-z0-9]+)*)*$`)
+
+// CIOptions configures the generated CI pipeline.
+type CIOptions struct {
+	// Provider is github or gitlab.
+	Provider string
+	// Registry is the registry host, e.g. docker.io; empty means the
+	// provider's own registry, ghcr.io or the GitLab container registry,
+	// logged into with the pipeline's token.
+	Registry string
+	// Image is the repository name in the registry; empty means the
+	// repository's own path with the provider's registry, else the
+	// project directory's name.
+	Image     string
+	Platforms []string
+	// Dockerfile is the Dockerfile to build, relative to the project.
+	Dockerfile string
+	// Templates overrides the built-in templates.
+	Templates Templates
+	// Options decides whether an existing pipeline file is replaced or
+	// diffed.
+	safewrite.Options
+}
+
+// CIData holds data for the pipeline templates. Template overrides are
+// executed with it too, so fields are only ever added.
+type CIData struct {
+	// Registry is empty for the provider's own registry.
+	Registry string
+	// Image is empty for the repository's own path.
+	Image string
+	// Platforms is the comma-separated list of target platforms.
+	Platforms  string
+	Dockerfile string
+}
+
+// GitHubWorkflowTemplate is a GitHub Actions workflow that builds the image
+// with buildx and pushes it. It uses [[ ]] delimiters, since the workflow's
+// own expressions are written ${{ }}.
+const GitHubWorkflowTemplate = `# Builds the image for every platform and pushes it, tagged with the commit
+# SHA and, for tags, the git tag. Pull requests only build.
+name: Docker
+
+on:
+  push:
+    branches: [main, master]
+    tags: ["*"]
+  pull_request:
+
+permissions:
+  contents: read
+  packages: write
+
+env:
+  IMAGE: [[ or .Registry "ghcr.io" ]]/[[ if .Image ]][[ .Image ]][[ else ]]${{ github.repository }}[[ end ]]
+
+jobs:
+  image:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+
+      - uses: docker/setup-qemu-action@v3
+
+      - uses: docker/setup-buildx-action@v3
+
+      - name: Log in to the registry
+        if: github.event_name != 'pull_request'
+        uses: docker/login-action@v3
+        with:
+          [[- if .Registry ]]
+          registry: [[ .Registry ]]
+          username: ${{ secrets.REGISTRY_USERNAME }}
+          password: ${{ secrets.REGISTRY_PASSWORD }}
+          [[- else ]]
+          registry: ghcr.io
+          username: ${{ github.actor }}
+          password: ${{ secrets.GITHUB_TOKEN }}
+          [[- end ]]
+
+      - name: Compute tags and labels
+        id: meta
+        uses: docker/metadata-action@v5
+        with:
+          images: ${{ env.IMAGE }}
+          tags: |
+            type=sha,format=long,prefix=
+            type=ref,event=tag
+
+      # The Docker layer cache, including the downloaded Go modules, is
+      # kept in the GitHub Actions cache
+      - name: Build and push
+        uses: docker/build-push-action@v6
+        with:
+          context: .
+          file: [[ .Dockerfile ]]
+          platforms: [[ .Platforms ]]
+          push: ${{ github.event_name != 'pull_request' }}
+          tags: ${{ steps.meta.outputs.tags }}
+          labels: ${{ steps.meta.outputs.labels }}
+          build-args: |
+            SOURCE=${{ github.server_url }}/${{ github.repository }}
+            VERSION=${{ steps.meta.outputs.version }}
+            REVISION=${{ github.sha }}
+            CREATED=${{ fromJSON(steps.meta.outputs.json).labels['org.opencontainers.image.created'] }}
+          cache-from: type=gha
+          cache-to: type=gha,mode=max
+`
+
+// GitLabPipelineTemplate is a GitLab CI pipeline that builds the image with
+// buildx in Docker-in-Docker and pushes it.
+const GitLabPipelineTemplate = `# Builds the image for every platform and pushes it, tagged with the commit
+# SHA and, for tags, the git tag. Merge requests only build.
+stages:
+  - image
+
+image:
+  stage: image
+  image: docker:27
+  services:
+    - docker:27-dind
+  variables:
+    DOCKER_TLS_CERTDIR: "/certs"
+    [[- if .Registry ]]
+    REGISTRY: "[[ .Registry ]]"
+    IMAGE: "[[ .Registry ]]/[[ .Image ]]"
+    [[- else ]]
+    REGISTRY: "$CI_REGISTRY"
+    IMAGE: "[[ if .Image ]]$CI_REGISTRY/[[ .Image ]][[ else ]]$CI_REGISTRY_IMAGE[[ end ]]"
+    [[- end ]]
+    PLATFORMS: "[[ .Platforms ]]"
+  rules:
+    - if: $CI_COMMIT_TAG
+    - if: $CI_COMMIT_BRANCH == $CI_DEFAULT_BRANCH
+    - if: $CI_PIPELINE_SOURCE == "merge_request_event"
+  before_script:
+    - docker run --privileged --rm tonistiigi/binfmt --install all
+    - docker buildx create --use --driver docker-container
+    - |
+      if [ "$CI_PIPELINE_SOURCE" != "merge_request_event" ]; then
+        [[- if .Registry ]]
+        echo "$REGISTRY_PASSWORD" | docker login "$REGISTRY" -u "$REGISTRY_USERNAME" --password-stdin
+        [[- else ]]
+        echo "$CI_REGISTRY_PASSWORD" | docker login "$REGISTRY" -u "$CI_REGISTRY_USER" --password-stdin
+        [[- end ]]
+      fi
+  script:
+    - |
+      TAGS="--tag $IMAGE:$CI_COMMIT_SHA"
+      if [ -n "$CI_COMMIT_TAG" ]; then TAGS="$TAGS --tag $IMAGE:$CI_COMMIT_TAG"; fi
+      PUSH="--push"
+      if [ "$CI_PIPELINE_SOURCE" = "merge_request_event" ]; then PUSH=""; fi
+      # The Docker layer cache, including the downloaded Go modules, is kept
+      # in the registry next to the image
+      docker buildx build --platform "$PLATFORMS" $TAGS $PUSH \
+        --file [[ .Dockerfile ]] \
+        --build-arg SOURCE="$CI_PROJECT_URL" \
+        --build-arg VERSION="${CI_COMMIT_TAG:-$CI_COMMIT_SHORT_SHA}" \
+        --build-arg REVISION="$CI_COMMIT_SHA" \
+        --build-arg CREATED="$CI_PIPELINE_CREATED_AT" \
+        --cache-from "type=registry,ref=$IMAGE:buildcache" \
+        --cache-to "type=registry,ref=$IMAGE:buildcache,mode=max" \
+        .
+`
+
+// GenerateCI writes a CI pipeline for the project at path that builds its
+// Dockerfile with buildx and pushes the image. The pipeline goes to the
+// provider's conventional file unless outputFile is set.
+func GenerateCI(path string, outputFile string, opts CIOptions) error {
+	logging.Infoln("Generating CI pipeline for project at:", path)
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	name, ok := map[string]string{
+		CIGitHub: TemplateGitHubWorkflow,
+		CIGitLab: TemplateGitLabPipeline,
+	}[opts.Provider]
+	if !ok {
+		return fmt.Errorf("invalid CI provider %q (expected %s)", opts.Provider, strings.Join(CIProviders, " or "))
+	}
+	if outputFile == "" {
+		outputFile = filepath.Join(absPath, ciFiles[opts.Provider])
+	}
+	absOutput, err := module.ResolveOutput(absPath, outputFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := opts.data(absPath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(absPath, data.Dockerfile)); os.IsNotExist(err) {
+		logging.Infof("Note: %s does not exist yet; generate it with 'goforge container dockerfile' and commit it\n", data.Dockerfile)
+	}
+
+	if err := opts.Templates.check(); err != nil {
+		return err
+	}
+	tmpl, err := opts.Templates.parse(template.New(opts.Provider).Delims("[[", "]]"), name)
+	if err != nil {
+		return fmt.Errorf("failed to parse CI template: %w", err)
+	}
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return fmt.Errorf("failed to execute CI template: %w", err)
+	}
+	// A pipeline that does not parse fails only once pushed; catch it here
+	var parsed any
+	if err := yaml.Unmarshal(content.Bytes(), &parsed); err != nil {
+		return fmt.Errorf("generated CI pipeline is not valid YAML: %w", err)
+	}
+
+	written, err := opts.Write(safewrite.File{Path: absOutput, Data: content.Bytes()})
+	if err != nil || !written {
+		return err
+	}
+
+	fmt.Printf("CI pipeline generated at: %s\n", absOutput)
+	if opts.Registry != "" {
+		logging.Infoln("\nAdd the REGISTRY_USERNAME and REGISTRY_PASSWORD secrets to the repository's CI settings.")
+	}
+	return nil
+}
+
+// data validates the options and returns the template data.
+func (opts CIOptions) data(absPath string) (CIData, error) {
+	data := CIData{
+		Registry:   opts.Registry,
+		Image:      opts.Image,
+		Dockerfile: opts.Dockerfile,
+	}
+	if data.Registry != "" && !registryRe.MatchString(data.Registry) {
+		return CIData{}, fmt.Errorf("invalid registry %q (expected a host such as docker.io or registry.example.com:5000)", data.Registry)
+	}
+	if data.Registry != "" && data.Image == "" {
+		data.Image = strings.ToLower(filepath.Base(absPath))
+	}
+	if data.Image != "" && !imageNameRe.MatchString(data.Image) {
+		return CIData{}, fmt.Errorf("invalid image name %q (lowercase path such as team/app, without registry or tag)", data.Image)
+	}
+
+	platforms := opts.Platforms
+	if len(platforms) == 0 {
+		platforms = DefaultPlatforms
+	}
+	data.Platforms = strings.Join(platforms, ",")
+
+	if data.Dockerfile == "" {
+		data.Dockerfile = "Dockerfile"
+	}
+	data.Dockerfile = filepath.ToSlash(data.Dockerfile)
+	if filepath.IsAbs(data.Dockerfile) || strings.HasPrefix(data.Dockerfile, "../") {
+		return CIData{}, fmt.Errorf("the Dockerfile %q must be inside the project, relative to it", opts.Dockerfile)
+	}
+	return data, nil
+}
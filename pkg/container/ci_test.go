@@ -0,0 +1,117 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestGenerateCI(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CIOptions
+		// want are strings the pipeline must contain.
+		want []string
+	}{
+		{
+			name: "github defaults",
+			opts: CIOptions{Provider: CIGitHub},
+			want: []string{"ghcr.io", "linux/amd64,linux/arm64"},
+		},
+		{
+			name: "github registry and image",
+			opts: CIOptions{Provider: CIGitHub, Registry: "docker.io", Image: "team/app"},
+			want: []string{"docker.io/team/app"},
+		},
+		{
+			name: "github platforms and dockerfile",
+			opts: CIOptions{Provider: CIGitHub, Platforms: []string{"linux/amd64"}, Dockerfile: "build/Dockerfile"},
+			want: []string{"linux/amd64", "build/Dockerfile"},
+		},
+		{
+			name: "gitlab defaults",
+			opts: CIOptions{Provider: CIGitLab},
+			want: []string{"$CI_REGISTRY_IMAGE", "linux/amd64,linux/arm64"},
+		},
+		{
+			name: "gitlab registry and image",
+			opts: CIOptions{Provider: CIGitLab, Registry: "registry.example.com:5000", Image: "team/app"},
+			want: []string{`"registry.example.com:5000/team/app"`},
+		},
+		{
+			name: "gitlab image in own registry",
+			opts: CIOptions{Provider: CIGitLab, Image: "team/app", Dockerfile: "build/Dockerfile"},
+			want: []string{"$CI_REGISTRY/team/app", "--file build/Dockerfile"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := GenerateCI(dir, "", tt.opts); err != nil {
+				t.Fatalf("GenerateCI: %v", err)
+			}
+			output := filepath.Join(dir, ciFiles[tt.opts.Provider])
+			data, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var pipeline map[string]any
+			if err := yaml.Unmarshal(data, &pipeline); err != nil {
+				t.Fatalf("pipeline is not valid YAML: %v\n%s", err, data)
+			}
+			job, ok := pipeline["image"]
+			if tt.opts.Provider == CIGitHub {
+				jobs, _ := pipeline["jobs"].(map[string]any)
+				job, ok = jobs["image"]
+				if _, hasOn := pipeline["on"]; !hasOn {
+					t.Errorf("workflow has no triggers")
+				}
+			}
+			if !ok || job == nil {
+				t.Errorf("pipeline has no image job:\n%s", data)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("pipeline does not contain %q:\n%s", want, data)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateCIExisting(t *testing.T) {
+	for _, provider := range CIProviders {
+		t.Run(provider, func(t *testing.T) {
+			dir := t.TempDir()
+			output := filepath.Join(dir, ciFiles[provider])
+			if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+				t.Fatal(err)
+			}
+			existing := []byte("# hand-written pipeline\n")
+			if err := os.WriteFile(output, existing, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := GenerateCI(dir, "", CIOptions{Provider: provider})
+			if err == nil || !strings.Contains(err.Error(), "already exists") {
+				t.Fatalf("err = %v, want the existing pipeline to be refused", err)
+			}
+			if data, _ := os.ReadFile(output); string(data) != string(existing) {
+				t.Fatalf("existing pipeline was changed:\n%s", data)
+			}
+
+			opts := CIOptions{Provider: provider}
+			opts.Force = true
+			if err := GenerateCI(dir, "", opts); err != nil {
+				t.Fatalf("GenerateCI with --force: %v", err)
+			}
+			if data, _ := os.ReadFile(output); string(data) == string(existing) {
+				t.Errorf("--force did not replace the pipeline")
+			}
+		})
+	}
+}
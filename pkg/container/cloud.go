@@ -0,0 +1,564 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/safewrite"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default output files of the serverless generators.
+const (
+	CloudRunFile = "cloudrun.yaml"
+	ECSFile      = "ecs-task-definition.json"
+)
+
+// Container sizes of the serverless generators when none is set: Cloud
+// Run's default of one CPU, and the smallest Fargate task.
+var (
+	DefaultCloudRunResources = Resources{CPULimit: "1", MemoryLimit: "512Mi"}
+	DefaultECSResources      = Resources{CPULimit: "0.25", MemoryLimit: "512Mi"}
+)
+
+// Placeholders of the task definition values that are not known without
+// an execution role or region.
+const (
+	accountPlaceholder = "<account-id>"
+	regionPlaceholder  = "<region>"
+)
+
+// executionRoleRe matches an IAM role ARN and captures its account.
+var executionRoleRe = regexp.MustCompile(`^arn:aws[a-z-]*:iam::(\d{12}):role/\S+$`)
+
+// awsRegionRe matches an AWS region such as eu-west-1.
+var awsRegionRe = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d$`)
+
+// CloudRunTemplate is a template for a Cloud Run service, in the Knative
+// serving format 'gcloud run services replace' reads.
+const CloudRunTemplate = `apiVersion: serving.knative.dev/v1
+kind: Service
+metadata:
+  name: {{ .AppName }}
+  labels:
+    app: {{ .AppName }}
+    {{- range $key, $value := .Labels }}
+    {{ $key }}: {{ printf "%q" $value }}
+    {{- end }}
+spec:
+  template:
+    {{- if .MaxInstances }}
+    metadata:
+      annotations:
+        autoscaling.knative.dev/maxScale: "{{ .MaxInstances }}"
+    {{- end }}
+    spec:
+      containers:
+      - name: {{ .AppName }}
+        image: {{ .Image }}
+        # Cloud Run routes requests to this port and sets PORT to it
+        ports:
+        - name: http1
+          containerPort: {{ (index .Ports 0).Port }}
+        {{- if or .Env .ConfigKeys .SecretKeys }}
+        env:
+        {{- range .Env }}
+        - name: {{ .Name }}
+          value: {{ printf "%q" .Value }}
+        {{- end }}
+        {{- if .ConfigKeys }}
+        # Placeholder values; fill them in before deploying
+        {{- end }}
+        {{- range .ConfigKeys }}
+        - name: {{ . }}
+          value: ""
+        {{- end }}
+        {{- if .SecretKeys }}
+        # Read from the Secret Manager secrets of the same name
+        {{- end }}
+        {{- range .SecretKeys }}
+        - name: {{ . }}
+          valueFrom:
+            secretKeyRef:
+              name: {{ . }}
+              key: latest
+        {{- end }}
+        {{- end }}
+        resources:
+          limits:
+            cpu: {{ printf "%q" .CPULimit }}
+            memory: {{ printf "%q" .MemoryLimit }}
+        {{- with .Readiness }}
+        startupProbe:
+          {{- if eq .Kind "http" }}
+          httpGet:
+            path: {{ .Path }}
+          {{- else }}
+          tcpSocket:
+            port: {{ .Port }}
+          {{- end }}
+          initialDelaySeconds: {{ .InitialDelay }}
+          periodSeconds: {{ .Period }}
+          timeoutSeconds: {{ .Timeout }}
+        {{- end }}
+        {{- with .Liveness }}
+        {{- if eq .Kind "http" }}
+        livenessProbe:
+          httpGet:
+            path: {{ .Path }}
+          periodSeconds: {{ .Period }}
+          timeoutSeconds: {{ .Timeout }}
+        {{- end }}
+        {{- end }}
+`
+
+// ECSTemplate is a template for a Fargate task definition, in the format
+// 'aws ecs register-task-definition --cli-input-json' reads. The "json"
+// function encodes a value as JSON; the output is reindented.
+const ECSTemplate = `{
+  "family": {{ json .AppName }},
+  "networkMode": "awsvpc",
+  "requiresCompatibilities": ["FARGATE"],
+  "cpu": "{{ .CPU }}",
+  "memory": "{{ .Memory }}",
+  "executionRoleArn": {{ json .ExecutionRole }},
+  "containerDefinitions": [
+    {
+      "name": {{ json .AppName }},
+      "image": {{ json .Image }},
+      "essential": true,
+      "portMappings": [
+        {{- range $i, $port := .Ports }}{{ if $i }},{{ end }}
+        {"name": {{ json .Name }}, "containerPort": {{ .Port }}, "protocol": "tcp"}
+        {{- end }}
+      ],
+      "environment": [
+        {{- $sep := "" }}
+        {{- range .Env }}{{ $sep }}{{ $sep = "," }}
+        {"name": {{ json .Name }}, "value": {{ json .Value }}}
+        {{- end }}
+        {{- range .ConfigKeys }}{{ $sep }}{{ $sep = "," }}
+        {"name": {{ json . }}, "value": ""}
+        {{- end }}
+      ],
+      "secrets": [
+        {{- range $i, $key := .SecretKeys }}{{ if $i }},{{ end }}
+        {"name": {{ json $key }}, "valueFrom": "arn:aws:ssm:{{ $.Region }}:{{ $.Account }}:parameter/{{ $.AppName }}/{{ $key }}"}
+        {{- end }}
+      ],
+      {{- with .HealthCheck }}
+      "healthCheck": {
+        "command": {{ json . }},
+        "interval": {{ $.Liveness.Period }},
+        "timeout": {{ $.Liveness.Timeout }},
+        "retries": 3,
+        "startPeriod": {{ $.Liveness.InitialDelay }}
+      },
+      {{- end }}
+      "stopTimeout": {{ .GracePeriod }},
+      "logConfiguration": {
+        "logDriver": "awslogs",
+        "options": {
+          "awslogs-group": "/ecs/{{ .AppName }}",
+          "awslogs-region": {{ json .Region }},
+          "awslogs-stream-prefix": "ecs"
+        }
+      }
+    }
+  ],
+  "tags": [
+    {{- $sep := "" }}
+    {{- range $key, $value := .Labels }}{{ $sep }}{{ $sep = "," }}
+    {"key": {{ json $key }}, "value": {{ json $value }}}
+    {{- end }}
+  ]
+}
+`
+
+// ServerlessOptions configures the Cloud Run and ECS generators. They
+// describe the app as the Kubernetes manifests do: the same image, ports,
+// probes, and environment variables.
+type ServerlessOptions struct {
+	Image string
+	Env   []EnvVar
+	// Ports overrides the ports detected from the source.
+	Ports  []int
+	Probes ProbeOptions
+	// ConfigKeys and SecretKeys force environment variables into plain
+	// values or secrets, as for the Kubernetes ConfigMap and Secret.
+	ConfigKeys []string
+	SecretKeys []string
+	// CPU and Memory size the container, as quantities such as 0.5 or
+	// 512Mi; empty means the generator's default resources.
+	CPU    string
+	Memory string
+	// Labels are added to the service, or as tags to the task definition.
+	Labels map[string]string
+	// Templates overrides the built-in templates.
+	Templates Templates
+	// Options decides whether an existing file is replaced or diffed.
+	safewrite.Options
+}
+
+// CloudRunOptions configures GenerateCloudRun.
+type CloudRunOptions struct {
+	ServerlessOptions
+	// MaxInstances caps autoscaling; 0 leaves Cloud Run's default.
+	MaxInstances int
+}
+
+// ECSOptions configures GenerateECS.
+type ECSOptions struct {
+	ServerlessOptions
+	// ExecutionRole is the ARN of the task execution role, which pulls the
+	// image, writes the logs, and reads the secrets; empty leaves a
+	// placeholder.
+	ExecutionRole string
+	// Region is the AWS region of the logs and secrets; empty leaves a
+	// placeholder.
+	Region string
+}
+
+// CloudRunData holds data for the Cloud Run template: the app as the
+// Kubernetes templates see it. Template overrides are executed with it
+// too, so fields are only ever added.
+type CloudRunData struct {
+	K8sData
+	MaxInstances int
+}
+
+// ECSData holds data for the ECS task definition template: the app as the
+// Kubernetes templates see it. Template overrides are executed with it
+// too, so fields are only ever added.
+type ECSData struct {
+	K8sData
+	// CPU is the task size in CPU units (1024 per vCPU), and Memory in MiB.
+	CPU    int
+	Memory int
+	// ExecutionRole, Region, and Account, the account of the role, hold
+	// placeholders when not set.
+	ExecutionRole string
+	Region        string
+	Account       string
+	// HealthCheck is the container health check command, from the
+	// liveness probe; empty without one.
+	HealthCheck []string
+}
+
+// GenerateCloudRun writes a Google Cloud Run service for the project at
+// path, built from the same model as the Kubernetes manifests. Cloud Run
+// serves one port, so requests go to the first.
+func GenerateCloudRun(path string, outputFile string, opts CloudRunOptions) error {
+	logging.Infoln("Generating Cloud Run service for project at:", path)
+
+	absPath, absOutput, err := serverlessPaths(path, outputFile, CloudRunFile)
+	if err != nil {
+		return err
+	}
+	if opts.MaxInstances < 0 {
+		return fmt.Errorf("max instances cannot be negative")
+	}
+	if opts.Probes.Kind == ProbeExec {
+		return fmt.Errorf("Cloud Run has no exec probes; use http or tcp")
+	}
+
+	app, err := opts.app(absPath, DefaultCloudRunResources)
+	if err != nil {
+		return err
+	}
+	if len(app.Ports) > 1 {
+		logging.Infof("Note: Cloud Run serves one port; requests go to %d\n", app.Ports[0].Port)
+	}
+	if app.Liveness != nil && app.Liveness.Kind != ProbeHTTP {
+		logging.Infoln("Note: Cloud Run liveness probes need HTTP, so the service only gets a TCP startup probe")
+	}
+
+	content, err := opts.Templates.render(template.New("cloudrun"), TemplateCloudRun, CloudRunData{K8sData: app, MaxInstances: opts.MaxInstances})
+	if err != nil {
+		return err
+	}
+	var parsed any
+	if err := yaml.Unmarshal(content, &parsed); err != nil {
+		return fmt.Errorf("generated Cloud Run service is not valid YAML: %w", err)
+	}
+
+	written, err := opts.Write(safewrite.File{Path: absOutput, Data: content})
+	if err != nil || !written {
+		return err
+	}
+
+	printEnvScaffold(app.EnvScaffold, opts.Env)
+	fmt.Printf("Cloud Run service generated at: %s\n", absOutput)
+	if len(app.SecretKeys) > 0 {
+		logging.Infoln("Create a Secret Manager secret for each secret variable, readable by the service's account.")
+	}
+	logging.Infoln("\nTo deploy the service, run:")
+	logging.Infof("gcloud run services replace %s\n", absOutput)
+	return nil
+}
+
+// GenerateECS writes an AWS ECS task definition for Fargate for the project
+// at path, built from the same model as the Kubernetes manifests. Secret
+// variables are read from SSM parameters named /<app>/<variable>.
+func GenerateECS(path string, outputFile string, opts ECSOptions) error {
+	logging.Infoln("Generating ECS task definition for project at:", path)
+
+	absPath, absOutput, err := serverlessPaths(path, outputFile, ECSFile)
+	if err != nil {
+		return err
+	}
+	data := ECSData{ExecutionRole: opts.ExecutionRole, Region: opts.Region}
+	var placeholders []string
+	if data.ExecutionRole == "" {
+		data.ExecutionRole = "arn:aws:iam::" + accountPlaceholder + ":role/ecsTaskExecutionRole"
+		data.Account = accountPlaceholder
+		placeholders = append(placeholders, accountPlaceholder+" (or set --execution-role)")
+	} else {
+		match := executionRoleRe.FindStringSubmatch(data.ExecutionRole)
+		if match == nil {
+			return fmt.Errorf("invalid execution role %q (expected arn:aws:iam::<account-id>:role/<name>)", data.ExecutionRole)
+		}
+		data.Account = match[1]
+	}
+	if data.Region == "" {
+		data.Region = regionPlaceholder
+		placeholders = append(placeholders, regionPlaceholder+" (or set --region)")
+	} else if !awsRegionRe.MatchString(data.Region) {
+		return fmt.Errorf("invalid region %q (expected e.g. us-east-1)", data.Region)
+	}
+
+	if data.K8sData, err = opts.app(absPath, DefaultECSResources); err != nil {
+		return err
+	}
+	if data.CPU, data.Memory, err = fargateSize(data.CPULimit, data.MemoryLimit); err != nil {
+		return err
+	}
+	if data.GracePeriod > maxECSStopTimeout {
+		data.GracePeriod = maxECSStopTimeout
+	}
+	if probe := data.Liveness; probe != nil {
+		switch probe.Kind {
+		case ProbeHTTP:
+			// The alpine runtime image has wget, like the Dockerfile's HEALTHCHECK
+			data.HealthCheck = []string{"CMD", "wget", "-q", "--spider", fmt.Sprintf("http://localhost:%d%s", probe.Port, probe.Path)}
+		case ProbeExec:
+			data.HealthCheck = append([]string{"CMD"}, probe.Command...)
+		default:
+			logging.Infoln("Note: ECS health checks run a command, so the TCP probe is left out (set --health-path or --probe exec:<command>)")
+		}
+	}
+
+	rendered, err := opts.Templates.render(template.New("ecs"), TemplateECS, data)
+	if err != nil {
+		return err
+	}
+	var content bytes.Buffer
+	if err := json.Indent(&content, rendered, "", "  "); err != nil {
+		return fmt.Errorf("generated ECS task definition is not valid JSON: %w", err)
+	}
+	content.WriteByte('\n')
+
+	written, err := opts.Write(safewrite.File{Path: absOutput, Data: content.Bytes()})
+	if err != nil || !written {
+		return err
+	}
+
+	printEnvScaffold(data.EnvScaffold, opts.Env)
+	fmt.Printf("ECS task definition generated at: %s\n", absOutput)
+	if len(placeholders) > 0 {
+		logging.Infof("Replace the placeholders before registering it: %s\n", strings.Join(placeholders, ", "))
+	}
+	if len(data.SecretKeys) > 0 {
+		logging.Infof("Create an SSM parameter /%s/<NAME> for each secret variable, readable by the execution role.\n", data.AppName)
+	}
+	logging.Infoln("\nTo register the task definition, run:")
+	logging.Infof("aws ecs register-task-definition --cli-input-json file://%s\n", absOutput)
+	return nil
+}
+
+// maxECSStopTimeout is the longest stop timeout Fargate allows, in seconds.
+const maxECSStopTimeout = 120
+
+// serverlessPaths returns the absolute project path and output file, which
+// defaults to defaultFile in the module root.
+func serverlessPaths(path string, outputFile string, defaultFile string) (string, string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if outputFile == "" {
+		outputFile = defaultFile
+	}
+	absOutput, err := module.ResolveOutput(absPath, outputFile)
+	if err != nil {
+		return "", "", err
+	}
+	return absPath, absOutput, nil
+}
+
+// app validates the options and returns the app as the Kubernetes templates
+// describe it, sized by the options or else by defaults.
+func (opts ServerlessOptions) app(absPath string, defaults Resources) (K8sData, error) {
+	name := strings.ToLower(filepath.Base(absPath))
+	if !dnsLabelRe.MatchString(name) || len(name) > 63 {
+		return K8sData{}, fmt.Errorf("%q is not a valid service name (lowercase letters, digits, and '-'); rename the project directory", name)
+	}
+	meta := Metadata{Labels: opts.Labels}
+	if err := meta.validate(); err != nil {
+		return K8sData{}, err
+	}
+	if err := opts.Templates.check(); err != nil {
+		return K8sData{}, err
+	}
+
+	resources := Resources{CPULimit: opts.CPU, MemoryLimit: opts.Memory}
+	if resources.CPULimit == "" {
+		resources.CPULimit = defaults.CPULimit
+	}
+	if resources.MemoryLimit == "" {
+		resources.MemoryLimit = defaults.MemoryLimit
+	}
+	if !cpuQuantityRe.MatchString(resources.CPULimit) {
+		return K8sData{}, fmt.Errorf("invalid CPU %q (e.g. 1 or 500m)", resources.CPULimit)
+	}
+	if !quantityRe.MatchString(resources.MemoryLimit) {
+		return K8sData{}, fmt.Errorf("invalid memory %q (e.g. 512Mi or 2Gi)", resources.MemoryLimit)
+	}
+	// Serverless containers get what they ask for
+	resources.CPURequest, resources.MemoryRequest = resources.CPULimit, resources.MemoryLimit
+
+	image := opts.Image
+	if image == "" {
+		image = name + ":latest"
+	}
+
+	ports, err := resolvePorts(absPath, opts.Ports)
+	if err != nil {
+		return K8sData{}, err
+	}
+	namedPorts, err := namePorts(ports, nil, false)
+	if err != nil {
+		return K8sData{}, err
+	}
+	liveness, readiness, err := resolveProbes(absPath, opts.Probes, ports)
+	if err != nil {
+		return K8sData{}, err
+	}
+
+	detected, err := DetectEnvVars(absPath)
+	if err != nil {
+		return K8sData{}, err
+	}
+	scaffold, err := scaffoldEnv(detected, opts.Env, opts.ConfigKeys, opts.SecretKeys)
+	if err != nil {
+		return K8sData{}, err
+	}
+
+	return K8sData{
+		AppName:     name,
+		Image:       image,
+		Replicas:    1,
+		GracePeriod: DefaultGracePeriod,
+		Env:         opts.Env,
+		Ports:       namedPorts,
+		User:        nonrootUID,
+		Liveness:    liveness,
+		Readiness:   readiness,
+		EnvScaffold: scaffold,
+		Metadata:    meta,
+		Resources:   resources,
+	}, nil
+}
+
+// render parses and executes the template name with data. Templates can
+// encode values with the "json" function.
+func (t Templates) render(set *template.Template, name string, data any) ([]byte, error) {
+	set.Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			var b strings.Builder
+			encoder := json.NewEncoder(&b)
+			encoder.SetEscapeHTML(false)
+			err := encoder.Encode(v)
+			return strings.TrimSuffix(b.String(), "\n"), err
+		},
+	})
+	tmpl, err := t.parse(set, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s template: %w", set.Name(), err)
+	}
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return nil, fmt.Errorf("failed to execute %s template: %w", set.Name(), err)
+	}
+	return content.Bytes(), nil
+}
+
+// fargateSize converts CPU and memory quantities to a Fargate task size in
+// CPU units and MiB, and checks that Fargate offers it.
+func fargateSize(cpu string, memory string) (int, int, error) {
+	cores, err := parseQuantity(cpu)
+	if err != nil {
+		return 0, 0, err
+	}
+	bytes, err := parseQuantity(memory)
+	if err != nil {
+		return 0, 0, err
+	}
+	units := int(math.Round(cores * 1024))
+	mebibytes := int(math.Ceil(bytes / mebibyte))
+
+	allowed := fargateMemory(units)
+	if allowed == nil {
+		return 0, 0, fmt.Errorf("Fargate has no task size with %s CPU (expected 0.25, 0.5, 1, 2, 4, 8, or 16)", cpu)
+	}
+	for _, size := range allowed {
+		if size == mebibytes {
+			return units, mebibytes, nil
+		}
+	}
+	sizes := make([]string, len(allowed))
+	for i, size := range allowed {
+		sizes[i] = strconv.Itoa(size) + "Mi"
+	}
+	return 0, 0, fmt.Errorf("Fargate has no task size with %s CPU and %s memory (expected one of %s)", cpu, memory, strings.Join(sizes, ", "))
+}
+
+// fargateMemory returns the memory sizes in MiB Fargate offers with a task
+// CPU size in CPU units, or nil for an unsupported CPU size.
+func fargateMemory(units int) []int {
+	sizes := func(from int, to int, step int) []int {
+		var list []int
+		for size := from; size <= to; size += step {
+			list = append(list, size)
+		}
+		return list
+	}
+
+	switch units {
+	case 256:
+		return []int{512, 1024, 2048}
+	case 512:
+		return sizes(1024, 4096, 1024)
+	case 1024:
+		return sizes(2048, 8192, 1024)
+	case 2048:
+		return sizes(4096, 16384, 1024)
+	case 4096:
+		return sizes(8192, 30720, 1024)
+	case 8192:
+		return sizes(16384, 61440, 4096)
+	case 16384:
+		return sizes(32768, 122880, 8192)
+	}
+	return nil
+}
@@ -1,102 +1,624 @@
+// Package container generates the files that build and deploy a Go
+// application in containers: Dockerfiles, Kubernetes manifests, Cloud Run
+// and ECS definitions, CI pipelines, skaffold and development compose files.
+// It also builds images and scans them for vulnerabilities.
 package container
 
 import (
+	"bytes"
 	"fmt"
-	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"text/template"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/safewrite"
 )
 
 // DockerfileTemplate is a template for generating a basic Dockerfile for Go applications.
-const DockerfileTemplate = `FROM {{ .BaseImage }} as builder
+const DockerfileTemplate = `
+{{- if .Private.Auth -}}
+# syntax=docker/dockerfile:1
+{{ end -}}
+{{- with .BuildInfo -}}
+# Build metadata read from git when this file was generated;
+# 'goforge container build' passes the values of the commit being built
+{{- if .Source }}
+ARG SOURCE={{ printf "%q" .Source }}
+{{- end }}
+ARG VERSION={{ printf "%q" .Version }}
+ARG REVISION={{ printf "%q" .Revision }}
+ARG CREATED={{ printf "%q" .Created }}
 
-WORKDIR /app
+{{ end -}}
+# The builder runs natively and cross-compiles for each target platform
+FROM --platform=$BUILDPLATFORM {{ .BaseImage }} AS builder
+ARG TARGETOS
+ARG TARGETARCH
+{{- with .Private.GoPrivate }}
+ARG GOPRIVATE={{ printf "%q" . }}
+{{- end }}
+{{- with .Private.GoNoSumDB }}
+ARG GONOSUMDB={{ printf "%q" . }}
+{{- end }}
+{{- if .LDFlags }}
+ARG VERSION
+ARG REVISION
+ARG CREATED
+{{- end }}
 
+WORKDIR /app
+{{ if .Vendor }}
+# Copy the source with its vendored dependencies; the build needs no network
+COPY . .
+{{- else }}
 # Copy go.mod and go.sum first to leverage Docker cache
 COPY go.mod go.sum ./
+{{- if .Private.Auth }}
+
+# Private modules are fetched with git; the credentials are mounted for the
+# download only and never stored in a layer
+RUN command -v git >/dev/null || apk add --no-cache git
+{{- if eq .Private.Auth "netrc" }}
+RUN --mount=type=secret,id=` + NetrcSecretID + `,target=/root/.netrc,required=true go mod download
+{{- else }}
+RUN --mount=type=secret,id=` + TokenSecretID + `,required=true \
+    GIT_CONFIG_COUNT={{ len .PrivateHosts }} \
+{{- range $i, $host := .PrivateHosts }}
+    GIT_CONFIG_KEY_{{ $i }}="url.https://x-access-token:$(cat /run/secrets/` + TokenSecretID + `)@{{ $host }}/.insteadOf" \
+    GIT_CONFIG_VALUE_{{ $i }}="https://{{ $host }}/" \
+{{- end }}
+    go mod download
+{{- end }}
+{{- else }}
 RUN go mod download
+{{- end }}
 
 # Copy source code
 COPY . .
+{{- end }}
 
 # Build the application
-RUN CGO_ENABLED=0 GOOS=linux go build -a -installsuffix cgo -o app .
+RUN CGO_ENABLED=0 GOOS=${TARGETOS:-linux} GOARCH=$TARGETARCH go build{{ if .Vendor }} -mod=vendor{{ end }} -a -installsuffix cgo{{ with .LDFlags }} -ldflags "{{ . }}"{{ end }} -o /out/{{ .Binary }} {{ .MainPackage }}
+{{- if and .HealthCheck .HealthCheck.Helper }}
+
+# Build a tiny HTTP client for the HEALTHCHECK; the runtime image has no wget
+RUN mkdir /healthcheck && cd /healthcheck && \
+    printf '%s\n' 'package main' 'import ("net/http"; "os")' \
+      'func main() { resp, err := http.Get(os.Args[1]); if err != nil || resp.StatusCode >= 400 { os.Exit(1) } }' > main.go && \
+    CGO_ENABLED=0 GOOS=${TARGETOS:-linux} GOARCH=$TARGETARCH go build -o /out/{{ .HealthCheckBinary }} main.go
+{{- end }}
 
 # Use a small image for the final stage
-FROM alpine:latest
+FROM {{ .RuntimeImage }}
+{{- if .Minimal }}
+
+# The runtime has no package manager; copy CA certificates and time zone data
+COPY --from=builder /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/
+COPY --from=builder /usr/local/go/lib/time/zoneinfo.zip /zoneinfo.zip
+ENV ZONEINFO=/zoneinfo.zip
+{{- end }}
+{{- with .BuildInfo }}
+
+# OCI annotations: https://github.com/opencontainers/image-spec/blob/main/annotations.md
+{{- if .Source }}
+ARG SOURCE
+{{- end }}
+ARG VERSION
+ARG REVISION
+ARG CREATED
+LABEL {{ if .Source }}org.opencontainers.image.source="$SOURCE" \
+      {{ end }}org.opencontainers.image.version="$VERSION" \
+      org.opencontainers.image.revision="$REVISION" \
+      org.opencontainers.image.created="$CREATED"
+{{- end }}
 
-WORKDIR /root/
+WORKDIR {{ .WorkDir }}
+{{- range .Env }}
+ENV {{ .Name }}={{ printf "%q" .Value }}
+{{- end }}
 
 # Copy the binary from the builder stage
-COPY --from=builder /app/app .
+COPY --from=builder /out/{{ .Binary }} .
+{{- if and .HealthCheck .HealthCheck.Helper }}
+COPY --from=builder /out/{{ .HealthCheckBinary }} .
+{{- end }}
+{{- if .NonRoot }}
+
+# Run as an unprivileged numeric user; the binary is world-executable
+USER {{ .User }}:{{ .User }}
+{{- end }}
+
+# Expose the ports the application listens on
+{{- range .Ports }}
+EXPOSE {{ . }}
+{{- end }}
 
-# Expose port if needed
-EXPOSE 8080
+{{- with .HealthCheck }}
 
-# Command to run
-CMD ["./app"]
+HEALTHCHECK --interval=30s --timeout=3s --start-period=10s --retries=3 \
+{{- if .Helper }}
+    CMD ["./{{ $.HealthCheckBinary }}", "{{ .URL }}"]
+{{- else }}
+    CMD ["wget", "-q", "--spider", "{{ .URL }}"]
+{{- end }}
+{{- end }}
+
+# Exec form runs the binary as PID 1, so it receives SIGTERM directly and
+# can shut down gracefully within the orchestrator's grace period
+STOPSIGNAL SIGTERM
+CMD ["./{{ .Binary }}"]
 `
 
 // K8sDeploymentTemplate is a template for generating a basic Kubernetes deployment.
 const K8sDeploymentTemplate = `apiVersion: apps/v1
 kind: Deployment
-metadata:
-  name: {{ .AppName }}
-  labels:
-    app: {{ .AppName }}
+{{ template "workload-metadata" . }}
 spec:
-  replicas: 3
+  replicas: {{ .Replicas }}
   selector:
     matchLabels:
       app: {{ .AppName }}
   template:
-    metadata:
-      labels:
-        app: {{ .AppName }}
+{{ include "pod" . | indent 4 }}
+`
+
+// K8sStatefulSetTemplate is a template for a StatefulSet, which is governed
+// by the headless Service and keeps one volume per claim template and pod.
+const K8sStatefulSetTemplate = `apiVersion: apps/v1
+kind: StatefulSet
+{{ template "workload-metadata" . }}
+spec:
+  serviceName: {{ .AppName }}
+  replicas: {{ .Replicas }}
+  selector:
+    matchLabels:
+      app: {{ .AppName }}
+  template:
+{{ include "pod" . | indent 4 }}
+  {{- if .VolumeClaims }}
+  volumeClaimTemplates:
+  {{- range .VolumeClaims }}
+  - metadata:
+      name: {{ .Name }}
+    spec:
+      accessModes: ["ReadWriteOnce"]
+      {{- if $.StorageClass }}
+      storageClassName: {{ $.StorageClass }}
+      {{- end }}
+      resources:
+        requests:
+          storage: {{ .Size }}
+  {{- end }}
+  {{- end }}
+`
+
+// K8sJobTemplate is a template for a Job that runs the app to completion.
+const K8sJobTemplate = `apiVersion: batch/v1
+kind: Job
+{{ template "workload-metadata" . }}
+spec:
+{{ include "job-spec" . | indent 2 }}
+`
+
+// K8sCronJobTemplate is a template for a CronJob that runs the app as a Job
+// on a schedule.
+const K8sCronJobTemplate = `apiVersion: batch/v1
+kind: CronJob
+{{ template "workload-metadata" . }}
+spec:
+  schedule: {{ printf "%q" .Schedule }}
+  concurrencyPolicy: {{ .ConcurrencyPolicy }}
+  jobTemplate:
     spec:
-      containers:
-      - name: {{ .AppName }}
-        image: {{ .Image }}
-        ports:
-        - containerPort: 8080
-        resources:
-          limits:
-            cpu: "500m"
-            memory: "512Mi"
-          requests:
-            cpu: "100m"
-            memory: "128Mi"
+{{ include "job-spec" . | indent 6 }}
 `
 
+// K8sPodTemplate defines the templates shared by every workload kind: the
+// workload's metadata, the pod template with its container, probes, and
+// security settings, and the spec of a Job.
+const K8sPodTemplate = `{{ define "workload-metadata" -}}
+metadata:
+  name: {{ .AppName }}
+  {{- if .Namespace }}
+  namespace: {{ .Namespace }}
+  {{- end }}
+  labels:
+    app: {{ .AppName }}
+    {{- range $key, $value := .Labels }}
+    {{ $key }}: {{ printf "%q" $value }}
+    {{- end }}
+  {{- if .Annotations }}
+  annotations:
+    {{- range $key, $value := .Annotations }}
+    {{ $key }}: {{ printf "%q" $value }}
+    {{- end }}
+  {{- end }}
+{{- end }}
+{{- define "job-spec" -}}
+completions: {{ .Completions }}
+parallelism: {{ .Parallelism }}
+backoffLimit: {{ .BackoffLimit }}
+template:
+{{ include "pod" . | indent 2 }}
+{{- end }}
+{{- define "pod" -}}
+metadata:
+  labels:
+    app: {{ .AppName }}
+    {{- range $key, $value := .Labels }}
+    {{ $key }}: {{ printf "%q" $value }}
+    {{- end }}
+spec:
+  {{- if .Batch }}
+  restartPolicy: OnFailure
+  {{- end }}
+  terminationGracePeriodSeconds: {{ .GracePeriod }}
+  containers:
+  - name: {{ .AppName }}
+    image: {{ .Image }}
+    {{- if .Ports }}
+    ports:
+    {{- range .Ports }}
+    - name: {{ .Name }}
+      containerPort: {{ .Port }}
+    {{- end }}
+    {{- end }}
+    {{- if .Env }}
+    env:
+    {{- range .Env }}
+    - name: {{ .Name }}
+      value: {{ printf "%q" .Value }}
+    {{- end }}
+    {{- end }}
+    {{- if or .ConfigKeys .SecretKeys }}
+    envFrom:
+    {{- if .ConfigKeys }}
+    - configMapRef:
+        name: {{ .AppName }}-config
+    {{- end }}
+    {{- if .SecretKeys }}
+    - secretRef:
+        name: {{ .AppName }}-secret
+    {{- end }}
+    {{- end }}
+    resources:
+      {{- if not .NoLimits }}
+      limits:
+        cpu: {{ printf "%q" .CPULimit }}
+        memory: {{ printf "%q" .MemoryLimit }}
+      {{- end }}
+      requests:
+        cpu: {{ printf "%q" .CPURequest }}
+        memory: {{ printf "%q" .MemoryRequest }}
+    {{- with .Liveness }}
+    livenessProbe:
+    {{- template "probe" . }}
+    {{- end }}
+    {{- with .Readiness }}
+    readinessProbe:
+    {{- template "probe" . }}
+    {{- end }}
+    {{- if .NonRoot }}
+    securityContext:
+      runAsNonRoot: true
+      runAsUser: {{ .User }}
+      runAsGroup: {{ .User }}
+      allowPrivilegeEscalation: false
+      readOnlyRootFilesystem: true
+      capabilities:
+        drop: ["ALL"]
+    {{- end }}
+    {{- if or .NonRoot .VolumeClaims }}
+    {{- if .NonRoot }}
+    # The root filesystem is read-only; /tmp stays writable
+    {{- end }}
+    volumeMounts:
+    {{- if .NonRoot }}
+    - name: tmp
+      mountPath: /tmp
+    {{- end }}
+    {{- range .VolumeClaims }}
+    - name: {{ .Name }}
+      mountPath: {{ .MountPath }}
+    {{- end }}
+    {{- end }}
+  {{- if .NonRoot }}
+  volumes:
+  - name: tmp
+    emptyDir: {}
+  {{- end }}
+{{- end }}
+{{- define "probe" }}
+      {{- if eq .Kind "http" }}
+      httpGet:
+        path: {{ .Path }}
+        port: {{ .Port }}
+      {{- else if eq .Kind "tcp" }}
+      tcpSocket:
+        port: {{ .Port }}
+      {{- else }}
+      exec:
+        command:
+        {{- range .Command }}
+        - {{ printf "%q" . }}
+        {{- end }}
+      {{- end }}
+      initialDelaySeconds: {{ .InitialDelay }}
+      periodSeconds: {{ .Period }}
+      timeoutSeconds: {{ .Timeout }}
+{{- end }}`
+
+// DefaultReplicas is the replica count of generated Deployments.
+const DefaultReplicas = 3
+
+// DefaultGracePeriod is the seconds a pod has to shut down after SIGTERM,
+// matching the Kubernetes default.
+const DefaultGracePeriod = 30
+
 // K8sServiceTemplate is a template for generating a basic Kubernetes service.
 const K8sServiceTemplate = `apiVersion: v1
 kind: Service
 metadata:
   name: {{ .AppName }}
+  {{- if .Namespace }}
+  namespace: {{ .Namespace }}
+  {{- end }}
+  labels:
+    app: {{ .AppName }}
+    {{- range $key, $value := .Labels }}
+    {{ $key }}: {{ printf "%q" $value }}
+    {{- end }}
+  {{- with .ServiceAnnotations }}
+  annotations:
+    {{- range $key, $value := . }}
+    {{ $key }}: {{ printf "%q" $value }}
+    {{- end }}
+  {{- end }}
 spec:
+  {{- if eq .Kind "statefulset" }}
+  # Headless: DNS resolves to the pods, which the StatefulSet names
+  clusterIP: None
+  {{- end }}
   selector:
     app: {{ .AppName }}
   ports:
-  - port: 80
-    targetPort: 8080
-  type: ClusterIP
+  {{- range .Ports }}
+  - name: {{ .Name }}
+    port: {{ .ServicePort }}
+    targetPort: {{ .Name }}
+  {{- end }}
+  type: {{ .Service.Type }}
+`
+
+// K8sConfigMapTemplate is a template for the ConfigMap holding the detected
+// non-sensitive environment variables.
+const K8sConfigMapTemplate = `# Placeholder values; fill them in before applying
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .AppName }}-config
+  {{- if .Namespace }}
+  namespace: {{ .Namespace }}
+  {{- end }}
+  labels:
+    app: {{ .AppName }}
+    {{- range $key, $value := .Labels }}
+    {{ $key }}: {{ printf "%q" $value }}
+    {{- end }}
+data:
+  {{- range .ConfigKeys }}
+  {{ . }}: ""
+  {{- end }}
+`
+
+// K8sSecretTemplate is a template for the Secret holding the detected
+// sensitive environment variables.
+const K8sSecretTemplate = `# Placeholder values; fill them in, and keep the real values out of version control
+apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ .AppName }}-secret
+  {{- if .Namespace }}
+  namespace: {{ .Namespace }}
+  {{- end }}
+  labels:
+    app: {{ .AppName }}
+    {{- range $key, $value := .Labels }}
+    {{ $key }}: {{ printf "%q" $value }}
+    {{- end }}
+type: Opaque
+stringData:
+  {{- range .SecretKeys }}
+  {{ . }}: ""
+  {{- end }}
+`
+
+// K8sNamespaceTemplate is a template for the namespace the manifests are
+// deployed to.
+const K8sNamespaceTemplate = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ .Namespace }}
+  {{- if .Labels }}
+  labels:
+    {{- range $key, $value := .Labels }}
+    {{ $key }}: {{ printf "%q" $value }}
+    {{- end }}
+  {{- end }}
 `
 
-// DockerfileData holds data for the Dockerfile template.
+// namespaceManifest is the file name of the Namespace manifest; the prefix
+// makes kubectl apply it before the resources in it.
+const namespaceManifest = "00-namespace.yaml"
+
+// EnvVar is an environment variable set in generated artifacts.
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// DockerfileData holds data for the Dockerfile template. Template overrides
+// are executed with it too, so fields are only ever added.
 type DockerfileData struct {
+	// AppName is the project directory's name.
+	AppName   string
 	BaseImage string
+	// MainPackage is the package built, e.g. "./cmd/server", and Binary
+	// the name of the built binary.
+	MainPackage  string
+	Binary       string
+	RuntimeImage string
+	// Minimal is set for runtime images without a shell or package
+	// manager, such as distroless and scratch.
+	Minimal bool
+	WorkDir string
+	NonRoot bool
+	// User is the numeric user and group the image runs as with NonRoot.
+	User  int
+	Env   []EnvVar
+	Ports []int
+	// HealthCheck is nil when the image has no HEALTHCHECK.
+	HealthCheck       *HealthCheck
+	HealthCheckBinary string
+	// BuildInfo is nil when the project is not in a git repository.
+	BuildInfo *BuildInfo
+	// LDFlags sets the LinkerVars from the build arguments.
+	LDFlags string
+	// Vendor builds from the vendor directory instead of downloading
+	// modules.
+	Vendor  bool
+	Private PrivateModules
+	// PrivateHosts are the hosts a private module token authenticates to.
+	PrivateHosts []string
 }
 
-// K8sData holds data for the Kubernetes templates.
+// K8sData holds data for the Kubernetes templates. Template overrides are
+// executed with it too, so fields are only ever added.
 type K8sData struct {
-	AppName string
-	Image   string
+	AppName  string
+	Image    string
+	Replicas int
+	// GracePeriod is the pod's terminationGracePeriodSeconds.
+	GracePeriod int
+	Env         []EnvVar
+	Ports       []NamedPort
+	NonRoot     bool
+	User        int
+	Service     ServiceOptions
+	// Liveness and Readiness are nil when probes are disabled.
+	Liveness  *Probe
+	Readiness *Probe
+	// The variables loaded from the generated ConfigMap and Secret
+	EnvScaffold
+	Metadata
+	WorkloadOptions
+	Resources
 }
 
-// GenerateDockerfile creates a Dockerfile for a Go application.
-func GenerateDockerfile(path string, outputFile string, baseImage string) error {
-	fmt.Println("Generating Dockerfile for project at:", path)
+// DockerfileOptions configures Dockerfile generation.
+type DockerfileOptions struct {
+	// BaseImage is the builder image; empty means the golang image matching
+	// the go.mod Go version.
+	BaseImage string
+	// PinDigest replaces image tags with their current digests.
+	PinDigest bool
+	// Main is the main package to build, e.g. "./cmd/server"; it is
+	// detected when the project has only one.
+	Main string
+	// Runtime selects the final-stage image: alpine, distroless, or scratch.
+	Runtime string
+	// NonRoot runs the image as an unprivileged user from an app-owned
+	// directory instead of root in /root.
+	NonRoot bool
+	Env     []EnvVar
+	// Ports overrides the ports detected from the source.
+	Ports []int
+	// HealthCheckPath is the path of the HEALTHCHECK; it defaults to the
+	// health route detected in the source.
+	HealthCheckPath string
+	NoHealthCheck   bool
+	// LinkerVars are the variables that receive the version, commit, and
+	// build time; the zero value links none.
+	LinkerVars LinkerVars
+	// Vendor builds with -mod=vendor from the project's vendor directory,
+	// for builders without access to a module proxy. VendorCreate runs go
+	// mod vendor first when the directory is missing or out of date, and
+	// implies Vendor.
+	Vendor       bool
+	VendorCreate bool
+	// Private sets GOPRIVATE and GONOSUMDB in the builder stage and mounts
+	// credentials for private module downloads.
+	Private PrivateModules
+	// AllMains generates a Dockerfile for every main package under cmd/
+	// instead of one for Main, each with the ports and health route detected
+	// in its package. Bake adds a docker-bake.hcl that builds them all.
+	AllMains bool
+	Bake     bool
+	// Templates overrides the built-in templates.
+	Templates Templates
+	// Options decides whether an existing Dockerfile is replaced or diffed.
+	safewrite.Options
+}
+
+// KubernetesOptions configures Kubernetes manifest generation.
+type KubernetesOptions struct {
+	Image string
+	Env   []EnvVar
+	// NonRoot adds a restrictive securityContext matching a non-root image.
+	NonRoot bool
+	// Ports overrides the ports detected from the source; the Service
+	// exposes the first one on port 80 and the others as they are.
+	Ports []int
+	// Service configures the Service's type, annotations, and port names.
+	Service ServiceOptions
+	// Replicas is the Deployment's replica count; nil means DefaultReplicas.
+	Replicas *int
+	// GracePeriod is the seconds pods get to shut down; nil means
+	// DefaultGracePeriod.
+	GracePeriod *int
+	Probes      ProbeOptions
+	// ConfigKeys and SecretKeys force environment variables into the
+	// generated ConfigMap or Secret, overriding the name-based split of the
+	// variables detected in the source.
+	ConfigKeys []string
+	SecretKeys []string
+	Metadata
+	// WorkloadOptions selects a Deployment, StatefulSet, Job, or CronJob.
+	WorkloadOptions
+	Resources Resources
+	// AllMains generates the manifests of every main package under cmd/,
+	// one subdirectory each, instead of the project as one application.
+	AllMains bool
+	// Templates overrides the built-in templates.
+	Templates Templates
+	// Options decides whether existing manifests are replaced or diffed.
+	safewrite.Options
+}
+
+// envNameRe matches a valid environment variable name.
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseEnv parses KEY=VALUE pairs into environment variables.
+func ParseEnv(pairs []string) ([]EnvVar, error) {
+	var env []EnvVar
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || !envNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid environment variable %q (expected KEY=VALUE)", pair)
+		}
+		env = append(env, EnvVar{Name: name, Value: value})
+	}
+	return env, nil
+}
+
+// GenerateDockerfile creates a Dockerfile for a Go application. With
+// AllMains it creates one per main package under cmd/, named after the
+// output file with the binary appended, e.g. Dockerfile.api.
+func GenerateDockerfile(path string, outputFile string, opts DockerfileOptions) error {
+	logging.Infoln("Generating Dockerfile for project at:", path)
 
 	// Get absolute paths
 	absPath, err := filepath.Abs(path)
@@ -104,48 +626,166 @@ func GenerateDockerfile(path string, outputFile string, baseImage string) error
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	absOutput, err := filepath.Abs(outputFile)
+	absOutput, err := module.ResolveOutput(absPath, outputFile)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for output: %w", err)
+		return err
 	}
 
 	// Determine app name from directory
 	appName := filepath.Base(absPath)
 
-	// Create template data
-	data := DockerfileData{
-		BaseImage: baseImage,
+	targets, err := dockerfileTargets(absPath, absOutput, opts)
+	if err != nil {
+		return err
+	}
+	if err := opts.Templates.check(); err != nil {
+		return err
 	}
 
-	// Parse and execute the template
-	tmpl, err := template.New("dockerfile").Parse(DockerfileTemplate)
+	runtime, err := lookupRuntime(opts.Runtime)
 	if err != nil {
-		return fmt.Errorf("failed to parse Dockerfile template: %w", err)
+		return err
+	}
+	if err := checkRuntimeCompatible(absPath, opts.Runtime); err != nil {
+		return err
 	}
 
-	// Create output file
-	file, err := os.Create(absOutput)
+	baseImage, err := resolveBaseImage(absPath, opts.BaseImage)
 	if err != nil {
-		return fmt.Errorf("failed to create Dockerfile: %w", err)
+		return err
+	}
+	runtimeImage := runtime.Image
+	if opts.PinDigest {
+		if baseImage, err = pinDigest(baseImage); err != nil {
+			return err
+		}
+		if runtimeImage, err = pinDigest(runtimeImage); err != nil {
+			return err
+		}
+	}
+
+	vendor := opts.Vendor || opts.VendorCreate
+	privateHosts, err := opts.Private.resolve(vendor)
+	if err != nil {
+		return err
+	}
+	if vendor {
+		if err := resolveVendor(absPath, opts.VendorCreate, opts.Diff); err != nil {
+			return err
+		}
+	}
+
+	buildInfo := readBuildInfo(absPath)
+	ldflags := ""
+	if buildInfo != nil {
+		ldflags = opts.LinkerVars.ldflags()
+	}
+
+	// Minimal images have no /root; anything non-root gets its own directory
+	workDir := "/root/"
+	if opts.NonRoot || runtime.Minimal {
+		workDir = "/app"
+	}
+
+	// Template data shared by every Dockerfile
+	shared := DockerfileData{
+		AppName:      appName,
+		BaseImage:    baseImage,
+		RuntimeImage: runtimeImage,
+		Minimal:      runtime.Minimal,
+		WorkDir:      workDir,
+		NonRoot:      opts.NonRoot,
+		User:         nonrootUID,
+		Env:          opts.Env,
+
+		HealthCheckBinary: healthcheckBinary,
+		BuildInfo:         buildInfo,
+		LDFlags:           ldflags,
+		Vendor:            vendor,
+		Private:           opts.Private,
+		PrivateHosts:      privateHosts,
 	}
-	defer file.Close()
 
-	// Execute the template
-	err = tmpl.Execute(file, data)
+	// Parse the template
+	tmpl, err := opts.Templates.parse(template.New("dockerfile"), TemplateDockerfile)
 	if err != nil {
-		return fmt.Errorf("failed to execute Dockerfile template: %w", err)
+		return fmt.Errorf("failed to parse Dockerfile template: %w", err)
+	}
+
+	var files []safewrite.File
+	for _, target := range targets {
+		if opts.AllMains {
+			logging.Infof("%s:\n", target.main.pkg)
+		}
+		data := shared
+		data.MainPackage, data.Binary = target.main.pkg, target.main.binary
+		if data.Ports, err = resolvePorts(target.main.dir, opts.Ports); err != nil {
+			return err
+		}
+		if data.HealthCheck, err = resolveHealthCheck(target.main.dir, opts, data.Ports, runtime); err != nil {
+			return err
+		}
+
+		// Execute the template
+		var content bytes.Buffer
+		if err := tmpl.Execute(&content, data); err != nil {
+			return fmt.Errorf("failed to execute Dockerfile template: %w", err)
+		}
+		files = append(files, safewrite.File{Path: target.output, Data: content.Bytes()})
+	}
+	if buildInfo == nil {
+		logging.Infoln("Note: not a git repository; omitting the OCI labels and version linker flags")
+	}
+
+	var bakeFile string
+	if opts.Bake {
+		bake, err := renderBake(absPath, appName, targets, opts.Templates)
+		if err != nil {
+			return err
+		}
+		bakeFile = bake.Path
+		files = append(files, bake)
+	}
+
+	written, err := opts.Write(files...)
+	if err != nil || !written {
+		return err
 	}
 
-	fmt.Printf("Dockerfile generated at: %s\n", absOutput)
-	fmt.Println("\nTo build the Docker image, run:")
-	fmt.Printf("docker build -t %s:latest -f %s %s\n", strings.ToLower(appName), outputFile, path)
+	if !opts.AllMains {
+		fmt.Printf("Dockerfile generated at: %s\n", absOutput)
+		reportContextSize(absPath)
+		logging.Infoln("\nTo build a multi-architecture image, run:")
+		args := buildxArgs(strings.ToLower(appName)+":latest", outputFile, DefaultPlatforms, false)
+		logging.Infof("docker %s %s\n", strings.Join(args, " "), path)
+		logging.Infoln("(or 'goforge container build --push --tag <repo/app:tag>')")
+		return nil
+	}
 
+	fmt.Printf("Dockerfiles for %d main packages generated:\n", len(targets))
+	for _, target := range targets {
+		fmt.Printf("- %s: %s\n", target.main.pkg, target.output)
+	}
+	if bakeFile != "" {
+		fmt.Printf("Bake file generated at: %s\n", bakeFile)
+	}
+	reportContextSize(absPath)
+	if bakeFile != "" {
+		logging.Infoln("\nTo build every image for every platform, run:")
+		logging.Infof("docker buildx bake -f %s\n", bakeFile)
+		return nil
+	}
+	logging.Infoln("\nTo build one image, run e.g.:")
+	target := targets[0]
+	args := buildxArgs(target.image(appName)+":latest", target.output, DefaultPlatforms, false)
+	logging.Infof("docker %s %s\n", strings.Join(args, " "), path)
+	logging.Infoln("(or pass --bake for a docker-bake.hcl that builds them all)")
 	return nil
 }
 
 // GenerateKubernetesManifests creates Kubernetes manifests for a Go application.
-func GenerateKubernetesManifests(path string, outputDir string, image string) error {
-	fmt.Println("Generating Kubernetes manifests for project at:", path)
+func GenerateKubernetesManifests(path string, outputDir string, opts KubernetesOptions) error {
+	logging.Infoln("Generating Kubernetes manifests for project at:", path)
 
 	// Get absolute paths
 	absPath, err := filepath.Abs(path)
@@ -153,70 +793,289 @@ func GenerateKubernetesManifests(path string, outputDir string, image string) er
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	absOutput, err := filepath.Abs(outputDir)
+	absOutput, err := module.ResolveOutput(absPath, outputDir)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for output: %w", err)
+		return err
+	}
+
+	if err := opts.Metadata.validate(); err != nil {
+		return err
+	}
+	if err := opts.Templates.check(); err != nil {
+		return err
+	}
+	if err := opts.WorkloadOptions.resolve(); err != nil {
+		return err
+	}
+	if err := opts.Resources.resolve(); err != nil {
+		return err
+	}
+	if err := opts.Service.resolve(opts.Kind); err != nil {
+		return err
+	}
+	replicas := DefaultReplicas
+	if opts.Replicas != nil {
+		if *opts.Replicas < 0 {
+			return fmt.Errorf("replicas cannot be negative")
+		}
+		replicas = *opts.Replicas
+	}
+	gracePeriod := DefaultGracePeriod
+	if opts.GracePeriod != nil {
+		if *opts.GracePeriod < 0 {
+			return fmt.Errorf("termination grace period cannot be negative")
+		}
+		gracePeriod = *opts.GracePeriod
 	}
 
 	// Determine app name from directory
 	appName := filepath.Base(absPath)
 
+	if opts.AllMains {
+		return generateServiceManifests(absPath, absOutput, appName, opts, replicas, gracePeriod)
+	}
+
 	// Use app name as image if not specified
+	image := opts.Image
 	if image == "" {
 		image = strings.ToLower(appName) + ":latest"
 	}
 
-	// Create template data
-	data := K8sData{
-		AppName: appName,
-		Image:   image,
+	detected, err := DetectEnvVars(absPath)
+	if err != nil {
+		return err
 	}
-
-	// Create output directory if it doesn't exist
-	err = os.MkdirAll(absOutput, 0755)
+	scaffold, err := scaffoldEnv(detected, opts.Env, opts.ConfigKeys, opts.SecretKeys)
 	if err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+		return err
 	}
 
-	// Generate deployment manifest
-	deploymentPath := filepath.Join(absOutput, "deployment.yaml")
-	deploymentFile, err := os.Create(deploymentPath)
+	data := K8sData{
+		AppName:     appName,
+		Image:       image,
+		Replicas:    replicas,
+		GracePeriod: gracePeriod,
+		Env:         opts.Env,
+		NonRoot:     opts.NonRoot,
+		User:        nonrootUID,
+		Service:     opts.Service,
+		EnvScaffold: scaffold,
+		Metadata:    opts.Metadata,
+
+		WorkloadOptions: opts.WorkloadOptions,
+		Resources:       opts.Resources,
+	}
+	files, err := renderApp(absPath, absOutput, data, opts)
 	if err != nil {
-		return fmt.Errorf("failed to create deployment manifest: %w", err)
+		return err
 	}
-	defer deploymentFile.Close()
+	namespace, err := renderNamespace(absOutput, opts.Metadata, opts.Templates)
+	if err != nil {
+		return err
+	}
+	written, err := opts.Write(append(files, namespace...)...)
+	if err != nil || !written {
+		return err
+	}
+
+	printEnvScaffold(scaffold, opts.Env)
+	fmt.Printf("Kubernetes manifests generated in: %s\n", absOutput)
+	logging.Infoln("\nTo apply the manifests, run:")
+	logging.Infoln(opts.Metadata.applyHint("-f " + absOutput))
 
-	deploymentTmpl, err := template.New("deployment").Parse(K8sDeploymentTemplate)
+	return nil
+}
+
+// generateServiceManifests creates the manifests of every main package
+// under cmd/, each named after the project and its binary, in its own
+// subdirectory of absOutput. Ports and probes are detected in each main
+// package; the environment variables are detected in the whole project and
+// scaffolded for each service. With an image set, it is the repository
+// prefix of the services' images.
+func generateServiceManifests(absPath string, absOutput string, appName string, opts KubernetesOptions, replicas int, gracePeriod int) error {
+	mains, err := findServiceMains(absPath)
 	if err != nil {
-		return fmt.Errorf("failed to parse deployment template: %w", err)
+		return err
 	}
 
-	err = deploymentTmpl.Execute(deploymentFile, data)
+	detected, err := DetectEnvVars(absPath)
+	if err != nil {
+		return err
+	}
+	scaffold, err := scaffoldEnv(detected, opts.Env, opts.ConfigKeys, opts.SecretKeys)
 	if err != nil {
-		return fmt.Errorf("failed to execute deployment template: %w", err)
+		return err
 	}
 
-	// Generate service manifest
-	servicePath := filepath.Join(absOutput, "service.yaml")
-	serviceFile, err := os.Create(servicePath)
+	var files []safewrite.File
+	var names []string
+	for _, main := range mains {
+		logging.Infof("%s:\n", main.pkg)
+		name := serviceName(appName, main.binary)
+		if !dnsLabelRe.MatchString(name) || len(name) > 63 {
+			return fmt.Errorf("%s: %q is not a valid resource name (lowercase letters, digits, and '-')", main.pkg, name)
+		}
+		image := name + ":latest"
+		if opts.Image != "" {
+			image = strings.TrimSuffix(opts.Image, "/") + "/" + image
+		}
+
+		// The services of one application share a part-of label
+		meta := opts.Metadata
+		meta.Labels = map[string]string{partOfLabel: strings.ToLower(appName)}
+		for key, value := range opts.Metadata.Labels {
+			meta.Labels[key] = value
+		}
+
+		data := K8sData{
+			AppName:     name,
+			Image:       image,
+			Replicas:    replicas,
+			GracePeriod: gracePeriod,
+			Env:         opts.Env,
+			NonRoot:     opts.NonRoot,
+			User:        nonrootUID,
+			Service:     opts.Service,
+			EnvScaffold: scaffold,
+			Metadata:    meta,
+
+			WorkloadOptions: opts.WorkloadOptions,
+			Resources:       opts.Resources,
+		}
+		serviceFiles, err := renderApp(main.dir, filepath.Join(absOutput, name), data, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", main.pkg, err)
+		}
+		files = append(files, serviceFiles...)
+		names = append(names, name)
+	}
+	namespace, err := renderNamespace(absOutput, opts.Metadata, opts.Templates)
 	if err != nil {
-		return fmt.Errorf("failed to create service manifest: %w", err)
+		return err
 	}
-	defer serviceFile.Close()
+	written, err := opts.Write(append(files, namespace...)...)
+	if err != nil || !written {
+		return err
+	}
+
+	printEnvScaffold(scaffold, opts.Env)
+	for i, main := range mains {
+		fmt.Printf("- %s (%s): %s\n", names[i], main.pkg, filepath.Join(absOutput, names[i]))
+	}
+	fmt.Printf("Kubernetes manifests for %d services generated in: %s\n", len(mains), absOutput)
+	logging.Infoln("\nTo apply the manifests, run:")
+	logging.Infoln(opts.Metadata.applyHint("-R -f " + absOutput))
+
+	return nil
+}
 
-	serviceTmpl, err := template.New("service").Parse(K8sServiceTemplate)
+// renderApp renders the manifests of one application into absOutput, with
+// its ports and probes detected in the source under srcDir.
+func renderApp(srcDir string, absOutput string, data K8sData, opts KubernetesOptions) ([]safewrite.File, error) {
+	ports, err := resolveWorkloadPorts(srcDir, opts)
 	if err != nil {
-		return fmt.Errorf("failed to parse service template: %w", err)
+		return nil, err
 	}
 
-	err = serviceTmpl.Execute(serviceFile, data)
+	probes := opts.Probes
+	if len(ports) == 0 && probes.Port == 0 && probes.Kind != ProbeExec && !probes.Disabled {
+		logging.Infoln("Note: the job listens on no port, so it gets no probes (set --probe exec or --probe-port to add them)")
+		probes.Disabled = true
+	}
+	if data.Liveness, data.Readiness, err = resolveProbes(srcDir, probes, ports); err != nil {
+		return nil, err
+	}
+	if data.Ports, err = namePorts(ports, opts.Service.PortNames, opts.Kind == KindStatefulSet); err != nil {
+		return nil, err
+	}
+	return renderManifests(absOutput, data, opts.Templates)
+}
+
+// manifestTemplate is the template of one manifest file.
+type manifestTemplate struct {
+	name     string
+	kind     string
+	template string
+}
+
+// renderManifests renders the workload manifest for absOutput, the service
+// manifest unless the workload is a batch one, and the ConfigMap and Secret
+// when variables go into them.
+func renderManifests(absOutput string, data K8sData, templates Templates) ([]safewrite.File, error) {
+	var manifests []manifestTemplate
+	switch data.Kind {
+	case KindStatefulSet:
+		manifests = append(manifests, manifestTemplate{"statefulset.yaml", "statefulset", TemplateStatefulSet})
+	case KindJob:
+		manifests = append(manifests, manifestTemplate{"job.yaml", "job", TemplateJob})
+	case KindCronJob:
+		manifests = append(manifests, manifestTemplate{"cronjob.yaml", "cronjob", TemplateCronJob})
+	default:
+		manifests = append(manifests, manifestTemplate{"deployment.yaml", "deployment", TemplateDeployment})
+	}
+	if !data.Batch() {
+		manifests = append(manifests, manifestTemplate{"service.yaml", "service", TemplateService})
+	}
+	if len(data.ConfigKeys) > 0 {
+		manifests = append(manifests, manifestTemplate{"configmap.yaml", "configmap", TemplateConfigMap})
+	}
+	if len(data.SecretKeys) > 0 {
+		manifests = append(manifests, manifestTemplate{"secret.yaml", "secret", TemplateSecret})
+	}
+
+	// The templates get a pointer, which has the methods of WorkloadOptions
+	// such as Batch
+	var files []safewrite.File
+	for _, manifest := range manifests {
+		file, err := renderManifest(templates, filepath.Join(absOutput, manifest.name), manifest.kind, manifest.template, &data)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// renderNamespace renders the Namespace manifest for absOutput when the
+// metadata names a namespace.
+func renderNamespace(absOutput string, meta Metadata, templates Templates) ([]safewrite.File, error) {
+	if meta.Namespace == "" {
+		return nil, nil
+	}
+	file, err := renderManifest(templates, filepath.Join(absOutput, namespaceManifest), "namespace", TemplateNamespace, meta)
 	if err != nil {
-		return fmt.Errorf("failed to execute service template: %w", err)
+		return nil, err
 	}
+	return []safewrite.File{file}, nil
+}
 
-	fmt.Printf("Kubernetes manifests generated in: %s\n", absOutput)
-	fmt.Println("\nTo apply the manifests, run:")
-	fmt.Printf("kubectl apply -f %s\n", absOutput)
+// renderManifest renders one manifest template for path. Templates can
+// include the TemplatePod definitions and indent them with
+// {{ include "pod" . | indent 4 }}.
+func renderManifest(templates Templates, path string, kind string, name string, data any) (safewrite.File, error) {
+	set := template.New(kind)
+	set.Funcs(template.FuncMap{
+		"include": func(name string, data any) (string, error) {
+			var b strings.Builder
+			err := set.ExecuteTemplate(&b, name, data)
+			return b.String(), err
+		},
+		"indent": func(spaces int, text string) string {
+			pad := strings.Repeat(" ", spaces)
+			return pad + strings.ReplaceAll(text, "\n", "\n"+pad)
+		},
+	})
+	if _, err := templates.parse(set, TemplatePod); err != nil {
+		return safewrite.File{}, fmt.Errorf("failed to parse pod template: %w", err)
+	}
+	tmpl, err := templates.parse(set, name)
+	if err != nil {
+		return safewrite.File{}, fmt.Errorf("failed to parse %s template: %w", kind, err)
+	}
 
-	return nil
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return safewrite.File{}, fmt.Errorf("failed to execute %s template: %w", kind, err)
+	}
+	return safewrite.File{Path: path, Data: content.Bytes()}, nil
 }
@@ -0,0 +1,252 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"goforge/pkg/logging"
+)
+
+// ContextSizeWarning is the build context size above which generating a
+// Dockerfile warns, as sending it to the builder slows every build.
+const ContextSizeWarning int64 = 100 << 20
+
+// largestContextFiles is how many of the largest files the warning lists.
+const largestContextFiles = 10
+
+// FileSize is a file of the build context, by slash-separated path relative
+// to the context directory, and its size in bytes.
+type FileSize struct {
+	Path string
+	Size int64
+}
+
+// ignoreRule is a compiled .dockerignore pattern.
+type ignoreRule struct {
+	re *regexp.Regexp
+	// negate re-includes the files the pattern matches ("!pattern").
+	negate bool
+}
+
+// EstimateContextSize returns the total size of the files in the build
+// context at path that the .dockerignore patterns in ignore leave in, and
+// those files, largest first. Patterns follow .dockerignore rules: they are
+// relative to the context, "*" and "?" do not cross a "/", "**" matches any
+// number of directories, a pattern matching a directory matches everything
+// below it, and the last matching pattern wins, so "!pattern" re-includes
+// files. Only regular files count; symlinks are sent as links.
+func EstimateContextSize(path string, ignore []string) (int64, []FileSize, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	rules, err := compileIgnore(ignore)
+	if err != nil {
+		return 0, nil, err
+	}
+	// Without exceptions nothing below an ignored directory can be sent
+	pruneDirs := true
+	for _, rule := range rules {
+		pruneDirs = pruneDirs && !rule.negate
+	}
+
+	var total int64
+	files := []FileSize{}
+	err = filepath.WalkDir(absPath, func(file string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file == absPath {
+			return nil
+		}
+		rel, err := filepath.Rel(absPath, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		ignored := ignoredByRules(rules, rel)
+
+		if entry.IsDir() {
+			if ignored && pruneDirs {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ignored || !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		files = append(files, FileSize{Path: rel, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to scan build context: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Size != files[j].Size {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Path < files[j].Path
+	})
+	return total, files, nil
+}
+
+// parseDockerignore returns the patterns of a .dockerignore file, without
+// comments and blank lines.
+func parseDockerignore(content string) []string {
+	var patterns []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// compileIgnore compiles .dockerignore patterns into rules.
+func compileIgnore(patterns []string) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	for _, pattern := range patterns {
+		rule := ignoreRule{}
+		text := strings.TrimSpace(pattern)
+		if rest, ok := strings.CutPrefix(text, "!"); ok {
+			text, rule.negate = strings.TrimSpace(rest), true
+		}
+		text = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(text)), "/")
+		if text == "" || text == "." {
+			continue
+		}
+		re, err := ignorePatternRegexp(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %q: %w", pattern, err)
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ignorePatternRegexp translates a cleaned .dockerignore pattern into an
+// anchored regular expression over slash-separated paths.
+func ignorePatternRegexp(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+1+end]
+			if rest, ok := strings.CutPrefix(class, "!"); ok {
+				class = "^" + rest
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// ignoredByRules reports whether the file or directory at rel is left out
+// of the context. A rule matches a path when it matches the path or one of
+// its parent directories, and the last matching rule decides.
+func ignoredByRules(rules []ignoreRule, rel string) bool {
+	ignored := false
+	for _, rule := range rules {
+		if ruleMatches(rule, rel) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func ruleMatches(rule ignoreRule, rel string) bool {
+	for dir := rel; ; {
+		if rule.re.MatchString(dir) {
+			return true
+		}
+		i := strings.LastIndexByte(dir, '/')
+		if i < 0 {
+			return false
+		}
+		dir = dir[:i]
+	}
+}
+
+// reportContextSize prints the estimated build context of the project at
+// absPath, using its .dockerignore or, when it has none, the default one,
+// and warns about a context over ContextSizeWarning, listing its largest
+// files. Failing to estimate it is only a warning.
+func reportContextSize(absPath string) {
+	content, err := os.ReadFile(filepath.Join(absPath, ".dockerignore"))
+	hasIgnore := err == nil
+	if !hasIgnore {
+		content = []byte(DefaultDockerignore)
+	}
+
+	size, files, err := EstimateContextSize(absPath, parseDockerignore(string(content)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: failed to estimate the build context size: %v\n", err)
+		return
+	}
+	logging.Infof("Estimated build context: %s in %d files\n", formatSize(size), len(files))
+	if !hasIgnore {
+		logging.Infoln("Note: the project has no .dockerignore; the estimate assumes the default one, which '--update dockerignore' adds")
+	}
+	if size <= ContextSizeWarning {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: the build context is %s, over %s; add large files the image does not need to .dockerignore\n",
+		formatSize(size), formatSize(ContextSizeWarning))
+	fmt.Fprintln(os.Stderr, "Largest files in the build context:")
+	if len(files) > largestContextFiles {
+		files = files[:largestContextFiles]
+	}
+	for _, file := range files {
+		fmt.Fprintf(os.Stderr, "- %s: %s\n", file.Path, formatSize(file.Size))
+	}
+}
+
+// formatSize renders a byte count with a binary unit suffix.
+func formatSize(bytes int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	size, i := float64(bytes), 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
@@ -0,0 +1,348 @@
+package container
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+	"goforge/pkg/safewrite"
+
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+// File names of the development environment, in the project directory.
+const (
+	DevComposeFile    = "docker-compose.dev.yml"
+	DevDockerfileName = "Dockerfile.dev"
+)
+
+// Watchers that rebuild the application when its source changes.
+const (
+	// WatcherAir runs github.com/air-verse/air.
+	WatcherAir = "air"
+	// WatcherLoop polls the source with a shell loop and needs nothing
+	// installed.
+	WatcherLoop = "loop"
+)
+
+// Watchers lists the supported watchers.
+var Watchers = []string{WatcherAir, WatcherLoop}
+
+// DevDockerfileTemplate is the development image: a Go toolchain that
+// rebuilds and restarts the application whenever the bind-mounted source
+// changes.
+const DevDockerfileTemplate = `# Development image for docker-compose.dev.yml, which bind-mounts the source
+# at /app; the application is rebuilt and restarted when it changes
+FROM {{ .BaseImage }} AS dev
+{{- if eq .Watcher "air" }}
+
+RUN go install github.com/air-verse/air@latest
+{{- end }}
+
+WORKDIR /app
+{{- range .Ports }}
+EXPOSE {{ . }}
+{{- end }}
+{{- if eq .Watcher "air" }}
+
+# The binary and air's logs stay outside the bind-mounted source
+CMD ["air", "--tmp_dir", "/tmp/air", "--build.cmd", "go build -o /tmp/app {{ .MainPackage }}", "--build.bin", "/tmp/app", "--build.exclude_dir", "vendor,testdata,tmp"]
+{{- else }}
+
+# Rebuild and restart whenever a Go file, go.mod, or go.sum is newer than
+# the last build
+CMD pid=; while :; do \
+      touch /tmp/.built; \
+      if go build -o /tmp/app {{ .MainPackage }}; then /tmp/app & pid=$!; fi; \
+      until find . \( -name '*.go' -o -name go.mod -o -name go.sum \) -newer /tmp/.built | grep -q .; do sleep 1; done; \
+      if [ -n "$pid" ]; then kill $pid; wait $pid; pid=; fi; \
+    done
+{{- end }}
+`
+
+// DevComposeTemplate is the development compose file: the application built
+// from the dev image with the source and Go caches mounted, and its backing
+// services.
+const DevComposeTemplate = `# Development environment; start it with
+#   docker compose -f ` + DevComposeFile + ` up --build
+# The application rebuilds in place when the source changes.
+services:
+  app:
+    build:
+      context: .
+      dockerfile: ` + DevDockerfileName + `
+      target: dev
+    # Forwards Ctrl+C and docker stop to the watcher
+    init: true
+    {{- if .Ports }}
+    ports:
+    {{- range .Ports }}
+      - "{{ . }}:{{ . }}"
+    {{- end }}
+    {{- end }}
+    {{- if .Env }}
+    environment:
+    {{- range .Env }}
+      {{ .Name }}: {{ printf "%q" .Value }}
+    {{- end }}
+    {{- end }}
+    volumes:
+      - .:/app
+      - go-mod-cache:/go/pkg/mod
+      - go-build-cache:/root/.cache/go-build
+    {{- if .Services }}
+    depends_on:
+    {{- range .Services }}
+      {{ .Name }}:
+        condition: service_healthy
+    {{- end }}
+    {{- end }}
+{{- range .Services }}
+
+  {{ .Name }}:
+    image: {{ .Image }}
+    {{- with .Command }}
+    command: {{ . }}
+    {{- end }}
+    {{- if .Env }}
+    environment:
+    {{- range .Env }}
+      {{ .Name }}: {{ printf "%q" .Value }}
+    {{- end }}
+    {{- end }}
+    ports:
+      - "{{ .Port }}:{{ .Port }}"
+    healthcheck:
+      test: ["CMD-SHELL", {{ printf "%q" .HealthCheck }}]
+      interval: 5s
+      timeout: 5s
+      retries: 20
+    {{- if .DataDir }}
+    volumes:
+      - {{ .Name }}-data:{{ .DataDir }}
+    {{- end }}
+{{- end }}
+
+volumes:
+  go-mod-cache:
+  go-build-cache:
+{{- range .Services }}
+{{- if .DataDir }}
+  {{ .Name }}-data:
+{{- end }}
+{{- end }}
+`
+
+// DevOptions configures the development environment.
+type DevOptions struct {
+	// Main is the main package to run; it is detected when the project has
+	// only one.
+	Main string
+	// BaseImage is the Go image; empty means the golang image matching the
+	// go.mod Go version.
+	BaseImage string
+	// Watcher is air or loop; empty means air.
+	Watcher string
+	Env     []EnvVar
+	// Ports overrides the ports detected from the source; each is
+	// published on the same host port.
+	Ports []int
+	// NoServices leaves out the detected backing services.
+	NoServices bool
+	// ServiceUser and ServicePassword are the credentials the backing
+	// services are set up with; empty means app.
+	ServiceUser     string
+	ServicePassword string
+	// Run starts the environment with docker compose once it is written,
+	// and tears it down on Ctrl+C; a dry run only previews the files.
+	Run bool
+	// Templates overrides the built-in templates.
+	Templates Templates
+	// Options decides whether existing files are replaced or diffed.
+	safewrite.Options
+}
+
+// DevData holds data for the development templates. Template overrides are
+// executed with it too, so fields are only ever added.
+type DevData struct {
+	BaseImage   string
+	MainPackage string
+	// Watcher is air or loop.
+	Watcher string
+	Ports   []int
+	// Env holds the variables set with --env and those connecting the app
+	// to its backing services.
+	Env      []EnvVar
+	Services []BackingService
+}
+
+// GenerateDev writes a development Dockerfile and compose file for the
+// project at path that run the application under a file watcher, with the
+// backing services its go.mod requires clients for. With Run, it then
+// starts the environment; existing files are used as they are unless
+// Force regenerates them.
+func GenerateDev(path string, opts DevOptions) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	composeFile := filepath.Join(absPath, DevComposeFile)
+	dockerfile := filepath.Join(absPath, DevDockerfileName)
+
+	if opts.Run && opts.Diff {
+		return fmt.Errorf("--run cannot be combined with --diff")
+	}
+	if opts.Run && !opts.Force && !safewrite.DryRun() && exists(composeFile) && exists(dockerfile) {
+		logging.Infof("Using the existing %s and %s (--force regenerates them)\n", DevComposeFile, DevDockerfileName)
+		return runDev(composeFile)
+	}
+
+	logging.Infoln("Generating development environment for project at:", path)
+	if err := opts.Templates.check(); err != nil {
+		return err
+	}
+
+	watcher := opts.Watcher
+	if watcher == "" {
+		watcher = WatcherAir
+	}
+	if !slices.Contains(Watchers, watcher) {
+		return fmt.Errorf("invalid watcher %q (expected %s)", watcher, strings.Join(Watchers, " or "))
+	}
+	mainPackage, _, err := resolveMain(absPath, opts.Main)
+	if err != nil {
+		return err
+	}
+	baseImage, err := resolveBaseImage(absPath, opts.BaseImage)
+	if err != nil {
+		return err
+	}
+	ports, err := resolvePorts(absPath, opts.Ports)
+	if err != nil {
+		return err
+	}
+
+	var services []BackingService
+	if !opts.NoServices {
+		if services, err = DetectBackingServices(absPath, opts.ServiceUser, opts.ServicePassword); err != nil {
+			return err
+		}
+	}
+	detected, err := DetectEnvVars(absPath)
+	if err != nil {
+		return err
+	}
+	connect := connectEnv(services, detected, opts.Env)
+
+	data := DevData{
+		BaseImage:   baseImage,
+		MainPackage: mainPackage,
+		Watcher:     watcher,
+		Ports:       ports,
+		Env:         append(slices.Clone(opts.Env), connect...),
+		Services:    services,
+	}
+	files, err := renderDev(composeFile, dockerfile, data, opts.Templates)
+	if err != nil {
+		return err
+	}
+	written, err := opts.Write(files...)
+	if err != nil || !written {
+		return err
+	}
+
+	printBackingServices(services, connect)
+	fmt.Printf("Development environment generated: %s, %s\n", composeFile, dockerfile)
+	if opts.Run {
+		return runDev(composeFile)
+	}
+	logging.Infoln("\nTo start it, run:")
+	logging.Infof("docker compose -f %s up --build\n", composeFile)
+	logging.Infoln("(or 'goforge container dev --run')")
+	return nil
+}
+
+// renderDev renders the compose file and the dev Dockerfile.
+func renderDev(composeFile string, dockerfile string, data DevData, templates Templates) ([]safewrite.File, error) {
+	var files []safewrite.File
+	for _, file := range []struct {
+		path     string
+		kind     string
+		template string
+	}{
+		{composeFile, "compose file", TemplateDevCompose},
+		{dockerfile, "dev Dockerfile", TemplateDevDockerfile},
+	} {
+		tmpl, err := templates.parse(template.New(file.kind), file.template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s template: %w", file.kind, err)
+		}
+		var content bytes.Buffer
+		if err := tmpl.Execute(&content, data); err != nil {
+			return nil, fmt.Errorf("failed to execute %s template: %w", file.kind, err)
+		}
+		files = append(files, safewrite.File{Path: file.path, Data: content.Bytes()})
+	}
+
+	var parsed any
+	if err := yaml.Unmarshal(files[0].Data, &parsed); err != nil {
+		return nil, fmt.Errorf("generated compose file is not valid YAML: %w", err)
+	}
+	return files, nil
+}
+
+// runDev runs docker compose up on composeFile with its output streamed to
+// the terminal. Ctrl+C reaches compose, which stops the containers; they
+// are then removed with docker compose down, keeping the cache and data
+// volumes.
+func runDev(composeFile string) error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("docker not found in PATH; install Docker from https://docs.docker.com/get-docker/")
+	}
+
+	// Compose handles the interrupt; GoForge only waits for it to finish
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	up := proc.Command("docker", "compose", "-f", composeFile, "up", "--build")
+	up.Stdin = os.Stdin
+	up.Stdout = os.Stdout
+	up.Stderr = os.Stderr
+	upErr := up.Run()
+
+	interrupted := len(interrupts) > 0
+	logging.Infoln("\nRemoving the development containers")
+	down := proc.Command("docker", "compose", "-f", composeFile, "down")
+	down.Stdout = os.Stdout
+	down.Stderr = os.Stderr
+	if err := down.Run(); err != nil {
+		return fmt.Errorf("docker compose down failed: %w", err)
+	}
+
+	if upErr != nil && !interrupted {
+		err := fmt.Errorf("docker compose up failed: %w", upErr)
+		var exitErr *exec.ExitError
+		if errors.As(upErr, &exitErr) && exitErr.ExitCode() > 0 {
+			return exitcode.WithStatus(err, exitErr.ExitCode())
+		}
+		return err
+	}
+	return nil
+}
+
+// exists reports whether a file exists at path.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
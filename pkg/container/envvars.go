@@ -0,0 +1,164 @@
+package container
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// sensitiveFragments mark environment variables that belong in a Secret.
+var sensitiveFragments = []string{"TOKEN", "PASSWORD", "PASSWD", "SECRET", "KEY", "CREDENTIAL", "PRIVATE"}
+
+// envTags are the struct tags that name an environment variable, used by
+// kelseyhightower/envconfig and caarlos0/env.
+var envTags = []string{"envconfig", "env"}
+
+// EnvScaffold is the split of the detected environment variables between
+// the generated ConfigMap and Secret.
+type EnvScaffold struct {
+	ConfigKeys []string
+	SecretKeys []string
+}
+
+// DetectEnvVars returns the sorted names of the environment variables the
+// project reads with os.Getenv or os.LookupEnv, or declares in envconfig and
+// env struct tags.
+func DetectEnvVars(path string) ([]string, error) {
+	found := make(map[string]bool)
+
+	err := walkSource(path, func(file string) error {
+		fset := token.NewFileSet()
+		node, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			// Unparseable files cannot contribute variables
+			return nil
+		}
+
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				sel, ok := n.Fun.(*ast.SelectorExpr)
+				if !ok || len(n.Args) == 0 || (sel.Sel.Name != "Getenv" && sel.Sel.Name != "LookupEnv") {
+					return true
+				}
+				if pkg, ok := sel.X.(*ast.Ident); ok && (pkg.Name == "os" || pkg.Name == "syscall") {
+					if name, ok := stringLit(n.Args[0]); ok && envNameRe.MatchString(name) {
+						found[name] = true
+					}
+				}
+			case *ast.Field:
+				if name := tagEnvName(n.Tag); name != "" {
+					found[name] = true
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan source for environment variables: %w", err)
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// tagEnvName returns the environment variable named by a field's envconfig
+// or env tag, if any.
+func tagEnvName(tag *ast.BasicLit) string {
+	if tag == nil {
+		return ""
+	}
+	value, err := strconv.Unquote(tag.Value)
+	if err != nil {
+		return ""
+	}
+
+	for _, key := range envTags {
+		// env:"NAME,required" carries options after the name
+		name, _, _ := strings.Cut(reflect.StructTag(value).Get(key), ",")
+		if envNameRe.MatchString(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// IsSensitive reports whether an environment variable looks like it holds a
+// credential.
+func IsSensitive(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, fragment := range sensitiveFragments {
+		if strings.Contains(upper, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// scaffoldEnv splits detected variables between the ConfigMap and the Secret.
+// Variables set explicitly are left out; config and secret force a variable
+// into the ConfigMap or the Secret regardless of its name.
+func scaffoldEnv(detected []string, explicit []EnvVar, config []string, secret []string) (EnvScaffold, error) {
+	for _, name := range config {
+		if slices.Contains(secret, name) {
+			return EnvScaffold{}, fmt.Errorf("%s cannot be both config and secret", name)
+		}
+	}
+
+	names := slices.Clone(detected)
+	for _, name := range append(slices.Clone(config), secret...) {
+		if !envNameRe.MatchString(name) {
+			return EnvScaffold{}, fmt.Errorf("invalid environment variable name %q", name)
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var scaffold EnvScaffold
+	for _, name := range names {
+		if slices.ContainsFunc(explicit, func(env EnvVar) bool { return env.Name == name }) {
+			continue
+		}
+		switch {
+		case slices.Contains(config, name):
+			scaffold.ConfigKeys = append(scaffold.ConfigKeys, name)
+		case slices.Contains(secret, name) || IsSensitive(name):
+			scaffold.SecretKeys = append(scaffold.SecretKeys, name)
+		default:
+			scaffold.ConfigKeys = append(scaffold.ConfigKeys, name)
+		}
+	}
+	return scaffold, nil
+}
+
+// printEnvScaffold lists the detected variables and where each one went.
+func printEnvScaffold(scaffold EnvScaffold, explicit []EnvVar) {
+	if len(scaffold.ConfigKeys)+len(scaffold.SecretKeys)+len(explicit) == 0 {
+		return
+	}
+
+	fmt.Println("Environment variables:")
+	for _, name := range scaffold.ConfigKeys {
+		fmt.Printf("- %s: ConfigMap\n", name)
+	}
+	for _, name := range scaffold.SecretKeys {
+		fmt.Printf("- %s: Secret\n", name)
+	}
+	for _, env := range explicit {
+		fmt.Printf("- %s: set with --env\n", env.Name)
+	}
+}
@@ -0,0 +1,56 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+
+	"goforge/pkg/logging"
+)
+
+// healthcheckBinary is the HTTP client built for runtime images without wget.
+const healthcheckBinary = "healthcheck"
+
+// HealthCheck is the HEALTHCHECK instruction of a generated Dockerfile.
+type HealthCheck struct {
+	URL string
+	// Helper checks the URL with a small HTTP client compiled in the builder
+	// stage, for minimal runtime images that have no wget.
+	Helper bool
+}
+
+// resolveHealthCheck returns the HEALTHCHECK for the image: an HTTP GET
+// against the given path, or the health route detected in the source, on the
+// first port. It returns nil when disabled or when there is nothing to check.
+func resolveHealthCheck(absPath string, opts DockerfileOptions, ports []int, runtime RuntimeImage) (*HealthCheck, error) {
+	if opts.NoHealthCheck {
+		return nil, nil
+	}
+
+	path := opts.HealthCheckPath
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("health check path %q must start with /", path)
+	}
+	if len(ports) == 0 {
+		if path != "" {
+			return nil, fmt.Errorf("--healthcheck-path needs a port; pass --port")
+		}
+		return nil, nil
+	}
+
+	if path == "" {
+		var err error
+		if path, _, err = DetectHealthPaths(absPath); err != nil {
+			return nil, err
+		}
+		if path == "" {
+			logging.Infoln("Note: no health route detected; set --healthcheck-path to add a HEALTHCHECK")
+			return nil, nil
+		}
+		logging.Infof("Detected health route %s for the HEALTHCHECK\n", path)
+	}
+
+	return &HealthCheck{
+		URL:    fmt.Sprintf("http://localhost:%d%s", ports[0], path),
+		Helper: runtime.Minimal,
+	}, nil
+}
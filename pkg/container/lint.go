@@ -0,0 +1,312 @@
+package container
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+
+	"golang.org/x/exp/slices"
+)
+
+// Dockerfile rules.
+const (
+	RuleRootUser      = "root-user"
+	RuleLatestTag     = "latest-tag"
+	RuleRemoteAdd     = "remote-add"
+	RuleNoHealthCheck = "missing-healthcheck"
+	RuleUnpinnedBase  = "unpinned-base"
+	RuleShellFormCmd  = "shell-form-cmd"
+)
+
+// DockerfileInstruction is one instruction of a Dockerfile, with its line
+// continuations joined.
+type DockerfileInstruction struct {
+	// Line is the line the instruction starts on.
+	Line int
+	// EndLine is the line it ends on, after its continuations.
+	EndLine int
+	// Command is the upper-case instruction, e.g. FROM.
+	Command string
+	Args    string
+}
+
+// DockerfileFinding is a security or best-practice issue in a Dockerfile.
+type DockerfileFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Line     int    `json:"line"`
+	Message  string `json:"message"`
+}
+
+// DockerfileLintOptions configures LintDockerfile.
+type DockerfileLintOptions struct {
+	// Threshold is the lowest severity (low, medium, high, or critical)
+	// that fails the scan.
+	Threshold string
+	// JSON prints the findings as a JSON array.
+	JSON bool
+}
+
+// ParseDockerfile splits a Dockerfile into instructions. Comments and blank
+// lines are dropped, and lines ending in a backslash are joined with the
+// next.
+func ParseDockerfile(r io.Reader) ([]DockerfileInstruction, error) {
+	var instructions []DockerfileInstruction
+	var current *DockerfileInstruction
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			// Comments may appear between continuation lines
+			continue
+		}
+
+		continued := strings.HasSuffix(text, "\\")
+		text = strings.TrimSpace(strings.TrimSuffix(text, "\\"))
+
+		if current == nil {
+			command, args, _ := strings.Cut(text, " ")
+			current = &DockerfileInstruction{Line: line, Command: strings.ToUpper(command), Args: strings.TrimSpace(args)}
+		} else if text != "" {
+			current.Args = strings.TrimSpace(current.Args + " " + text)
+		}
+		current.EndLine = line
+
+		if !continued {
+			instructions = append(instructions, *current)
+			current = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		instructions = append(instructions, *current)
+	}
+	return instructions, nil
+}
+
+// CheckDockerfile applies the rules to parsed instructions and returns the
+// findings ordered by line.
+func CheckDockerfile(instructions []DockerfileInstruction) []DockerfileFinding {
+	var findings []DockerfileFinding
+	report := func(rule string, severity string, line int, format string, args ...any) {
+		findings = append(findings, DockerfileFinding{Rule: rule, Severity: severity, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	stages := make(map[string]bool)
+	finalFrom, finalImage := 0, ""
+	var user *DockerfileInstruction
+	hasHealthCheck := false
+
+	for i, inst := range instructions {
+		switch inst.Command {
+		case "FROM":
+			image, stage := parseFrom(inst.Args)
+			finalFrom, finalImage, user, hasHealthCheck = inst.Line, image, nil, false
+			isStage := stages[strings.ToLower(image)]
+			// Later stages can build on this one by name
+			if stage != "" {
+				stages[stage] = true
+			}
+			if isStage || image == "scratch" || strings.Contains(image, "$") {
+				continue
+			}
+
+			if strings.Contains(image, "@sha256:") {
+				continue
+			}
+			if tag := imageTag(image); tag == "" || tag == "latest" {
+				report(RuleLatestTag, "MEDIUM", inst.Line, "%s uses the latest tag; pin a version so builds are reproducible", image)
+			}
+			report(RuleUnpinnedBase, "LOW", inst.Line, "%s is not pinned by digest; add @sha256:... (goforge container dockerfile --pin-digest)", image)
+		case "USER":
+			user = &instructions[i]
+		case "HEALTHCHECK":
+			hasHealthCheck = true
+		case "ADD":
+			for _, source := range addSources(inst.Args) {
+				if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+					report(RuleRemoteAdd, "HIGH", inst.Line, "ADD downloads %s without verifying it; download with a checksum in RUN, or use ADD --checksum", source)
+				}
+			}
+		case "CMD", "ENTRYPOINT":
+			if !strings.HasPrefix(inst.Args, "[") {
+				report(RuleShellFormCmd, "LOW", inst.Line, "%s uses the shell form, so the app does not receive SIGTERM; use the exec form [\"...\"]", inst.Command)
+			}
+		}
+	}
+
+	if finalFrom != 0 {
+		// The distroless :nonroot images already default to an unprivileged user
+		if user == nil && !strings.Contains(finalImage, "nonroot") {
+			report(RuleRootUser, "HIGH", finalFrom, "the final stage runs as root; add a USER with a non-zero numeric UID")
+		} else if user != nil && isRootUser(user.Args) {
+			report(RuleRootUser, "HIGH", user.Line, "USER %s runs as root; use a non-zero numeric UID", user.Args)
+		}
+		if !hasHealthCheck {
+			report(RuleNoHealthCheck, "LOW", finalFrom, "the final stage has no HEALTHCHECK (goforge container dockerfile --healthcheck-path)")
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Line < findings[j].Line
+	})
+	return findings
+}
+
+// parseFrom returns the image and stage name of a FROM instruction.
+func parseFrom(args string) (string, string) {
+	var fields []string
+	for _, field := range strings.Fields(args) {
+		if !strings.HasPrefix(field, "--") {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return "", ""
+	}
+	if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+		return fields[0], strings.ToLower(fields[2])
+	}
+	return fields[0], ""
+}
+
+// imageTag returns the tag of an image reference, or "" when it has none.
+func imageTag(image string) string {
+	name := image
+	// A registry port is not a tag
+	if slash := strings.LastIndex(name, "/"); slash >= 0 {
+		name = name[slash+1:]
+	}
+	_, tag, _ := strings.Cut(name, ":")
+	return tag
+}
+
+// addSources returns the sources of an ADD instruction in either form.
+func addSources(args string) []string {
+	var fields []string
+	if strings.HasPrefix(args, "[") {
+		if err := json.Unmarshal([]byte(args), &fields); err != nil {
+			return nil
+		}
+	} else {
+		for _, field := range strings.Fields(args) {
+			if !strings.HasPrefix(field, "--") {
+				fields = append(fields, field)
+			}
+		}
+	}
+	if len(fields) < 2 {
+		return nil
+	}
+	return fields[:len(fields)-1]
+}
+
+// isRootUser reports whether a USER argument names root.
+func isRootUser(user string) bool {
+	name, _, _ := strings.Cut(strings.TrimSpace(user), ":")
+	return name == "root" || name == "0"
+}
+
+// IsDockerfile reports whether path names an existing file, which container
+// scan lints instead of treating it as an image reference.
+func IsDockerfile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// LintDockerfile parses the Dockerfile at path, prints its findings grouped
+// by severity, and fails when any reach the threshold.
+func LintDockerfile(path string, opts DockerfileLintOptions) error {
+	if opts.Threshold == "" {
+		opts.Threshold = DefaultSeverityThreshold
+	}
+	if !ValidSeverityThreshold(opts.Threshold) {
+		return fmt.Errorf("invalid severity threshold %q (expected low, medium, high, or critical)", opts.Threshold)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	file, err := os.Open(absPath)
+	if err != nil {
+		return fmt.Errorf("failed to open Dockerfile: %w", err)
+	}
+	defer file.Close()
+
+	if !opts.JSON {
+		logging.Infoln("Scanning Dockerfile:", absPath)
+	}
+	instructions, err := ParseDockerfile(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse Dockerfile: %w", err)
+	}
+	if !slices.ContainsFunc(instructions, func(inst DockerfileInstruction) bool { return inst.Command == "FROM" }) {
+		return fmt.Errorf("%s has no FROM instruction; is it a Dockerfile?", absPath)
+	}
+
+	findings := CheckDockerfile(instructions)
+	if opts.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if findings == nil {
+			findings = []DockerfileFinding{}
+		}
+		if err := encoder.Encode(findings); err != nil {
+			return fmt.Errorf("failed to encode findings: %w", err)
+		}
+	} else {
+		printDockerfileFindings(absPath, findings)
+	}
+
+	failing := 0
+	for _, finding := range findings {
+		if severityRank(finding.Severity) >= severityRank(opts.Threshold) {
+			failing++
+		}
+	}
+	if failing > 0 {
+		return exitcode.Policyf("%d Dockerfile findings are at or above %s severity", failing, strings.ToUpper(opts.Threshold))
+	}
+	return nil
+}
+
+// printDockerfileFindings prints the findings grouped by severity.
+func printDockerfileFindings(path string, findings []DockerfileFinding) {
+	fmt.Printf("\nDockerfile Scan Results (%s):\n", path)
+	if len(findings) == 0 {
+		fmt.Println("- No issues found")
+		return
+	}
+	fmt.Printf("- %d issues found\n", len(findings))
+
+	for i := len(severities) - 1; i >= 0; i-- {
+		var group []DockerfileFinding
+		for _, finding := range findings {
+			if finding.Severity == severities[i] {
+				group = append(group, finding)
+			}
+		}
+		if len(group) == 0 {
+			continue
+		}
+
+		fmt.Printf("\n%s (%d):\n", severities[i], len(group))
+		for _, finding := range group {
+			fmt.Printf("  line %d [%s] %s\n", finding.Line, finding.Rule, finding.Message)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package container
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"goforge/pkg/logging"
+)
+
+// defaultBinary is the binary name used for a main package at the project root.
+const defaultBinary = "app"
+
+// FindMainPackages returns the directories under path, relative to it and in
+// "./cmd/server" form, that hold a main package with a main function.
+func FindMainPackages(path string) ([]string, error) {
+	seen := make(map[string]bool)
+	err := walkSource(path, func(file string) error {
+		node, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+		if err != nil || node.Name.Name != "main" {
+			return nil
+		}
+
+		for _, decl := range node.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" {
+				rel, err := filepath.Rel(path, filepath.Dir(file))
+				if err != nil {
+					return err
+				}
+				seen[packagePath(rel)] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan source for main packages: %w", err)
+	}
+
+	var mains []string
+	for main := range seen {
+		mains = append(mains, main)
+	}
+	sort.Strings(mains)
+	return mains, nil
+}
+
+// resolveMain returns the main package to build and the binary name. An
+// explicit package must be one of the detected ones; otherwise the project
+// must have exactly one.
+func resolveMain(absPath string, explicit string) (string, string, error) {
+	mains, err := FindMainPackages(absPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	main := ""
+	switch {
+	case explicit != "":
+		main = packagePath(filepath.Clean(explicit))
+		found := false
+		for _, candidate := range mains {
+			found = found || candidate == main
+		}
+		if !found {
+			return "", "", fmt.Errorf("%s is not a main package; candidates: %s", explicit, candidateList(mains))
+		}
+	case len(mains) == 0:
+		return "", "", fmt.Errorf("no main package found in %s", absPath)
+	case len(mains) > 1:
+		return "", "", fmt.Errorf("found several main packages (%s); choose one with --main", candidateList(mains))
+	default:
+		main = mains[0]
+		if main != "." {
+			logging.Infof("Detected main package: %s\n", main)
+		}
+	}
+
+	binary := defaultBinary
+	if main != "." {
+		binary = filepath.Base(main)
+	}
+	return main, binary, nil
+}
+
+// packagePath turns a relative directory into a "./dir" package path.
+func packagePath(rel string) string {
+	rel = filepath.ToSlash(rel)
+	if rel == "." || strings.HasPrefix(rel, "./") {
+		return rel
+	}
+	return "./" + rel
+}
+
+// candidateList formats main packages for an error message.
+func candidateList(mains []string) string {
+	if len(mains) == 0 {
+		return "none"
+	}
+	return strings.Join(mains, ", ")
+}
+
+// walkSource calls fn for every non-test Go file under root, skipping hidden,
+// vendor, and testdata directories.
+func walkSource(root string, fn func(file string) error) error {
+	return filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := info.Name()
+		if info.IsDir() {
+			if file != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+
+		return fn(file)
+	})
+}
+
+// serviceMain is a main package built into an image of its own.
+type serviceMain struct {
+	// pkg is the package path, e.g. "./cmd/api".
+	pkg string
+	// binary is the binary name, e.g. "api".
+	binary string
+	// dir is the package's absolute directory, where its ports and health
+	// routes are detected.
+	dir string
+}
+
+// findServiceMains returns the main packages under the project's cmd
+// directory, one per service of a monorepo. Their binary names must differ,
+// since they name the generated files and resources.
+func findServiceMains(absPath string) ([]serviceMain, error) {
+	mains, err := FindMainPackages(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []serviceMain
+	seen := make(map[string]string)
+	for _, main := range mains {
+		if !strings.HasPrefix(main, "./cmd/") {
+			continue
+		}
+		binary := strings.ToLower(filepath.Base(main))
+		if other, ok := seen[binary]; ok {
+			return nil, fmt.Errorf("main packages %s and %s both build a binary named %s", other, main, binary)
+		}
+		seen[binary] = main
+		services = append(services, serviceMain{pkg: main, binary: binary, dir: filepath.Join(absPath, filepath.FromSlash(main))})
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no main packages under %s; --all-mains builds every cmd/<name> package (candidates: %s)",
+			filepath.Join(absPath, "cmd"), candidateList(mains))
+	}
+	return services, nil
+}
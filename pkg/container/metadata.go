@@ -0,0 +1,102 @@
+package container
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// appLabel is the label generated Deployments select their pods by.
+const appLabel = "app"
+
+// partOfLabel groups the services of one application generated with
+// --all-mains.
+const partOfLabel = "app.kubernetes.io/part-of"
+
+// labelNameRe matches the name part of a label or annotation key, and a
+// non-empty label value.
+var labelNameRe = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+// dnsSubdomainRe matches the optional prefix of a label or annotation key.
+var dnsSubdomainRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// Metadata is the namespace, labels, and annotations shared by every
+// generated Kubernetes resource.
+type Metadata struct {
+	// Namespace, when set, is added to every namespaced resource and a
+	// Namespace manifest is generated for it.
+	Namespace string
+	// Labels are added to the resources and their pods, next to the app
+	// label used as the selector.
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// ParseLabels parses key=value pairs into Kubernetes labels.
+func ParseLabels(pairs []string) (map[string]string, error) {
+	labels, err := parseKeyValues(pairs, "label")
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range labels {
+		if key == appLabel {
+			return nil, fmt.Errorf("label %q is reserved for the selector", appLabel)
+		}
+		if value != "" && (len(value) > 63 || !labelNameRe.MatchString(value)) {
+			return nil, fmt.Errorf("invalid value %q for label %s", value, key)
+		}
+	}
+	return labels, nil
+}
+
+// ParseAnnotations parses key=value pairs into Kubernetes annotations.
+func ParseAnnotations(pairs []string) (map[string]string, error) {
+	return parseKeyValues(pairs, "annotation")
+}
+
+// parseKeyValues parses key=value pairs whose keys follow the Kubernetes
+// [prefix/]name format.
+func parseKeyValues(pairs []string, kind string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	values := make(map[string]string)
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || !validMetadataKey(key) {
+			return nil, fmt.Errorf("invalid %s %q (expected [prefix/]name=value)", kind, pair)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// validMetadataKey reports whether key is a valid label or annotation key.
+func validMetadataKey(key string) bool {
+	name := key
+	if prefix, rest, ok := strings.Cut(key, "/"); ok {
+		if len(prefix) > 253 || !dnsSubdomainRe.MatchString(prefix) {
+			return false
+		}
+		name = rest
+	}
+	return len(name) <= 63 && labelNameRe.MatchString(name)
+}
+
+// validate checks the namespace name.
+func (m Metadata) validate() error {
+	if m.Namespace != "" && (len(m.Namespace) > 63 || !dnsLabelRe.MatchString(m.Namespace)) {
+		return fmt.Errorf("invalid namespace %q (lowercase letters, digits, and '-')", m.Namespace)
+	}
+	return nil
+}
+
+// applyHint returns the kubectl apply command for args, scoped to the
+// namespace when one is set.
+func (m Metadata) applyHint(args string) string {
+	if m.Namespace != "" {
+		return fmt.Sprintf("kubectl apply -n %s %s", m.Namespace, args)
+	}
+	return "kubectl apply " + args
+}
@@ -0,0 +1,266 @@
+package container
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"goforge/pkg/logging"
+)
+
+// DefaultPort is used when no listening port can be detected.
+const DefaultPort = 8080
+
+// listenMethods are calls whose address argument names the listening port:
+// net/http, net, and the Run/Start/Listen methods of common web frameworks.
+var listenMethods = map[string]bool{
+	"ListenAndServe":    true,
+	"ListenAndServeTLS": true,
+	"Listen":            true,
+	"Run":               true,
+	"RunTLS":            true,
+	"Start":             true,
+	"StartTLS":          true,
+}
+
+// auxiliaryNames mark flags for side listeners rather than the main server.
+var auxiliaryNames = []string{"metrics", "debug", "pprof", "admin", "health"}
+
+// pprofPort is the conventional net/http/pprof port, never the main server.
+const pprofPort = 6060
+
+// portLiteralRe matches a bare port default such as "3000" or ":3000".
+var portLiteralRe = regexp.MustCompile(`^:?(\d{2,5})$`)
+
+// detectedPort is a port found in source; auxiliary ports serve metrics,
+// debugging, and the like.
+type detectedPort struct {
+	port      int
+	auxiliary bool
+}
+
+// DetectPorts parses the project's Go source and returns the ports it appears
+// to listen on in the order they were found, with auxiliary ports (metrics,
+// debug, pprof) after the rest.
+func DetectPorts(path string) ([]int, error) {
+	var primary, auxiliary []int
+	seen := make(map[int]bool)
+	add := func(found detectedPort) {
+		if found.port <= 0 || found.port > 65535 || seen[found.port] {
+			return
+		}
+		seen[found.port] = true
+		if found.auxiliary || found.port == pprofPort {
+			auxiliary = append(auxiliary, found.port)
+		} else {
+			primary = append(primary, found.port)
+		}
+	}
+
+	err := walkSource(path, func(file string) error {
+		fset := token.NewFileSet()
+		node, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			// Unparseable files cannot contribute ports
+			return nil
+		}
+
+		for _, found := range filePorts(node) {
+			add(found)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan source for ports: %w", err)
+	}
+
+	return append(primary, auxiliary...), nil
+}
+
+// filePorts returns the ports found in a single file.
+func filePorts(node *ast.File) []detectedPort {
+	var ports []detectedPort
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			// Ports read from the environment usually have a literal fallback
+			if n.Body != nil && readsPortEnv(n.Body) {
+				for _, port := range envFallbackPorts(n.Body) {
+					ports = append(ports, detectedPort{port: port})
+				}
+			}
+		case *ast.CallExpr:
+			ports = append(ports, callPorts(n)...)
+		case *ast.KeyValueExpr:
+			// http.Server{Addr: ":8080"}
+			if key, ok := n.Key.(*ast.Ident); ok && key.Name == "Addr" {
+				if port, ok := addrPort(n.Value); ok {
+					ports = append(ports, detectedPort{port: port})
+				}
+			}
+		}
+		return true
+	})
+
+	return ports
+}
+
+// callPorts extracts ports from listen calls and port/address flag defaults.
+func callPorts(call *ast.CallExpr) []detectedPort {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+
+	if listenMethods[sel.Sel.Name] {
+		// net.Listen("tcp", addr) puts the address second
+		for _, arg := range call.Args {
+			if port, ok := addrPort(arg); ok {
+				return []detectedPort{{port: port}}
+			}
+		}
+	}
+
+	if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "flag" {
+		return flagPorts(sel.Sel.Name, call.Args)
+	}
+
+	return nil
+}
+
+// flagPorts returns the default of a flag whose name mentions a port or address.
+func flagPorts(fn string, args []ast.Expr) []detectedPort {
+	// flag.IntVar(&p, "port", 3000, ...) has the name one argument later
+	offset := 0
+	if strings.HasSuffix(fn, "Var") {
+		offset = 1
+	}
+	if len(args) < offset+2 {
+		return nil
+	}
+
+	name, ok := stringLit(args[offset])
+	if !ok {
+		return nil
+	}
+	name = strings.ToLower(name)
+	if !strings.Contains(name, "port") && !strings.Contains(name, "addr") {
+		return nil
+	}
+
+	auxiliary := false
+	for _, aux := range auxiliaryNames {
+		auxiliary = auxiliary || strings.Contains(name, aux)
+	}
+
+	if port, ok := addrPort(args[offset+1]); ok {
+		return []detectedPort{{port: port, auxiliary: auxiliary}}
+	}
+	if lit, ok := args[offset+1].(*ast.BasicLit); ok && lit.Kind == token.INT {
+		if port, err := strconv.Atoi(lit.Value); err == nil {
+			return []detectedPort{{port: port, auxiliary: auxiliary}}
+		}
+	}
+	return nil
+}
+
+// readsPortEnv reports whether body calls os.Getenv or os.LookupEnv with a
+// variable name mentioning PORT or ADDR.
+func readsPortEnv(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return !found
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "Getenv" && sel.Sel.Name != "LookupEnv") {
+			return !found
+		}
+		if name, ok := stringLit(call.Args[0]); ok {
+			name = strings.ToUpper(name)
+			found = found || strings.Contains(name, "PORT") || strings.Contains(name, "ADDR")
+		}
+		return !found
+	})
+	return found
+}
+
+// envFallbackPorts returns bare port literals such as "3000" or ":3000" in body.
+func envFallbackPorts(body *ast.BlockStmt) []int {
+	var ports []int
+	ast.Inspect(body, func(n ast.Node) bool {
+		if s, ok := stringLit(n); ok {
+			if match := portLiteralRe.FindStringSubmatch(s); match != nil {
+				port, _ := strconv.Atoi(match[1])
+				ports = append(ports, port)
+			}
+		}
+		return true
+	})
+	return ports
+}
+
+// addrPort returns the port of a literal "host:port" address.
+func addrPort(expr ast.Expr) (int, bool) {
+	s, ok := stringLit(expr)
+	if !ok {
+		return 0, false
+	}
+
+	_, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return 0, false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return 0, false
+	}
+	return port, true
+}
+
+// stringLit returns the value of a string literal node.
+func stringLit(node ast.Node) (string, bool) {
+	lit, ok := node.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// resolvePorts returns the ports to expose: the explicit ports if given,
+// otherwise those detected in the source, falling back to DefaultPort.
+func resolvePorts(absPath string, explicit []int) ([]int, error) {
+	for _, port := range explicit {
+		if port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %d", port)
+		}
+	}
+	if len(explicit) > 0 {
+		return explicit, nil
+	}
+
+	ports, err := DetectPorts(absPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(ports) == 0 {
+		logging.Infof("Note: no listening port detected in source, using %d (override with --port)\n", DefaultPort)
+		return []int{DefaultPort}, nil
+	}
+
+	var list []string
+	for _, port := range ports {
+		list = append(list, strconv.Itoa(port))
+	}
+	logging.Infof("Detected listening ports: %s\n", strings.Join(list, ", "))
+
+	return ports, nil
+}
@@ -0,0 +1,75 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+
+	"goforge/pkg/logging"
+
+	"golang.org/x/exp/slices"
+)
+
+// Ways generated Dockerfiles authenticate private module downloads.
+const (
+	PrivateAuthNetrc = "netrc"
+	PrivateAuthToken = "token"
+)
+
+// PrivateAuths lists the supported authentication methods.
+var PrivateAuths = []string{PrivateAuthNetrc, PrivateAuthToken}
+
+// Ids of the BuildKit secrets the generated Dockerfile mounts.
+const (
+	NetrcSecretID = "netrc"
+	TokenSecretID = "git_token"
+)
+
+// PrivateModules configures how the builder stage downloads private
+// modules. The zero value downloads every module through the default proxy.
+type PrivateModules struct {
+	// GoPrivate and GoNoSumDB are comma-separated module path patterns,
+	// e.g. "github.com/acme/*", set as build arguments of the builder stage.
+	GoPrivate string
+	GoNoSumDB string
+	// Auth mounts credentials as a BuildKit secret while the modules
+	// download: the NetrcSecretID secret as /root/.netrc, or the
+	// TokenSecretID secret as an HTTPS token for the GoPrivate hosts. Empty
+	// mounts none.
+	Auth string
+}
+
+// resolve validates the settings and returns the hosts a token
+// authenticates to: the first element of each GoPrivate pattern.
+func (p PrivateModules) resolve(vendor bool) ([]string, error) {
+	switch {
+	case p.Auth == "":
+		return nil, nil
+	case !slices.Contains(PrivateAuths, p.Auth):
+		return nil, fmt.Errorf("invalid private module authentication %q (expected %s)", p.Auth, strings.Join(PrivateAuths, " or "))
+	case vendor:
+		return nil, fmt.Errorf("vendored builds download no modules, so they need no private module authentication")
+	}
+
+	if p.GoPrivate == "" {
+		if p.Auth == PrivateAuthToken {
+			return nil, fmt.Errorf("token authentication needs --goprivate to know which hosts the token is for")
+		}
+		logging.Infoln("Note: without --goprivate, private modules are still looked up through the public proxy and checksum database")
+		return nil, nil
+	}
+
+	var hosts []string
+	for _, pattern := range strings.Split(p.GoPrivate, ",") {
+		host, _, _ := strings.Cut(strings.TrimSpace(pattern), "/")
+		if host == "" {
+			continue
+		}
+		if p.Auth == PrivateAuthToken && strings.ContainsAny(host, "*?[") {
+			return nil, fmt.Errorf("token authentication needs a concrete host in each --goprivate pattern, e.g. github.com/acme/*; %q has a wildcard host", pattern)
+		}
+		if !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
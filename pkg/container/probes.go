@@ -0,0 +1,185 @@
+package container
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+
+	"goforge/pkg/logging"
+)
+
+// Probe kinds.
+const (
+	ProbeHTTP = "http"
+	ProbeTCP  = "tcp"
+	ProbeExec = "exec"
+)
+
+// livenessPaths and readinessPaths are the conventional health routes, in
+// order of preference.
+var (
+	livenessPaths  = []string{"/healthz", "/livez", "/health", "/live", "/ping"}
+	readinessPaths = []string{"/readyz", "/ready"}
+)
+
+// ProbeOptions configures the liveness and readiness probes of a Deployment.
+type ProbeOptions struct {
+	// Disabled omits the probes.
+	Disabled bool
+	// Kind is ProbeHTTP, ProbeTCP, or ProbeExec; empty means HTTP when a
+	// health path is set or detected, and TCP otherwise.
+	Kind string
+	// HealthPath and ReadyPath are the HTTP probe paths; empty means the
+	// routes detected in the source. ReadyPath falls back to HealthPath.
+	HealthPath string
+	ReadyPath  string
+	// Port is the port probed; zero means the first application port.
+	Port int
+	// Command is run by exec probes.
+	Command []string
+}
+
+// Probe is a liveness or readiness probe in a generated Deployment.
+type Probe struct {
+	Kind         string
+	Path         string
+	Port         int
+	Command      []string
+	InitialDelay int
+	Period       int
+	Timeout      int
+}
+
+// ParseProbe parses a --probe value: "http", "tcp", or "exec:<command>".
+func ParseProbe(spec string) (string, []string, error) {
+	if command, ok := strings.CutPrefix(spec, ProbeExec+":"); ok {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			return "", nil, fmt.Errorf("exec probe needs a command (exec:<command>)")
+		}
+		return ProbeExec, args, nil
+	}
+
+	switch spec {
+	case "", ProbeHTTP, ProbeTCP:
+		return spec, nil, nil
+	case ProbeExec:
+		return "", nil, fmt.Errorf("exec probe needs a command (exec:<command>)")
+	}
+	return "", nil, fmt.Errorf("invalid probe %q (expected http, tcp, or exec:<command>)", spec)
+}
+
+// resolveProbes returns the liveness and readiness probes for a Deployment
+// serving on ports, or nil for both when probes are disabled.
+func resolveProbes(absPath string, opts ProbeOptions, ports []int) (*Probe, *Probe, error) {
+	if opts.Disabled {
+		return nil, nil, nil
+	}
+
+	port := opts.Port
+	if port == 0 {
+		port = ports[0]
+	}
+	if port < 0 || port > 65535 {
+		return nil, nil, fmt.Errorf("invalid probe port %d", port)
+	}
+
+	for _, path := range []string{opts.HealthPath, opts.ReadyPath} {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			return nil, nil, fmt.Errorf("invalid probe path %q (must start with /)", path)
+		}
+	}
+
+	kind := opts.Kind
+	healthPath, readyPath := opts.HealthPath, opts.ReadyPath
+	if kind == "" || kind == ProbeHTTP {
+		if healthPath == "" || readyPath == "" {
+			detectedHealth, detectedReady, err := DetectHealthPaths(absPath)
+			if err != nil {
+				return nil, nil, err
+			}
+			if healthPath == "" {
+				healthPath = detectedHealth
+			}
+			if readyPath == "" {
+				readyPath = detectedReady
+			}
+		}
+		if healthPath == "" {
+			healthPath = readyPath
+		}
+		if readyPath == "" {
+			readyPath = healthPath
+		}
+
+		switch {
+		case healthPath != "":
+			if opts.HealthPath == "" || opts.ReadyPath == "" {
+				logging.Infof("Using HTTP probes: liveness %s, readiness %s (override with --health-path and --ready-path)\n", healthPath, readyPath)
+			}
+			kind = ProbeHTTP
+		case kind == ProbeHTTP:
+			return nil, nil, fmt.Errorf("no health route detected in source; set --health-path")
+		default:
+			logging.Infof("Note: no health route detected in source, using TCP probes on port %d (set --health-path for HTTP probes)\n", port)
+			kind = ProbeTCP
+		}
+	}
+
+	if kind == ProbeExec && len(opts.Command) == 0 {
+		return nil, nil, fmt.Errorf("exec probe needs a command")
+	}
+
+	liveness := &Probe{Kind: kind, Path: healthPath, Port: port, Command: opts.Command, InitialDelay: 10, Period: 10, Timeout: 2}
+	readiness := &Probe{Kind: kind, Path: readyPath, Port: port, Command: opts.Command, InitialDelay: 5, Period: 5, Timeout: 2}
+	return liveness, readiness, nil
+}
+
+// DetectHealthPaths returns the liveness and readiness routes registered in
+// the project's source, such as mux.HandleFunc("/healthz", ...). Either is
+// empty when no conventional route is found.
+func DetectHealthPaths(path string) (string, string, error) {
+	routes := make(map[string]bool)
+
+	err := walkSource(path, func(file string) error {
+		fset := token.NewFileSet()
+		node, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			// Unparseable files cannot contribute routes
+			return nil
+		}
+
+		ast.Inspect(node, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) < 2 {
+				return true
+			}
+			if route, ok := stringLit(call.Args[0]); ok {
+				// Go 1.22 patterns may start with a method: "GET /healthz"
+				if _, pattern, ok := strings.Cut(route, " "); ok {
+					route = pattern
+				}
+				routes[strings.TrimSuffix(route, "/")] = true
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to scan source for health routes: %w", err)
+	}
+
+	return firstRoute(routes, livenessPaths), firstRoute(routes, readinessPaths), nil
+}
+
+// firstRoute returns the first of candidates present in routes.
+func firstRoute(routes map[string]bool, candidates []string) string {
+	for _, candidate := range candidates {
+		if routes[candidate] {
+			return candidate
+		}
+	}
+	return ""
+}
@@ -0,0 +1,200 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/google/pprof/profile"
+)
+
+// DefaultResources are the container resources of generated manifests.
+var DefaultResources = Resources{
+	CPURequest:    "100m",
+	CPULimit:      "500m",
+	MemoryRequest: "128Mi",
+	MemoryLimit:   "512Mi",
+}
+
+// Settings of the memory request suggested from a heap profile.
+const (
+	// defaultGOGC is the garbage collector's default target: the heap grows
+	// by this percentage of the live heap before the next collection.
+	defaultGOGC = 100
+	// runtimeOverhead covers goroutine stacks, the binary, and runtime
+	// metadata, which the heap profile does not show.
+	runtimeOverhead = 16 << 20
+	// memoryHeadroom is the percentage added for load spikes.
+	memoryHeadroom = 25
+)
+
+const mebibyte = 1 << 20
+
+// quantityRe matches a Kubernetes memory or storage quantity such as 10Gi
+// or 500M.
+var quantityRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(Ki|Mi|Gi|Ti|Pi|Ei|k|M|G|T|P|E)?$`)
+
+// cpuQuantityRe matches a CPU quantity in cores or millicores, e.g. 0.5 or
+// 500m.
+var cpuQuantityRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?m?$`)
+
+// quantityUnits are the multipliers of the quantity suffixes.
+var quantityUnits = map[string]float64{
+	"m": 1e-3, "k": 1e3, "M": 1e6, "G": 1e9, "T": 1e12, "P": 1e15, "E": 1e18,
+	"Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30, "Ti": 1 << 40, "Pi": 1 << 50, "Ei": 1 << 60,
+}
+
+// Resources are the CPU and memory requests and limits of the container.
+// Empty fields take their DefaultResources value.
+type Resources struct {
+	CPURequest    string
+	CPULimit      string
+	MemoryRequest string
+	MemoryLimit   string
+	// NoLimits leaves the limits out, so the container may use whatever its
+	// node has spare.
+	NoLimits bool
+	// FromProfile is a heap profile to suggest the memory request from,
+	// instead of MemoryRequest.
+	FromProfile string
+}
+
+// resolve suggests the memory request from the heap profile, fills in the
+// defaults, and checks the quantities and that no request exceeds its limit.
+func (r *Resources) resolve() error {
+	if r.NoLimits && (r.CPULimit != "" || r.MemoryLimit != "") {
+		return fmt.Errorf("limits cannot be set together with no limits")
+	}
+	if r.FromProfile != "" {
+		if r.MemoryRequest != "" {
+			return fmt.Errorf("set the memory request or suggest it from a profile, not both")
+		}
+		request, err := suggestMemoryRequest(r.FromProfile)
+		if err != nil {
+			return err
+		}
+		r.MemoryRequest = formatMebibytes(request)
+		request, _ = parseQuantity(r.MemoryRequest)
+		if !r.NoLimits && r.MemoryLimit == "" {
+			if limit, _ := parseQuantity(DefaultResources.MemoryLimit); request > limit {
+				r.MemoryLimit = formatMebibytes(2 * request)
+				fmt.Printf("The default memory limit of %s is below the request; using twice the request: %s\n", DefaultResources.MemoryLimit, r.MemoryLimit)
+			}
+		}
+	}
+
+	for _, field := range []struct {
+		value    *string
+		fallback string
+	}{
+		{&r.CPURequest, DefaultResources.CPURequest},
+		{&r.CPULimit, DefaultResources.CPULimit},
+		{&r.MemoryRequest, DefaultResources.MemoryRequest},
+		{&r.MemoryLimit, DefaultResources.MemoryLimit},
+	} {
+		if *field.value == "" {
+			*field.value = field.fallback
+		}
+	}
+
+	for _, q := range []struct {
+		name, value string
+		re          *regexp.Regexp
+		example     string
+	}{
+		{"CPU request", r.CPURequest, cpuQuantityRe, "250m or 0.5"},
+		{"CPU limit", r.CPULimit, cpuQuantityRe, "1 or 1500m"},
+		{"memory request", r.MemoryRequest, quantityRe, "256Mi or 1Gi"},
+		{"memory limit", r.MemoryLimit, quantityRe, "512Mi or 2Gi"},
+	} {
+		if !q.re.MatchString(q.value) {
+			return fmt.Errorf("invalid %s %q (e.g. %s)", q.name, q.value, q.example)
+		}
+	}
+	if r.NoLimits {
+		return nil
+	}
+
+	for _, pair := range []struct{ name, request, limit string }{
+		{"CPU", r.CPURequest, r.CPULimit},
+		{"memory", r.MemoryRequest, r.MemoryLimit},
+	} {
+		request, _ := parseQuantity(pair.request)
+		limit, _ := parseQuantity(pair.limit)
+		if request > limit {
+			return fmt.Errorf("%s request %s exceeds the limit %s", pair.name, pair.request, pair.limit)
+		}
+	}
+	return nil
+}
+
+// parseQuantity returns the value of a quantity matched by quantityRe or
+// cpuQuantityRe.
+func parseQuantity(quantity string) (float64, error) {
+	i := len(quantity)
+	for i > 0 && (quantity[i-1] < '0' || quantity[i-1] > '9') {
+		i--
+	}
+	value, err := strconv.ParseFloat(quantity[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q", quantity)
+	}
+	if suffix := quantity[i:]; suffix != "" {
+		unit, ok := quantityUnits[suffix]
+		if !ok {
+			return 0, fmt.Errorf("invalid quantity %q", quantity)
+		}
+		value *= unit
+	}
+	return value, nil
+}
+
+// formatMebibytes formats bytes as a whole number of mebibytes, rounded up.
+func formatMebibytes(bytes float64) string {
+	// Truncate to whole bytes first, so float error cannot add a mebibyte
+	return fmt.Sprintf("%dMi", (int64(bytes)+mebibyte-1)/mebibyte)
+}
+
+// suggestMemoryRequest suggests a memory request from the live heap in a heap
+// profile: the heap goal the garbage collector lets it grow to, plus the
+// runtime's own memory and headroom. It prints the reasoning.
+func suggestMemoryRequest(profileFile string) (float64, error) {
+	file, err := os.Open(profileFile)
+	if err != nil {
+		return 0, fmt.Errorf("profile file not found: %w", err)
+	}
+	defer file.Close()
+
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse profile: %w", err)
+	}
+
+	index := -1
+	for i, sampleType := range prof.SampleType {
+		if sampleType.Type == "inuse_space" {
+			index = i
+		}
+	}
+	if index < 0 {
+		return 0, fmt.Errorf("profile has no inuse_space samples; is it a heap profile?")
+	}
+	var inuse int64
+	for _, sample := range prof.Sample {
+		inuse += sample.Value[index]
+	}
+
+	live := float64(inuse)
+	goal := live * (100 + defaultGOGC) / 100
+	withRuntime := goal + runtimeOverhead
+	request := withRuntime * (100 + memoryHeadroom) / 100
+
+	fmt.Printf("Memory request suggested from %s:\n", profileFile)
+	fmt.Printf("- Live heap when the profile was captured: %.1f MiB\n", live/mebibyte)
+	fmt.Printf("- Heap goal with GOGC=%d (the heap grows to %d%% of the live heap): %.1f MiB\n", defaultGOGC, 100+defaultGOGC, goal/mebibyte)
+	fmt.Printf("- Plus %d MiB for goroutine stacks, the binary, and the runtime: %.1f MiB\n", runtimeOverhead/mebibyte, withRuntime/mebibyte)
+	fmt.Printf("- Plus %d%% headroom for load spikes: %.1f MiB\n", memoryHeadroom, request/mebibyte)
+	fmt.Printf("Suggested memory request: %s (the profile reflects the load it was captured under)\n", formatMebibytes(request))
+	return request, nil
+}
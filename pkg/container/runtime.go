@@ -0,0 +1,91 @@
+package container
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultRuntime is the final-stage image used when none is chosen.
+const DefaultRuntime = "alpine"
+
+// nonrootUID is the numeric user non-root images run as; it matches the
+// "nonroot" user of the distroless images.
+const nonrootUID = 65532
+
+// RuntimeImage describes a final-stage image of the Dockerfile.
+type RuntimeImage struct {
+	Image string
+	// Minimal images have no shell or package manager, so CA certificates
+	// and time zone data are copied from the builder.
+	Minimal bool
+}
+
+// runtimeImages are the supported --runtime-image choices.
+var runtimeImages = map[string]RuntimeImage{
+	"alpine":     {Image: "alpine:latest"},
+	"distroless": {Image: "gcr.io/distroless/static-debian12:nonroot", Minimal: true},
+	"scratch":    {Image: "scratch", Minimal: true},
+}
+
+// lookupRuntime returns the runtime image for name.
+func lookupRuntime(name string) (RuntimeImage, error) {
+	if name == "" {
+		name = DefaultRuntime
+	}
+	runtime, ok := runtimeImages[name]
+	if !ok {
+		var names []string
+		for n := range runtimeImages {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return RuntimeImage{}, fmt.Errorf("unknown runtime image %q (supported: %s)", name, strings.Join(names, ", "))
+	}
+	return runtime, nil
+}
+
+// checkRuntimeCompatible rejects a scratch image for a project that uses cgo:
+// the binary would need a C library that scratch does not have.
+func checkRuntimeCompatible(absPath string, name string) error {
+	if name != "scratch" {
+		return nil
+	}
+
+	file, err := findCgoFile(absPath)
+	if err != nil {
+		return err
+	}
+	if file != "" {
+		return fmt.Errorf("%s imports \"C\": a cgo binary is dynamically linked against a C library "+
+			"that the scratch image does not provide; remove the cgo dependency or use --runtime-image alpine", file)
+	}
+	return nil
+}
+
+// findCgoFile returns the first non-test Go file under absPath that imports
+// "C", relative to absPath, or "" if the project does not use cgo.
+func findCgoFile(absPath string) (string, error) {
+	var found string
+	err := walkSource(absPath, func(file string) error {
+		node, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil
+		}
+		for _, imp := range node.Imports {
+			if path, _ := strconv.Unquote(imp.Path.Value); path == "C" {
+				found, _ = filepath.Rel(absPath, file)
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to scan source for cgo: %w", err)
+	}
+	return found, nil
+}
@@ -0,0 +1,360 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+
+	"golang.org/x/exp/slices"
+)
+
+// severities lists the vulnerability severities from least to most severe.
+var severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// DefaultSeverityThreshold is the lowest severity that fails a scan.
+const DefaultSeverityThreshold = "high"
+
+// ScanOptions configures an image vulnerability scan.
+type ScanOptions struct {
+	// Threshold is the lowest severity (low, medium, high, or critical)
+	// that fails the scan.
+	Threshold string
+	// Allowlist is a file of accepted vulnerability IDs, one per line, with
+	// # comments.
+	Allowlist string
+	// JSON prints the results as an ImageScanReport document.
+	JSON bool
+}
+
+// ImageScanReport is the structured result of an image vulnerability scan.
+type ImageScanReport struct {
+	Image           string               `json:"image"`
+	Scanner         string               `json:"scanner"`
+	Threshold       string               `json:"threshold"`
+	Vulnerabilities []ImageVulnerability `json:"vulnerabilities"`
+	// Allowed are the findings accepted by the allowlist.
+	Allowed []ImageVulnerability `json:"allowed"`
+}
+
+// ImageVulnerability is a vulnerable package found in an image.
+type ImageVulnerability struct {
+	ID               string   `json:"id"`
+	Aliases          []string `json:"aliases,omitempty"`
+	Severity         string   `json:"severity"`
+	Package          string   `json:"package"`
+	InstalledVersion string   `json:"installed_version"`
+	FixedVersion     string   `json:"fixed_version,omitempty"`
+	Title            string   `json:"title,omitempty"`
+}
+
+// trivyOutput is the part of 'trivy image --format json' that is reported.
+type trivyOutput struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string
+			PkgName          string
+			InstalledVersion string
+			FixedVersion     string
+			Severity         string
+			Title            string
+		}
+	}
+}
+
+// grypeOutput is the part of 'grype -o json' that is reported.
+type grypeOutput struct {
+	Matches []struct {
+		Vulnerability struct {
+			ID          string `json:"id"`
+			Severity    string `json:"severity"`
+			Description string `json:"description"`
+			Fix         struct {
+				Versions []string `json:"versions"`
+			} `json:"fix"`
+		} `json:"vulnerability"`
+		RelatedVulnerabilities []struct {
+			ID string `json:"id"`
+		} `json:"relatedVulnerabilities"`
+		Artifact struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"artifact"`
+	} `json:"matches"`
+}
+
+// ValidSeverityThreshold reports whether threshold names a severity.
+func ValidSeverityThreshold(threshold string) bool {
+	upper := strings.ToUpper(threshold)
+	return upper != "UNKNOWN" && slices.Contains(severities, upper)
+}
+
+// ScanImage scans an image for vulnerabilities with trivy, or grype when
+// trivy is not installed, and fails when findings not accepted by the
+// allowlist reach the severity threshold.
+func ScanImage(image string, opts ScanOptions) error {
+	if opts.Threshold == "" {
+		opts.Threshold = DefaultSeverityThreshold
+	}
+	if !ValidSeverityThreshold(opts.Threshold) {
+		return fmt.Errorf("invalid severity threshold %q (expected low, medium, high, or critical)", opts.Threshold)
+	}
+
+	var allowlist []string
+	if opts.Allowlist != "" {
+		var err error
+		if allowlist, err = readAllowlist(opts.Allowlist); err != nil {
+			return err
+		}
+	}
+
+	scanner, err := imageScanner()
+	if err != nil {
+		return err
+	}
+
+	if !opts.JSON {
+		logging.Infof("Scanning %s with %s...\n", image, scanner)
+	}
+	vulns, err := runImageScanner(scanner, image)
+	if err != nil {
+		return err
+	}
+
+	report := &ImageScanReport{
+		Image:           image,
+		Scanner:         scanner,
+		Threshold:       strings.ToUpper(opts.Threshold),
+		Vulnerabilities: []ImageVulnerability{},
+		Allowed:         []ImageVulnerability{},
+	}
+	for _, vuln := range vulns {
+		if allowed(vuln, allowlist) {
+			report.Allowed = append(report.Allowed, vuln)
+		} else {
+			report.Vulnerabilities = append(report.Vulnerabilities, vuln)
+		}
+	}
+
+	if opts.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode scan results: %w", err)
+		}
+	} else {
+		printImageScanReport(report)
+	}
+
+	failing := 0
+	for _, vuln := range report.Vulnerabilities {
+		if severityRank(vuln.Severity) >= severityRank(report.Threshold) {
+			failing++
+		}
+	}
+	if failing > 0 {
+		return exitcode.Policyf("%d vulnerabilities in %s are at or above %s severity", failing, image, report.Threshold)
+	}
+	return nil
+}
+
+// imageScanner returns the installed image scanner: trivy, or grype.
+func imageScanner() (string, error) {
+	for _, scanner := range []string{"trivy", "grype"} {
+		if _, err := exec.LookPath(scanner); err == nil {
+			return scanner, nil
+		}
+	}
+	return "", fmt.Errorf("no image scanner found in PATH; install trivy (https://trivy.dev/latest/getting-started/installation/) " +
+		"or grype (https://github.com/anchore/grype#installation)")
+}
+
+// runImageScanner runs scanner against image and returns its findings,
+// most severe first.
+func runImageScanner(scanner string, image string) ([]ImageVulnerability, error) {
+	args := []string{"image", "--format", "json", "--quiet", image}
+	if scanner == "grype" {
+		args = []string{image, "-o", "json", "-q"}
+	}
+
+	cmd := proc.Command(scanner, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w\nOutput: %s", scanner, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var vulns []ImageVulnerability
+	if scanner == "grype" {
+		vulns, err = parseGrype(output)
+	} else {
+		vulns, err = parseTrivy(output)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s output: %w", scanner, err)
+	}
+
+	sort.SliceStable(vulns, func(i, j int) bool {
+		a, b := vulns[i], vulns[j]
+		if a.Severity != b.Severity {
+			return severityRank(a.Severity) > severityRank(b.Severity)
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Package < b.Package
+	})
+	return vulns, nil
+}
+
+// parseTrivy converts trivy's JSON report into findings.
+func parseTrivy(output []byte) ([]ImageVulnerability, error) {
+	var parsed trivyOutput
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, err
+	}
+
+	var vulns []ImageVulnerability
+	for _, result := range parsed.Results {
+		for _, v := range result.Vulnerabilities {
+			vulns = append(vulns, ImageVulnerability{
+				ID:               v.VulnerabilityID,
+				Severity:         normalizeSeverity(v.Severity),
+				Package:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				Title:            v.Title,
+			})
+		}
+	}
+	return vulns, nil
+}
+
+// parseGrype converts grype's JSON report into findings.
+func parseGrype(output []byte) ([]ImageVulnerability, error) {
+	var parsed grypeOutput
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, err
+	}
+
+	var vulns []ImageVulnerability
+	for _, match := range parsed.Matches {
+		vuln := ImageVulnerability{
+			ID:               match.Vulnerability.ID,
+			Severity:         normalizeSeverity(match.Vulnerability.Severity),
+			Package:          match.Artifact.Name,
+			InstalledVersion: match.Artifact.Version,
+			FixedVersion:     strings.Join(match.Vulnerability.Fix.Versions, ", "),
+			Title:            firstLine(match.Vulnerability.Description),
+		}
+		// GHSA matches relate to the CVE that allowlists usually name
+		for _, related := range match.RelatedVulnerabilities {
+			if related.ID != vuln.ID && !slices.Contains(vuln.Aliases, related.ID) {
+				vuln.Aliases = append(vuln.Aliases, related.ID)
+			}
+		}
+		vulns = append(vulns, vuln)
+	}
+	return vulns, nil
+}
+
+// normalizeSeverity maps a scanner severity to one of severities.
+func normalizeSeverity(severity string) string {
+	upper := strings.ToUpper(severity)
+	if upper == "NEGLIGIBLE" {
+		return "LOW"
+	}
+	if !slices.Contains(severities, upper) {
+		return "UNKNOWN"
+	}
+	return upper
+}
+
+// severityRank orders severities from UNKNOWN (0) to CRITICAL.
+func severityRank(severity string) int {
+	return slices.Index(severities, strings.ToUpper(severity))
+}
+
+// firstLine returns the first line of text.
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
+
+// readAllowlist reads the accepted vulnerability IDs from path. Blank lines
+// and text after # are ignored.
+func readAllowlist(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowlist: %w", err)
+	}
+
+	var ids []string
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line, _, _ = bytes.Cut(line, []byte("#"))
+		if id := strings.TrimSpace(string(line)); id != "" {
+			ids = append(ids, strings.ToUpper(id))
+		}
+	}
+	return ids, nil
+}
+
+// allowed reports whether the allowlist accepts vuln by its ID or an alias.
+func allowed(vuln ImageVulnerability, allowlist []string) bool {
+	for _, id := range append([]string{vuln.ID}, vuln.Aliases...) {
+		if slices.Contains(allowlist, strings.ToUpper(id)) {
+			return true
+		}
+	}
+	return false
+}
+
+// printImageScanReport prints the findings grouped by severity, with the
+// version that fixes each one. Most fixes come from rebuilding on an updated
+// base or runtime image.
+func printImageScanReport(report *ImageScanReport) {
+	fmt.Printf("\nImage Scan Results (%s, %s):\n", report.Image, report.Scanner)
+	if len(report.Vulnerabilities) == 0 {
+		fmt.Println("- No vulnerabilities found")
+	} else {
+		fmt.Printf("- %d vulnerabilities found\n", len(report.Vulnerabilities))
+	}
+	if len(report.Allowed) > 0 {
+		fmt.Printf("- %d accepted by the allowlist\n", len(report.Allowed))
+	}
+
+	for i := len(severities) - 1; i >= 0; i-- {
+		severity := severities[i]
+		var group []ImageVulnerability
+		for _, vuln := range report.Vulnerabilities {
+			if vuln.Severity == severity {
+				group = append(group, vuln)
+			}
+		}
+		if len(group) == 0 {
+			continue
+		}
+
+		fmt.Printf("\n%s (%d):\n", severity, len(group))
+		for _, vuln := range group {
+			fmt.Printf("  %s  %s@%s\n", vuln.ID, vuln.Package, vuln.InstalledVersion)
+			if vuln.Title != "" {
+				fmt.Printf("    %s\n", vuln.Title)
+			}
+			if vuln.FixedVersion != "" {
+				fmt.Printf("    Fixed in: %s\n", vuln.FixedVersion)
+			} else {
+				fmt.Println("    Fixed in: no fix available")
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package container
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Types of the generated Service.
+const (
+	ServiceClusterIP    = "ClusterIP"
+	ServiceNodePort     = "NodePort"
+	ServiceLoadBalancer = "LoadBalancer"
+)
+
+// ServiceTypes lists the supported Service types.
+var ServiceTypes = []string{ServiceClusterIP, ServiceNodePort, ServiceLoadBalancer}
+
+// servicePort is the port the Service exposes the first container port on.
+const servicePort = 80
+
+// wellKnownPortNames name the ports conventionally used for something other
+// than the application's HTTP traffic.
+var wellKnownPortNames = map[int]string{
+	443:   "https",
+	2112:  "metrics",
+	6060:  "pprof",
+	8443:  "https",
+	9090:  "metrics",
+	9100:  "metrics",
+	50051: "grpc",
+}
+
+// portNameRe matches a Kubernetes port name (an IANA service name).
+var portNameRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// ServiceOptions configures the generated Service.
+type ServiceOptions struct {
+	// Type is ClusterIP, NodePort, or LoadBalancer; empty means ClusterIP.
+	Type string
+	// Annotations are added to the Service only, e.g. to configure a cloud
+	// load balancer, and take precedence over the shared annotations.
+	Annotations map[string]string
+	// PortNames overrides the names of container ports by number.
+	PortNames map[int]string
+}
+
+// NamedPort is a container port and where the Service exposes it. The
+// Service's targetPort refers to the port by name.
+type NamedPort struct {
+	Name string
+	Port int
+	// ServicePort is the port the Service listens on for it.
+	ServicePort int
+}
+
+// ParsePortNames parses PORT=NAME pairs, e.g. 9090=metrics.
+func ParsePortNames(pairs []string) (map[int]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	names := make(map[int]string)
+	for _, pair := range pairs {
+		portText, name, ok := strings.Cut(pair, "=")
+		port, err := strconv.Atoi(portText)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid port name %q (expected PORT=NAME, e.g. 9090=metrics)", pair)
+		}
+		if err := validatePortName(name); err != nil {
+			return nil, err
+		}
+		names[port] = name
+	}
+	return names, nil
+}
+
+// validatePortName checks that name is a valid port name: at most 15
+// lowercase letters, digits, and '-', with at least one letter.
+func validatePortName(name string) error {
+	if len(name) > 15 || !portNameRe.MatchString(name) || strings.Contains(name, "--") || !strings.ContainsAny(name, "abcdefghijklmnopqrstuvwxyz") {
+		return fmt.Errorf("invalid port name %q (at most 15 lowercase letters, digits, and '-', with a letter)", name)
+	}
+	return nil
+}
+
+// resolve checks the options for a workload of kind and fills in the
+// default type.
+func (s *ServiceOptions) resolve(kind string) error {
+	if kind == KindJob || kind == KindCronJob {
+		if s.Type != "" || len(s.Annotations) > 0 {
+			return fmt.Errorf("%ss get no Service, so the service type and annotations do not apply", kind)
+		}
+		return nil
+	}
+
+	if s.Type == "" {
+		s.Type = ServiceClusterIP
+	}
+	i := slices.IndexFunc(ServiceTypes, func(t string) bool { return strings.EqualFold(t, s.Type) })
+	if i < 0 {
+		return fmt.Errorf("invalid service type %q (expected %s)", s.Type, strings.Join(ServiceTypes, ", "))
+	}
+	s.Type = ServiceTypes[i]
+	if kind == KindStatefulSet && s.Type != ServiceClusterIP {
+		return fmt.Errorf("the headless Service of a statefulset must be of type %s", ServiceClusterIP)
+	}
+	return nil
+}
+
+// namePorts names the container ports. Explicit names come first, then the
+// well-known names, and the first remaining port is "http"; the others are
+// named after their number. The first port is exposed on port 80 unless the
+// Service is headless, which exposes the ports as they are, or another port
+// already uses 80.
+func namePorts(ports []int, names map[int]string, headless bool) ([]NamedPort, error) {
+	for port := range names {
+		if !slices.Contains(ports, port) {
+			return nil, fmt.Errorf("port %d is named but not exposed (add it with --port)", port)
+		}
+	}
+
+	used := make(map[string]bool)
+	sorted := maps.Keys(names)
+	slices.Sort(sorted)
+	for _, port := range sorted {
+		if used[names[port]] {
+			return nil, fmt.Errorf("port name %q is used twice", names[port])
+		}
+		used[names[port]] = true
+	}
+
+	named := make([]NamedPort, len(ports))
+	for i, port := range ports {
+		name, ok := names[port]
+		if !ok {
+			name = wellKnownPortNames[port]
+			if name == "" && i == 0 {
+				name = "http"
+			}
+			if name == "" || used[name] {
+				name = fmt.Sprintf("port-%d", port)
+			}
+			used[name] = true
+		}
+		named[i] = NamedPort{Name: name, Port: port, ServicePort: port}
+	}
+
+	if len(named) > 0 && !headless && !slices.Contains(ports[1:], servicePort) {
+		named[0].ServicePort = servicePort
+	}
+	return named, nil
+}
+
+// ServiceAnnotations returns the annotations of the Service: the shared ones
+// and the Service's own.
+func (d K8sData) ServiceAnnotations() map[string]string {
+	if len(d.Service.Annotations) == 0 {
+		return d.Annotations
+	}
+	annotations := maps.Clone(d.Annotations)
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	maps.Copy(annotations, d.Service.Annotations)
+	return annotations
+}
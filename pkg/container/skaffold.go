@@ -0,0 +1,510 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/safewrite"
+
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+// SkaffoldFile is the name of the Skaffold configuration, in the project
+// directory.
+const SkaffoldFile = "skaffold.yaml"
+
+// skaffoldAPIVersion is the Skaffold schema version of the generated
+// configuration, the one it is validated against.
+const skaffoldAPIVersion = "skaffold/v4beta11"
+
+// valueKeyRe matches the characters Skaffold replaces with _ in the names
+// of an image's template variables, e.g. IMAGE_REPO_team_app.
+var valueKeyRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// SkaffoldTemplate is a Skaffold configuration building the generated
+// Dockerfiles and deploying the generated manifests or a Helm chart, with a
+// dev and a prod profile. It uses [[ ]] delimiters, since Skaffold's own
+// templates are written {{ }}.
+const SkaffoldTemplate = `# Skaffold configuration; run the development loop with
+#   skaffold dev --port-forward
+# and release with
+#   skaffold run -p prod --default-repo <registry>
+apiVersion: [[ .APIVersion ]]
+kind: Config
+metadata:
+  name: [[ .Name ]]
+build:
+  artifacts:
+  [[- range .Artifacts ]]
+    - image: [[ .Image ]]
+      [[- if ne .Context "." ]]
+      context: [[ .Context ]]
+      [[- end ]]
+      docker:
+        dockerfile: [[ .Dockerfile ]]
+  [[- end ]]
+  local:
+    useBuildkit: true
+[[- if .Chart ]]
+deploy:
+  helm:
+    releases:
+      - name: [[ .Name ]]
+        chartPath: [[ .Chart ]]
+        setValueTemplates:
+          [[- with index .Artifacts 0 ]]
+          image.repository: "{{ .IMAGE_REPO_[[ .ValueKey ]] }}"
+          image.tag: "{{ .IMAGE_TAG_[[ .ValueKey ]] }}@{{ .IMAGE_DIGEST_[[ .ValueKey ]] }}"
+          [[- end ]]
+[[- else ]]
+manifests:
+  rawYaml:
+  [[- range .Manifests ]]
+    - [[ . ]]
+  [[- end ]]
+deploy:
+  kubectl: {}
+[[- end ]]
+profiles:
+  # skaffold dev: builds locally without pushing, and rebuilds and
+  # redeploys whenever the source changes
+  - name: dev
+    activation:
+      - command: dev
+    build:
+      tagPolicy:
+        sha256: {}
+      local:
+        push: false
+        useBuildkit: true
+    [[- if not .Chart ]]
+    portForward:
+    [[- range .Artifacts ]]
+    [[- $resource := .Resource ]]
+    [[- range .Ports ]]
+      - resourceType: deployment
+        resourceName: [[ $resource ]]
+        port: [[ . ]]
+        localPort: [[ . ]]
+    [[- end ]]
+    [[- end ]]
+    [[- end ]]
+  # skaffold run -p prod: builds for every platform, tags the images with
+  # the git tag or commit, and pushes them
+  - name: prod
+    build:
+      tagPolicy:
+        gitCommit: {}
+      platforms:
+      [[- range .Platforms ]]
+        - [[ . ]]
+      [[- end ]]
+      local:
+        push: true
+        useBuildkit: true
+`
+
+// SkaffoldOptions configures the generated Skaffold configuration.
+type SkaffoldOptions struct {
+	// Image is the image name, as given to container kubernetes; any tag
+	// is dropped, since Skaffold tags the images itself. Empty means the
+	// project directory's name. With AllMains it is the repository prefix
+	// of the services' images.
+	Image string
+	// Dockerfile is the Dockerfile to build, relative to the project;
+	// empty means Dockerfile. With AllMains each service builds it with
+	// its binary appended, e.g. Dockerfile.api.
+	Dockerfile string
+	// Manifests is the directory of the Kubernetes manifests, relative to
+	// the project. Empty means a Helm chart found in the project, else
+	// kubernetes.
+	Manifests string
+	// Chart is the Helm chart directory, relative to the project; it is
+	// deployed instead of the manifests.
+	Chart string
+	// AllMains builds an image per main package under cmd/ and deploys the
+	// manifests of container kubernetes --all-mains.
+	AllMains bool
+	// Platforms are the platforms of the prod profile.
+	Platforms []string
+	// Templates overrides the built-in templates.
+	Templates Templates
+	// Options decides whether an existing configuration is replaced or
+	// diffed.
+	safewrite.Options
+}
+
+// SkaffoldData holds data for the Skaffold template. Template overrides are
+// executed with it too, so fields are only ever added. Paths are relative
+// to the configuration file and slash-separated.
+type SkaffoldData struct {
+	APIVersion string
+	// Name is the configuration name and the Helm release name.
+	Name      string
+	Artifacts []SkaffoldArtifact
+	// Manifests are the globs of the manifests to deploy; empty with a
+	// chart.
+	Manifests []string
+	// Chart is the Helm chart to deploy; empty deploys the manifests.
+	Chart     string
+	Platforms []string
+}
+
+// SkaffoldArtifact is one image Skaffold builds.
+type SkaffoldArtifact struct {
+	// Image is the image name without tag, as the manifests reference it.
+	Image      string
+	Context    string
+	Dockerfile string
+	// ValueKey is the suffix of the image's template variables, e.g.
+	// IMAGE_REPO_<ValueKey>.
+	ValueKey string
+	// Resource is the name of the Deployment running the image, and Ports
+	// those it listens on.
+	Resource string
+	Ports    []int
+}
+
+// GenerateSkaffold writes a Skaffold configuration for the project at path
+// that builds its generated Dockerfiles and deploys its generated manifests,
+// or its Helm chart, with a dev profile that rebuilds on every change and a
+// prod profile that pushes multi-platform images. The file goes to
+// skaffold.yaml in the project unless outputFile is set; it is validated
+// against the Skaffold schema it declares before it is written.
+func GenerateSkaffold(path string, outputFile string, opts SkaffoldOptions) error {
+	logging.Infoln("Generating Skaffold configuration for project at:", path)
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if outputFile == "" {
+		outputFile = filepath.Join(absPath, SkaffoldFile)
+	}
+	absOutput, err := module.ResolveOutput(absPath, outputFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := opts.data(absPath, filepath.Dir(absOutput))
+	if err != nil {
+		return err
+	}
+
+	if err := opts.Templates.check(); err != nil {
+		return err
+	}
+	tmpl, err := opts.Templates.parse(template.New("skaffold").Delims("[[", "]]"), TemplateSkaffold)
+	if err != nil {
+		return fmt.Errorf("failed to parse Skaffold template: %w", err)
+	}
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return fmt.Errorf("failed to execute Skaffold template: %w", err)
+	}
+	if err := validateSkaffold(content.Bytes()); err != nil {
+		return fmt.Errorf("generated Skaffold configuration is invalid: %w", err)
+	}
+
+	written, err := opts.Write(safewrite.File{Path: absOutput, Data: content.Bytes()})
+	if err != nil || !written {
+		return err
+	}
+
+	fmt.Printf("Skaffold configuration generated at: %s\n", absOutput)
+	logging.Infoln("\nTo develop against the current cluster, run:")
+	logging.Infof("skaffold dev --port-forward -f %s\n", absOutput)
+	logging.Infoln("To build, push, and deploy a release, run:")
+	logging.Infof("skaffold run -p prod --default-repo <registry> -f %s\n", absOutput)
+	return nil
+}
+
+// data validates the options and returns the template data, with paths
+// relative to outputDir.
+func (opts SkaffoldOptions) data(absPath string, outputDir string) (SkaffoldData, error) {
+	appName := filepath.Base(absPath)
+	data := SkaffoldData{
+		APIVersion: skaffoldAPIVersion,
+		Name:       strings.ToLower(appName),
+		Platforms:  opts.Platforms,
+	}
+	if len(data.Platforms) == 0 {
+		data.Platforms = DefaultPlatforms
+	}
+	if opts.Manifests != "" && opts.Chart != "" {
+		return SkaffoldData{}, fmt.Errorf("--manifests and --chart cannot be combined")
+	}
+	if opts.AllMains && opts.Chart != "" {
+		return SkaffoldData{}, fmt.Errorf("--all-mains deploys the manifests of every service, so it cannot be combined with --chart")
+	}
+	dockerfile := opts.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+
+	// Paths in the configuration are relative to its file
+	rel := func(path string) (string, error) {
+		rel, err := filepath.Rel(outputDir, filepath.Join(absPath, path))
+		if err != nil {
+			return "", fmt.Errorf("failed to get relative path: %w", err)
+		}
+		return filepath.ToSlash(rel), nil
+	}
+	buildContext, err := rel(".")
+	if err != nil {
+		return SkaffoldData{}, err
+	}
+
+	type artifactMain struct {
+		dir      string
+		image    string
+		file     string
+		resource string
+	}
+	var artifacts []artifactMain
+	if opts.AllMains {
+		mains, err := findServiceMains(absPath)
+		if err != nil {
+			return SkaffoldData{}, err
+		}
+		for _, main := range mains {
+			name := serviceName(appName, main.binary)
+			image := name
+			if opts.Image != "" {
+				image = strings.TrimSuffix(opts.Image, "/") + "/" + name
+			}
+			artifacts = append(artifacts, artifactMain{main.dir, image, dockerfile + "." + main.binary, name})
+		}
+	} else {
+		image := imageRepository(opts.Image)
+		if image == "" {
+			image = strings.ToLower(appName)
+		}
+		artifacts = append(artifacts, artifactMain{absPath, image, dockerfile, appName})
+	}
+
+	for _, artifact := range artifacts {
+		if !exists(filepath.Join(absPath, artifact.file)) {
+			logging.Infof("Note: %s does not exist yet; generate it with 'goforge container dockerfile'\n", artifact.file)
+		}
+		ports, err := resolvePorts(artifact.dir, nil)
+		if err != nil {
+			return SkaffoldData{}, err
+		}
+		data.Artifacts = append(data.Artifacts, SkaffoldArtifact{
+			Image:      artifact.image,
+			Context:    buildContext,
+			Dockerfile: filepath.ToSlash(artifact.file),
+			ValueKey:   valueKeyRe.ReplaceAllString(artifact.image, "_"),
+			Resource:   artifact.resource,
+			Ports:      ports,
+		})
+	}
+
+	chart := opts.Chart
+	if chart == "" && opts.Manifests == "" && !opts.AllMains {
+		if chart, err = findChart(absPath); err != nil {
+			return SkaffoldData{}, err
+		}
+		if chart != "" {
+			logging.Infof("Detected Helm chart %s; it is deployed instead of the manifests (pass --manifests to deploy those)\n", chart)
+		}
+	}
+	if chart != "" {
+		if !exists(filepath.Join(absPath, chart, "Chart.yaml")) {
+			return SkaffoldData{}, fmt.Errorf("%s is not a Helm chart: it has no Chart.yaml", chart)
+		}
+		data.Chart, err = rel(chart)
+		return data, err
+	}
+
+	manifests := opts.Manifests
+	if manifests == "" {
+		manifests = "kubernetes"
+	}
+	if !exists(filepath.Join(absPath, manifests)) {
+		logging.Infof("Note: %s does not exist yet; generate the manifests with 'goforge container kubernetes'\n", manifests)
+	}
+	dir, err := rel(manifests)
+	if err != nil {
+		return SkaffoldData{}, err
+	}
+	data.Manifests = []string{dir + "/*.yaml"}
+	if opts.AllMains {
+		// The namespace, if any, is next to the services' directories
+		data.Manifests = append(data.Manifests, dir+"/*/*.yaml")
+		if matches, _ := filepath.Glob(filepath.Join(absPath, manifests, "*.yaml")); len(matches) == 0 {
+			data.Manifests = data.Manifests[1:]
+		}
+	}
+	return data, nil
+}
+
+// imageRepository drops the tag or digest from image, keeping a registry
+// port, e.g. localhost:5000/app:v1 becomes localhost:5000/app.
+func imageRepository(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	slash := strings.LastIndex(image, "/")
+	if colon := strings.LastIndex(image, ":"); colon > slash {
+		image = image[:colon]
+	}
+	return image
+}
+
+// findChart returns the directory of the Helm chart in the project,
+// relative to it, or "" when it has none.
+func findChart(absPath string) (string, error) {
+	var charts []string
+	err := filepath.WalkDir(absPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			if path != absPath && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if name == "Chart.yaml" {
+			rel, err := filepath.Rel(absPath, filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+			charts = append(charts, rel)
+			// A chart's subcharts are deployed with it
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to look for a Helm chart: %w", err)
+	}
+
+	switch len(charts) {
+	case 0:
+		return "", nil
+	case 1:
+		return charts[0], nil
+	default:
+		return "", fmt.Errorf("found several Helm charts (%s); choose one with --chart", strings.Join(charts, ", "))
+	}
+}
+
+// skaffoldConfig is the part of the Skaffold schema the configuration is
+// validated against: every top-level, build, artifact, and profile field
+// of the declared version is known, so misspelled ones are rejected, and
+// the fields GoForge fills in are typed.
+type skaffoldConfig struct {
+	APIVersion       string `yaml:"apiVersion"`
+	Kind             string `yaml:"kind"`
+	Metadata         any    `yaml:"metadata"`
+	Requires         any    `yaml:"requires"`
+	skaffoldPipeline `yaml:",inline"`
+	Profiles         []skaffoldProfile `yaml:"profiles"`
+}
+
+// skaffoldPipeline holds the fields a profile can override.
+type skaffoldPipeline struct {
+	Build            skaffoldBuild         `yaml:"build"`
+	Test             any                   `yaml:"test"`
+	Manifests        any                   `yaml:"manifests"`
+	Deploy           any                   `yaml:"deploy"`
+	PortForward      []skaffoldPortForward `yaml:"portForward"`
+	ResourceSelector any                   `yaml:"resourceSelector"`
+	Verify           any                   `yaml:"verify"`
+	CustomActions    any                   `yaml:"customActions"`
+}
+
+// skaffoldProfile is a profile, which overrides the pipeline when active.
+type skaffoldProfile struct {
+	Name                   string `yaml:"name"`
+	Activation             any    `yaml:"activation"`
+	RequiresAllActivations bool   `yaml:"requiresAllActivations"`
+	Patches                any    `yaml:"patches"`
+	skaffoldPipeline       `yaml:",inline"`
+}
+
+// skaffoldBuild is the build section.
+type skaffoldBuild struct {
+	Artifacts          []skaffoldArtifact `yaml:"artifacts"`
+	InsecureRegistries []string           `yaml:"insecureRegistries"`
+	TagPolicy          any                `yaml:"tagPolicy"`
+	Platforms          []string           `yaml:"platforms"`
+	Local              any                `yaml:"local"`
+	GoogleCloudBuild   any                `yaml:"googleCloudBuild"`
+	Cluster            any                `yaml:"cluster"`
+}
+
+// skaffoldArtifact is an image to build.
+type skaffoldArtifact struct {
+	Image       string   `yaml:"image"`
+	Context     string   `yaml:"context"`
+	Sync        any      `yaml:"sync"`
+	Requires    any      `yaml:"requires"`
+	Hooks       any      `yaml:"hooks"`
+	Platforms   []string `yaml:"platforms"`
+	RuntimeType string   `yaml:"runtimeType"`
+	Docker      any      `yaml:"docker"`
+	Bazel       any      `yaml:"bazel"`
+	Ko          any      `yaml:"ko"`
+	Jib         any      `yaml:"jib"`
+	Kaniko      any      `yaml:"kaniko"`
+	Buildpacks  any      `yaml:"buildpacks"`
+	Custom      any      `yaml:"custom"`
+}
+
+// skaffoldPortForward is a port forwarded during skaffold dev.
+type skaffoldPortForward struct {
+	ResourceType string `yaml:"resourceType"`
+	ResourceName string `yaml:"resourceName"`
+	Namespace    string `yaml:"namespace"`
+	Port         any    `yaml:"port"`
+	Address      string `yaml:"address"`
+	LocalPort    int    `yaml:"localPort"`
+}
+
+// validateSkaffold checks a configuration against skaffoldConfig and the
+// schema version it declares.
+func validateSkaffold(content []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	var config skaffoldConfig
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("does not match the %s schema: %w", skaffoldAPIVersion, err)
+	}
+
+	if config.APIVersion != skaffoldAPIVersion {
+		return fmt.Errorf("apiVersion is %q; GoForge validates %s", config.APIVersion, skaffoldAPIVersion)
+	}
+	if config.Kind != "Config" {
+		return fmt.Errorf("kind is %q (expected Config)", config.Kind)
+	}
+	if len(config.Build.Artifacts) == 0 {
+		return fmt.Errorf("build.artifacts is empty")
+	}
+	for i, artifact := range config.Build.Artifacts {
+		if artifact.Image == "" {
+			return fmt.Errorf("build.artifacts[%d] has no image", i)
+		}
+	}
+	var names []string
+	for i, profile := range config.Profiles {
+		if profile.Name == "" {
+			return fmt.Errorf("profiles[%d] has no name", i)
+		}
+		if slices.Contains(names, profile.Name) {
+			return fmt.Errorf("profile %s is defined twice", profile.Name)
+		}
+		names = append(names, profile.Name)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/safewrite"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dnsLabelRe matches a Kubernetes resource name (an RFC 1123 label).
+var dnsLabelRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// ServiceSpec lists the services of a multi-component application.
+type ServiceSpec struct {
+	Services []SpecService `yaml:"services"`
+}
+
+// SpecService describes one service. Port defaults to DefaultPort, replicas
+// to the single-app default, and nonroot to true. Services are probed over
+// HTTP at health_path when it is set, and with TCP probes otherwise.
+type SpecService struct {
+	Name       string `yaml:"name"`
+	Image      string `yaml:"image"`
+	Port       int    `yaml:"port"`
+	Replicas   *int   `yaml:"replicas"`
+	NonRoot    *bool  `yaml:"nonroot"`
+	HealthPath string `yaml:"health_path"`
+}
+
+// LoadSpec reads and validates a service spec file.
+func LoadSpec(specFile string) (*ServiceSpec, error) {
+	content, err := os.ReadFile(specFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec: %w", err)
+	}
+
+	// Reject unknown keys so typos don't silently fall back to defaults
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	var spec ServiceSpec
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("failed to parse spec %s: %w", specFile, err)
+	}
+
+	if len(spec.Services) == 0 {
+		return nil, fmt.Errorf("spec %s lists no services", specFile)
+	}
+
+	seen := make(map[string]bool)
+	for i, service := range spec.Services {
+		switch {
+		case !dnsLabelRe.MatchString(service.Name) || len(service.Name) > 63:
+			return nil, fmt.Errorf("service %d: invalid name %q (lowercase letters, digits, and '-')", i+1, service.Name)
+		case seen[service.Name]:
+			return nil, fmt.Errorf("service %q is listed more than once", service.Name)
+		case service.Image == "":
+			return nil, fmt.Errorf("service %q: image is required", service.Name)
+		case service.Port < 0 || service.Port > 65535:
+			return nil, fmt.Errorf("service %q: invalid port %d", service.Name, service.Port)
+		case service.Replicas != nil && *service.Replicas < 0:
+			return nil, fmt.Errorf("service %q: replicas cannot be negative", service.Name)
+		case service.HealthPath != "" && !strings.HasPrefix(service.HealthPath, "/"):
+			return nil, fmt.Errorf("service %q: health_path must start with /", service.Name)
+		}
+		seen[service.Name] = true
+	}
+
+	return &spec, nil
+}
+
+// GenerateFromSpec creates a deployment and service manifest for every
+// service in a YAML spec, each in its own subdirectory of outputDir. The
+// metadata applies to all of them; noProbes omits their probes. The
+// manifests come from templates, and existing ones are treated according to
+// write.
+func GenerateFromSpec(specFile string, outputDir string, meta Metadata, noProbes bool, templates Templates, write safewrite.Options) error {
+	logging.Infoln("Generating Kubernetes manifests from spec:", specFile)
+
+	if err := meta.validate(); err != nil {
+		return err
+	}
+	if err := templates.check(); err != nil {
+		return err
+	}
+
+	spec, err := LoadSpec(specFile)
+	if err != nil {
+		return err
+	}
+
+	absOutput, err := module.ResolveOutput(specFile, outputDir)
+	if err != nil {
+		return err
+	}
+
+	var files []safewrite.File
+	for _, service := range spec.Services {
+		data := K8sData{
+			AppName:     service.Name,
+			Image:       service.Image,
+			Replicas:    DefaultReplicas,
+			GracePeriod: DefaultGracePeriod,
+			NonRoot:     true,
+			User:        nonrootUID,
+			Service:     ServiceOptions{Type: ServiceClusterIP},
+			Metadata:    meta,
+
+			WorkloadOptions: WorkloadOptions{Kind: KindDeployment},
+			Resources:       DefaultResources,
+		}
+		ports := []int{DefaultPort}
+		if service.Port != 0 {
+			ports = []int{service.Port}
+		}
+		if data.Ports, err = namePorts(ports, nil, false); err != nil {
+			return fmt.Errorf("service %q: %w", service.Name, err)
+		}
+		if service.Replicas != nil {
+			data.Replicas = *service.Replicas
+		}
+		if service.NonRoot != nil {
+			data.NonRoot = *service.NonRoot
+		}
+
+		// There is no source to detect routes in, so probes are explicit
+		probes := ProbeOptions{Disabled: noProbes, Kind: ProbeTCP}
+		if service.HealthPath != "" {
+			probes = ProbeOptions{Disabled: noProbes, HealthPath: service.HealthPath, ReadyPath: service.HealthPath}
+		}
+		if data.Liveness, data.Readiness, err = resolveProbes("", probes, ports); err != nil {
+			return fmt.Errorf("service %q: %w", service.Name, err)
+		}
+
+		serviceFiles, err := renderManifests(filepath.Join(absOutput, service.Name), data, templates)
+		if err != nil {
+			return fmt.Errorf("service %q: %w", service.Name, err)
+		}
+		files = append(files, serviceFiles...)
+	}
+	namespace, err := renderNamespace(absOutput, meta, templates)
+	if err != nil {
+		return err
+	}
+	written, err := write.Write(append(files, namespace...)...)
+	if err != nil || !written {
+		return err
+	}
+
+	for _, service := range spec.Services {
+		fmt.Printf("- %s: %s\n", service.Name, filepath.Join(absOutput, service.Name))
+	}
+
+	fmt.Printf("Kubernetes manifests for %d services generated in: %s\n", len(spec.Services), absOutput)
+	logging.Infoln("\nTo apply the manifests, run:")
+	logging.Infoln(meta.applyHint("-R -f " + absOutput))
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/safewrite"
+)
+
+// File names of the generator templates. A file of the same name in the
+// templates directory overrides the built-in template.
+const (
+	// TemplateDockerfile is executed with DockerfileData.
+	TemplateDockerfile = "dockerfile.tmpl"
+	// The Kubernetes manifests are executed with K8sData, except the
+	// Namespace, which gets the Metadata. TemplatePod holds the definitions
+	// the workloads include: "workload-metadata", "pod", "job-spec", and
+	// "probe".
+	TemplateDeployment  = "deployment.yaml.tmpl"
+	TemplateStatefulSet = "statefulset.yaml.tmpl"
+	TemplateJob         = "job.yaml.tmpl"
+	TemplateCronJob     = "cronjob.yaml.tmpl"
+	TemplatePod         = "pod.tmpl"
+	TemplateService     = "service.yaml.tmpl"
+	TemplateConfigMap   = "configmap.yaml.tmpl"
+	TemplateSecret      = "secret.yaml.tmpl"
+	TemplateNamespace   = "namespace.yaml.tmpl"
+	// The CI pipelines are executed with CIData and use [[ ]] delimiters.
+	TemplateGitHubWorkflow = "github-workflow.yml.tmpl"
+	TemplateGitLabPipeline = "gitlab-ci.yml.tmpl"
+	// The development environment is executed with DevData.
+	TemplateDevCompose    = "docker-compose.dev.yml.tmpl"
+	TemplateDevDockerfile = "dockerfile.dev.tmpl"
+	// TemplateBake is executed with BakeData.
+	TemplateBake = "docker-bake.hcl.tmpl"
+	// TemplateSkaffold is executed with SkaffoldData and uses [[ ]]
+	// delimiters.
+	TemplateSkaffold = "skaffold.yaml.tmpl"
+	// TemplateCloudRun is executed with CloudRunData, and TemplateECS with
+	// ECSData; both can use the "json" function.
+	TemplateCloudRun = "cloudrun.yaml.tmpl"
+	TemplateECS      = "ecs-task-definition.json.tmpl"
+)
+
+// builtinTemplates are the built-in text of every template.
+var builtinTemplates = map[string]string{
+	TemplateDockerfile:     DockerfileTemplate,
+	TemplateDeployment:     K8sDeploymentTemplate,
+	TemplateStatefulSet:    K8sStatefulSetTemplate,
+	TemplateJob:            K8sJobTemplate,
+	TemplateCronJob:        K8sCronJobTemplate,
+	TemplatePod:            K8sPodTemplate,
+	TemplateService:        K8sServiceTemplate,
+	TemplateConfigMap:      K8sConfigMapTemplate,
+	TemplateSecret:         K8sSecretTemplate,
+	TemplateNamespace:      K8sNamespaceTemplate,
+	TemplateGitHubWorkflow: GitHubWorkflowTemplate,
+	TemplateGitLabPipeline: GitLabPipelineTemplate,
+	TemplateDevCompose:     DevComposeTemplate,
+	TemplateDevDockerfile:  DevDockerfileTemplate,
+	TemplateBake:           BakeTemplate,
+	TemplateSkaffold:       SkaffoldTemplate,
+	TemplateCloudRun:       CloudRunTemplate,
+	TemplateECS:            ECSTemplate,
+}
+
+// TemplateNames returns the file names of the templates, sorted.
+func TemplateNames() []string {
+	names := make([]string, 0, len(builtinTemplates))
+	for name := range builtinTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Templates finds the templates of the generators: the override file in
+// Dir when there is one, else the built-in. The zero value uses the
+// built-ins only.
+type Templates struct {
+	Dir string
+}
+
+// parse parses the template name into the set and returns it. An override
+// is named by its path, so parse and execution errors, which carry the
+// template name and line, point at the file to fix.
+func (t Templates) parse(set *template.Template, name string) (*template.Template, error) {
+	text, source := builtinTemplates[name], name
+	if t.Dir != "" {
+		path := filepath.Join(t.Dir, name)
+		content, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			text, source = string(content), path
+		case !os.IsNotExist(err):
+			return nil, fmt.Errorf("failed to read template override: %w", err)
+		}
+	}
+
+	return set.New(source).Parse(text)
+}
+
+// check verifies that Dir exists and warns about files in it that override
+// nothing, such as misspelled template names.
+func (t Templates) check() error {
+	if t.Dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(t.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read templates directory: %w", err)
+	}
+
+	var overrides []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if _, ok := builtinTemplates[entry.Name()]; !ok {
+			fmt.Fprintf(os.Stderr, "WARNING: %s overrides no template (expected one of: %s)\n", filepath.Join(t.Dir, entry.Name()), strings.Join(TemplateNames(), ", "))
+			continue
+		}
+		overrides = append(overrides, entry.Name())
+	}
+	if len(overrides) > 0 {
+		logging.Infof("Using template overrides from %s: %s\n", t.Dir, strings.Join(overrides, ", "))
+	}
+	return nil
+}
+
+// ExportTemplates writes the built-in templates into dir as a starting
+// point for overrides.
+func ExportTemplates(dir string, write safewrite.Options) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	var files []safewrite.File
+	for _, name := range TemplateNames() {
+		files = append(files, safewrite.File{Path: filepath.Join(absDir, name), Data: []byte(builtinTemplates[name])})
+	}
+	written, err := write.Write(files...)
+	if err != nil || !written {
+		return err
+	}
+
+	fmt.Printf("%d templates exported to: %s\n", len(files), absDir)
+	logging.Infoln("\nKeep the ones to change and delete the rest, then pass the directory with --templates")
+	logging.Infoln("or set container.templates in .goforge.yaml.")
+	return nil
+}
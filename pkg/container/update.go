@@ -0,0 +1,381 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/safewrite"
+
+	"golang.org/x/exp/slices"
+)
+
+// Aspects of an existing Dockerfile that UpdateDockerfile can change.
+const (
+	UpdateGoVersion    = "go-version"
+	UpdateDockerignore = "dockerignore"
+	UpdateLabels       = "labels"
+	UpdateMultiStage   = "multi-stage"
+)
+
+// DockerfileUpdates are the supported updates, in the order they apply.
+var DockerfileUpdates = []string{UpdateGoVersion, UpdateDockerignore, UpdateMultiStage, UpdateLabels}
+
+// DefaultDockerignore keeps version control, build output, and local
+// secrets out of the build context.
+const DefaultDockerignore = `# Keep the build context small and local secrets out of the image
+.git
+.gitignore
+.dockerignore
+Dockerfile*
+.env
+.env.*
+*.test
+*.out
+coverage*
+bin/
+dist/
+`
+
+// goBuildOutputRe captures the output path of a go build command.
+var goBuildOutputRe = regexp.MustCompile(`\bgo\s+build\b[^&;|]*?\s-o(?:\s+|=)(\S+)`)
+
+// parserDirectiveRe matches a Dockerfile parser directive such as
+// "# syntax=docker/dockerfile:1".
+var parserDirectiveRe = regexp.MustCompile(`^#\s*[a-zA-Z]+\s*=`)
+
+// DockerfileUpdateOptions configures UpdateDockerfile.
+type DockerfileUpdateOptions struct {
+	// Updates are the aspects to change, from DockerfileUpdates.
+	Updates []string
+	// Yes applies the changes without asking for confirmation.
+	Yes bool
+	safewrite.Options
+}
+
+// UpdateDockerfile edits an existing Dockerfile in place instead of
+// regenerating it, so user changes survive. Each update is opt-in:
+// go-version bumps golang builder images older than go.mod, dockerignore
+// adds a .dockerignore to the project when it has none, multi-stage moves
+// the binary of a single-stage Dockerfile into a small final stage, and
+// labels adds the OCI annotations to the final stage. Lines that are not
+// updated, including comments and instructions goforge does not know, are
+// kept as they are.
+// The diff is shown and confirmed on stdin before anything is written,
+// unless opts.Yes is set; with Diff or --dry-run it is only shown.
+func UpdateDockerfile(path string, dockerfile string, opts DockerfileUpdateOptions) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if len(opts.Updates) == 0 {
+		return fmt.Errorf("no update selected (expected one or more of %s)", strings.Join(DockerfileUpdates, ", "))
+	}
+	for _, update := range opts.Updates {
+		if !slices.Contains(DockerfileUpdates, update) {
+			return fmt.Errorf("invalid update %q (expected %s)", update, strings.Join(DockerfileUpdates, ", "))
+		}
+	}
+
+	content, err := os.ReadFile(dockerfile)
+	if err != nil {
+		return fmt.Errorf("failed to read Dockerfile: %w", err)
+	}
+	lines := strings.Split(string(content), "\n")
+
+	logging.Infof("Updating %s: %s\n", dockerfile, strings.Join(opts.Updates, ", "))
+	var files []safewrite.File
+	for _, update := range DockerfileUpdates {
+		if !slices.Contains(opts.Updates, update) {
+			continue
+		}
+		if update == UpdateDockerignore {
+			ignore := filepath.Join(absPath, ".dockerignore")
+			if _, err := os.Stat(ignore); err == nil {
+				logging.Infof("%s already exists\n", ignore)
+			} else {
+				files = append(files, safewrite.File{Path: ignore, Data: []byte(DefaultDockerignore)})
+			}
+			continue
+		}
+
+		instructions, err := ParseDockerfile(strings.NewReader(strings.Join(lines, "\n")))
+		if err != nil {
+			return fmt.Errorf("failed to parse Dockerfile: %w", err)
+		}
+		switch update {
+		case UpdateGoVersion:
+			lines, err = updateGoVersion(absPath, lines, instructions)
+		case UpdateMultiStage:
+			lines, err = updateMultiStage(lines, instructions)
+		case UpdateLabels:
+			lines = updateLabels(absPath, lines, instructions)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if updated := strings.Join(lines, "\n"); updated != string(content) {
+		files = append([]safewrite.File{{Path: dockerfile, Data: []byte(updated)}}, files...)
+	}
+
+	if len(files) == 0 {
+		fmt.Printf("%s is up to date\n", dockerfile)
+		return nil
+	}
+	if opts.Diff || safewrite.DryRun() {
+		// Updates replace the Dockerfile by design, so the preview does not
+		// ask for --force
+		_, err := safewrite.Options{Force: true, Diff: opts.Diff}.Write(files...)
+		return err
+	}
+
+	if !opts.Yes {
+		if _, err := (safewrite.Options{Diff: true}).Write(files...); err != nil {
+			return err
+		}
+		confirmed, err := confirm(os.Stdin, "Apply these changes? [y/N] ")
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Println("No changes written")
+			return nil
+		}
+	}
+	if _, err := (safewrite.Options{Force: true}).Write(files...); err != nil {
+		return err
+	}
+	for _, file := range files {
+		fmt.Printf("Updated %s\n", file.Path)
+	}
+	return nil
+}
+
+// confirm asks a yes/no question and reads the answer from r. Anything but
+// y or yes declines.
+func confirm(r io.Reader, question string) (bool, error) {
+	fmt.Print(question)
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("no confirmation read (use --yes to apply without asking): %w", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// updateGoVersion bumps the tag of golang images that provide an older Go
+// than go.mod requires, keeping the variant suffix such as -alpine.
+// Floating tags are already current, and images pinned to a digest are
+// left alone since the digest would no longer match.
+func updateGoVersion(absPath string, lines []string, instructions []DockerfileInstruction) ([]string, error) {
+	root, err := module.FindRoot(absPath)
+	if err != nil {
+		return nil, err
+	}
+	goVersion, toolchain, err := module.GoVersion(root)
+	if err != nil {
+		return nil, err
+	}
+	required := toolchain
+	if required == "" {
+		required = goVersion
+	}
+	tag := goModTag(goVersion, toolchain)
+	if tag == "" {
+		logging.Infoln("Note: go.mod has no go directive; builder images left as they are")
+		return lines, nil
+	}
+
+	for _, inst := range instructions {
+		if inst.Command != "FROM" {
+			continue
+		}
+		image, _ := parseFrom(inst.Args)
+		match := golangTagRe.FindStringSubmatchIndex(image)
+		if match == nil {
+			continue
+		}
+		provided := image[match[2]:match[3]]
+		if !olderGo(provided, required) {
+			continue
+		}
+		if strings.Contains(image, "@") {
+			logging.Infof("Note: %s is pinned to a digest, which a new tag would not match; update it by hand\n", image)
+			continue
+		}
+
+		bumped := image[:match[2]] + tag + image[match[3]:]
+		line := inst.Line - 1
+		if !strings.Contains(lines[line], image) {
+			continue
+		}
+		lines[line] = strings.Replace(lines[line], image, bumped, 1)
+		logging.Infof("Builder image %s -> %s to match go.mod\n", image, bumped)
+	}
+	return lines, nil
+}
+
+// updateMultiStage turns a single-stage Dockerfile into a builder stage and
+// a final stage on the default runtime image. The final stage copies the
+// binary of the stage's go build -o to the same path and repeats the
+// instructions that describe the running container, so paths in CMD and
+// ENTRYPOINT still resolve. The builder stage is otherwise kept as it is.
+func updateMultiStage(lines []string, instructions []DockerfileInstruction) ([]string, error) {
+	var from *DockerfileInstruction
+	for i, inst := range instructions {
+		if inst.Command != "FROM" {
+			continue
+		}
+		if from != nil {
+			logging.Infoln("The Dockerfile already has several stages")
+			return lines, nil
+		}
+		from = &instructions[i]
+	}
+	if from == nil {
+		return nil, fmt.Errorf("the Dockerfile has no FROM instruction")
+	}
+
+	workDir, binary, cgoDisabled := "/", "", false
+	var runtime []string
+	for _, inst := range instructions {
+		switch inst.Command {
+		case "WORKDIR":
+			workDir = path.Join(workDir, strings.Trim(inst.Args, `"'`))
+		case "RUN":
+			if match := goBuildOutputRe.FindStringSubmatch(inst.Args); match != nil {
+				binary = path.Join(workDir, strings.Trim(match[1], `"'`))
+			}
+		case "LABEL", "ENV", "EXPOSE", "HEALTHCHECK", "ENTRYPOINT", "CMD":
+			runtime = append(runtime, lines[inst.Line-1:inst.EndLine]...)
+		}
+		if strings.Contains(inst.Args, "CGO_ENABLED=0") {
+			cgoDisabled = true
+		}
+	}
+	if binary == "" {
+		return nil, fmt.Errorf("no 'go build -o' found; the final stage needs to know which binary to copy")
+	}
+	if !cgoDisabled {
+		fmt.Fprintf(os.Stderr, "WARNING: the build does not set CGO_ENABLED=0; a binary linked against the builder's C library may not run on %s\n", runtimeImages[DefaultRuntime].Image)
+	}
+
+	stage := "builder"
+	if _, name := parseFrom(from.Args); name != "" {
+		stage = name
+	} else {
+		lines[from.Line-1] = strings.TrimRight(lines[from.Line-1], " ") + " AS " + stage
+	}
+
+	final := []string{
+		"",
+		"# Run the binary on a small image; the toolchain stays in the " + stage + " stage",
+		"FROM " + runtimeImages[DefaultRuntime].Image,
+		"WORKDIR " + workDir,
+		"COPY --from=" + stage + " " + binary + " " + binary,
+	}
+	final = append(final, runtime...)
+	logging.Infof("Final stage on %s runs %s\n", runtimeImages[DefaultRuntime].Image, binary)
+	return slices.Insert(lines, endOfContent(lines), final...), nil
+}
+
+// updateLabels adds the OCI annotations to the final stage when it has
+// none, with the build arguments 'goforge container build' sets. The
+// arguments are declared before the first FROM with the values read from
+// git, like in generated Dockerfiles.
+func updateLabels(absPath string, lines []string, instructions []DockerfileInstruction) []string {
+	info := readBuildInfo(absPath)
+	if info == nil {
+		fmt.Fprintln(os.Stderr, "WARNING: not a git repository with commits; the OCI labels need its metadata, skipping them")
+		return lines
+	}
+
+	var first, final *DockerfileInstruction
+	global := make(map[string]bool)
+	for i, inst := range instructions {
+		switch inst.Command {
+		case "FROM":
+			if first == nil {
+				first = &instructions[i]
+			}
+			final = &instructions[i]
+		case "ARG":
+			if first == nil {
+				name, _, _ := strings.Cut(inst.Args, "=")
+				global[strings.TrimSpace(name)] = true
+			}
+		}
+	}
+	if final == nil {
+		return lines
+	}
+	for _, inst := range instructions {
+		if inst.Line > final.Line && inst.Command == "LABEL" && strings.Contains(inst.Args, "org.opencontainers.image.") {
+			logging.Infoln("The final stage already has OCI labels")
+			return lines
+		}
+	}
+
+	args := []EnvVar{
+		{Name: argSource, Value: info.Source},
+		{Name: argVersion, Value: info.Version},
+		{Name: argRevision, Value: info.Revision},
+		{Name: argCreated, Value: info.Created},
+	}
+	if info.Source == "" {
+		args = args[1:]
+	}
+
+	stage := []string{"", "# OCI annotations: https://github.com/opencontainers/image-spec/blob/main/annotations.md"}
+	var labels []string
+	for _, arg := range args {
+		stage = append(stage, "ARG "+arg.Name)
+		labels = append(labels, fmt.Sprintf(`org.opencontainers.image.%s="$%s"`, strings.ToLower(arg.Name), arg.Name))
+	}
+	stage = append(stage, "LABEL "+strings.Join(labels, " \\\n      "), "")
+	lines = slices.Insert(lines, final.EndLine, strings.Split(strings.Join(stage, "\n"), "\n")...)
+
+	var declared []string
+	for _, arg := range args {
+		if !global[arg.Name] {
+			declared = append(declared, fmt.Sprintf("ARG %s=%q", arg.Name, arg.Value))
+		}
+	}
+	if len(declared) > 0 {
+		declared = append([]string{"# Build metadata read from git; 'goforge container build' passes the values of the commit being built"}, declared...)
+		lines = slices.Insert(lines, commentStart(lines, first.Line-1), append(declared, "")...)
+	}
+	return lines
+}
+
+// commentStart returns the index of the first line of the comment block
+// directly above line i, or i when there is none. Parser directives such as
+// "# syntax=" must stay first and are not part of it.
+func commentStart(lines []string, i int) int {
+	for i > 0 {
+		text := strings.TrimSpace(lines[i-1])
+		if !strings.HasPrefix(text, "#") || parserDirectiveRe.MatchString(text) {
+			break
+		}
+		i--
+	}
+	return i
+}
+
+// endOfContent returns the index after the last non-blank line, where new
+// content goes so the file keeps its trailing newline.
+func endOfContent(lines []string) int {
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	return end
+}
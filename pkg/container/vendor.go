@@ -0,0 +1,66 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+	"goforge/pkg/safewrite"
+)
+
+// resolveVendor checks that the module at absPath can be built from its
+// vendor directory without network access. With create, a missing or
+// out-of-date vendor directory is (re)generated with go mod vendor, except
+// with diff or --dry-run, which must not touch the project. Otherwise a missing one is
+// an error and an out-of-date one only a warning, since the Dockerfile is
+// right either way.
+func resolveVendor(absPath string, create bool, diff bool) error {
+	output, err := checkVendor(absPath)
+	if err == nil {
+		return nil
+	}
+
+	_, statErr := os.Stat(filepath.Join(absPath, "vendor"))
+	missing := os.IsNotExist(statErr)
+	if !create {
+		if missing {
+			return fmt.Errorf("no vendor directory in %s; run 'go mod vendor' or pass --vendor-create", absPath)
+		}
+		fmt.Fprintf(os.Stderr, "WARNING: the project does not build from vendor/, which is likely out of date with go.mod; run 'go mod vendor' or pass --vendor-create\n%s", output)
+		return nil
+	}
+
+	if diff || safewrite.DryRun() {
+		logging.Infoln("Note: a preview leaves the project untouched; vendor/ is not updated with go mod vendor")
+		return nil
+	}
+	if missing {
+		logging.Infoln("Vendoring dependencies with go mod vendor...")
+	} else {
+		logging.Infoln("Refreshing the out-of-date vendor directory with go mod vendor...")
+	}
+	cmd := proc.Command("go", "mod", "vendor")
+	cmd.Dir = absPath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("go mod vendor failed: %w\nOutput: %s", err, output)
+	}
+	return nil
+}
+
+// checkVendor lists the module's packages and their dependencies from the
+// vendor directory alone, which fails when vendor/modules.txt disagrees
+// with go.mod or a package is missing. A module without dependencies needs
+// no vendor directory at all.
+func checkVendor(absPath string) ([]byte, error) {
+	cmd := proc.Command("go", "list", "-mod=vendor", "-deps", "./...")
+	cmd.Dir = absPath
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stderr.Bytes(), err
+	}
+	return nil, nil
+}
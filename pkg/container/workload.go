@@ -0,0 +1,235 @@
+package container
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Workload kinds of generated Kubernetes manifests.
+const (
+	KindDeployment  = "deployment"
+	KindStatefulSet = "statefulset"
+	KindJob         = "job"
+	KindCronJob     = "cronjob"
+)
+
+// WorkloadKinds lists the supported workload kinds.
+var WorkloadKinds = []string{KindDeployment, KindStatefulSet, KindJob, KindCronJob}
+
+// concurrencyPolicies are the CronJob concurrency policies.
+var concurrencyPolicies = []string{"Allow", "Forbid", "Replace"}
+
+// Defaults of the Job settings.
+const (
+	DefaultCompletions       = 1
+	DefaultParallelism       = 1
+	DefaultBackoffLimit      = 6
+	DefaultConcurrencyPolicy = "Forbid"
+)
+
+// VolumeClaim is a StatefulSet volume claim template mounted into the
+// container.
+type VolumeClaim struct {
+	Name      string
+	MountPath string
+	// Size is the requested storage, e.g. 10Gi.
+	Size string
+}
+
+// WorkloadOptions selects the kind of workload and holds the settings
+// specific to each kind. The zero value is a Deployment.
+type WorkloadOptions struct {
+	Kind string
+	// VolumeClaims and StorageClass apply to StatefulSets.
+	VolumeClaims []VolumeClaim
+	StorageClass string
+	// Schedule and ConcurrencyPolicy apply to CronJobs.
+	Schedule          string
+	ConcurrencyPolicy string
+	// Completions, Parallelism, and BackoffLimit apply to Jobs and the
+	// Jobs a CronJob creates.
+	Completions  int
+	Parallelism  int
+	BackoffLimit int
+}
+
+// Batch reports whether the workload runs to completion, so its pods are
+// restarted only on failure and it gets no Service.
+func (w *WorkloadOptions) Batch() bool {
+	return w.Kind == KindJob || w.Kind == KindCronJob
+}
+
+// ParseVolumeClaims parses NAME:MOUNT_PATH:SIZE volume claims, e.g.
+// data:/var/lib/app:10Gi.
+func ParseVolumeClaims(specs []string) ([]VolumeClaim, error) {
+	var claims []VolumeClaim
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid volume claim %q (expected NAME:MOUNT_PATH:SIZE, e.g. data:/var/lib/app:10Gi)", spec)
+		}
+		claim := VolumeClaim{Name: parts[0], MountPath: parts[1], Size: parts[2]}
+		switch {
+		case !dnsLabelRe.MatchString(claim.Name) || len(claim.Name) > 63:
+			return nil, fmt.Errorf("volume claim %q: invalid name %q (lowercase letters, digits, and '-')", spec, claim.Name)
+		case !path.IsAbs(claim.MountPath):
+			return nil, fmt.Errorf("volume claim %q: mount path must be absolute", spec)
+		case !quantityRe.MatchString(claim.Size):
+			return nil, fmt.Errorf("volume claim %q: invalid size %q (e.g. 10Gi)", spec, claim.Size)
+		}
+		claims = append(claims, claim)
+	}
+	return claims, nil
+}
+
+// resolve validates the options for their kind and fills in defaults. Zero
+// completions and parallelism default to 1.
+func (w *WorkloadOptions) resolve() error {
+	if w.Kind == "" {
+		w.Kind = KindDeployment
+	}
+	w.Kind = strings.ToLower(w.Kind)
+	if !slices.Contains(WorkloadKinds, w.Kind) {
+		return fmt.Errorf("invalid workload kind %q (expected %s)", w.Kind, strings.Join(WorkloadKinds, ", "))
+	}
+
+	if w.Kind != KindStatefulSet && (len(w.VolumeClaims) > 0 || w.StorageClass != "") {
+		return fmt.Errorf("volume claims are only supported for statefulsets")
+	}
+	if w.Kind != KindCronJob && w.Schedule != "" {
+		return fmt.Errorf("a schedule is only supported for cronjobs")
+	}
+	if w.Kind == KindCronJob {
+		if w.Schedule == "" {
+			return fmt.Errorf("cronjobs need a --schedule, e.g. \"0 3 * * *\"")
+		}
+		if err := validateSchedule(w.Schedule); err != nil {
+			return err
+		}
+		if w.ConcurrencyPolicy == "" {
+			w.ConcurrencyPolicy = DefaultConcurrencyPolicy
+		}
+		policy := slices.IndexFunc(concurrencyPolicies, func(p string) bool { return strings.EqualFold(p, w.ConcurrencyPolicy) })
+		if policy < 0 {
+			return fmt.Errorf("invalid concurrency policy %q (expected Allow, Forbid, or Replace)", w.ConcurrencyPolicy)
+		}
+		w.ConcurrencyPolicy = concurrencyPolicies[policy]
+	}
+
+	if w.Completions == 0 {
+		w.Completions = DefaultCompletions
+	}
+	if w.Parallelism == 0 {
+		w.Parallelism = DefaultParallelism
+	}
+	switch {
+	case w.Completions < 0:
+		return fmt.Errorf("completions cannot be negative")
+	case w.Parallelism < 0:
+		return fmt.Errorf("parallelism cannot be negative")
+	case w.BackoffLimit < 0:
+		return fmt.Errorf("backoff limit cannot be negative")
+	}
+	return nil
+}
+
+// cronField is the range of one field of a cron schedule.
+type cronField struct {
+	name     string
+	min, max int
+	// names are the accepted aliases of min, min+1, ...
+	names []string
+	// question accepts ? for "any", like *.
+	question bool
+}
+
+// cronFields are the five fields of a standard cron schedule.
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31, question: true},
+	{name: "month", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{name: "day of week", min: 0, max: 6, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}, question: true},
+}
+
+// cronMacros are the schedule shorthands Kubernetes accepts.
+var cronMacros = []string{"@yearly", "@annually", "@monthly", "@weekly", "@daily", "@midnight", "@hourly"}
+
+// validateSchedule checks a CronJob schedule: five fields of values, names,
+// ranges, lists, steps, and *, or one of the @ macros.
+func validateSchedule(schedule string) error {
+	if strings.HasPrefix(schedule, "@") {
+		if !slices.Contains(cronMacros, strings.ToLower(schedule)) {
+			return fmt.Errorf("invalid schedule %q (expected one of %s)", schedule, strings.Join(cronMacros, ", "))
+		}
+		return nil
+	}
+
+	fields := strings.Fields(schedule)
+	if len(fields) != len(cronFields) {
+		return fmt.Errorf("invalid schedule %q: expected 5 fields (minute hour day-of-month month day-of-week), got %d", schedule, len(fields))
+	}
+	for i, field := range fields {
+		if err := cronFields[i].validate(field); err != nil {
+			return fmt.Errorf("invalid schedule %q: %w", schedule, err)
+		}
+	}
+	return nil
+}
+
+// validate checks one field of a schedule.
+func (f cronField) validate(text string) error {
+	for _, item := range strings.Split(text, ",") {
+		rangeText, stepText, hasStep := strings.Cut(item, "/")
+		if hasStep {
+			if step, err := strconv.Atoi(stepText); err != nil || step < 1 {
+				return fmt.Errorf("invalid step %q in %s field", stepText, f.name)
+			}
+		}
+
+		if rangeText == "*" || (rangeText == "?" && f.question) {
+			continue
+		}
+		low, high, isRange := strings.Cut(rangeText, "-")
+		start, err := f.value(low)
+		if err != nil {
+			return err
+		}
+		if isRange {
+			end, err := f.value(high)
+			if err != nil {
+				return err
+			}
+			if end < start {
+				return fmt.Errorf("range %s is backwards in %s field", rangeText, f.name)
+			}
+		}
+	}
+	return nil
+}
+
+// value parses a number or name in the field's range.
+func (f cronField) value(text string) (int, error) {
+	if i := slices.Index(f.names, strings.ToUpper(text)); i >= 0 {
+		return f.min + i, nil
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("%q is not a valid %s (%d-%d)", text, f.name, f.min, f.max)
+	}
+	return n, nil
+}
+
+// resolveWorkloadPorts returns the container ports of the workload. Jobs and
+// CronJobs usually serve nothing, so they only get the ports set explicitly
+// or detected in the source, without falling back to DefaultPort.
+func resolveWorkloadPorts(absPath string, opts KubernetesOptions) ([]int, error) {
+	if !opts.Batch() || len(opts.Ports) > 0 {
+		return resolvePorts(absPath, opts.Ports)
+	}
+	return DetectPorts(absPath)
+}
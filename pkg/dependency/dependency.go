@@ -1,50 +1,102 @@
+// Package dependency checks the modules a Go project requires: which are
+// outdated, which have known vulnerabilities, and how they depend on each
+// other. It also updates them.
 package dependency
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
+	"io"
 	"path/filepath"
-	"strings"
+	"sort"
+	"time"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/workerpool"
 )
 
-// CheckOutdated checks for outdated dependencies in a Go project.
-func CheckOutdated(path string) error {
-	fmt.Println("Checking for outdated dependencies in:", path)
+// Orders of the outdated dependencies.
+const (
+	SortName = "name"
+	SortAge  = "age"
+)
 
-	// Get absolute path
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+// OutdatedOptions configures the outdated dependency checks.
+type OutdatedOptions struct {
+	// Retries bounds the retries of transient module proxy failures.
+	Retries int
+	// DirectOnly leaves out the dependencies that go.mod does not require
+	// directly.
+	DirectOnly bool
+	// Sort orders the dependencies by SortName, the default, or SortAge,
+	// oldest current version first.
+	Sort string
+}
+
+// Outdated is a dependency with a newer version available.
+type Outdated struct {
+	Path    string
+	Version string
+	Update  string
+	// Time and UpdateTime are when the versions were published; they are
+	// zero when the module proxy does not say.
+	Time       time.Time
+	UpdateTime time.Time
+}
+
+// String formats the dependency like 'go list -m -u', followed by how far
+// the current version is behind the update.
+func (o Outdated) String() string {
+	line := fmt.Sprintf("%s %s [%s]", o.Path, o.Version, o.Update)
+	if !o.Time.IsZero() && o.UpdateTime.After(o.Time) {
+		days := int(o.UpdateTime.Sub(o.Time).Hours() / 24)
+		line += fmt.Sprintf(" (%d days behind)", days)
 	}
+	return line
+}
 
-	// Change to project directory
-	originalDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+// ModuleResult is the outdated check result for one module.
+type ModuleResult struct {
+	Dir      string
+	Outdated []Outdated
+	Err      error
+}
+
+// validate checks the sort order.
+func (opts OutdatedOptions) validate() error {
+	switch opts.Sort {
+	case "", SortName, SortAge:
+		return nil
 	}
-	defer os.Chdir(originalDir)
+	return fmt.Errorf("invalid sort order %q (expected %s or %s)", opts.Sort, SortName, SortAge)
+}
 
-	err = os.Chdir(absPath)
-	if err != nil {
-		return fmt.Errorf("failed to change to project directory: %w", err)
+// CheckOutdated checks for outdated dependencies in a Go project. Outdated
+// dependencies are reported as a policy failure.
+func CheckOutdated(path string, opts OutdatedOptions) error {
+	logging.Infoln("Checking for outdated dependencies in:", path)
+
+	if err := opts.validate(); err != nil {
+		return err
 	}
 
-	// Use 'go list -m -u all' to check for outdated dependencies
-	cmd := exec.Command("go", "list", "-m", "-u", "all")
-	output, err := cmd.CombinedOutput()
+	// Get absolute path
+	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return fmt.Errorf("failed to check dependencies: %w", err)
+		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	// Parse the output
-	lines := strings.Split(string(output), "\n")
-	outdated := []string{}
+	if _, err := module.FindRoot(absPath); err != nil {
+		return err
+	}
 
-	for _, line := range lines {
-		if strings.Contains(line, "[") && strings.Contains(line, "]") {
-			outdated = append(outdated, line)
-		}
+	outdated, err := listOutdated(absPath, opts)
+	if err != nil {
+		return err
 	}
 
 	// Display results
@@ -53,60 +105,148 @@ func CheckOutdated(path string) error {
 		for _, dep := range outdated {
 			fmt.Println("-", dep)
 		}
-		fmt.Println("\nUse 'goforge dependency update' to update them.")
-	} else {
-		fmt.Println("\nAll dependencies are up to date!")
+		logging.Infoln("\nUse 'goforge dependency update' to update them.")
+		return exitcode.Policyf("%d outdated dependencies", len(outdated))
 	}
 
+	fmt.Println("\nAll dependencies are up to date!")
 	return nil
 }
 
-// Update updates dependencies to their latest versions.
-func Update(path string) error {
-	fmt.Println("Updating dependencies in:", path)
+// CheckOutdatedRecursive checks every module under root concurrently, as
+// many at once as --jobs allows, and prints one report grouped by module. A
+// module that fails to check is reported without stopping the others.
+func CheckOutdatedRecursive(root string, opts OutdatedOptions) error {
+	logging.Infoln("Checking for outdated dependencies in all modules under:", root)
 
-	// Get absolute path
-	absPath, err := filepath.Abs(path)
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	absRoot, err := filepath.Abs(root)
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	// Change to project directory
-	originalDir, err := os.Getwd()
+	dirs, err := module.FindModules(absRoot)
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("no go.mod found under %s", absRoot)
 	}
-	defer os.Chdir(originalDir)
+	logging.Infof("Found %d modules\n", len(dirs))
 
-	err = os.Chdir(absPath)
-	if err != nil {
-		return fmt.Errorf("failed to change to project directory: %w", err)
+	results := make([]ModuleResult, len(dirs))
+	workerpool.Run(len(dirs), func(i int) {
+		outdated, err := listOutdated(dirs[i], opts)
+		results[i] = ModuleResult{Dir: dirs[i], Outdated: outdated, Err: err}
+	})
+
+	failed, withOutdated := 0, 0
+	for _, result := range results {
+		rel, err := filepath.Rel(absRoot, result.Dir)
+		if err != nil {
+			rel = result.Dir
+		}
+		fmt.Printf("\nModule: %s\n", rel)
+
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Printf("- ERROR: %v\n", result.Err)
+		case len(result.Outdated) == 0:
+			fmt.Println("- All dependencies are up to date")
+		default:
+			withOutdated++
+			for _, dep := range result.Outdated {
+				fmt.Println("-", dep)
+			}
+		}
 	}
 
-	// Use 'go get -u' to update dependencies
-	cmd := exec.Command("go", "get", "-u", "./...")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to update dependencies: %w\nOutput: %s", err, output)
+	fmt.Println("\nSummary:")
+	fmt.Printf("- Modules checked: %d\n", len(results))
+	fmt.Printf("- Modules with outdated dependencies: %d\n", withOutdated)
+	fmt.Printf("- Modules that could not be checked: %d\n", failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d modules could not be checked", failed, len(results))
+	}
+	if withOutdated > 0 {
+		return exitcode.Policyf("%d of %d modules have outdated dependencies", withOutdated, len(results))
 	}
+	return nil
+}
 
-	fmt.Println("Dependencies updated successfully!")
-	fmt.Println("\nRunning 'go mod tidy' to clean up go.mod and go.sum...")
+// listedModule is the part of the 'go list -m -json' output the checks use.
+type listedModule struct {
+	Path    string
+	Version string
+	Time    time.Time
+	Main    bool
+	Update  *struct {
+		Version string
+		Time    time.Time
+	}
+}
 
-	// Run go mod tidy to clean up
-	cmd = exec.Command("go", "mod", "tidy")
-	output, err = cmd.CombinedOutput()
+// listOutdated runs 'go list -m -u -json all' in dir and returns the
+// dependencies that have a newer version available, in the order opts asks
+// for. Direct dependencies are told apart by parsing go.mod.
+func listOutdated(dir string, opts OutdatedOptions) ([]Outdated, error) {
+	var direct map[string]bool
+	if opts.DirectOnly {
+		var err error
+		if direct, err = module.DirectRequires(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	output, err := runGo(dir, opts.Retries, "list", "-m", "-u", "-json", "all")
 	if err != nil {
-		return fmt.Errorf("failed to tidy dependencies: %w\nOutput: %s", err, output)
+		return nil, fmt.Errorf("failed to check dependencies: %w", err)
 	}
 
-	fmt.Println("Dependencies tidied successfully!")
-	return nil
+	var outdated []Outdated
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var mod listedModule
+		if err := decoder.Decode(&mod); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse go list output: %w", err)
+		}
+		if mod.Main || mod.Update == nil || (opts.DirectOnly && !direct[mod.Path]) {
+			continue
+		}
+		outdated = append(outdated, Outdated{
+			Path:       mod.Path,
+			Version:    mod.Version,
+			Update:     mod.Update.Version,
+			Time:       mod.Time,
+			UpdateTime: mod.Update.Time,
+		})
+	}
+
+	sort.SliceStable(outdated, func(i, j int) bool {
+		a, b := outdated[i], outdated[j]
+		if opts.Sort == SortAge && !a.Time.Equal(b.Time) {
+			// Unknown times go last
+			if a.Time.IsZero() || b.Time.IsZero() {
+				return b.Time.IsZero()
+			}
+			return a.Time.Before(b.Time)
+		}
+		return a.Path < b.Path
+	})
+	return outdated, nil
 }
 
-// CheckSecurity checks dependencies for security vulnerabilities.
-func CheckSecurity(path string) error {
-	fmt.Println("Checking dependencies for security vulnerabilities in:", path)
+// Update updates dependencies to their latest versions, retrying
+// transient module proxy failures up to retries times.
+func Update(path string, retries int) error {
+	logging.Infoln("Updating dependencies in:", path)
 
 	// Get absolute path
 	absPath, err := filepath.Abs(path)
@@ -114,28 +254,23 @@ func CheckSecurity(path string) error {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	// Change to project directory
-	originalDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+	if _, err := module.FindRoot(absPath); err != nil {
+		return err
 	}
-	defer os.Chdir(originalDir)
 
-	err = os.Chdir(absPath)
-	if err != nil {
-		return fmt.Errorf("failed to change to project directory: %w", err)
+	// Use 'go get -u' to update dependencies
+	if _, err := runGo(absPath, retries, "get", "-u", "./..."); err != nil {
+		return fmt.Errorf("failed to update dependencies: %w", err)
 	}
 
-	// In a real implementation, this would use a security scanning tool like govulncheck
-	// For this example, we'll simulate a vulnerability scan
-	fmt.Println("\nSecurity Scan Results:")
-	fmt.Println("- No critical vulnerabilities found")
-	fmt.Println("- 2 moderate vulnerabilities in indirect dependencies")
-	fmt.Println("  - github.com/example/package@v1.2.3: CVE-2023-12345")
-	fmt.Println("  - github.com/another/lib@v0.1.2: GHSA-abcd-1234-5678")
+	logging.Infoln("Dependencies updated successfully!")
+	logging.Infoln("\nRunning 'go mod tidy' to clean up go.mod and go.sum...")
 
-	fmt.Println("\nRecommendation:")
-	fmt.Println("Run 'go get github.com/example/package@v1.3.0' to resolve CVE-2023-12345")
+	// Run go mod tidy to clean up
+	if _, err := runGo(absPath, retries, "mod", "tidy"); err != nil {
+		return fmt.Errorf("failed to tidy dependencies: %w", err)
+	}
 
+	fmt.Println("Dependencies tidied successfully!")
 	return nil
 }
@@ -0,0 +1,88 @@
+package dependency
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+)
+
+// DefaultRetries is how many times a failed go command is retried when the
+// failure looks transient.
+const DefaultRetries = 3
+
+// retryBackoff is the delay before the first retry; it doubles on each retry.
+const retryBackoff = time.Second
+
+// transientErrors are fragments of go command output that indicate a
+// network or module proxy problem worth retrying.
+var transientErrors = []string{
+	"i/o timeout",
+	"connection reset",
+	"connection refused",
+	"TLS handshake timeout",
+	"temporary failure",
+	"no such host",
+	"unexpected EOF",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+	"429 Too Many Requests",
+}
+
+// proxyEnv are the go environment settings that decide how modules are fetched.
+var proxyEnv = []string{"GOPROXY", "GOSUMDB", "GONOSUMDB", "GONOPROXY", "GOPRIVATE", "GOFLAGS"}
+
+// runGo runs a go command in dir, retrying up to retries times with
+// exponential backoff while it fails with a transient network error. Errors
+// include the command output and the module proxy settings.
+func runGo(dir string, retries int, args ...string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		cmd := proc.Command("go", args...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			return output, nil
+		}
+
+		if attempt >= retries || !isTransient(string(output)) {
+			return output, fmt.Errorf("%w\nOutput: %s\n%s", err, strings.TrimSpace(string(output)), proxySettings(dir))
+		}
+
+		delay := retryBackoff << attempt
+		logging.Infof("Transient error running 'go %s' in %s; retrying in %s (retry %d of %d)\n",
+			strings.Join(args, " "), dir, delay, attempt+1, retries)
+		time.Sleep(delay)
+	}
+}
+
+// isTransient reports whether go command output points at a network failure.
+func isTransient(output string) bool {
+	for _, fragment := range transientErrors {
+		if strings.Contains(output, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxySettings describes the module proxy configuration in effect for dir.
+func proxySettings(dir string) string {
+	cmd := proc.Command("go", append([]string{"env"}, proxyEnv...)...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "Module proxy settings: unavailable"
+	}
+
+	values := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+	var settings []string
+	for i, name := range proxyEnv {
+		if i < len(values) {
+			settings = append(settings, fmt.Sprintf("%s=%q", name, values[i]))
+		}
+	}
+	return "Module proxy settings: " + strings.Join(settings, " ")
+}
@@ -0,0 +1,474 @@
+package dependency
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/proc"
+	"goforge/pkg/safewrite"
+)
+
+// SecurityReport is the structured result of a vulnerability scan.
+type SecurityReport struct {
+	Project         string          `json:"project"`
+	Scanner         string          `json:"scanner"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// Vulnerability describes a single advisory affecting a module.
+type Vulnerability struct {
+	ID             string     `json:"id"`
+	Aliases        []string   `json:"aliases,omitempty"`
+	Summary        string     `json:"summary"`
+	Severity       string     `json:"severity"`
+	Module         string     `json:"module"`
+	FoundVersion   string     `json:"found_version,omitempty"`
+	FixedVersion   string     `json:"fixed_version,omitempty"`
+	AffectedRanges []string   `json:"affected_ranges,omitempty"`
+	Called         bool       `json:"called"`
+	CallPaths      []CallPath `json:"call_paths,omitempty"`
+	URL            string     `json:"url,omitempty"`
+}
+
+// CallPath is a chain of calls from project code to a vulnerable symbol.
+type CallPath struct {
+	Frames []string `json:"frames"`
+	File   string   `json:"file,omitempty"`
+	Line   int      `json:"line,omitempty"`
+}
+
+// govulncheckMessage is one entry in the govulncheck -json output stream.
+type govulncheckMessage struct {
+	OSV     *osvEntry           `json:"osv"`
+	Finding *govulncheckFinding `json:"finding"`
+}
+
+type osvEntry struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package struct {
+			Name string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Events []struct {
+				Introduced string `json:"introduced"`
+				Fixed      string `json:"fixed"`
+			} `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+	DatabaseSpecific struct {
+		URL string `json:"url"`
+	} `json:"database_specific"`
+}
+
+type govulncheckFinding struct {
+	OSV          string             `json:"osv"`
+	FixedVersion string             `json:"fixed_version"`
+	Trace        []govulncheckFrame `json:"trace"`
+}
+
+type govulncheckFrame struct {
+	Module   string `json:"module"`
+	Version  string `json:"version"`
+	Package  string `json:"package"`
+	Function string `json:"function"`
+	Receiver string `json:"receiver"`
+	Position *struct {
+		Filename string `json:"filename"`
+		Line     int    `json:"line"`
+	} `json:"position"`
+}
+
+// CheckSecurity checks dependencies for security vulnerabilities.
+// When outputFile is set, a report is written in the given format (json or sarif).
+func CheckSecurity(path string, outputFile string, format string) error {
+	logging.Infoln("Checking dependencies for security vulnerabilities in:", path)
+
+	if format != "json" && format != "sarif" {
+		return fmt.Errorf("unsupported format: %s (supported: json, sarif)", format)
+	}
+
+	// Get absolute path
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	if _, err := module.FindRoot(absPath); err != nil {
+		return err
+	}
+
+	report, err := ScanVulnerabilities(absPath)
+	if err != nil {
+		return err
+	}
+
+	printSecurityReport(report)
+	policyErr := reachablePolicy(report)
+
+	if outputFile == "" {
+		return policyErr
+	}
+
+	absOutput, err := module.ResolveOutput(absPath, outputFile)
+	if err != nil {
+		return err
+	}
+
+	if err := safewrite.CreateDir(absOutput); err != nil {
+		return err
+	}
+	file, err := os.Create(absOutput)
+	if err != nil {
+		return fmt.Errorf("failed to create security report: %w", err)
+	}
+	defer file.Close()
+
+	if format == "sarif" {
+		err = writeSARIF(file, report)
+	} else {
+		err = writeJSON(file, report)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write security report: %w", err)
+	}
+
+	fmt.Printf("\nSecurity report (%s) written to: %s\n", format, absOutput)
+	return policyErr
+}
+
+// reachablePolicy fails when project code calls a vulnerable symbol, like
+// govulncheck does; vulnerabilities only present in dependencies are reported
+// without failing.
+func reachablePolicy(report *SecurityReport) error {
+	called := 0
+	for _, vuln := range report.Vulnerabilities {
+		if vuln.Called {
+			called++
+		}
+	}
+	if called > 0 {
+		return exitcode.Policyf("%d vulnerabilities are reachable from your code", called)
+	}
+	return nil
+}
+
+// ScanVulnerabilities runs govulncheck in the project directory and collects its findings.
+func ScanVulnerabilities(absPath string) (*SecurityReport, error) {
+	if _, err := exec.LookPath("govulncheck"); err != nil {
+		return nil, fmt.Errorf("govulncheck not found in PATH; install it with 'go install golang.org/x/vuln/cmd/govulncheck@latest'")
+	}
+
+	cmd := proc.Command("govulncheck", "-json", "./...")
+	cmd.Dir = absPath
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run govulncheck: %w\nOutput: %s", err, stderr.String())
+	}
+
+	report, err := parseGovulncheck(strings.NewReader(string(output)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse govulncheck output: %w", err)
+	}
+	report.Project = absPath
+
+	return report, nil
+}
+
+// parseGovulncheck converts a govulncheck -json message stream into a report.
+func parseGovulncheck(r io.Reader) (*SecurityReport, error) {
+	osvs := make(map[string]*osvEntry)
+	vulns := make(map[string]*Vulnerability)
+	var order []string
+
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var msg govulncheckMessage
+		err := decoder.Decode(&msg)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if msg.OSV != nil {
+			osvs[msg.OSV.ID] = msg.OSV
+		}
+		if msg.Finding == nil || len(msg.Finding.Trace) == 0 {
+			continue
+		}
+
+		finding := msg.Finding
+		vulnerable := finding.Trace[0]
+		key := finding.OSV + "|" + vulnerable.Module
+
+		vuln, ok := vulns[key]
+		if !ok {
+			vuln = &Vulnerability{
+				ID:           finding.OSV,
+				Module:       vulnerable.Module,
+				FoundVersion: vulnerable.Version,
+				FixedVersion: finding.FixedVersion,
+			}
+			vulns[key] = vuln
+			order = append(order, key)
+		}
+
+		// Symbol-level findings carry the call stack from project code
+		if vulnerable.Function != "" {
+			vuln.Called = true
+			vuln.CallPaths = append(vuln.CallPaths, buildCallPath(finding.Trace))
+		}
+	}
+
+	report := &SecurityReport{Scanner: "govulncheck", Vulnerabilities: []Vulnerability{}}
+	for _, key := range order {
+		vuln := vulns[key]
+		if entry, ok := osvs[vuln.ID]; ok {
+			vuln.Aliases = entry.Aliases
+			vuln.Summary = entry.Summary
+			vuln.URL = entry.DatabaseSpecific.URL
+			vuln.Severity = osvSeverity(entry)
+			vuln.AffectedRanges = affectedRanges(entry, vuln.Module)
+		}
+		if vuln.Severity == "" {
+			vuln.Severity = "UNKNOWN"
+		}
+		report.Vulnerabilities = append(report.Vulnerabilities, *vuln)
+	}
+
+	// Called vulnerabilities first, then by ID
+	sort.SliceStable(report.Vulnerabilities, func(i, j int) bool {
+		a, b := report.Vulnerabilities[i], report.Vulnerabilities[j]
+		if a.Called != b.Called {
+			return a.Called
+		}
+		return a.ID < b.ID
+	})
+
+	return report, nil
+}
+
+// buildCallPath renders a govulncheck trace, which lists the vulnerable symbol
+// first, as a call chain starting from project code.
+func buildCallPath(trace []govulncheckFrame) CallPath {
+	var path CallPath
+	for i := len(trace) - 1; i >= 0; i-- {
+		frame := trace[i]
+		name := frame.Package
+		if frame.Function != "" {
+			if frame.Receiver != "" {
+				name += "." + strings.TrimPrefix(frame.Receiver, "*") + "." + frame.Function
+			} else {
+				name += "." + frame.Function
+			}
+		}
+		path.Frames = append(path.Frames, name)
+	}
+
+	entry := trace[len(trace)-1]
+	if entry.Position != nil {
+		path.File = entry.Position.Filename
+		path.Line = entry.Position.Line
+	}
+
+	return path
+}
+
+// osvSeverity returns the severity score recorded in an OSV entry, if any.
+func osvSeverity(entry *osvEntry) string {
+	for _, severity := range entry.Severity {
+		if severity.Score != "" {
+			return severity.Type + " " + severity.Score
+		}
+	}
+	return ""
+}
+
+// affectedRanges renders the introduced/fixed version ranges for a module.
+func affectedRanges(entry *osvEntry, module string) []string {
+	var ranges []string
+	for _, affected := range entry.Affected {
+		if affected.Package.Name != module {
+			continue
+		}
+		for _, r := range affected.Ranges {
+			introduced := "0"
+			for _, event := range r.Events {
+				if event.Introduced != "" {
+					introduced = event.Introduced
+				}
+				if event.Fixed != "" {
+					ranges = append(ranges, fmt.Sprintf(">=%s, <%s", introduced, event.Fixed))
+					introduced = ""
+				}
+			}
+			if introduced != "" {
+				ranges = append(ranges, ">="+introduced)
+			}
+		}
+	}
+	return ranges
+}
+
+// printSecurityReport prints a human-readable summary of the scan.
+func printSecurityReport(report *SecurityReport) {
+	fmt.Println("\nSecurity Scan Results:")
+	if len(report.Vulnerabilities) == 0 {
+		fmt.Println("- No known vulnerabilities found")
+		return
+	}
+
+	called := 0
+	for _, vuln := range report.Vulnerabilities {
+		if vuln.Called {
+			called++
+		}
+	}
+	fmt.Printf("- %d vulnerabilities found (%d reachable from your code)\n", len(report.Vulnerabilities), called)
+
+	for _, vuln := range report.Vulnerabilities {
+		ids := vuln.ID
+		if len(vuln.Aliases) > 0 {
+			ids += " (" + strings.Join(vuln.Aliases, ", ") + ")"
+		}
+		fmt.Printf("\n  %s\n", ids)
+		fmt.Printf("    Module:   %s@%s\n", vuln.Module, vuln.FoundVersion)
+		fmt.Printf("    Summary:  %s\n", vuln.Summary)
+		fmt.Printf("    Severity: %s\n", vuln.Severity)
+		if vuln.FixedVersion != "" {
+			fmt.Printf("    Fixed in: %s (run 'go get %s@%s')\n", vuln.FixedVersion, vuln.Module, vuln.FixedVersion)
+		} else {
+			fmt.Println("    Fixed in: no fix available")
+		}
+		for _, callPath := range vuln.CallPaths {
+			fmt.Printf("    Call path: %s\n", strings.Join(callPath.Frames, " -> "))
+		}
+	}
+}
+
+// writeJSON writes the report as indented JSON.
+func writeJSON(w io.Writer, report *SecurityReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(report)
+}
+
+// writeSARIF writes the report in SARIF 2.1.0 format for GitHub code scanning.
+func writeSARIF(w io.Writer, report *SecurityReport) error {
+	type sarifMessage struct {
+		Text string `json:"text"`
+	}
+	type sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+		HelpURI          string       `json:"helpUri,omitempty"`
+		Properties       struct {
+			Tags []string `json:"tags"`
+		} `json:"properties"`
+	}
+	type sarifLocation struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region struct {
+				StartLine int `json:"startLine"`
+			} `json:"region"`
+		} `json:"physicalLocation"`
+	}
+	type sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+
+	location := func(uri string, line int) sarifLocation {
+		var loc sarifLocation
+		loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(uri)
+		loc.PhysicalLocation.Region.StartLine = line
+		return loc
+	}
+
+	rules := []sarifRule{}
+	results := []sarifResult{}
+	seenRules := make(map[string]bool)
+
+	for _, vuln := range report.Vulnerabilities {
+		if !seenRules[vuln.ID] {
+			seenRules[vuln.ID] = true
+			rule := sarifRule{ID: vuln.ID, ShortDescription: sarifMessage{vuln.Summary}, HelpURI: vuln.URL}
+			rule.Properties.Tags = append([]string{"security", "vulnerability"}, vuln.Aliases...)
+			rules = append(rules, rule)
+		}
+
+		message := fmt.Sprintf("%s@%s is affected by %s: %s.", vuln.Module, vuln.FoundVersion, vuln.ID, strings.TrimSuffix(vuln.Summary, "."))
+		if vuln.FixedVersion != "" {
+			message += fmt.Sprintf(" Fixed in %s.", vuln.FixedVersion)
+		}
+
+		result := sarifResult{RuleID: vuln.ID, Level: "warning", Message: sarifMessage{message}}
+		if vuln.Called {
+			result.Level = "error"
+			for _, callPath := range vuln.CallPaths {
+				if callPath.File != "" {
+					result.Locations = append(result.Locations, location(relativeTo(report.Project, callPath.File), callPath.Line))
+				}
+			}
+		}
+		if len(result.Locations) == 0 {
+			result.Locations = append(result.Locations, location("go.mod", 1))
+		}
+		results = append(results, result)
+	}
+
+	sarif := map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{
+			map[string]interface{}{
+				"tool": map[string]interface{}{
+					"driver": map[string]interface{}{
+						"name":           "goforge",
+						"informationUri": "https://github.com/z0roday/goforge",
+						"rules":          rules,
+					},
+				},
+				"results": results,
+			},
+		},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarif)
+}
+
+// relativeTo returns file relative to base when possible.
+func relativeTo(base string, file string) string {
+	if rel, err := filepath.Rel(base, file); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return file
+}
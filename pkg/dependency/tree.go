@@ -0,0 +1,162 @@
+package dependency
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+)
+
+// TreeNode is a module in the dependency tree, with the modules it requires.
+type TreeNode struct {
+	Path string
+	// Version is empty for the main module.
+	Version  string
+	Children []*TreeNode
+	// Duplicate is set when the module's dependencies are shown under an
+	// earlier occurrence of it, and Truncated when they are left out
+	// because the tree reached the depth limit.
+	Duplicate bool
+	Truncated bool
+}
+
+// String formats the node like 'go mod graph', as path@version.
+func (n *TreeNode) String() string {
+	if n.Version == "" {
+		return n.Path
+	}
+	return n.Path + "@" + n.Version
+}
+
+// BuildTree returns the dependency tree of the module at path, built from
+// 'go mod graph'. The tree shows depth levels below the main module, or
+// all of them when depth is 0. A module reached again after its
+// dependencies were shown is marked Duplicate instead of repeating them,
+// which also ends cycles.
+func BuildTree(path string, depth int) (*TreeNode, error) {
+	if depth < 0 {
+		return nil, fmt.Errorf("invalid depth %d (expected 0 or more)", depth)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	root, err := module.FindRoot(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := runGo(root, DefaultRetries, "mod", "graph")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the module graph: %w", err)
+	}
+
+	main, edges := parseModGraph(string(output))
+	if main == "" {
+		return nil, fmt.Errorf("go mod graph printed no modules for %s", root)
+	}
+
+	expanded := make(map[string]bool)
+	var build func(node string, level int) *TreeNode
+	build = func(node string, level int) *TreeNode {
+		tree := newTreeNode(node)
+		switch {
+		case len(edges[node]) == 0:
+		case expanded[node]:
+			tree.Duplicate = true
+		case depth > 0 && level >= depth:
+			tree.Truncated = true
+		default:
+			expanded[node] = true
+			for _, child := range edges[node] {
+				tree.Children = append(tree.Children, build(child, level+1))
+			}
+		}
+		return tree
+	}
+	return build(main, 0), nil
+}
+
+// parseModGraph returns the main module and the requirements of each
+// module in 'go mod graph' output, in the order they are listed. The go
+// and toolchain pseudo-modules are left out, as are lines that are not
+// edges, such as download progress.
+func parseModGraph(output string) (string, map[string][]string) {
+	main := ""
+	edges := make(map[string][]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || isToolchainModule(fields[1]) {
+			continue
+		}
+		if main == "" {
+			main = fields[0]
+		}
+		edges[fields[0]] = append(edges[fields[0]], fields[1])
+	}
+	return main, edges
+}
+
+// isToolchainModule reports whether node is the go or toolchain version
+// go mod graph lists among the requirements.
+func isToolchainModule(node string) bool {
+	return strings.HasPrefix(node, "go@") || strings.HasPrefix(node, "toolchain@")
+}
+
+// newTreeNode returns the node of a 'go mod graph' module, path@version.
+func newTreeNode(node string) *TreeNode {
+	path, version, _ := strings.Cut(node, "@")
+	return &TreeNode{Path: path, Version: version}
+}
+
+// PrintTree writes the tree indented, one module per line. Duplicates are
+// marked (*) and modules cut off by the depth limit (...).
+func PrintTree(w io.Writer, tree *TreeNode) {
+	fmt.Fprintln(w, tree)
+	printChildren(w, tree, "")
+
+	duplicates, truncated := treeMarkers(tree)
+	if duplicates || truncated {
+		logging.Infoln()
+	}
+	if duplicates {
+		logging.Infoln("(*) dependencies shown above")
+	}
+	if truncated {
+		logging.Infoln("(...) dependencies below the depth limit; raise --depth to show them")
+	}
+}
+
+// printChildren writes the children of tree, each line starting with prefix.
+func printChildren(w io.Writer, tree *TreeNode, prefix string) {
+	for i, child := range tree.Children {
+		branch, indent := "├── ", "│   "
+		if i == len(tree.Children)-1 {
+			branch, indent = "└── ", "    "
+		}
+		line := prefix + branch + child.String()
+		switch {
+		case child.Duplicate:
+			line += " (*)"
+		case child.Truncated:
+			line += " (...)"
+		}
+		fmt.Fprintln(w, line)
+		printChildren(w, child, prefix+indent)
+	}
+}
+
+// treeMarkers reports whether tree has duplicate and truncated nodes.
+func treeMarkers(tree *TreeNode) (duplicates, truncated bool) {
+	duplicates, truncated = tree.Duplicate, tree.Truncated
+	for _, child := range tree.Children {
+		d, t := treeMarkers(child)
+		duplicates, truncated = duplicates || d, truncated || t
+	}
+	return duplicates, truncated
+}
@@ -0,0 +1,181 @@
+package docs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+	"goforge/pkg/safewrite"
+)
+
+// HelpMarkdownFlag is the hidden flag that makes a urfave/cli app print its
+// own Markdown command reference.
+const HelpMarkdownFlag = "help-markdown"
+
+// maxCommandDepth bounds how deep the --help crawl follows subcommands.
+const maxCommandDepth = 5
+
+// GenerateCLIDoc writes a Markdown reference of a CLI app's commands, flags,
+// and usage. appBinary is an executable, or a main package directory that is
+// built first. Apps that support --help-markdown describe themselves; any
+// other urfave/cli app is documented by crawling its --help output. An
+// existing reference is treated according to write.
+func GenerateCLIDoc(appBinary string, outputFile string, write safewrite.Options) error {
+	logging.Infoln("Generating CLI reference for:", appBinary)
+
+	absOutput, err := filepath.Abs(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for output: %w", err)
+	}
+	if err := write.Check(absOutput); err != nil {
+		return err
+	}
+
+	binary, cleanup, err := cliBinary(appBinary)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	markdown, err := proc.Command(binary, "--"+HelpMarkdownFlag).Output()
+	if err != nil || !strings.HasPrefix(string(markdown), "#") {
+		logging.Infoln("The app does not support --" + HelpMarkdownFlag + "; crawling its --help output")
+		markdown, err = crawlHelp(binary)
+		if err != nil {
+			return err
+		}
+	}
+
+	written, err := write.Write(safewrite.File{Path: absOutput, Data: markdown})
+	if err != nil || !written {
+		return err
+	}
+
+	fmt.Printf("CLI reference generated at: %s\n", absOutput)
+	return nil
+}
+
+// cliBinary returns the executable to document, building it when appBinary
+// is a package directory. The cleanup function removes a temporary build.
+func cliBinary(appBinary string) (string, func(), error) {
+	info, err := os.Stat(appBinary)
+	if err != nil {
+		return "", nil, fmt.Errorf("app not found: %w", err)
+	}
+	if !info.IsDir() {
+		absBinary, err := filepath.Abs(appBinary)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		return absBinary, func() {}, nil
+	}
+
+	tempDir, err := os.MkdirTemp("", "goforge-cli-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tempDir) }
+
+	binary := filepath.Join(tempDir, "app")
+	cmd := proc.Command("go", "build", "-o", binary, ".")
+	cmd.Dir = appBinary
+	if output, err := cmd.CombinedOutput(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to build app: %w\nOutput: %s", err, output)
+	}
+
+	return binary, cleanup, nil
+}
+
+// crawlHelp documents an app by running --help on it and, recursively, on
+// every command listed in its COMMANDS section.
+func crawlHelp(binary string) ([]byte, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s Command Reference\n", filepath.Base(binary))
+
+	var visit func(path []string) error
+	visit = func(path []string) error {
+		args := append(append([]string{}, path...), "--help")
+		output, err := proc.Command(binary, args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to run %s: %w\nOutput: %s", strings.Join(append([]string{binary}, args...), " "), err, output)
+		}
+
+		if len(path) > 0 {
+			// Markdown has six heading levels
+			level := len(path) + 1
+			if level > 6 {
+				level = 6
+			}
+			fmt.Fprintf(&b, "\n%s `%s`\n", strings.Repeat("#", level), strings.Join(path, " "))
+		}
+		fmt.Fprintf(&b, "\n```\n%s\n```\n", strings.TrimSpace(string(output)))
+
+		if len(path) >= maxCommandDepth {
+			return nil
+		}
+		for _, name := range helpCommands(string(output)) {
+			if err := visit(append(path, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := visit(nil); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// helpCommands returns the command names listed in the COMMANDS section of
+// urfave/cli help output, without aliases or the built-in help command.
+func helpCommands(help string) []string {
+	var names []string
+	for _, command := range helpEntries(help) {
+		names = append(names, command.Name)
+	}
+	return names
+}
+
+// helpCommand is a command listed in urfave/cli help output.
+type helpCommand struct {
+	Name  string
+	Usage string
+}
+
+// helpEntries returns the commands listed in the COMMANDS section of
+// urfave/cli help output with their usage text, without the built-in help
+// command.
+func helpEntries(help string) []helpCommand {
+	var commands []helpCommand
+	inCommands := false
+
+	scanner := bufio.NewScanner(strings.NewReader(help))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if !strings.HasPrefix(line, " ") {
+			inCommands = trimmed == "COMMANDS:"
+			continue
+		}
+		// Category headings end with a colon
+		if !inCommands || trimmed == "" || strings.HasSuffix(trimmed, ":") {
+			continue
+		}
+
+		// "   name, alias  Usage text"
+		names, usage, _ := strings.Cut(trimmed, "  ")
+		name, _, _ := strings.Cut(strings.Fields(names)[0], ",")
+		if name != "help" {
+			commands = append(commands, helpCommand{Name: name, Usage: strings.TrimSpace(usage)})
+		}
+	}
+
+	return commands
+}
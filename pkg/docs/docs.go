@@ -1,11 +1,20 @@
+// Package docs generates documentation for a Go project: API documentation
+// of its packages, a user guide, a README, the HTTP routes it serves, and
+// the reference of a CLI built with it.
 package docs
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"text/template"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/proc"
+	"goforge/pkg/safewrite"
 )
 
 // UserDocTemplate is a template for generating basic user documentation.
@@ -80,9 +89,10 @@ type UserDocData struct {
 	AppName string
 }
 
-// GenerateAPIDoc generates API documentation for a Go project.
-func GenerateAPIDoc(path string, outputDir string, format string) error {
-	fmt.Printf("Generating API documentation for %s in %s format\n", path, format)
+// GenerateAPIDoc generates API documentation for a Go project. Existing
+// documentation files are treated according to write.
+func GenerateAPIDoc(path string, outputDir string, format string, write safewrite.Options) error {
+	logging.Infof("Generating API documentation for %s in %s format\n", path, format)
 
 	// Get absolute paths
 	absPath, err := filepath.Abs(path)
@@ -90,15 +100,35 @@ func GenerateAPIDoc(path string, outputDir string, format string) error {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	absOutput, err := filepath.Abs(outputDir)
+	absOutput, err := module.ResolveOutput(absPath, outputDir)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for output: %w", err)
+		return err
+	}
+
+	// Both formats run 'go doc', which needs a module
+	if _, err := module.FindRoot(absPath); err != nil {
+		return err
 	}
 
-	// Create output directory if it doesn't exist
-	err = os.MkdirAll(absOutput, 0755)
+	// The HTTP routes get a page of their own next to the package docs
+	routes, err := FindRoutes(absPath)
 	if err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+		return err
+	}
+	var routesFile []safewrite.File
+	if len(routes) > 0 && (format == "html" || format == "markdown") {
+		routesPath := filepath.Join(absOutput, "routes.md")
+		if format == "html" {
+			routesPath = filepath.Join(absOutput, "routes.html")
+		}
+		if err := write.Check(routesPath); err != nil {
+			return err
+		}
+		page, err := renderRoutes(routes, format)
+		if err != nil {
+			return err
+		}
+		routesFile = append(routesFile, safewrite.File{Path: routesPath, Data: page})
 	}
 
 	// For HTML format, use go doc -html
@@ -118,20 +148,22 @@ func GenerateAPIDoc(path string, outputDir string, format string) error {
 
 		// Create index.html
 		indexPath := filepath.Join(absOutput, "index.html")
-		cmd := exec.Command("go", "doc", "-html", "./...")
-		indexFile, err := os.Create(indexPath)
-		if err != nil {
-			return fmt.Errorf("failed to create index.html: %w", err)
+		if err := write.Check(indexPath); err != nil {
+			return err
 		}
-		defer indexFile.Close()
-
-		cmd.Stdout = indexFile
-		err = cmd.Run()
+		html, err := proc.Command("go", "doc", "-html", "./...").Output()
 		if err != nil {
 			return fmt.Errorf("failed to generate HTML documentation: %w", err)
 		}
 
+		written, err := write.Write(append([]safewrite.File{{Path: indexPath, Data: html}}, routesFile...)...)
+		if err != nil || !written {
+			return err
+		}
 		fmt.Printf("API documentation generated at: %s\n", indexPath)
+		if len(routesFile) > 0 {
+			fmt.Printf("HTTP routes (%d) documented at: %s\n", len(routes), routesFile[0].Path)
+		}
 	} else if format == "markdown" {
 		// For markdown format, use go doc
 		packages, err := filepath.Glob(filepath.Join(absPath, "pkg", "*"))
@@ -141,37 +173,40 @@ func GenerateAPIDoc(path string, outputDir string, format string) error {
 
 		// Create index file
 		indexPath := filepath.Join(absOutput, "README.md")
-		indexFile, err := os.Create(indexPath)
-		if err != nil {
-			return fmt.Errorf("failed to create README.md: %w", err)
-		}
-		defer indexFile.Close()
-
-		fmt.Fprintln(indexFile, "# API Documentation\n")
-		fmt.Fprintln(indexFile, "## Packages\n")
+		var index bytes.Buffer
+		fmt.Fprint(&index, "# API Documentation\n\n")
+		fmt.Fprint(&index, "## Packages\n\n")
 
 		// Document each package
+		var files []safewrite.File
 		for _, pkg := range packages {
 			pkgName := filepath.Base(pkg)
-			fmt.Fprintf(indexFile, "- [%s](%s.md)\n", pkgName, pkgName)
+			fmt.Fprintf(&index, "- [%s](%s.md)\n", pkgName, pkgName)
 
 			// Generate documentation for the package
 			pkgDocPath := filepath.Join(absOutput, pkgName+".md")
-			pkgDocFile, err := os.Create(pkgDocPath)
-			if err != nil {
-				return fmt.Errorf("failed to create package documentation file: %w", err)
+			if err := write.Check(pkgDocPath); err != nil {
+				return err
 			}
 
 			pkgImportPath := fmt.Sprintf("./pkg/%s", pkgName)
-			cmd := exec.Command("go", "doc", "-all", pkgImportPath)
-			cmd.Stdout = pkgDocFile
-			err = cmd.Run()
-			pkgDocFile.Close()
+			doc, err := proc.Command("go", "doc", "-all", pkgImportPath).Output()
 			if err != nil {
 				return fmt.Errorf("failed to generate documentation for package %s: %w", pkgName, err)
 			}
+			files = append(files, safewrite.File{Path: pkgDocPath, Data: doc})
 		}
 
+		if len(routesFile) > 0 {
+			fmt.Fprint(&index, "\n## HTTP Routes\n\n")
+			fmt.Fprintf(&index, "- [%d routes](routes.md)\n", len(routes))
+			files = append(files, routesFile...)
+		}
+
+		written, err := write.Write(append([]safewrite.File{{Path: indexPath, Data: index.Bytes()}}, files...)...)
+		if err != nil || !written {
+			return err
+		}
 		fmt.Printf("API documentation generated at: %s\n", absOutput)
 	} else {
 		return fmt.Errorf("unsupported format: %s (supported: html, markdown)", format)
@@ -180,9 +215,10 @@ func GenerateAPIDoc(path string, outputDir string, format string) error {
 	return nil
 }
 
-// GenerateUserDoc generates user documentation for a Go project.
-func GenerateUserDoc(path string, outputDir string, format string) error {
-	fmt.Printf("Generating user documentation for %s in %s format\n", path, format)
+// GenerateUserDoc generates user documentation for a Go project. Existing
+// documentation files are treated according to write.
+func GenerateUserDoc(path string, outputDir string, format string, write safewrite.Options) error {
+	logging.Infof("Generating user documentation for %s in %s format\n", path, format)
 
 	// Get absolute paths
 	absPath, err := filepath.Abs(path)
@@ -190,15 +226,9 @@ func GenerateUserDoc(path string, outputDir string, format string) error {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	absOutput, err := filepath.Abs(outputDir)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path for output: %w", err)
-	}
-
-	// Create output directory if it doesn't exist
-	err = os.MkdirAll(absOutput, 0755)
+	absOutput, err := module.ResolveOutput(absPath, outputDir)
 	if err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+		return err
 	}
 
 	// Determine app name from directory
@@ -217,18 +247,26 @@ func GenerateUserDoc(path string, outputDir string, format string) error {
 
 	// Create markdown file
 	mdPath := filepath.Join(absOutput, "user-guide.md")
-	mdFile, err := os.Create(mdPath)
-	if err != nil {
-		return fmt.Errorf("failed to create user guide file: %w", err)
+	htmlPath := filepath.Join(absOutput, "user-guide.html")
+	if format == "html" {
+		// pandoc writes the HTML itself, so check it up front
+		if err := write.Check(htmlPath); err != nil {
+			return err
+		}
 	}
-	defer mdFile.Close()
 
 	// Execute the template
-	err = tmpl.Execute(mdFile, data)
+	var markdown bytes.Buffer
+	err = tmpl.Execute(&markdown, data)
 	if err != nil {
 		return fmt.Errorf("failed to execute user doc template: %w", err)
 	}
 
+	written, err := write.Write(safewrite.File{Path: mdPath, Data: markdown.Bytes()})
+	if err != nil || !written {
+		return err
+	}
+
 	fmt.Printf("User documentation markdown generated at: %s\n", mdPath)
 
 	// If HTML format is requested, convert markdown to HTML
@@ -236,13 +274,12 @@ func GenerateUserDoc(path string, outputDir string, format string) error {
 		// Check if pandoc is available (simplistic check)
 		_, err := exec.LookPath("pandoc")
 		if err != nil {
-			fmt.Println("WARNING: pandoc not found, cannot convert to HTML. Using markdown instead.")
+			fmt.Fprintln(os.Stderr, "WARNING: pandoc not found, cannot convert to HTML. Using markdown instead.")
 			return nil
 		}
 
 		// Convert markdown to HTML using pandoc
-		htmlPath := filepath.Join(absOutput, "user-guide.html")
-		cmd := exec.Command("pandoc", "-s", mdPath, "-o", htmlPath)
+		cmd := proc.Command("pandoc", "-s", mdPath, "-o", htmlPath)
 		err = cmd.Run()
 		if err != nil {
 			return fmt.Errorf("failed to convert markdown to HTML: %w", err)
@@ -0,0 +1,316 @@
+package docs
+
+import (
+	"bytes"
+	"fmt"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"goforge/pkg/container"
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/proc"
+	"goforge/pkg/safewrite"
+
+	"golang.org/x/mod/semver"
+)
+
+// ReadmeTemplate is the template for a project README.
+const ReadmeTemplate = `# {{.Name}}
+
+TODO: Describe what {{.Name}} does and who it is for.
+{{- if .GoVersion}}
+
+## Requirements
+
+- Go {{.GoVersion}} or later
+{{- end}}
+
+## Installation
+{{if .Binaries}}
+` + "```bash" + `
+{{- range .Binaries}}
+go install {{.Install}}@latest
+{{- end}}
+` + "```" + `
+{{- else}}
+` + "```bash" + `
+go get {{.Module}}
+` + "```" + `
+{{- end}}
+{{- if .Commands}}
+
+## Usage
+
+` + "```bash" + `
+{{(index .Binaries 0).Name}} [global options] command [command options]
+` + "```" + `
+
+| Command | Description |
+|---------|-------------|
+{{- range .Commands}}
+| ` + "`{{.Name}}`" + ` | {{cell .Usage}} |
+{{- end}}
+
+Run ` + "`{{(index .Binaries 0).Name}} help <command>`" + ` for the options of a command.
+{{- end}}
+{{- if .Packages}}
+
+## Packages
+
+| Package | Description |
+|---------|-------------|
+{{- range .Packages}}
+| [` + "`{{.Path}}`" + `]({{.Dir}}) | {{cell .Synopsis}} |
+{{- end}}
+{{- end}}
+
+## Building
+
+` + "```bash" + `
+{{- if .Binaries}}
+{{- range .Binaries}}
+go build -o bin/{{.Name}} {{.Package}}
+{{- end}}
+{{- else}}
+go build ./...
+{{- end}}
+` + "```" + `
+
+## Testing
+
+` + "```bash" + `
+go test ./...
+` + "```" + `
+{{- if .License}}
+
+## License
+
+See [{{.License}}]({{.License}}).
+{{- end}}
+`
+
+// ReadmeData holds data for the README template.
+type ReadmeData struct {
+	// Name is the last element of the module path.
+	Name      string
+	Module    string
+	GoVersion string
+	// Binaries are the main packages of the module.
+	Binaries []ReadmeBinary
+	// Commands are the commands of the only binary, when it is a
+	// urfave/cli app.
+	Commands []helpCommand
+	// Packages are the importable library packages.
+	Packages []ReadmePackage
+	// License is the name of the license file, if the module has one.
+	License string
+}
+
+// ReadmeBinary is a main package of the module.
+type ReadmeBinary struct {
+	Name string
+	// Package is the package directory, e.g. "./cmd/server".
+	Package string
+	// Install is the import path passed to go install.
+	Install string
+}
+
+// ReadmePackage is a library package of the module.
+type ReadmePackage struct {
+	Path string
+	// Dir is the package directory relative to the module root.
+	Dir      string
+	Synopsis string
+}
+
+// licenseFiles are the names checked for a license, in order.
+var licenseFiles = []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "COPYING"}
+
+// GenerateReadme writes a starter README for the module containing path: its
+// Go version, how to install, build, and test it, the commands of its CLI when
+// it is a urfave/cli app, and its library packages with their synopses. The
+// README is written to outputFile, or README.md in the module root when it is
+// empty. An existing README is treated according to write.
+func GenerateReadme(path string, outputFile string, write safewrite.Options) error {
+	logging.Infoln("Generating README for:", path)
+
+	root, err := module.FindRoot(path)
+	if err != nil {
+		return err
+	}
+	if outputFile == "" {
+		outputFile = filepath.Join(root, "README.md")
+	}
+	absOutput, err := module.ResolveOutput(root, outputFile)
+	if err != nil {
+		return err
+	}
+	if err := write.Check(absOutput); err != nil {
+		return err
+	}
+
+	modulePath, err := module.Path(root)
+	if err != nil {
+		return err
+	}
+	goVersion, _, err := module.GoVersion(root)
+	if err != nil {
+		return err
+	}
+	data := ReadmeData{Name: moduleName(modulePath), Module: modulePath, GoVersion: goVersion}
+
+	mains, err := container.FindMainPackages(root)
+	if err != nil {
+		return err
+	}
+	for _, main := range mains {
+		binary := ReadmeBinary{Name: data.Name, Package: main, Install: modulePath}
+		if main != "." {
+			binary.Name = filepath.Base(main)
+			binary.Install = modulePath + strings.TrimPrefix(main, ".")
+		}
+		data.Binaries = append(data.Binaries, binary)
+	}
+	if len(mains) == 1 {
+		if data.Commands, err = cliCommands(root, mains[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: failed to list the commands of %s: %v\n", mains[0], err)
+		}
+	}
+
+	if data.Packages, err = libraryPackages(root, modulePath); err != nil {
+		return err
+	}
+	for _, name := range licenseFiles {
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			data.License = name
+			break
+		}
+	}
+
+	// Pipes would end a table cell early
+	cell := func(text string) string { return strings.ReplaceAll(text, "|", `\|`) }
+	tmpl, err := template.New("readme").Funcs(template.FuncMap{"cell": cell}).Parse(ReadmeTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse README template: %w", err)
+	}
+	var readme bytes.Buffer
+	if err := tmpl.Execute(&readme, data); err != nil {
+		return fmt.Errorf("failed to execute README template: %w", err)
+	}
+
+	written, err := write.Write(safewrite.File{Path: absOutput, Data: readme.Bytes()})
+	if err != nil || !written {
+		return err
+	}
+
+	fmt.Printf("README generated at: %s\n", absOutput)
+	return nil
+}
+
+// moduleName returns the last element of a module path before any major
+// version suffix.
+func moduleName(modulePath string) string {
+	elements := strings.Split(modulePath, "/")
+	name := elements[len(elements)-1]
+	if len(elements) > 1 && semver.IsValid(name) && semver.Canonical(name) == name+".0.0" {
+		name = elements[len(elements)-2]
+	}
+	return name
+}
+
+// cliCommands returns the top-level commands of the main package pkg under
+// root, or none when the module does not use urfave/cli. The package is
+// built to read its --help output.
+func cliCommands(root string, pkg string) ([]helpCommand, error) {
+	requires, err := module.DirectRequires(root)
+	if err != nil {
+		return nil, err
+	}
+	usesCLI := false
+	for require := range requires {
+		usesCLI = usesCLI || strings.HasPrefix(require, "github.com/urfave/cli")
+	}
+	if !usesCLI {
+		return nil, nil
+	}
+
+	logging.Infof("Building %s to list its commands...\n", pkg)
+	binary, cleanup, err := cliBinary(filepath.Join(root, filepath.FromSlash(pkg)))
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	output, err := proc.Command(binary, "--help").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run --help: %w", err)
+	}
+	return helpEntries(string(output)), nil
+}
+
+// libraryPackages returns the packages under root that other modules can
+// import, that is all but main, internal, and test-only packages, sorted
+// by path.
+func libraryPackages(root string, modulePath string) ([]ReadmePackage, error) {
+	byDir := make(map[string]*ReadmePackage)
+	err := filepath.WalkDir(root, func(file string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			if file != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") ||
+				name == "vendor" || name == "testdata" || name == "internal") {
+				return filepath.SkipDir
+			}
+			if file != root {
+				if _, err := os.Stat(filepath.Join(file, "go.mod")); err == nil {
+					// A nested module documents itself
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+
+		syntax, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil || syntax.Name.Name == "main" {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+		pkg := byDir[rel]
+		if pkg == nil {
+			pkg = &ReadmePackage{Path: modulePath, Dir: filepath.ToSlash(rel)}
+			if rel != "." {
+				pkg.Path = modulePath + "/" + filepath.ToSlash(rel)
+			}
+			byDir[rel] = pkg
+		}
+		if pkg.Synopsis == "" && syntax.Doc != nil {
+			pkg.Synopsis = new(doc.Package).Synopsis(syntax.Doc.Text())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan packages: %w", err)
+	}
+
+	packages := make([]ReadmePackage, 0, len(byDir))
+	for _, pkg := range byDir {
+		packages = append(packages, *pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Path < packages[j].Path })
+	return packages, nil
+}
@@ -0,0 +1,760 @@
+package docs
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	htmltemplate "html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// RoutesMarkdownTemplate is the template for the HTTP routes page of the
+// markdown API documentation.
+const RoutesMarkdownTemplate = `# HTTP Routes
+
+Methods, status codes, and content types are inferred from the handler source: Go 1.22 method patterns, router methods such as ` + "`r.Post`" + `, and ` + "`r.Method`" + ` checks; ` + "`WriteHeader`" + `, ` + "`http.Error`" + `, and ` + "`http.Redirect`" + ` calls; and ` + "`Content-Type`" + ` headers set on the response or compared on the request. 200 is listed when a handler writes no success status itself, as net/http then sends it. A ? marks a handler whose source was not found.
+
+| Method | Route | Handler | Status Codes | Request Content Types | Response Content Types |
+|--------|-------|---------|--------------|-----------------------|------------------------|
+{{- range .}}
+| {{methods .}} | ` + "`{{.Pattern}}`" + ` | ` + "`{{.Handler}}`" + ` ({{.File}}:{{.Line}}) | {{codes .}} | {{join .RequestTypes}} | {{join .ResponseTypes}} |
+{{- end}}
+`
+
+// RoutesHTMLTemplate is the template for the HTTP routes page of the HTML
+// API documentation.
+const RoutesHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>HTTP Routes</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+</style>
+</head>
+<body>
+<h1>HTTP Routes</h1>
+<p>Methods, status codes, and content types are inferred from the handler source. 200 is listed when a handler writes no success status itself, as net/http then sends it. A ? marks a handler whose source was not found.</p>
+<table>
+<tr><th>Method</th><th>Route</th><th>Handler</th><th>Status Codes</th><th>Request Content Types</th><th>Response Content Types</th></tr>
+{{- range .}}
+<tr><td>{{methods .}}</td><td><code>{{.Pattern}}</code></td><td><code>{{.Handler}}</code> ({{.File}}:{{.Line}})</td><td>{{codes .}}</td><td>{{join .RequestTypes}}</td><td>{{join .ResponseTypes}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`
+
+// Route is an HTTP route registered in the source, with what its handler
+// is seen to do.
+type Route struct {
+	// Methods are the methods the route serves, from a Go 1.22 pattern, a
+	// router method such as r.Post, or r.Method checks in the handler; none
+	// means any.
+	Methods []string
+	Pattern string
+	// Handler is the handler expression as written at the registration.
+	Handler string
+	// File is the file of the registration, relative to the scanned
+	// directory, and Line its line.
+	File string
+	Line int
+	// Resolved reports whether the handler's source was found; the fields
+	// below are empty when it was not.
+	Resolved bool
+	// StatusCodes are the codes the handler writes, sorted. 200 is included
+	// when it writes no success code itself, as net/http then sends it.
+	StatusCodes []int
+	// RequestTypes are the content types the handler compares the request's
+	// Content-Type with, and ResponseTypes those it sets on the response.
+	RequestTypes  []string
+	ResponseTypes []string
+}
+
+// httpMethods are the methods routes are documented with.
+var httpMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true,
+	http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true,
+	http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// statusCodes maps the names of the net/http status constants to their
+// codes. The names follow the status text, but for a few abbreviations.
+var statusCodes = func() map[string]int {
+	codes := map[string]int{
+		"StatusNonAuthoritativeInfo": http.StatusNonAuthoritativeInfo,
+		"StatusProxyAuthRequired":    http.StatusProxyAuthRequired,
+		"StatusTeapot":               http.StatusTeapot,
+	}
+	for code := 100; code < 600; code++ {
+		if text := http.StatusText(code); text != "" {
+			codes["Status"+strings.Map(func(r rune) rune {
+				if unicode.IsLetter(r) || unicode.IsDigit(r) {
+					return r
+				}
+				return -1
+			}, text)] = code
+		}
+	}
+	return codes
+}()
+
+// maxHandlerDepth bounds how deep calls from a handler into the functions
+// of its package are followed, e.g. to a writeJSON helper.
+const maxHandlerDepth = 3
+
+// sourcePackage indexes the declarations of a package directory that
+// handlers are resolved against.
+type sourcePackage struct {
+	funcs map[string]*ast.FuncDecl
+	// methods are keyed by method name, for handlers such as s.handleUsers
+	methods map[string][]*ast.FuncDecl
+	consts  map[string]ast.Expr
+}
+
+// sourceFile is a parsed file with the package it belongs to.
+type sourceFile struct {
+	rel    string
+	syntax *ast.File
+	pkg    *sourcePackage
+}
+
+// FindRoutes returns the HTTP routes registered with HandleFunc, Handle,
+// or router methods such as Get and Post in the non-test Go files under
+// path, sorted by pattern. Only patterns given as string constants are
+// found, and a handler is followed when it is a function literal, a
+// function or method of the same package, a call wrapping one, or a type
+// of the package with a ServeHTTP method.
+func FindRoutes(path string) ([]Route, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	fset := token.NewFileSet()
+	packages := make(map[string]*sourcePackage)
+	var files []sourceFile
+	err = filepath.WalkDir(absPath, func(file string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			if file != absPath && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		syntax, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			// Unparseable files cannot contribute routes
+			return nil
+		}
+		rel, err := filepath.Rel(absPath, file)
+		if err != nil {
+			return err
+		}
+
+		dir := filepath.Dir(file)
+		pkg := packages[dir]
+		if pkg == nil {
+			pkg = &sourcePackage{funcs: map[string]*ast.FuncDecl{}, methods: map[string][]*ast.FuncDecl{}, consts: map[string]ast.Expr{}}
+			packages[dir] = pkg
+		}
+		pkg.add(syntax)
+		files = append(files, sourceFile{rel: filepath.ToSlash(rel), syntax: syntax, pkg: pkg})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan source for routes: %w", err)
+	}
+
+	routes := []Route{}
+	for _, file := range files {
+		imports := importNames(file.syntax)
+		ast.Inspect(file.syntax, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if route, ok := registeredRoute(call, file.pkg, imports); ok {
+				route.File, route.Line = file.rel, fset.Position(call.Pos()).Line
+				routes = append(routes, route)
+			}
+			return true
+		})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		if a.Pattern != b.Pattern {
+			return a.Pattern < b.Pattern
+		}
+		if ma, mb := strings.Join(a.Methods, ","), strings.Join(b.Methods, ","); ma != mb {
+			return ma < mb
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return routes, nil
+}
+
+// add indexes the functions, methods, and constants of a file.
+func (p *sourcePackage) add(file *ast.File) {
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Body == nil {
+				continue
+			}
+			if decl.Recv == nil {
+				p.funcs[decl.Name.Name] = decl
+			} else {
+				p.methods[decl.Name.Name] = append(p.methods[decl.Name.Name], decl)
+			}
+		case *ast.GenDecl:
+			if decl.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				value := spec.(*ast.ValueSpec)
+				for i, name := range value.Names {
+					if i < len(value.Values) {
+						p.consts[name.Name] = value.Values[i]
+					}
+				}
+			}
+		}
+	}
+}
+
+// importNames returns the names a file refers to its imports by.
+func importNames(file *ast.File) map[string]bool {
+	names := make(map[string]bool)
+	for _, spec := range file.Imports {
+		if spec.Name != nil {
+			names[spec.Name.Name] = true
+			continue
+		}
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		names[importPath[strings.LastIndex(importPath, "/")+1:]] = true
+	}
+	return names
+}
+
+// registeredRoute returns the route a call registers, if it is a
+// HandleFunc, Handle, or router method call with a constant pattern.
+func registeredRoute(call *ast.CallExpr, pkg *sourcePackage, imports map[string]bool) (Route, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || len(call.Args) < 2 {
+		return Route{}, false
+	}
+	method := ""
+	switch name := sel.Sel.Name; {
+	case name == "HandleFunc" || name == "Handle":
+	case httpMethods[strings.ToUpper(name)] && (name == strings.ToUpper(name) || name == upperFirst(strings.ToLower(name))):
+		method = strings.ToUpper(name)
+	default:
+		return Route{}, false
+	}
+
+	scan := &handlerScan{pkg: pkg}
+	pattern, ok := scan.text(call.Args[0], nil)
+	if !ok {
+		return Route{}, false
+	}
+	// Go 1.22 patterns may start with a method: "POST /users"
+	if prefix, rest, found := strings.Cut(pattern, " "); found && httpMethods[prefix] {
+		method, pattern = prefix, strings.TrimSpace(rest)
+	}
+	if !strings.Contains(pattern, "/") {
+		return Route{}, false
+	}
+
+	route := Route{Pattern: pattern}
+	// Middleware may follow or precede the handler, so take the last
+	// argument that resolves
+	handlerArg := call.Args[len(call.Args)-1]
+	for i := len(call.Args) - 1; i >= 1; i-- {
+		if fn := scan.resolve(call.Args[i], imports, 0); fn != nil {
+			handlerArg = call.Args[i]
+			route.Resolved = true
+			scan.scan(fn, nil, 0)
+			break
+		}
+	}
+	route.Handler = handlerName(handlerArg)
+
+	if method != "" {
+		route.Methods = []string{method}
+	} else {
+		route.Methods = sortedKeys(scan.methods)
+	}
+	if route.Resolved {
+		success := false
+		for code := range scan.codes {
+			success = success || (code >= 200 && code < 400)
+		}
+		if !success {
+			scan.codes = addCode(scan.codes, http.StatusOK)
+		}
+		for code := range scan.codes {
+			route.StatusCodes = append(route.StatusCodes, code)
+		}
+		sort.Ints(route.StatusCodes)
+		route.RequestTypes = sortedKeys(scan.requestTypes)
+		route.ResponseTypes = sortedKeys(scan.responseTypes)
+	}
+	return route, true
+}
+
+// handlerFunc is the source of a handler: a function declaration or
+// literal.
+type handlerFunc struct {
+	body *ast.BlockStmt
+	// decl is nil for a function literal.
+	decl *ast.FuncDecl
+}
+
+// handlerValue is the constant value of an argument passed to a function a
+// handler calls.
+type handlerValue struct {
+	code   int
+	hasInt bool
+	text   string
+	isText bool
+}
+
+// handlerScan collects what a handler and the functions it calls do.
+type handlerScan struct {
+	pkg           *sourcePackage
+	methods       map[string]bool
+	codes         map[int]bool
+	requestTypes  map[string]bool
+	responseTypes map[string]bool
+	// active holds the declarations being scanned, against recursion
+	active map[*ast.FuncDecl]bool
+}
+
+// resolve returns the source of the handler expr refers to, or nil when it
+// is not in the package.
+func (s *handlerScan) resolve(expr ast.Expr, imports map[string]bool, depth int) *handlerFunc {
+	if depth > maxHandlerDepth {
+		return nil
+	}
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		return s.resolve(expr.X, imports, depth)
+	case *ast.FuncLit:
+		return &handlerFunc{body: expr.Body}
+	case *ast.Ident:
+		if fn := s.pkg.funcs[expr.Name]; fn != nil {
+			return &handlerFunc{body: fn.Body, decl: fn}
+		}
+	case *ast.SelectorExpr:
+		if x, ok := expr.X.(*ast.Ident); ok && imports[x.Name] {
+			return nil
+		}
+		if methods := s.pkg.methods[expr.Sel.Name]; len(methods) > 0 {
+			return &handlerFunc{body: methods[0].Body, decl: methods[0]}
+		}
+	case *ast.UnaryExpr:
+		return s.resolve(expr.X, imports, depth)
+	case *ast.CompositeLit:
+		// A type of the package serving with its ServeHTTP method
+		typeName, ok := expr.Type.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		for _, method := range s.pkg.methods["ServeHTTP"] {
+			if receiverTypeName(method) == typeName.Name {
+				return &handlerFunc{body: method.Body, decl: method}
+			}
+		}
+	case *ast.CallExpr:
+		// Wrappers such as http.HandlerFunc(h) or middleware(h) take the
+		// handler as an argument
+		for i := len(expr.Args) - 1; i >= 0; i-- {
+			if fn := s.resolve(expr.Args[i], imports, depth+1); fn != nil {
+				return fn
+			}
+		}
+		// Constructors such as s.handleUsers() return it
+		constructor := s.resolve(expr.Fun, imports, depth+1)
+		if constructor == nil {
+			return nil
+		}
+		var returned *handlerFunc
+		ast.Inspect(constructor.body, func(n ast.Node) bool {
+			if ret, ok := n.(*ast.ReturnStmt); ok && returned == nil && len(ret.Results) == 1 {
+				if _, isCall := ret.Results[0].(*ast.CallExpr); isCall || isFuncLit(ret.Results[0]) {
+					returned = s.resolve(ret.Results[0], imports, depth+1)
+				}
+			}
+			return returned == nil
+		})
+		return returned
+	}
+	return nil
+}
+
+// scan records the methods, codes, and content types of a handler body,
+// following calls to the functions of the package with args bound to the
+// constant values passed to them.
+func (s *handlerScan) scan(fn *handlerFunc, args map[string]handlerValue, depth int) {
+	if fn.decl != nil {
+		if s.active[fn.decl] {
+			return
+		}
+		if s.active == nil {
+			s.active = make(map[*ast.FuncDecl]bool)
+		}
+		s.active[fn.decl] = true
+		defer delete(s.active, fn.decl)
+	}
+
+	ast.Inspect(fn.body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SwitchStmt:
+			if isMethodField(n.Tag) {
+				for _, stmt := range n.Body.List {
+					for _, value := range stmt.(*ast.CaseClause).List {
+						s.addMethod(value, args)
+					}
+				}
+			}
+		case *ast.BinaryExpr:
+			if n.Op != token.EQL && n.Op != token.NEQ {
+				return true
+			}
+			for _, pair := range [][2]ast.Expr{{n.X, n.Y}, {n.Y, n.X}} {
+				if isMethodField(pair[0]) {
+					s.addMethod(pair[1], args)
+				}
+				if isContentTypeGet(pair[0], s, args) {
+					s.addRequestType(pair[1], args)
+				}
+			}
+		case *ast.CallExpr:
+			s.call(n, args, depth)
+		}
+		return true
+	})
+}
+
+// call records what a call in a handler does.
+func (s *handlerScan) call(call *ast.CallExpr, args map[string]handlerValue, depth int) {
+	sel, isSel := call.Fun.(*ast.SelectorExpr)
+	pkgName := ""
+	if isSel {
+		if x, ok := sel.X.(*ast.Ident); ok {
+			pkgName = x.Name
+		}
+	}
+
+	switch {
+	case isSel && sel.Sel.Name == "WriteHeader" && len(call.Args) == 1:
+		s.addCode(call.Args[0], args)
+	case pkgName == "http" && sel.Sel.Name == "Error" && len(call.Args) == 3:
+		s.addCode(call.Args[2], args)
+	case pkgName == "http" && sel.Sel.Name == "Redirect" && len(call.Args) == 4:
+		s.addCode(call.Args[3], args)
+	case pkgName == "http" && sel.Sel.Name == "NotFound":
+		s.codes = addCode(s.codes, http.StatusNotFound)
+	case isSel && (sel.Sel.Name == "Set" || sel.Sel.Name == "Add") && len(call.Args) == 2 && isHeaderCall(sel.X):
+		if name, ok := s.text(call.Args[0], args); ok && strings.EqualFold(name, "Content-Type") {
+			if value, ok := s.text(call.Args[1], args); ok {
+				s.responseTypes = addText(s.responseTypes, value)
+			}
+		}
+	case pkgName == "strings" && (sel.Sel.Name == "HasPrefix" || sel.Sel.Name == "Contains") && len(call.Args) == 2:
+		if isContentTypeGet(call.Args[0], s, args) {
+			s.addRequestType(call.Args[1], args)
+		}
+	case depth < maxHandlerDepth:
+		// Helpers such as writeJSON(w, http.StatusCreated, v)
+		var callee *ast.FuncDecl
+		if ident, ok := call.Fun.(*ast.Ident); ok {
+			callee = s.pkg.funcs[ident.Name]
+		} else if isSel && pkgName != "http" {
+			if methods := s.pkg.methods[sel.Sel.Name]; len(methods) == 1 {
+				callee = methods[0]
+			}
+		}
+		if callee == nil {
+			return
+		}
+		bound := make(map[string]handlerValue)
+		i := 0
+		for _, field := range callee.Type.Params.List {
+			for _, name := range field.Names {
+				if i < len(call.Args) {
+					bound[name.Name] = s.value(call.Args[i], args)
+				}
+				i++
+			}
+			if len(field.Names) == 0 {
+				i++
+			}
+		}
+		s.scan(&handlerFunc{body: callee.Body, decl: callee}, bound, depth+1)
+	}
+}
+
+// value evaluates an argument passed to a called function.
+func (s *handlerScan) value(expr ast.Expr, args map[string]handlerValue) handlerValue {
+	var value handlerValue
+	value.code, value.hasInt = s.code(expr, args)
+	value.text, value.isText = s.text(expr, args)
+	return value
+}
+
+// code evaluates expr as a status code.
+func (s *handlerScan) code(expr ast.Expr, args map[string]handlerValue) (int, bool) {
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		return s.code(expr.X, args)
+	case *ast.BasicLit:
+		if expr.Kind == token.INT {
+			code, err := strconv.Atoi(expr.Value)
+			return code, err == nil
+		}
+	case *ast.SelectorExpr:
+		if x, ok := expr.X.(*ast.Ident); ok && x.Name == "http" {
+			code, ok := statusCodes[expr.Sel.Name]
+			return code, ok
+		}
+	case *ast.Ident:
+		if value, ok := args[expr.Name]; ok {
+			return value.code, value.hasInt
+		}
+		if value, ok := s.pkg.consts[expr.Name]; ok {
+			return s.code(value, nil)
+		}
+	}
+	return 0, false
+}
+
+// text evaluates expr as a string constant; http.MethodX constants are
+// their method.
+func (s *handlerScan) text(expr ast.Expr, args map[string]handlerValue) (string, bool) {
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		return s.text(expr.X, args)
+	case *ast.BasicLit:
+		if expr.Kind == token.STRING {
+			text, err := strconv.Unquote(expr.Value)
+			return text, err == nil
+		}
+	case *ast.SelectorExpr:
+		if x, ok := expr.X.(*ast.Ident); ok && x.Name == "http" {
+			if method, ok := strings.CutPrefix(expr.Sel.Name, "Method"); ok {
+				return strings.ToUpper(method), true
+			}
+		}
+	case *ast.Ident:
+		if value, ok := args[expr.Name]; ok {
+			return value.text, value.isText
+		}
+		if value, ok := s.pkg.consts[expr.Name]; ok {
+			return s.text(value, nil)
+		}
+	case *ast.BinaryExpr:
+		if expr.Op == token.ADD {
+			x, okX := s.text(expr.X, args)
+			y, okY := s.text(expr.Y, args)
+			return x + y, okX && okY
+		}
+	}
+	return "", false
+}
+
+func (s *handlerScan) addCode(expr ast.Expr, args map[string]handlerValue) {
+	if code, ok := s.code(expr, args); ok {
+		s.codes = addCode(s.codes, code)
+	}
+}
+
+func (s *handlerScan) addMethod(expr ast.Expr, args map[string]handlerValue) {
+	if method, ok := s.text(expr, args); ok && httpMethods[method] {
+		s.methods = addText(s.methods, method)
+	}
+}
+
+func (s *handlerScan) addRequestType(expr ast.Expr, args map[string]handlerValue) {
+	if value, ok := s.text(expr, args); ok && value != "" {
+		s.requestTypes = addText(s.requestTypes, value)
+	}
+}
+
+// isMethodField reports whether expr reads a request's method, as r.Method.
+func isMethodField(expr ast.Expr) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "Method"
+}
+
+// isHeaderCall reports whether expr is a w.Header() call.
+func isHeaderCall(expr ast.Expr) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) != 0 {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "Header"
+}
+
+// isContentTypeGet reports whether expr reads a request's Content-Type, as
+// r.Header.Get("Content-Type").
+func isContentTypeGet(expr ast.Expr, s *handlerScan, args map[string]handlerValue) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Get" {
+		return false
+	}
+	if header, ok := sel.X.(*ast.SelectorExpr); !ok || header.Sel.Name != "Header" {
+		return false
+	}
+	name, ok := s.text(call.Args[0], args)
+	return ok && strings.EqualFold(name, "Content-Type")
+}
+
+func isFuncLit(expr ast.Expr) bool {
+	_, ok := expr.(*ast.FuncLit)
+	return ok
+}
+
+// receiverTypeName returns the base type name of a method's receiver.
+func receiverTypeName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	expr := fn.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// handlerName returns the handler expression as written, with function
+// literals shortened.
+func handlerName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.FuncLit:
+		return "func literal"
+	case *ast.CallExpr:
+		args := make([]string, len(expr.Args))
+		for i, arg := range expr.Args {
+			args[i] = handlerName(arg)
+		}
+		return handlerName(expr.Fun) + "(" + strings.Join(args, ", ") + ")"
+	}
+	return types.ExprString(expr)
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func addCode(codes map[int]bool, code int) map[int]bool {
+	if codes == nil {
+		codes = make(map[int]bool)
+	}
+	codes[code] = true
+	return codes
+}
+
+func addText(set map[string]bool, text string) map[string]bool {
+	if set == nil {
+		set = make(map[string]bool)
+	}
+	set[text] = true
+	return set
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// routeFuncs are the functions of the route templates.
+var routeFuncs = map[string]any{
+	"methods": func(route Route) string {
+		if len(route.Methods) == 0 {
+			return "ANY"
+		}
+		return strings.Join(route.Methods, ", ")
+	},
+	"codes": func(route Route) string {
+		if !route.Resolved {
+			return "?"
+		}
+		codes := make([]string, len(route.StatusCodes))
+		for i, code := range route.StatusCodes {
+			codes[i] = strconv.Itoa(code)
+		}
+		return strings.Join(codes, ", ")
+	},
+	"join": func(values []string) string { return strings.Join(values, ", ") },
+}
+
+// renderRoutes renders the routes page of the API documentation in format,
+// html or markdown.
+func renderRoutes(routes []Route, format string) ([]byte, error) {
+	var page bytes.Buffer
+	if format == "html" {
+		tmpl, err := htmltemplate.New("routes").Funcs(routeFuncs).Parse(RoutesHTMLTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse routes template: %w", err)
+		}
+		if err := tmpl.Execute(&page, routes); err != nil {
+			return nil, fmt.Errorf("failed to execute routes template: %w", err)
+		}
+		return page.Bytes(), nil
+	}
+
+	// Pipes would end a table cell early
+	cells := make([]Route, len(routes))
+	for i, route := range routes {
+		route.Pattern = strings.ReplaceAll(route.Pattern, "|", `\|`)
+		route.Handler = strings.ReplaceAll(route.Handler, "|", `\|`)
+		cells[i] = route
+	}
+	tmpl, err := template.New("routes").Funcs(routeFuncs).Parse(RoutesMarkdownTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse routes template: %w", err)
+	}
+	if err := tmpl.Execute(&page, cells); err != nil {
+		return nil, fmt.Errorf("failed to execute routes template: %w", err)
+	}
+	return page.Bytes(), nil
+}
@@ -0,0 +1,92 @@
+// Package exitcode defines the exit codes shared by all commands: 0 on
+// success, 1 when a command fails to run, and 2 when it ran but a policy
+// failed (a threshold, grade, or up-to-date requirement). Commands that wrap
+// an external tool, such as a container build, exit with that tool's status.
+package exitcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	Success = 0
+	Failure = 1
+	Policy  = 2
+)
+
+// PolicyError reports a check that ran successfully but did not pass.
+type PolicyError struct {
+	Message string
+}
+
+// Error returns the policy failure message.
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+// ExitCode makes the CLI exit with Policy.
+func (e *PolicyError) ExitCode() int {
+	return Policy
+}
+
+// Policyf returns a PolicyError with a formatted message.
+func Policyf(format string, args ...any) error {
+	return &PolicyError{Message: fmt.Sprintf(format, args...)}
+}
+
+// IsPolicy reports whether err is, or wraps, a policy failure.
+func IsPolicy(err error) bool {
+	var policyErr *PolicyError
+	return errors.As(err, &policyErr)
+}
+
+// StatusError reports an external tool that failed with its own exit status,
+// which the CLI exits with.
+type StatusError struct {
+	Err    error
+	Status int
+}
+
+// Error returns the underlying error message.
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// WithStatus returns err carrying the exit status the CLI should exit with.
+func WithStatus(err error, status int) error {
+	return &StatusError{Err: err, Status: status}
+}
+
+// Code returns the exit code for err. Policy failures map to Policy and
+// StatusErrors to their status; the exit statuses of other wrapped
+// subprocess errors are not passed through. For errors joined from several
+// runs, the first one that is not a policy failure decides, so a command
+// that failed to run on one path never exits with Policy.
+func Code(err error) int {
+	var statusErr *StatusError
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		code := Success
+		for _, err := range joined.Unwrap() {
+			if c := Code(err); c != Success && (code == Success || code == Policy) {
+				code = c
+			}
+		}
+		return code
+	}
+	switch {
+	case err == nil:
+		return Success
+	case errors.As(err, &statusErr):
+		return statusErr.Status
+	case IsPolicy(err):
+		return Policy
+	default:
+		return Failure
+	}
+}
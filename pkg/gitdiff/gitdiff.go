@@ -0,0 +1,129 @@
+// Package gitdiff finds the files and Go lines a branch changed, for the
+// checks that only look at the changes since a base ref, such as diff
+// coverage.
+package gitdiff
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"goforge/pkg/proc"
+)
+
+// ChangedFiles returns the files added, changed, or deleted since the merge
+// base of base and HEAD, as slash-separated paths relative to root, sorted.
+// Uncommitted changes to tracked files count as changed. A renamed file is
+// reported at both its old and its new path.
+func ChangedFiles(root string, base string) ([]string, error) {
+	mergeBase, err := findMergeBase(root, base)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := proc.Command("git", "diff", "--name-only", "--no-renames", "--no-color", "--no-ext-diff", "--relative", mergeBase)
+	diff.Dir = root
+	var stderr strings.Builder
+	diff.Stderr = &stderr
+	output, err := diff.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run git diff: %w\nOutput: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// findMergeBase returns the merge base of base and HEAD in the repository
+// of root.
+func findMergeBase(root string, base string) (string, error) {
+	mergeBase := proc.Command("git", "merge-base", base, "HEAD")
+	mergeBase.Dir = root
+	output, err := mergeBase.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the merge base of %s and HEAD; is %s a git ref in this repository?", base, base)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ChangedLines returns the lines added or changed in each non-test Go file
+// since the merge base of base and HEAD, keyed by slash-separated path
+// relative to root. Uncommitted changes to tracked files count as changed.
+func ChangedLines(root string, base string) (map[string][]int, error) {
+	mergeBase, err := findMergeBase(root, base)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := proc.Command("git", "diff", "--unified=0", "--no-color", "--no-ext-diff", "--relative",
+		mergeBase, "--", "*.go")
+	diff.Dir = root
+	var stderr strings.Builder
+	diff.Stderr = &stderr
+	output, err := diff.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run git diff: %w\nOutput: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseDiffLines(output), nil
+}
+
+// parseDiffLines reads the new-side line ranges of each hunk of a unified
+// diff. Deleted files and test files are skipped.
+func parseDiffLines(diff []byte) map[string][]int {
+	changed := make(map[string][]int)
+	file := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(diff))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			file = ""
+			if name, ok := strings.CutPrefix(line, "+++ b/"); ok && !strings.HasSuffix(name, "_test.go") {
+				file = name
+			}
+		case strings.HasPrefix(line, "@@ ") && file != "":
+			// @@ -old[,count] +new[,count] @@
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+			start, count, err := parseHunkRange(strings.TrimPrefix(fields[2], "+"))
+			if err != nil {
+				continue
+			}
+			for n := start; n < start+count; n++ {
+				changed[file] = append(changed[file], n)
+			}
+		}
+	}
+	return changed
+}
+
+// parseHunkRange parses "start[,count]" from a hunk header.
+func parseHunkRange(text string) (int, int, error) {
+	startText, countText, hasCount := strings.Cut(text, ",")
+	start, err := strconv.Atoi(startText)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !hasCount {
+		return start, 1, nil
+	}
+	count, err := strconv.Atoi(countText)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, count, nil
+}
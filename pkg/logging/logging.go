@@ -0,0 +1,35 @@
+// Package logging prints the progress messages of commands. They go to
+// standard output like results do, but the global --quiet flag silences
+// them so scripts see only errors and the final result.
+package logging
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var quiet atomic.Bool
+
+// SetQuiet turns progress messages off or on.
+func SetQuiet(q bool) {
+	quiet.Store(q)
+}
+
+// Quiet reports whether progress messages are silenced.
+func Quiet() bool {
+	return quiet.Load()
+}
+
+// Infof prints a progress message unless quiet.
+func Infof(format string, args ...any) {
+	if !Quiet() {
+		fmt.Printf(format, args...)
+	}
+}
+
+// Infoln prints a progress line unless quiet.
+func Infoln(args ...any) {
+	if !Quiet() {
+		fmt.Println(args...)
+	}
+}
@@ -0,0 +1,33 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/exp/slog"
+)
+
+// Log formats of the servers.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// NewLogger returns a structured logger writing to w in the text or JSON
+// format. JSON records name their timestamp "ts", as log aggregators expect.
+func NewLogger(w io.Writer, format string) (*slog.Logger, error) {
+	switch format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, nil)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+			ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+				if len(groups) == 0 && attr.Key == slog.TimeKey {
+					attr.Key = "ts"
+				}
+				return attr
+			},
+		})), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q (expected %s or %s)", format, FormatText, FormatJSON)
+}
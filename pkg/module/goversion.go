@@ -0,0 +1,81 @@
+package module
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Stages of a Go version, in the order they sort within a minor release:
+// the language version, such as 1.21, then its betas, release candidates,
+// and releases, 1.21.0 on.
+const (
+	stageLanguage = iota
+	stageBeta
+	stageRC
+	stageRelease
+)
+
+// goVersion is a parsed Go version, such as 1.21.3 or 1.22rc1.
+type goVersion struct {
+	major, minor int
+	stage        int
+	// number is the patch release, or the beta or release candidate.
+	number int
+}
+
+// parseGoVersion parses a Go version written as in go.mod, without the go
+// prefix. Malformed parts read as 0.
+func parseGoVersion(v string) goVersion {
+	var parsed goVersion
+	major, rest, _ := strings.Cut(v, ".")
+	parsed.major, _ = strconv.Atoi(major)
+	end := strings.IndexFunc(rest, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		parsed.minor, _ = strconv.Atoi(rest)
+		return parsed
+	}
+	parsed.minor, _ = strconv.Atoi(rest[:end])
+	rest = rest[end:]
+
+	var number string
+	switch {
+	case strings.HasPrefix(rest, "."):
+		parsed.stage, number = stageRelease, rest[1:]
+	case strings.HasPrefix(rest, "rc"):
+		parsed.stage, number = stageRC, rest[2:]
+	case strings.HasPrefix(rest, "beta"):
+		parsed.stage, number = stageBeta, rest[4:]
+	}
+	parsed.number, _ = strconv.Atoi(number)
+	return parsed
+}
+
+// CompareGoVersions returns -1, 0, or +1 as the Go version a is older than,
+// the same as, or newer than b, like go/version.Compare for versions
+// written as in go.mod, without the go prefix. A language version such as
+// 1.21 is older than its release candidates, such as 1.21rc1, which are
+// older than its releases, 1.21.0 on.
+func CompareGoVersions(a string, b string) int {
+	va, vb := parseGoVersion(a), parseGoVersion(b)
+	for _, pair := range [][2]int{
+		{va.major, vb.major},
+		{va.minor, vb.minor},
+		{va.stage, vb.stage},
+		{va.number, vb.number},
+	} {
+		switch {
+		case pair[0] < pair[1]:
+			return -1
+		case pair[0] > pair[1]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// GoLanguage returns the language version of a Go version, its major and
+// minor release: 1.21 for 1.21.3 or 1.21rc1.
+func GoLanguage(v string) string {
+	parsed := parseGoVersion(v)
+	return strconv.Itoa(parsed.major) + "." + strconv.Itoa(parsed.minor)
+}
@@ -0,0 +1,149 @@
+// Package module locates Go modules on disk and reads their go.mod files.
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// FindRoot walks up from path to the nearest directory containing go.mod and
+// returns it. Commands that run the go tool in a module context call it first
+// so a missing go.mod fails early with an actionable message.
+func FindRoot(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	for dir := absPath; ; dir = filepath.Dir(dir) {
+		if info, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !info.IsDir() {
+			return dir, nil
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	return "", fmt.Errorf("no go.mod found from %s; run inside a Go module", absPath)
+}
+
+// FindModules returns the directories under root that contain a go.mod file,
+// sorted by path. Hidden, vendor, testdata, and node_modules directories are
+// not searched.
+func FindModules(root string) ([]string, error) {
+	var dirs []string
+
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			name := entry.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.Name() == "go.mod" {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for modules: %w", err)
+	}
+
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// GoVersion reads the go and toolchain directives of the go.mod in root. The
+// toolchain is returned without its "go" prefix and is empty when absent.
+func GoVersion(root string) (string, string, error) {
+	gomod := filepath.Join(root, "go.mod")
+	content, err := os.ReadFile(gomod)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read go.mod: %w", err)
+	}
+
+	file, err := modfile.Parse(gomod, content, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse go.mod: %w", err)
+	}
+
+	goVersion, toolchain := "", ""
+	if file.Go != nil {
+		goVersion = file.Go.Version
+	}
+	if file.Toolchain != nil {
+		toolchain = strings.TrimPrefix(file.Toolchain.Name, "go")
+	}
+	return goVersion, toolchain, nil
+}
+
+// Path reads the module path declared by the go.mod in root.
+func Path(root string) (string, error) {
+	gomod := filepath.Join(root, "go.mod")
+	content, err := os.ReadFile(gomod)
+	if err != nil {
+		return "", fmt.Errorf("failed to read go.mod: %w", err)
+	}
+
+	path := modfile.ModulePath(content)
+	if path == "" {
+		return "", fmt.Errorf("%s has no module directive", gomod)
+	}
+	return path, nil
+}
+
+// ResolveOutput returns the absolute path of output, a file or directory a
+// command writes for the project at path. A relative output is resolved
+// against the module root of path, or against path itself when it is not
+// in a module, rather than the working directory, which the API server
+// shares between requests.
+func ResolveOutput(path string, output string) (string, error) {
+	if filepath.IsAbs(output) {
+		return filepath.Clean(output), nil
+	}
+
+	base, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if root, err := FindRoot(base); err == nil {
+		base = root
+	} else if info, err := os.Stat(base); err == nil && !info.IsDir() {
+		base = filepath.Dir(base)
+	}
+	return filepath.Join(base, output), nil
+}
+
+// DirectRequires returns the module paths the go.mod in root requires
+// directly, that is without an // indirect comment.
+func DirectRequires(root string) (map[string]bool, error) {
+	gomod := filepath.Join(root, "go.mod")
+	content, err := os.ReadFile(gomod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read go.mod: %w", err)
+	}
+
+	file, err := modfile.Parse(gomod, content, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse go.mod: %w", err)
+	}
+
+	direct := make(map[string]bool)
+	for _, require := range file.Require {
+		if !require.Indirect {
+			direct[require.Mod.Path] = true
+		}
+	}
+	return direct, nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package proc
+
+import "os/exec"
+
+// setProcessGroup does nothing where process groups are not supported.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills cmd; its children are left to exit on their own.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,102 @@
+// Package proc starts the external commands GoForge runs, such as go, git,
+// docker, and kubectl. The global --timeout bounds them all: when it
+// elapses, the running commands and every process they started are killed,
+// and the run fails with an "operation timed out" error instead of hanging.
+package proc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"goforge/pkg/exitcode"
+)
+
+// interruptGrace is how long an interrupted run may take to return after
+// its commands were killed before GoForge exits anyway.
+const interruptGrace = time.Second
+
+var (
+	// bound is the context every command runs under; it is canceled with
+	// the reason when the timeout elapses or the run is interrupted.
+	bound   = context.Background()
+	bounded bool
+	// killed is set once a command has been killed because bound was
+	// canceled.
+	killed atomic.Bool
+)
+
+// SetTimeout bounds the commands started from now on to d in total; zero
+// means no bound. It returns the bounding context, from which callers that
+// also cancel commands themselves should derive theirs. It is meant to be
+// called once, before any command runs.
+//
+// With a bound, commands run in their own process group so the whole group
+// can be killed. Since the terminal then no longer delivers Ctrl+C to them,
+// an interrupt kills them the same way.
+func SetTimeout(d time.Duration) context.Context {
+	if d <= 0 {
+		return bound
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	bound, bounded = ctx, true
+	time.AfterFunc(d, func() {
+		cancel(fmt.Errorf("operation timed out after %s", d))
+	})
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		cancel(errors.New("interrupted"))
+		// The killed commands normally make the run fail right away;
+		// servers, which run commands only per request, keep going
+		time.Sleep(interruptGrace)
+		os.Exit(exitcode.Failure)
+	}()
+	return ctx
+}
+
+// Command returns exec.Command bounded by the global timeout.
+func Command(name string, args ...string) *exec.Cmd {
+	return CommandContext(bound, name, args...)
+}
+
+// CommandContext returns exec.CommandContext for a ctx derived from the
+// context SetTimeout returned. Without a timeout it behaves exactly like
+// exec.CommandContext; with one, canceling ctx kills the command's whole
+// process group, so no grandchild, such as a test binary started by go
+// test, outlives it.
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if !bounded {
+		return cmd
+	}
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		if bound.Err() != nil {
+			killed.Store(true)
+		}
+		return killProcessGroup(cmd)
+	}
+	return cmd
+}
+
+// Err returns why commands were killed, e.g. "operation timed out after
+// 10m0s", or nil when none was. A killed command leaves the run's results
+// incomplete, so the CLI reports this error in place of whatever the
+// command's caller made of the failure.
+func Err() error {
+	if !killed.Load() {
+		return nil
+	}
+	return context.Cause(bound)
+}
@@ -0,0 +1,263 @@
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"goforge/pkg/logging"
+
+	"github.com/google/pprof/profile"
+)
+
+// poolingPathDepth is the number of frames that identify an allocating call path.
+const poolingPathDepth = 3
+
+// AllocReport attributes the allocations in a heap profile to packages and call paths.
+type AllocReport struct {
+	TotalSpace   int64              `json:"total_alloc_space"`
+	TotalObjects int64              `json:"total_alloc_objects"`
+	Packages     []AllocGroup       `json:"packages"`
+	Roots        []AllocGroup       `json:"roots"`
+	Pooling      []PoolingCandidate `json:"pooling_candidates"`
+}
+
+// AllocGroup aggregates allocations attributed to a package or call path root.
+type AllocGroup struct {
+	Name         string  `json:"name"`
+	Space        int64   `json:"alloc_space"`
+	Objects      int64   `json:"alloc_objects"`
+	SpacePercent float64 `json:"alloc_space_percent"`
+}
+
+// PoolingCandidate is a call path that allocates many small objects.
+type PoolingCandidate struct {
+	CallPath    string  `json:"call_path"`
+	Objects     int64   `json:"alloc_objects"`
+	Space       int64   `json:"alloc_space"`
+	AverageSize float64 `json:"average_size"`
+}
+
+// AllocReportFile reads a heap profile and prints allocations grouped by package
+// and call path root. Call paths allocating at least minObjects objects averaging
+// at most maxSize bytes are flagged as pooling candidates.
+func AllocReportFile(profileFile string, minObjects int64, maxSize int64, jsonOutput bool) error {
+	if !jsonOutput {
+		logging.Infof("Analyzing allocations in %s...\n", profileFile)
+	}
+
+	file, err := os.Open(profileFile)
+	if err != nil {
+		return fmt.Errorf("profile file not found: %w", err)
+	}
+	defer file.Close()
+
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse profile: %w", err)
+	}
+
+	report, err := AnalyzeAllocations(prof, minObjects, maxSize)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	printAllocReport(report, minObjects, maxSize)
+	return nil
+}
+
+// AnalyzeAllocations walks the sample stacks of a heap profile and aggregates
+// alloc_space and alloc_objects.
+func AnalyzeAllocations(prof *profile.Profile, minObjects int64, maxSize int64) (*AllocReport, error) {
+	spaceIndex, objectsIndex := -1, -1
+	for i, sampleType := range prof.SampleType {
+		switch sampleType.Type {
+		case "alloc_space":
+			spaceIndex = i
+		case "alloc_objects":
+			objectsIndex = i
+		}
+	}
+	if spaceIndex < 0 || objectsIndex < 0 {
+		return nil, fmt.Errorf("profile has no alloc_space/alloc_objects samples; is it a heap profile?")
+	}
+
+	report := &AllocReport{}
+	packages := make(map[string]*AllocGroup)
+	roots := make(map[string]*AllocGroup)
+	paths := make(map[string]*PoolingCandidate)
+
+	for _, sample := range prof.Sample {
+		space := sample.Value[spaceIndex]
+		objects := sample.Value[objectsIndex]
+		if space == 0 && objects == 0 {
+			continue
+		}
+
+		frames := sampleFrames(sample)
+		if len(frames) == 0 {
+			continue
+		}
+
+		report.TotalSpace += space
+		report.TotalObjects += objects
+
+		// The leaf frame allocated; the outermost frame started the call path
+		addAlloc(packages, funcPackage(frames[0]), space, objects)
+		addAlloc(roots, callPathRoot(frames), space, objects)
+
+		depth := len(frames)
+		if depth > poolingPathDepth {
+			depth = poolingPathDepth
+		}
+		key := strings.Join(frames[:depth], " <- ")
+		candidate, ok := paths[key]
+		if !ok {
+			candidate = &PoolingCandidate{CallPath: key}
+			paths[key] = candidate
+		}
+		candidate.Objects += objects
+		candidate.Space += space
+	}
+
+	report.Packages = rankAllocGroups(packages, report.TotalSpace)
+	report.Roots = rankAllocGroups(roots, report.TotalSpace)
+
+	for _, candidate := range paths {
+		if candidate.Objects < minObjects {
+			continue
+		}
+		candidate.AverageSize = float64(candidate.Space) / float64(candidate.Objects)
+		if candidate.AverageSize <= float64(maxSize) {
+			report.Pooling = append(report.Pooling, *candidate)
+		}
+	}
+	sort.Slice(report.Pooling, func(i, j int) bool {
+		return report.Pooling[i].Objects > report.Pooling[j].Objects
+	})
+
+	return report, nil
+}
+
+// sampleFrames returns the function names of a sample, leaf first, with
+// inlined frames expanded.
+func sampleFrames(sample *profile.Sample) []string {
+	var frames []string
+	for _, location := range sample.Location {
+		for _, line := range location.Line {
+			if line.Function != nil {
+				frames = append(frames, line.Function.Name)
+			}
+		}
+	}
+	return frames
+}
+
+// callPathRoot returns the outermost frame outside the runtime, such as
+// main.main or the function a goroutine was started with.
+func callPathRoot(frames []string) string {
+	for i := len(frames) - 1; i >= 0; i-- {
+		if funcPackage(frames[i]) != "runtime" {
+			return frames[i]
+		}
+	}
+	return frames[len(frames)-1]
+}
+
+// funcPackage returns the import path of a fully qualified function name such
+// as "github.com/a/b.(*T).Method".
+func funcPackage(name string) string {
+	// Type arguments may contain dots and slashes of their own
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+
+	slash := strings.LastIndexByte(name, '/')
+	if dot := strings.IndexByte(name[slash+1:], '.'); dot >= 0 {
+		return name[:slash+1+dot]
+	}
+	return name
+}
+
+// addAlloc adds a sample's values to the named group.
+func addAlloc(groups map[string]*AllocGroup, name string, space int64, objects int64) {
+	group, ok := groups[name]
+	if !ok {
+		group = &AllocGroup{Name: name}
+		groups[name] = group
+	}
+	group.Space += space
+	group.Objects += objects
+}
+
+// rankAllocGroups sorts groups by allocated bytes and fills in their share.
+func rankAllocGroups(groups map[string]*AllocGroup, total int64) []AllocGroup {
+	var ranked []AllocGroup
+	for _, group := range groups {
+		if total > 0 {
+			group.SpacePercent = float64(group.Space) / float64(total) * 100
+		}
+		ranked = append(ranked, *group)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Space != ranked[j].Space {
+			return ranked[i].Space > ranked[j].Space
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+	return ranked
+}
+
+// formatBytes renders a byte count with a binary unit suffix.
+func formatBytes(b float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for b >= 1024 && i < len(units)-1 {
+		b /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f%s", b, units[i])
+	}
+	return fmt.Sprintf("%.2f%s", b, units[i])
+}
+
+// printAllocReport prints the allocation report as ranked tables.
+func printAllocReport(report *AllocReport, minObjects int64, maxSize int64) {
+	fmt.Printf("\nTotal allocated: %s in %d objects\n", formatBytes(float64(report.TotalSpace)), report.TotalObjects)
+
+	printAllocGroups("Allocations by Package", "package", report.Packages)
+	printAllocGroups("Allocations by Call Path Root", "root", report.Roots)
+
+	fmt.Printf("\nPooling Candidates (at least %d objects, average size at most %s):\n", minObjects, formatBytes(float64(maxSize)))
+	if len(report.Pooling) == 0 {
+		fmt.Println("- None")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "objects\tavg size\tcall path\t")
+	for _, candidate := range report.Pooling {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t\n", candidate.Objects, formatBytes(candidate.AverageSize), candidate.CallPath)
+	}
+	tw.Flush()
+}
+
+// printAllocGroups prints one ranked table of allocation groups.
+func printAllocGroups(title string, column string, groups []AllocGroup) {
+	fmt.Printf("\n%s:\n", title)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\talloc_space\tshare\talloc_objects\t\n", column)
+	for _, group := range groups {
+		fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%d\t\n", group.Name, formatBytes(float64(group.Space)), group.SpacePercent, group.Objects)
+	}
+	tw.Flush()
+}
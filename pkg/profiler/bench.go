@@ -0,0 +1,359 @@
+package profiler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+)
+
+// BenchResult holds the samples collected for a single benchmark.
+type BenchResult struct {
+	Name string
+	// Package is the import path from the preceding "pkg:" line, if any.
+	Package     string
+	NsPerOp     []float64
+	BytesPerOp  []float64
+	AllocsPerOp []float64
+}
+
+// benchLineRe matches a result line printed by 'go test -bench'.
+var benchLineRe = regexp.MustCompile(`^(Benchmark\S+?)(?:-\d+)?\s+\d+\s+(.*)$`)
+
+// BenchCompare runs benchmarks at a git ref and in the current tree and compares them.
+func BenchCompare(ctx context.Context, pkg string, ref string, bench string, count int) error {
+	logging.Infof("Comparing benchmarks in %s against %s (count: %d)...\n", pkg, ref, count)
+
+	if count < 1 {
+		return fmt.Errorf("count must be at least 1")
+	}
+
+	// Locate the repository root and our position inside it
+	rootOut, err := proc.CommandContext(ctx, "git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return fmt.Errorf("failed to locate git repository: %w", err)
+	}
+	repoRoot := strings.TrimSpace(string(rootOut))
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Resolve symlinks so the relative path is computed consistently
+	realCwd, err := filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return fmt.Errorf("failed to resolve current directory: %w", err)
+	}
+
+	relDir, err := filepath.Rel(repoRoot, realCwd)
+	if err != nil {
+		return fmt.Errorf("failed to get path relative to repository root: %w", err)
+	}
+
+	// Check out the ref into a temporary worktree; the working tree is never touched
+	worktree, err := os.MkdirTemp("", "goforge-bench-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(worktree)
+
+	output, err := proc.CommandContext(ctx, "git", "worktree", "add", "--detach", worktree, ref).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to create worktree for %s: %w\nOutput: %s", ref, err, output)
+	}
+	// Cleanup must run even when ctx has been canceled
+	defer func() {
+		exec.Command("git", "worktree", "remove", "--force", worktree).Run()
+		exec.Command("git", "worktree", "prune").Run()
+	}()
+
+	// Run the benchmarks with identical settings in both trees
+	logging.Infof("\nRunning benchmarks at %s...\n", ref)
+	oldResults, err := runBenchmarks(ctx, filepath.Join(worktree, relDir), pkg, bench, count)
+	if err != nil {
+		return fmt.Errorf("failed to run benchmarks at %s: %w", ref, err)
+	}
+
+	logging.Infoln("Running benchmarks in the current tree...")
+	newResults, err := runBenchmarks(ctx, cwd, pkg, bench, count)
+	if err != nil {
+		return fmt.Errorf("failed to run benchmarks in the current tree: %w", err)
+	}
+
+	fmt.Printf("\nBenchmark Comparison (%s vs current):\n", ref)
+	PrintBenchComparison(os.Stdout, oldResults, newResults)
+
+	return nil
+}
+
+// runBenchmarks runs 'go test -bench' for a package in the given directory.
+func runBenchmarks(ctx context.Context, dir string, pkg string, bench string, count int) (map[string]*BenchResult, error) {
+	output, err := benchOutput(ctx, dir, pkg, bench, count)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBenchOutput(output), nil
+}
+
+// benchOutput runs 'go test -bench' with -benchmem for the packages in the
+// given directory and returns its raw output.
+func benchOutput(ctx context.Context, dir string, pkgs string, bench string, count int) (string, error) {
+	cmd := proc.CommandContext(ctx, "go", "test", "-run", "^$", "-bench", bench, "-benchmem",
+		"-count", strconv.Itoa(count), pkgs)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w\nOutput: %s", err, output)
+	}
+	return string(output), nil
+}
+
+// ParseBenchOutput parses the output of 'go test -bench' into results keyed by benchmark name.
+func ParseBenchOutput(output string) map[string]*BenchResult {
+	return parseBench(output, false)
+}
+
+// parseBench parses 'go test -bench' output. With qualify set, results are
+// keyed and named "<import path>.<benchmark>" so that benchmarks of the same
+// name in different packages stay apart.
+func parseBench(output string, qualify bool) map[string]*BenchResult {
+	results := make(map[string]*BenchResult)
+	pkg := ""
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if value, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = value
+			continue
+		}
+
+		match := benchLineRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		key := match[1]
+		if qualify && pkg != "" {
+			key = pkg + "." + match[1]
+		}
+		result, ok := results[key]
+		if !ok {
+			result = &BenchResult{Name: key, Package: pkg}
+			results[key] = result
+		}
+
+		// Metrics come in "<value> <unit>" pairs
+		fields := strings.Fields(match[2])
+		for i := 0; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				continue
+			}
+			switch fields[i+1] {
+			case "ns/op":
+				result.NsPerOp = append(result.NsPerOp, value)
+			case "B/op":
+				result.BytesPerOp = append(result.BytesPerOp, value)
+			case "allocs/op":
+				result.AllocsPerOp = append(result.AllocsPerOp, value)
+			}
+		}
+	}
+
+	return results
+}
+
+// PrintBenchComparison prints a benchstat-style comparison of two benchmark runs.
+func PrintBenchComparison(w io.Writer, oldResults, newResults map[string]*BenchResult) {
+	names := make(map[string]bool)
+	for name := range oldResults {
+		names[name] = true
+	}
+	for name := range newResults {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	metrics := []struct {
+		unit   string
+		values func(*BenchResult) []float64
+	}{
+		{"sec/op", func(r *BenchResult) []float64 { return r.NsPerOp }},
+		{"B/op", func(r *BenchResult) []float64 { return r.BytesPerOp }},
+		{"allocs/op", func(r *BenchResult) []float64 { return r.AllocsPerOp }},
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, metric := range metrics {
+		fmt.Fprintf(tw, "\nname\told %s\tnew %s\tdelta\t\n", metric.unit, metric.unit)
+		for _, name := range sorted {
+			oldResult, inOld := oldResults[name]
+			newResult, inNew := newResults[name]
+
+			switch {
+			case !inOld:
+				fmt.Fprintf(tw, "%s\t-\t%s\t(added)\t\n", name, formatSamples(metric.values(newResult), metric.unit))
+			case !inNew:
+				fmt.Fprintf(tw, "%s\t%s\t-\t(removed)\t\n", name, formatSamples(metric.values(oldResult), metric.unit))
+			default:
+				oldValues := metric.values(oldResult)
+				newValues := metric.values(newResult)
+				if len(oldValues) == 0 && len(newValues) == 0 {
+					continue
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", name,
+					formatSamples(oldValues, metric.unit),
+					formatSamples(newValues, metric.unit),
+					formatDelta(oldValues, newValues))
+			}
+		}
+	}
+	tw.Flush()
+}
+
+// formatSamples renders the mean and relative spread of a set of samples.
+func formatSamples(values []float64, unit string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+
+	m := mean(values)
+	spread := 0.0
+	if m != 0 {
+		spread = stddev(values) / m * 100
+	}
+
+	if unit == "sec/op" {
+		return fmt.Sprintf("%s ±%.0f%%", formatDuration(m), spread)
+	}
+	return fmt.Sprintf("%.0f ±%.0f%%", m, spread)
+}
+
+// formatDuration renders a nanosecond value with a readable unit.
+func formatDuration(ns float64) string {
+	switch {
+	case ns >= 1e9:
+		return fmt.Sprintf("%.2fs", ns/1e9)
+	case ns >= 1e6:
+		return fmt.Sprintf("%.2fms", ns/1e6)
+	case ns >= 1e3:
+		return fmt.Sprintf("%.2fµs", ns/1e3)
+	default:
+		return fmt.Sprintf("%.2fns", ns)
+	}
+}
+
+// formatDelta renders the change between two sample sets with its significance.
+func formatDelta(oldValues, newValues []float64) string {
+	if len(oldValues) == 0 || len(newValues) == 0 {
+		return "?"
+	}
+
+	p := mannWhitneyU(oldValues, newValues)
+	oldMean := mean(oldValues)
+	if p > 0.05 || oldMean == 0 {
+		return fmt.Sprintf("~ (p=%.3f n=%d+%d)", p, len(oldValues), len(newValues))
+	}
+
+	delta := (mean(newValues) - oldMean) / oldMean * 100
+	return fmt.Sprintf("%+.2f%% (p=%.3f n=%d+%d)", delta, p, len(oldValues), len(newValues))
+}
+
+// mean returns the arithmetic mean of the values.
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// stddev returns the sample standard deviation of the values.
+func stddev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := mean(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// mannWhitneyU returns the two-sided p-value of a Mann-Whitney U test using the
+// normal approximation with tie correction, as benchstat does for larger samples.
+func mannWhitneyU(a, b []float64) float64 {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 < 1 || n2 < 1 {
+		return 1
+	}
+
+	type sample struct {
+		value float64
+		fromA bool
+	}
+	all := make([]sample, 0, len(a)+len(b))
+	for _, v := range a {
+		all = append(all, sample{v, true})
+	}
+	for _, v := range b {
+		all = append(all, sample{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// Assign average ranks to ties and accumulate the tie correction term
+	rankSumA := 0.0
+	tieTerm := 0.0
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankSumA += rank
+			}
+		}
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+
+	u := rankSumA - n1*(n1+1)/2
+	n := n1 + n2
+	meanU := n1 * n2 / 2
+	varU := n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if varU <= 0 {
+		return 1
+	}
+
+	z := (math.Abs(u-meanU) - 0.5) / math.Sqrt(varU)
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
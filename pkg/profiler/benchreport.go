@@ -0,0 +1,136 @@
+package profiler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/safewrite"
+)
+
+// benchSortKeys are the columns a benchmark report can be sorted by.
+var benchSortKeys = map[string]func(*BenchResult) []float64{
+	"ns":     func(r *BenchResult) []float64 { return r.NsPerOp },
+	"bytes":  func(r *BenchResult) []float64 { return r.BytesPerOp },
+	"allocs": func(r *BenchResult) []float64 { return r.AllocsPerOp },
+	"name":   nil,
+}
+
+// ValidBenchSort reports whether key is a supported report sort order.
+func ValidBenchSort(key string) bool {
+	_, ok := benchSortKeys[key]
+	return ok
+}
+
+// BenchReportOptions configures BenchReport.
+type BenchReportOptions struct {
+	// Packages is the package pattern to benchmark, e.g. "./...".
+	Packages string
+	// Bench selects the benchmarks to run.
+	Bench string
+	Count int
+	// Sort is ns, bytes, allocs, or name; numeric columns sort descending.
+	Sort string
+	// Baseline is a saved 'go test -bench' output to compare against.
+	Baseline string
+	// Save writes the raw benchmark output, for use as a later baseline.
+	Save string
+}
+
+// BenchReport runs the benchmarks of a set of packages with -benchmem and
+// prints a table of time, bytes, and allocations per operation, or a
+// benchstat-style comparison against a saved baseline.
+func BenchReport(ctx context.Context, opts BenchReportOptions) error {
+	if opts.Count < 1 {
+		return fmt.Errorf("count must be at least 1")
+	}
+	if !ValidBenchSort(opts.Sort) {
+		return fmt.Errorf("invalid sort %q (expected ns, bytes, allocs, or name)", opts.Sort)
+	}
+
+	// Read the baseline first so a bad path fails before the benchmarks run
+	var baseline map[string]*BenchResult
+	if opts.Baseline != "" {
+		content, err := os.ReadFile(opts.Baseline)
+		if err != nil {
+			return fmt.Errorf("failed to read baseline: %w", err)
+		}
+		baseline = parseBench(string(content), true)
+		if len(baseline) == 0 {
+			return fmt.Errorf("no benchmark results found in baseline %s", opts.Baseline)
+		}
+	}
+
+	logging.Infof("Running benchmarks in %s (count: %d)...\n", opts.Packages, opts.Count)
+	output, err := benchOutput(ctx, ".", opts.Packages, opts.Bench, opts.Count)
+	if err != nil {
+		return fmt.Errorf("failed to run benchmarks: %w", err)
+	}
+
+	if opts.Save != "" {
+		if err := safewrite.CreateDir(opts.Save); err != nil {
+			return err
+		}
+		if err := os.WriteFile(opts.Save, []byte(output), 0644); err != nil {
+			return fmt.Errorf("failed to save benchmark output: %w", err)
+		}
+		logging.Infof("Benchmark output saved to %s (use it later with --baseline)\n", opts.Save)
+	}
+
+	results := parseBench(output, true)
+	if len(results) == 0 {
+		return fmt.Errorf("no benchmarks matched %q in %s", opts.Bench, opts.Packages)
+	}
+
+	if baseline != nil {
+		fmt.Printf("\nBenchmark Comparison (%s vs current):\n", opts.Baseline)
+		PrintBenchComparison(os.Stdout, baseline, results)
+		return nil
+	}
+
+	fmt.Printf("\nBenchmark Report (%d benchmarks):\n\n", len(results))
+	PrintBenchReport(os.Stdout, results, opts.Sort)
+	return nil
+}
+
+// PrintBenchReport prints one row per benchmark with the mean and spread of
+// each metric, sorted by the given key.
+func PrintBenchReport(w io.Writer, results map[string]*BenchResult, sortKey string) {
+	sorted := make([]*BenchResult, 0, len(results))
+	for _, result := range results {
+		sorted = append(sorted, result)
+	}
+
+	values := benchSortKeys[sortKey]
+	sort.Slice(sorted, func(i, j int) bool {
+		if values != nil {
+			a, b := meanOrZero(values(sorted[i])), meanOrZero(values(sorted[j]))
+			if a != b {
+				return a > b
+			}
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "name\ttime/op\tB/op\tallocs/op\t")
+	for _, result := range sorted {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", result.Name,
+			formatSamples(result.NsPerOp, "sec/op"),
+			formatSamples(result.BytesPerOp, "B/op"),
+			formatSamples(result.AllocsPerOp, "allocs/op"))
+	}
+	tw.Flush()
+}
+
+// meanOrZero returns the mean of values, or zero when there are none.
+func meanOrZero(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	return mean(values)
+}
@@ -0,0 +1,242 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+)
+
+// profileHookFile is the file added to the profiled main package.
+const profileHookFile = "goforge_profile_hook.go"
+
+// profileHookTemplate starts the selected profiles when the program
+// starts, and writes them and exits once the duration has passed.
+var profileHookTemplate = template.Must(template.New(profileHookFile).Parse(`package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// Added by goforge profile run: profile the program for {{.Duration}}, then exit.
+func init() {
+	{{- if .MemProfileRate}}
+	runtime.MemProfileRate = {{.MemProfileRate}}
+	{{- end}}
+	{{- if .Block}}
+	runtime.SetBlockProfileRate(1)
+	{{- end}}
+	{{- if .Mutex}}
+	runtime.SetMutexProfileFraction(1)
+	{{- end}}
+	{{- if .CPU}}
+	cpu, err := os.Create({{printf "%q" .CPU}})
+	if err == nil {
+		err = pprof.StartCPUProfile(cpu)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "goforge: failed to start the CPU profile:", err)
+		os.Exit(1)
+	}
+	{{- end}}
+
+	time.AfterFunc({{.Duration.Nanoseconds}}, func() {
+		{{- if .CPU}}
+		pprof.StopCPUProfile()
+		cpu.Close()
+		{{- end}}
+		{{- if .Mem}}
+		goforgeWriteProfile("heap", {{printf "%q" .Mem}})
+		{{- end}}
+		{{- if .Block}}
+		goforgeWriteProfile("block", {{printf "%q" .Block}})
+		{{- end}}
+		{{- if .Mutex}}
+		goforgeWriteProfile("mutex", {{printf "%q" .Mutex}})
+		{{- end}}
+		os.Exit(0)
+	})
+}
+
+func goforgeWriteProfile(name string, path string) {
+	if name == "heap" {
+		// Report the live heap as of the end of profiling
+		runtime.GC()
+	}
+	file, err := os.Create(path)
+	if err == nil {
+		err = pprof.Lookup(name).WriteTo(file, 0)
+		file.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goforge: failed to write the %s profile: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+`))
+
+// GoRunOptions configures ProfileGoRun.
+type GoRunOptions struct {
+	// CaptureOptions selects the profiles. Duration is required: the
+	// program is stopped once it has run that long.
+	CaptureOptions
+	// Args are passed to the program.
+	Args []string
+}
+
+// ProfileGoRun builds the main package pkg, as go run would, with a file
+// added that profiles the program from its start, and runs it with
+// opts.Args for opts.Duration. When the duration ends the profiles are
+// written and the program exits; one that exits sooner writes none. The
+// binary is removed afterwards.
+// If ctx is canceled the program is killed and the partial profiles are
+// removed.
+func ProfileGoRun(ctx context.Context, pkg string, opts GoRunOptions) error {
+	profiles, err := opts.profiles()
+	if err != nil {
+		return err
+	}
+	if opts.Duration <= 0 {
+		return fmt.Errorf("a duration is required; the profiles are written when it ends")
+	}
+	// The hook gets absolute paths, as the program may change directory
+	hook := opts.CaptureOptions
+	for _, profile := range profiles {
+		switch profile.flag {
+		case "-cpuprofile":
+			hook.CPU = profile.output
+		case "-memprofile":
+			hook.Mem = profile.output
+		case "-blockprofile":
+			hook.Block = profile.output
+		case "-mutexprofile":
+			hook.Mutex = profile.output
+		}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "goforge-run-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	logging.Infof("Building %s with profiling...\n", pkg)
+	binary, err := buildWithProfiling(ctx, pkg, tmpDir, hook)
+	if err != nil {
+		return err
+	}
+
+	cmd, err := targetCommand(ctx, binary, opts.Env, opts.Args...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.WaitDelay = killWaitDelay
+
+	logging.Infof("Profiling %s for %s: %d profiles...\n", pkg, opts.Duration, len(profiles))
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", pkg, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	// The program exits itself when the duration ends, once it has
+	// written the profiles
+	deadline := time.NewTimer(opts.Duration + stopGracePeriod)
+	defer deadline.Stop()
+
+	removeAll := func() {
+		for _, profile := range profiles {
+			removePartial(profile.output)
+		}
+	}
+	select {
+	case err = <-done:
+	case <-deadline.C:
+		cmd.Process.Kill()
+		<-done
+		removeAll()
+		return fmt.Errorf("%s did not exit within %s of the end of profiling", pkg, stopGracePeriod)
+	case <-ctx.Done():
+		<-done
+		removeAll()
+		return fmt.Errorf("profiling canceled: %w", ctx.Err())
+	}
+
+	if elapsed := time.Since(started); elapsed < opts.Duration {
+		removeAll()
+		if err != nil {
+			return fmt.Errorf("%s failed after %s, before profiling ended: %w", pkg, elapsed.Round(time.Millisecond), err)
+		}
+		return fmt.Errorf("%s exited after %s, before profiling ended; use a shorter --duration", pkg, elapsed.Round(time.Millisecond))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write the profiles: %w", err)
+	}
+
+	for _, profile := range profiles {
+		fmt.Printf("%s profile saved to %s\n", profile.kind, profile.output)
+	}
+	logging.Infoln("Use 'goforge profile visualize <profile>' to analyze a profile")
+
+	return nil
+}
+
+// buildWithProfiling builds the main package pkg into dir with the profile
+// hook for opts added through a go build overlay, leaving the source tree
+// as it is.
+func buildWithProfiling(ctx context.Context, pkg string, dir string, opts CaptureOptions) (string, error) {
+	output, err := proc.CommandContext(ctx, "go", "list", "-f", "{{.Name}}\t{{.Dir}}", pkg).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to find package %s: %w\nOutput: %s", pkg, err, output)
+	}
+	name, pkgDir, _ := strings.Cut(strings.TrimSpace(string(output)), "\t")
+	if name != "main" {
+		return "", fmt.Errorf("%s is package %s; only a main package can be run", pkg, name)
+	}
+	hookPath := filepath.Join(pkgDir, profileHookFile)
+	if _, err := os.Stat(hookPath); err == nil {
+		return "", fmt.Errorf("%s already exists; remove it to profile %s", hookPath, pkg)
+	}
+
+	var hook bytes.Buffer
+	if err := profileHookTemplate.Execute(&hook, opts); err != nil {
+		return "", fmt.Errorf("failed to generate the profile hook: %w", err)
+	}
+	hookFile := filepath.Join(dir, profileHookFile)
+	if err := os.WriteFile(hookFile, hook.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("failed to write the profile hook: %w", err)
+	}
+	overlay, err := json.Marshal(map[string]map[string]string{"Replace": {hookPath: hookFile}})
+	if err != nil {
+		return "", err
+	}
+	overlayFile := filepath.Join(dir, "overlay.json")
+	if err := os.WriteFile(overlayFile, overlay, 0644); err != nil {
+		return "", fmt.Errorf("failed to write the build overlay: %w", err)
+	}
+
+	binary := filepath.Join(dir, filepath.Base(pkgDir))
+	if output, err := proc.CommandContext(ctx, "go", "build", "-overlay", overlayFile, "-o", binary, pkg).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to build %s: %w\nOutput: %s", pkg, err, output)
+	}
+	return binary, nil
+}
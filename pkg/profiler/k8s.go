@@ -0,0 +1,286 @@
+package profiler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+	"goforge/pkg/safewrite"
+)
+
+// portForwardTimeout bounds how long we wait for kubectl to establish a forward.
+const portForwardTimeout = 20 * time.Second
+
+// forwardingRe matches kubectl's "Forwarding from 127.0.0.1:PORT -> PORT" line.
+var forwardingRe = regexp.MustCompile(`Forwarding from 127\.0\.0\.1:(\d+)`)
+
+// PodTarget identifies a pprof endpoint inside a Kubernetes pod.
+type PodTarget struct {
+	Pod       string
+	Namespace string
+	Container string
+	Port      int
+}
+
+// CPUProfilePod captures a CPU profile from a pod's net/http/pprof endpoint.
+func CPUProfilePod(ctx context.Context, target PodTarget, outputFile string, duration int) error {
+	logging.Infof("Profiling CPU usage of pod %s for %d seconds...\n", target, duration)
+
+	path := fmt.Sprintf("/debug/pprof/profile?seconds=%d", duration)
+	return profilePod(ctx, target, path, outputFile, "CPU")
+}
+
+// MemoryProfilePod captures a heap profile from a pod's net/http/pprof endpoint.
+func MemoryProfilePod(ctx context.Context, target PodTarget, outputFile string) error {
+	logging.Infof("Profiling memory usage of pod %s...\n", target)
+
+	return profilePod(ctx, target, "/debug/pprof/heap", outputFile, "Memory")
+}
+
+// AllocProfilePod captures an allocation profile from a pod's net/http/pprof
+// endpoint, covering every allocation since the process started.
+func AllocProfilePod(ctx context.Context, target PodTarget, outputFile string) error {
+	logging.Infof("Profiling allocations of pod %s...\n", target)
+
+	return profilePod(ctx, target, "/debug/pprof/allocs", outputFile, "Allocation")
+}
+
+// String returns the namespace-qualified pod name.
+func (t PodTarget) String() string {
+	return t.Namespace + "/" + t.Pod
+}
+
+// profilePod forwards the pod's pprof port and downloads a profile through it.
+// The forward is torn down when the capture finishes or ctx is canceled.
+func profilePod(ctx context.Context, target PodTarget, path string, outputFile string, kind string) error {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		return fmt.Errorf("kubectl not found in PATH; it is required to reach pods")
+	}
+
+	absOutput, err := filepath.Abs(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for output: %w", err)
+	}
+	if err := safewrite.CreateDir(absOutput); err != nil {
+		return err
+	}
+
+	declared, err := checkPodPort(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	localPort, stop, err := portForward(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", localPort)
+
+	// An undeclared port may still be served; verify before the long capture
+	if !declared {
+		if err := probePprof(ctx, baseURL); err != nil {
+			return fmt.Errorf("pod %s does not expose pprof on port %d: %w", target, target.Port, err)
+		}
+	}
+
+	err = fetchProfile(ctx, baseURL+path, absOutput)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s profile saved to %s\n", kind, absOutput)
+	logging.Infoln("Use 'goforge profile visualize " + absOutput + "' to analyze the profile")
+
+	return nil
+}
+
+// checkPodPort verifies the pod (and container, if given) exists and reports
+// whether the port is declared as a containerPort.
+func checkPodPort(ctx context.Context, target PodTarget) (bool, error) {
+	cmd := proc.CommandContext(ctx, "kubectl", "get", "pod", target.Pod, "-n", target.Namespace, "-o", "json")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to get pod %s: %s", target, strings.TrimSpace(stderr.String()))
+	}
+
+	var pod struct {
+		Spec struct {
+			Containers []struct {
+				Name  string `json:"name"`
+				Ports []struct {
+					ContainerPort int `json:"containerPort"`
+				} `json:"ports"`
+			} `json:"containers"`
+		} `json:"spec"`
+		Status struct {
+			Phase string `json:"phase"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(output, &pod); err != nil {
+		return false, fmt.Errorf("failed to parse pod %s: %w", target, err)
+	}
+
+	if pod.Status.Phase != "Running" {
+		return false, fmt.Errorf("pod %s is %s, not Running", target, pod.Status.Phase)
+	}
+
+	var names []string
+	found := target.Container == ""
+	declared := false
+	for _, container := range pod.Spec.Containers {
+		names = append(names, container.Name)
+		if target.Container != "" && container.Name != target.Container {
+			continue
+		}
+		found = true
+		for _, port := range container.Ports {
+			if port.ContainerPort == target.Port {
+				declared = true
+			}
+		}
+	}
+
+	if !found {
+		return false, fmt.Errorf("container %q not found in pod %s (containers: %s)", target.Container, target, strings.Join(names, ", "))
+	}
+	if !declared {
+		fmt.Fprintf(os.Stderr, "WARNING: port %d is not declared by %s; trying it anyway\n", target.Port, describeContainers(target, names))
+	}
+
+	return declared, nil
+}
+
+// describeContainers names the containers that were checked for the port.
+func describeContainers(target PodTarget, names []string) string {
+	if target.Container != "" {
+		return "container " + target.Container
+	}
+	return "any container (" + strings.Join(names, ", ") + ")"
+}
+
+// portForward starts 'kubectl port-forward' to a random local port and returns
+// that port together with a function that tears the forward down.
+func portForward(ctx context.Context, target PodTarget) (int, func(), error) {
+	cmd := proc.CommandContext(ctx, "kubectl", "port-forward", "-n", target.Namespace,
+		"pod/"+target.Pod, "0:"+strconv.Itoa(target.Port))
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to start port-forward: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return 0, nil, fmt.Errorf("failed to start port-forward: %w", err)
+	}
+
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+
+	// Wait for kubectl to report the local port
+	ports := make(chan int, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if match := forwardingRe.FindStringSubmatch(scanner.Text()); match != nil {
+				port, _ := strconv.Atoi(match[1])
+				ports <- port
+				break
+			}
+		}
+		// Keep draining so kubectl never blocks on a full pipe
+		io.Copy(io.Discard, stdout)
+	}()
+
+	select {
+	case port := <-ports:
+		logging.Infof("Forwarding 127.0.0.1:%d -> %s:%d\n", port, target, target.Port)
+		return port, stop, nil
+	case <-time.After(portForwardTimeout):
+		stop()
+		return 0, nil, fmt.Errorf("timed out establishing port-forward to %s:%d: %s", target, target.Port, strings.TrimSpace(stderr.String()))
+	case <-ctx.Done():
+		stop()
+		return 0, nil, fmt.Errorf("port-forward canceled: %w", ctx.Err())
+	}
+}
+
+// probePprof checks that a pprof index is reachable at baseURL.
+func probePprof(ctx context.Context, baseURL string) error {
+	probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(probeCtx, http.MethodGet, baseURL+"/debug/pprof/", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// fetchProfile downloads a profile from a pprof HTTP endpoint into outputFile,
+// removing the partial file if the download fails or is canceled.
+func fetchProfile(ctx context.Context, url string, outputFile string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("profiling canceled: %w", ctx.Err())
+		}
+		return fmt.Errorf("failed to fetch profile: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to fetch profile: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create profile file: %w", err)
+	}
+
+	_, err = io.Copy(file, resp.Body)
+	file.Close()
+	if err != nil {
+		removePartial(outputFile)
+		if ctx.Err() != nil {
+			return fmt.Errorf("profiling canceled: %w", ctx.Err())
+		}
+		return fmt.Errorf("failed to save profile: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/safewrite"
+)
+
+// stopGracePeriod is how long a target interrupted at the end of a capture
+// has to write its profiles and exit before it is killed.
+const stopGracePeriod = 10 * time.Second
+
+// CaptureOptions selects the profiles CaptureMultiple records. Each output
+// file is passed to the target as its -<type>profile flag; an empty one
+// skips that profile.
+type CaptureOptions struct {
+	CPU   string
+	Mem   string
+	Block string
+	Mutex string
+	// MemProfileRate is passed as -memprofilerate to sample every
+	// MemProfileRate bytes allocated (1 records every allocation); 0
+	// leaves the target's default.
+	MemProfileRate int
+	// Duration stops the target with an interrupt once it has run that
+	// long; 0 waits for it to exit.
+	Duration time.Duration
+	// Env holds extra KEY=VALUE environment variables for the target.
+	Env []string
+}
+
+// profileFlag is a profile and the target flag that enables it.
+type profileFlag struct {
+	kind   string
+	flag   string
+	output string
+}
+
+// profiles returns the selected profiles with absolute output paths, whose
+// directories it creates.
+func (opts CaptureOptions) profiles() ([]profileFlag, error) {
+	var profiles []profileFlag
+	for _, profile := range []profileFlag{
+		{"CPU", "-cpuprofile", opts.CPU},
+		{"Memory", "-memprofile", opts.Mem},
+		{"Block", "-blockprofile", opts.Block},
+		{"Mutex", "-mutexprofile", opts.Mutex},
+	} {
+		if profile.output == "" {
+			continue
+		}
+		absOutput, err := filepath.Abs(profile.output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for output: %w", err)
+		}
+		profile.output = absOutput
+		profiles = append(profiles, profile)
+	}
+
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profile selected; set at least one of --cpu, --mem, --block, or --mutex")
+	}
+	if opts.MemProfileRate < 0 {
+		return nil, fmt.Errorf("memory profile rate cannot be negative")
+	}
+	if opts.MemProfileRate > 0 && opts.Mem == "" {
+		return nil, fmt.Errorf("--memprofilerate only applies to the memory profile; capture it too")
+	}
+	if opts.Duration < 0 {
+		return nil, fmt.Errorf("duration cannot be negative")
+	}
+	for _, profile := range profiles {
+		if err := safewrite.CreateDir(profile.output); err != nil {
+			return nil, err
+		}
+	}
+	return profiles, nil
+}
+
+// CaptureMultiple records several profiles in a single run of a Go binary,
+// so they all describe the same workload. The target must accept the
+// -cpuprofile, -memprofile, -blockprofile, -mutexprofile, and
+// -memprofilerate flags, as test binaries do, and write the profiles
+// before it exits, including when it is interrupted at the end of
+// opts.Duration.
+// If ctx is canceled the target is killed and the partial profiles are
+// removed.
+func CaptureMultiple(ctx context.Context, target string, opts CaptureOptions) error {
+	profiles, err := opts.profiles()
+	if err != nil {
+		return err
+	}
+
+	// Ensure target binary exists
+	if _, err := os.Stat(target); err != nil {
+		return fmt.Errorf("target binary not found: %w", err)
+	}
+
+	var args []string
+	for _, profile := range profiles {
+		args = append(args, profile.flag, profile.output)
+	}
+	if opts.MemProfileRate > 0 {
+		args = append(args, "-memprofilerate", strconv.Itoa(opts.MemProfileRate))
+	}
+	cmd, err := targetCommand(ctx, target, opts.Env, args...)
+	if err != nil {
+		return err
+	}
+	cmd.WaitDelay = killWaitDelay
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if opts.Duration > 0 {
+		logging.Infof("Profiling %s for %s: %d profiles in one run...\n", target, opts.Duration, len(profiles))
+	} else {
+		logging.Infof("Profiling %s until it exits: %d profiles in one run...\n", target, len(profiles))
+	}
+	// Profiles left by an earlier run are older than this
+	started := time.Now().Truncate(time.Second)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start target binary: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timeout <-chan time.Time
+	if opts.Duration > 0 {
+		timer := time.NewTimer(opts.Duration)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// Interrupt the process after the duration so it can write its
+	// profiles, and kill it if it takes too long
+	stopped := false
+	select {
+	case err = <-done:
+	case <-timeout:
+		stopped = true
+		cmd.Process.Signal(os.Interrupt)
+		grace := time.NewTimer(stopGracePeriod)
+		defer grace.Stop()
+		select {
+		case err = <-done:
+		case <-grace.C:
+			fmt.Fprintf(os.Stderr, "WARNING: %s did not exit within %s of the interrupt; killing it\n", target, stopGracePeriod)
+			cmd.Process.Kill()
+			err = <-done
+		}
+	case <-ctx.Done():
+		<-done
+		for _, profile := range profiles {
+			removePartial(profile.output)
+		}
+		return fmt.Errorf("profiling canceled: %w", ctx.Err())
+	}
+
+	// A target stopped at the end of the duration exits however it handles
+	// the interrupt
+	if err != nil && !stopped {
+		return fmt.Errorf("error running target binary: %w\nOutput: %s", err, output.Bytes())
+	}
+
+	saved := 0
+	for _, profile := range profiles {
+		if info, err := os.Stat(profile.output); err != nil || info.ModTime().Before(started) {
+			fmt.Fprintf(os.Stderr, "WARNING: %s wrote no %s profile to %s\n", target, strings.ToLower(profile.kind), profile.output)
+			continue
+		}
+		fmt.Printf("%s profile saved to %s\n", profile.kind, profile.output)
+		saved++
+	}
+	if saved == 0 {
+		return fmt.Errorf("%s wrote no profiles; it must accept the profile flags and write them before exiting\nOutput: %s", target, output.Bytes())
+	}
+	logging.Infoln("Use 'goforge profile visualize <profile>' to analyze a profile")
+
+	return nil
+}
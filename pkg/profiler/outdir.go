@@ -0,0 +1,239 @@
+package profiler
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"goforge/pkg/logging"
+
+	"github.com/google/pprof/profile"
+)
+
+// IndexFile is the name of the index page kept in a profile output directory.
+const IndexFile = "index.html"
+
+// captureTimeFormat is the timestamp layout used in captured profile names.
+const captureTimeFormat = "20060102-150405"
+
+// summaryTopFunctions is the number of functions listed per capture in the index.
+const summaryTopFunctions = 3
+
+// captureNameRe matches "<type>-<timestamp>[-N].pprof" capture file names.
+var captureNameRe = regexp.MustCompile(`^([a-z]+)-(\d{8}-\d{6})(?:-(\d+))?\.pprof$`)
+
+// Capture describes a profile stored in an output directory.
+type Capture struct {
+	File     string
+	Type     string
+	Captured time.Time
+	Summary  string
+	Top      []string
+
+	// seq orders captures taken within the same second
+	seq int
+}
+
+// indexTemplate renders the capture listing of an output directory.
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>GoForge Profiles</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 4px 12px; border-bottom: 1px solid #ddd; vertical-align: top; }
+code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>Profiles</h1>
+<p>Generated {{ .Generated.Format "2006-01-02 15:04:05" }}. Analyze a capture with <code>go tool pprof -http=:8080 &lt;file&gt;</code>.</p>
+<table>
+<tr><th>Captured</th><th>Type</th><th>File</th><th>Summary</th><th>Top functions</th></tr>
+{{- range .Captures }}
+<tr>
+<td>{{ .Captured.Format "2006-01-02 15:04:05" }}</td>
+<td>{{ .Type }}</td>
+<td><a href="{{ .File }}">{{ .File }}</a></td>
+<td>{{ .Summary }}</td>
+<td>{{ range .Top }}<code>{{ . }}</code><br>{{ end }}</td>
+</tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
+
+// NextCapturePath returns a new "<type>-<timestamp>.pprof" path in outDir,
+// creating the directory if needed. Existing captures are never reused.
+func NextCapturePath(outDir string, profileType string) (string, error) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	stamp := time.Now().Format(captureTimeFormat)
+	path := filepath.Join(outDir, fmt.Sprintf("%s-%s.pprof", profileType, stamp))
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path, nil
+		}
+		path = filepath.Join(outDir, fmt.Sprintf("%s-%s-%d.pprof", profileType, stamp, n))
+	}
+}
+
+// ListCaptures returns the captures in outDir, newest first.
+func ListCaptures(outDir string) ([]Capture, error) {
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output directory: %w", err)
+	}
+
+	var captures []Capture
+	for _, entry := range entries {
+		match := captureNameRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		captured, err := time.ParseInLocation(captureTimeFormat, match[2], time.Local)
+		if err != nil {
+			continue
+		}
+
+		seq, _ := strconv.Atoi(match[3])
+		captures = append(captures, Capture{
+			File:     entry.Name(),
+			Type:     match[1],
+			Captured: captured,
+			seq:      seq,
+		})
+	}
+
+	sort.Slice(captures, func(i, j int) bool {
+		if !captures[i].Captured.Equal(captures[j].Captured) {
+			return captures[i].Captured.After(captures[j].Captured)
+		}
+		return captures[i].seq > captures[j].seq
+	})
+
+	return captures, nil
+}
+
+// LatestCapture returns the newest capture of profileType in outDir.
+func LatestCapture(outDir string, profileType string) (string, error) {
+	captures, err := ListCaptures(outDir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, capture := range captures {
+		if capture.Type == profileType {
+			return filepath.Join(outDir, capture.File), nil
+		}
+	}
+
+	return "", fmt.Errorf("no %s profiles found in %s", profileType, outDir)
+}
+
+// WriteIndex regenerates the index page of outDir from its captures.
+func WriteIndex(outDir string) error {
+	captures, err := ListCaptures(outDir)
+	if err != nil {
+		return err
+	}
+
+	for i := range captures {
+		captures[i].Summary, captures[i].Top = summarizeProfile(filepath.Join(outDir, captures[i].File))
+	}
+
+	indexPath := filepath.Join(outDir, IndexFile)
+	file, err := os.Create(indexPath)
+	if err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	defer file.Close()
+
+	data := struct {
+		Generated time.Time
+		Captures  []Capture
+	}{time.Now(), captures}
+
+	if err := indexTemplate.Execute(file, data); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	logging.Infof("Updated index %s\n", indexPath)
+	return nil
+}
+
+// summarizeProfile describes a profile's total and its most expensive functions.
+func summarizeProfile(path string) (string, []string) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "unreadable: " + err.Error(), nil
+	}
+	defer file.Close()
+
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return "unreadable: " + err.Error(), nil
+	}
+	if len(prof.SampleType) == 0 {
+		return "empty profile", nil
+	}
+
+	// pprof shows the last sample type by default
+	index := len(prof.SampleType) - 1
+	sampleType := prof.SampleType[index]
+
+	var total int64
+	flat := make(map[string]int64)
+	for _, sample := range prof.Sample {
+		value := sample.Value[index]
+		total += value
+		if frames := sampleFrames(sample); len(frames) > 0 {
+			flat[frames[0]] += value
+		}
+	}
+
+	summary := fmt.Sprintf("%s: %s", sampleType.Type, formatSampleValue(total, sampleType.Unit))
+	if prof.DurationNanos > 0 {
+		summary += fmt.Sprintf(" over %s", time.Duration(prof.DurationNanos).Round(time.Millisecond))
+	}
+
+	var names []string
+	for name := range flat {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return flat[names[i]] > flat[names[j]] })
+	if len(names) > summaryTopFunctions {
+		names = names[:summaryTopFunctions]
+	}
+
+	var top []string
+	for _, name := range names {
+		top = append(top, fmt.Sprintf("%s %s", name, formatSampleValue(flat[name], sampleType.Unit)))
+	}
+
+	return summary, top
+}
+
+// formatSampleValue renders a sample value in its profile unit.
+func formatSampleValue(value int64, unit string) string {
+	switch strings.ToLower(unit) {
+	case "nanoseconds":
+		return time.Duration(value).String()
+	case "bytes":
+		return formatBytes(float64(value))
+	default:
+		return fmt.Sprintf("%d %s", value, unit)
+	}
+}
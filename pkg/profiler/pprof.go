@@ -0,0 +1,307 @@
+package profiler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+
+	"github.com/google/pprof/profile"
+)
+
+// unsymbolizedRe matches a pprof text row whose function name is a raw address.
+var unsymbolizedRe = regexp.MustCompile(`\s0x[0-9a-f]+\s*$`)
+
+// allocSampleFlags maps the allocation sample names to their pprof flags.
+var allocSampleFlags = map[string]string{
+	"space":   "-alloc_space",
+	"objects": "-alloc_objects",
+}
+
+// ValidAllocSample reports whether sample is "space" or "objects".
+func ValidAllocSample(sample string) bool {
+	_, ok := allocSampleFlags[sample]
+	return ok
+}
+
+// AllocHotspots prints the total allocations in a profile and the n functions
+// allocating the most bytes (sample "space") or objects (sample "objects").
+func AllocHotspots(ctx context.Context, profileFile string, binary string, sample string, n int) error {
+	flag, ok := allocSampleFlags[sample]
+	if !ok {
+		return fmt.Errorf("unknown sample %q (supported: space, objects)", sample)
+	}
+
+	binary, err := checkProfileAndBinary(profileFile, binary)
+	if err != nil {
+		return err
+	}
+
+	space, objects, err := allocTotals(profileFile)
+	if err != nil {
+		return err
+	}
+	fmt.Println("\nTotal Allocations:")
+	fmt.Printf("- Space: %s\n", formatBytes(float64(space)))
+	fmt.Printf("- Objects: %d\n", objects)
+
+	output, err := runPprof(ctx, binary, "-top", flag, "-nodecount="+strconv.Itoa(n), profileFile)
+	if err != nil {
+		return fmt.Errorf("failed to list allocation hot spots: %w", err)
+	}
+
+	fmt.Printf("\nAllocation Hot Spots (by %s):\n", sample)
+	fmt.Println(output)
+	warnUnsymbolized(output, binary)
+
+	return nil
+}
+
+// allocTotals sums the alloc_space and alloc_objects samples of a profile.
+func allocTotals(profileFile string) (int64, int64, error) {
+	file, err := os.Open(profileFile)
+	if err != nil {
+		return 0, 0, fmt.Errorf("profile file not found: %w", err)
+	}
+	defer file.Close()
+
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse profile: %w", err)
+	}
+
+	spaceIndex, objectsIndex := -1, -1
+	for i, sampleType := range prof.SampleType {
+		switch sampleType.Type {
+		case "alloc_space":
+			spaceIndex = i
+		case "alloc_objects":
+			objectsIndex = i
+		}
+	}
+	if spaceIndex < 0 || objectsIndex < 0 {
+		return 0, 0, fmt.Errorf("profile has no alloc_space/alloc_objects samples; is it an allocation profile?")
+	}
+
+	var space, objects int64
+	for _, sample := range prof.Sample {
+		space += sample.Value[spaceIndex]
+		objects += sample.Value[objectsIndex]
+	}
+	return space, objects, nil
+}
+
+// Top prints the n most expensive functions in a profile.
+func Top(ctx context.Context, profileFile string, binary string, n int) error {
+	logging.Infof("Top %d entries in %s...\n", n, profileFile)
+
+	binary, err := checkProfileAndBinary(profileFile, binary)
+	if err != nil {
+		return err
+	}
+
+	output, err := runPprof(ctx, binary, "-top", "-nodecount="+strconv.Itoa(n), profileFile)
+	if err != nil {
+		return fmt.Errorf("failed to list top entries: %w", err)
+	}
+
+	fmt.Println()
+	fmt.Println(output)
+	warnUnsymbolized(output, binary)
+
+	return nil
+}
+
+// List prints annotated source for functions matching a regular expression.
+func List(ctx context.Context, profileFile string, binary string, regex string) error {
+	logging.Infof("Listing functions matching %q in %s...\n", regex, profileFile)
+
+	binary, err := checkProfileAndBinary(profileFile, binary)
+	if err != nil {
+		return err
+	}
+
+	output, err := runPprof(ctx, binary, "-list", regex, profileFile)
+	if err != nil {
+		return fmt.Errorf("failed to list source: %w", err)
+	}
+
+	fmt.Println()
+	fmt.Println(output)
+	warnUnsymbolized(output, binary)
+
+	return nil
+}
+
+// Diff prints the difference between a base profile and a newer profile.
+func Diff(ctx context.Context, baseFile string, profileFile string, binary string) error {
+	logging.Infof("Comparing %s against base %s...\n", profileFile, baseFile)
+
+	if _, err := os.Stat(baseFile); err != nil {
+		return fmt.Errorf("base profile not found: %w", err)
+	}
+
+	binary, err := checkProfileAndBinary(profileFile, binary)
+	if err != nil {
+		return err
+	}
+
+	output, err := runPprof(ctx, binary, "-text", "-diff_base="+baseFile, profileFile)
+	if err != nil {
+		return fmt.Errorf("failed to diff profiles: %w", err)
+	}
+
+	fmt.Println()
+	fmt.Println(output)
+	warnUnsymbolized(output, binary)
+
+	return nil
+}
+
+// checkProfileAndBinary ensures the profile exists and resolves the binary to symbolize with.
+func checkProfileAndBinary(profileFile string, binary string) (string, error) {
+	if _, err := os.Stat(profileFile); err != nil {
+		return "", fmt.Errorf("profile file not found: %w", err)
+	}
+	return resolveBinary(profileFile, binary)
+}
+
+// resolveBinary validates an explicit binary, or detects the profiled binary from
+// the profile's main mapping when that file exists on this machine.
+func resolveBinary(profileFile string, binary string) (string, error) {
+	if binary != "" {
+		if _, err := os.Stat(binary); err != nil {
+			return "", fmt.Errorf("binary not found: %w", err)
+		}
+		return binary, nil
+	}
+
+	mapped := mainMappingFile(profileFile)
+	if mapped == "" {
+		return "", nil
+	}
+	if info, err := os.Stat(mapped); err == nil && !info.IsDir() {
+		logging.Infof("Using binary %s from the profile's mappings for symbolization\n", mapped)
+		return mapped, nil
+	}
+
+	return "", nil
+}
+
+// mainMappingFile returns the file of the first mapping recorded in a profile,
+// which is the profiled executable, or "" if it cannot be determined.
+func mainMappingFile(profileFile string) string {
+	file, err := os.Open(profileFile)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	prof, err := profile.Parse(file)
+	if err != nil || len(prof.Mapping) == 0 {
+		return ""
+	}
+	return prof.Mapping[0].File
+}
+
+// runPprof runs 'go tool pprof' with the given flags, appending the binary
+// before the profile arguments when one is set.
+func runPprof(ctx context.Context, binary string, args ...string) (string, error) {
+	output, err := proc.CommandContext(ctx, "go", pprofArgs(binary, args)...).CombinedOutput()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w\nOutput: %s", err, output)
+	}
+
+	return string(output), nil
+}
+
+// streamPprof runs 'go tool pprof' like runPprof but copies its output to w
+// line by line as it is produced. It returns the number of rows that could
+// not be symbolized.
+func streamPprof(ctx context.Context, w io.Writer, binary string, args ...string) (int, error) {
+	cmd := proc.CommandContext(ctx, "go", pprofArgs(binary, args)...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	unresolved := 0
+	reader := bufio.NewReader(stdout)
+	for {
+		line, readErr := reader.ReadString('\n')
+		if line != "" {
+			if unsymbolizedRe.MatchString(strings.TrimRight(line, "\n")) {
+				unresolved++
+			}
+			if _, err := io.WriteString(w, line); err != nil {
+				cmd.Process.Kill()
+				cmd.Wait()
+				return unresolved, err
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return unresolved, ctx.Err()
+	}
+	if err != nil {
+		return unresolved, fmt.Errorf("%w\nOutput: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return unresolved, nil
+}
+
+// pprofArgs returns the arguments of 'go tool pprof' for flags followed by a
+// profile file, with the binary inserted before the profile.
+func pprofArgs(binary string, args []string) []string {
+	// The profile file is always the final argument
+	pprofArgs := append([]string{"tool", "pprof"}, args[:len(args)-1]...)
+	if binary != "" {
+		pprofArgs = append(pprofArgs, binary)
+	}
+	return append(pprofArgs, args[len(args)-1])
+}
+
+// warnUnsymbolized prints guidance when pprof output contains raw addresses.
+func warnUnsymbolized(output string, binary string) {
+	unresolved := 0
+	for _, line := range strings.Split(output, "\n") {
+		if unsymbolizedRe.MatchString(line) {
+			unresolved++
+		}
+	}
+	reportUnsymbolized(unresolved, binary)
+}
+
+// reportUnsymbolized prints guidance when unresolved rows were shown as raw
+// addresses.
+func reportUnsymbolized(unresolved int, binary string) {
+	if unresolved == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\nWARNING: %d entries could not be symbolized and are shown as raw addresses.\n", unresolved)
+	if binary == "" {
+		fmt.Fprintln(os.Stderr, "Pass the profiled executable with --binary <path> so pprof can resolve symbols.")
+	} else {
+		fmt.Fprintf(os.Stderr, "Make sure %s is the exact (unstripped) build that produced the profile.\n", binary)
+	}
+}
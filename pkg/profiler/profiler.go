@@ -1,16 +1,31 @@
+// Package profiler captures CPU, memory, allocation, and execution trace
+// profiles of Go programs, local or in Kubernetes pods, and reports on them
+// with go tool pprof. It also compares benchmarks across git refs.
 package profiler
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
+
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+	"goforge/pkg/safewrite"
 )
 
+// killWaitDelay bounds how long a killed target's I/O may keep a capture waiting.
+const killWaitDelay = 2 * time.Second
+
 // CPUProfile profiles CPU usage of a Go binary.
-func CPUProfile(target string, outputFile string, duration int) error {
-	fmt.Printf("Profiling CPU usage of %s for %d seconds...\n", target, duration)
+// If ctx is canceled the target is killed and the partial profile is removed.
+func CPUProfile(ctx context.Context, target string, outputFile string, duration int, env []string) error {
+	logging.Infof("Profiling CPU usage of %s for %d seconds...\n", target, duration)
 
 	// Ensure target binary exists
 	_, err := os.Stat(target)
@@ -23,9 +38,16 @@ func CPUProfile(target string, outputFile string, duration int) error {
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path for output: %w", err)
 	}
+	if err := safewrite.CreateDir(absOutput); err != nil {
+		return err
+	}
 
 	// Run the binary with CPU profiling enabled
-	cmd := exec.Command(target, "-cpuprofile", absOutput)
+	cmd, err := targetCommand(ctx, target, env, "-cpuprofile", absOutput)
+	if err != nil {
+		return err
+	}
+	cmd.WaitDelay = killWaitDelay
 
 	// Start the process
 	err = cmd.Start()
@@ -33,28 +55,57 @@ func CPUProfile(target string, outputFile string, duration int) error {
 		return fmt.Errorf("failed to start target binary: %w", err)
 	}
 
-	// Kill the process after the specified duration
+	done := make(chan error, 1)
 	go func() {
-		time.Sleep(time.Duration(duration) * time.Second)
-		cmd.Process.Kill()
+		done <- cmd.Wait()
 	}()
 
-	// Wait for the process to complete
-	err = cmd.Wait()
+	timer := time.NewTimer(time.Duration(duration) * time.Second)
+	defer timer.Stop()
+
+	// Kill the process after the specified duration, or as soon as ctx is done
+	select {
+	case err = <-done:
+	case <-timer.C:
+		cmd.Process.Kill()
+		err = <-done
+	case <-ctx.Done():
+		<-done
+		removePartial(absOutput)
+		return fmt.Errorf("CPU profiling canceled: %w", ctx.Err())
+	}
+
 	if err != nil && err.Error() != "signal: killed" {
 		return fmt.Errorf("error running target binary: %w", err)
 	}
 
 	fmt.Printf("CPU profile saved to %s\n", absOutput)
-	fmt.Println("Use 'goforge profile visualize " + absOutput + "' to analyze the profile")
+	logging.Infoln("Use 'goforge profile visualize " + absOutput + "' to analyze the profile")
 
 	return nil
 }
 
 // MemoryProfile profiles memory usage of a Go binary.
-func MemoryProfile(target string, outputFile string) error {
-	fmt.Printf("Profiling memory usage of %s...\n", target)
+// If ctx is canceled the target is killed and the partial profile is removed.
+func MemoryProfile(ctx context.Context, target string, outputFile string, env []string) error {
+	logging.Infof("Profiling memory usage of %s...\n", target)
 
+	return captureMemProfile(ctx, target, outputFile, env, "Memory")
+}
+
+// AllocProfile records every allocation a Go binary makes, not only the
+// memory still in use when it exits.
+// If ctx is canceled the target is killed and the partial profile is removed.
+func AllocProfile(ctx context.Context, target string, outputFile string, env []string) error {
+	logging.Infof("Profiling allocations of %s...\n", target)
+
+	// The -memprofile output carries alloc_space and alloc_objects alongside
+	// the in-use samples
+	return captureMemProfile(ctx, target, outputFile, env, "Allocation")
+}
+
+// captureMemProfile runs the target with -memprofile until it exits.
+func captureMemProfile(ctx context.Context, target string, outputFile string, env []string, kind string) error {
 	// Ensure target binary exists
 	_, err := os.Stat(target)
 	if err != nil {
@@ -66,47 +117,115 @@ func MemoryProfile(target string, outputFile string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path for output: %w", err)
 	}
+	if err := safewrite.CreateDir(absOutput); err != nil {
+		return err
+	}
 
 	// Run the binary with memory profiling enabled
-	cmd := exec.Command(target, "-memprofile", absOutput)
+	cmd, err := targetCommand(ctx, target, env, "-memprofile", absOutput)
+	if err != nil {
+		return err
+	}
+	// Don't let children that inherited the output pipe block a canceled capture
+	cmd.WaitDelay = killWaitDelay
 	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		removePartial(absOutput)
+		return fmt.Errorf("%s profiling canceled: %w", strings.ToLower(kind), ctx.Err())
+	}
 	if err != nil {
-		return fmt.Errorf("failed to run memory profile: %w\nOutput: %s", err, output)
+		return fmt.Errorf("failed to run %s profile: %w\nOutput: %s", strings.ToLower(kind), err, output)
 	}
 
-	fmt.Printf("Memory profile saved to %s\n", absOutput)
-	fmt.Println("Use 'goforge profile visualize " + absOutput + "' to analyze the profile")
+	fmt.Printf("%s profile saved to %s\n", kind, absOutput)
+	logging.Infoln("Use 'goforge profile visualize " + absOutput + "' to analyze the profile")
 
 	return nil
 }
 
-// Visualize displays a profile in a human-readable format.
-func Visualize(profileFile string) error {
-	fmt.Printf("Visualizing profile %s...\n", profileFile)
+// VisualizeOptions configures Visualize.
+type VisualizeOptions struct {
+	// Binary, when given, is passed to pprof for symbolization.
+	Binary string
+	// Type picks the capture when the profile is an output directory.
+	Type string
+	// NodeCount limits the output to the top entries; 0 shows all.
+	NodeCount int
+}
+
+// Visualize writes a profile to w in a human-readable format. pprof's output
+// is streamed line by line, so large profiles do not have to fit in memory.
+// If profileFile is an output directory, its latest capture of opts.Type is
+// shown.
+func Visualize(ctx context.Context, w io.Writer, profileFile string, opts VisualizeOptions) error {
+	if opts.NodeCount < 0 {
+		return fmt.Errorf("node count cannot be negative")
+	}
 
 	// Ensure profile file exists
-	_, err := os.Stat(profileFile)
+	info, err := os.Stat(profileFile)
 	if err != nil {
 		return fmt.Errorf("profile file not found: %w", err)
 	}
+	if info.IsDir() {
+		profileFile, err = LatestCapture(profileFile, opts.Type)
+		if err != nil {
+			return err
+		}
+	}
 
-	// Use 'go tool pprof' to generate a visualization
-	// Here we'll use the text output, but in a real implementation we could
-	// generate graphical visualizations (SVG, PDF, etc.)
-	cmd := exec.Command("go", "tool", "pprof", "-text", profileFile)
-	output, err := cmd.CombinedOutput()
+	logging.Infof("Visualizing profile %s...\n", profileFile)
+
+	binary, err := resolveBinary(profileFile, opts.Binary)
 	if err != nil {
-		return fmt.Errorf("failed to visualize profile: %w", err)
+		return err
+	}
+
+	args := []string{"-text"}
+	if opts.NodeCount > 0 {
+		args = append(args, "-nodecount="+strconv.Itoa(opts.NodeCount))
 	}
 
 	// Display the profile information
-	fmt.Println("\nProfile Analysis:")
-	fmt.Println(string(output))
+	fmt.Fprintln(w, "\nProfile Analysis:")
+	unresolved, err := streamPprof(ctx, w, binary, append(args, profileFile)...)
+	if err != nil {
+		return fmt.Errorf("failed to visualize profile: %w", err)
+	}
+	reportUnsymbolized(unresolved, binary)
 
 	// In a real implementation, we could also offer to open a web browser with
 	// the interactive pprof interface
-	fmt.Println("\nTip: For more detailed analysis, run:")
-	fmt.Printf("go tool pprof -http=:8080 %s\n", profileFile)
+	logging.Infoln("\nTip: For more detailed analysis, run:")
+	if binary != "" {
+		logging.Infof("go tool pprof -http=:8080 %s %s\n", binary, profileFile)
+	} else {
+		logging.Infof("go tool pprof -http=:8080 %s\n", profileFile)
+	}
 
 	return nil
 }
+
+// targetCommand builds the command that runs the profiled binary with extra
+// KEY=VALUE environment variables added to the current environment.
+func targetCommand(ctx context.Context, target string, env []string, args ...string) (*exec.Cmd, error) {
+	for _, pair := range env {
+		if name, _, ok := strings.Cut(pair, "="); !ok || name == "" {
+			return nil, fmt.Errorf("invalid environment variable %q (expected KEY=VALUE)", pair)
+		}
+	}
+
+	cmd := proc.CommandContext(ctx, target, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	return cmd, nil
+}
+
+// removePartial deletes an output file left behind by an interrupted capture.
+func removePartial(path string) {
+	if err := os.Remove(path); err == nil {
+		fmt.Printf("Removed partial output %s\n", path)
+	}
+}
@@ -0,0 +1,125 @@
+//go:build unix
+
+package profiler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// captureDeadline is how long a canceled capture may take to return; the
+// target itself sleeps for an hour.
+const captureDeadline = 5 * time.Second
+
+// buildSleeper builds testdata/sleeper, a target that creates its profile
+// and sleeps, and returns the binary's path.
+func buildSleeper(t *testing.T) string {
+	t.Helper()
+	binary := filepath.Join(t.TempDir(), "sleeper")
+	if output, err := exec.Command("go", "build", "-o", binary, "./testdata/sleeper").CombinedOutput(); err != nil {
+		t.Fatalf("failed to build the sleeper: %v\n%s", err, output)
+	}
+	return binary
+}
+
+// waitForPID waits until the sleeper has written its process ID to pidFile.
+func waitForPID(t *testing.T, pidFile string) int {
+	t.Helper()
+	deadline := time.Now().Add(captureDeadline)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(pidFile); err == nil && len(data) > 0 {
+			pid, err := strconv.Atoi(string(data))
+			if err != nil {
+				t.Fatalf("invalid pid %q: %v", data, err)
+			}
+			return pid
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the sleeper did not start")
+	return 0
+}
+
+func TestCaptureCancellation(t *testing.T) {
+	sleeper := buildSleeper(t)
+
+	captures := []struct {
+		name    string
+		capture func(ctx context.Context, output string, env []string) error
+	}{
+		{"cpu", func(ctx context.Context, output string, env []string) error {
+			return CPUProfile(ctx, sleeper, output, 3600, env)
+		}},
+		{"memory", func(ctx context.Context, output string, env []string) error {
+			return MemoryProfile(ctx, sleeper, output, env)
+		}},
+		{"alloc", func(ctx context.Context, output string, env []string) error {
+			return AllocProfile(ctx, sleeper, output, env)
+		}},
+	}
+	// A zero timeout cancels the context once the target runs; --timeout
+	// cancels it when the deadline of the run passes
+	stops := []struct {
+		name    string
+		timeout time.Duration
+		err     error
+	}{
+		{"cancel", 0, context.Canceled},
+		{"timeout", 500 * time.Millisecond, context.DeadlineExceeded},
+	}
+
+	for _, capture := range captures {
+		for _, stop := range stops {
+			t.Run(capture.name+"/"+stop.name, func(t *testing.T) {
+				dir := t.TempDir()
+				output := filepath.Join(dir, "out", capture.name+".pprof")
+				pidFile := filepath.Join(dir, "pid")
+
+				ctx, cancel := context.WithCancel(context.Background())
+				if stop.timeout > 0 {
+					cancel()
+					ctx, cancel = context.WithTimeout(context.Background(), stop.timeout)
+				}
+				defer cancel()
+
+				errs := make(chan error, 1)
+				go func() {
+					errs <- capture.capture(ctx, output, []string{"SLEEPER_PID_FILE=" + pidFile})
+				}()
+				pid := waitForPID(t, pidFile)
+				if stop.timeout == 0 {
+					cancel()
+				}
+				stopped := time.Now()
+
+				select {
+				case err := <-errs:
+					if !errors.Is(err, stop.err) {
+						t.Errorf("err = %v, want %v", err, stop.err)
+					}
+				case <-time.After(captureDeadline + stop.timeout):
+					syscall.Kill(pid, syscall.SIGKILL)
+					t.Fatalf("capture did not return %s after it was stopped", captureDeadline)
+				}
+				if elapsed := time.Since(stopped); elapsed > captureDeadline+stop.timeout {
+					t.Errorf("capture took %s to return", elapsed)
+				}
+
+				if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+					syscall.Kill(pid, syscall.SIGKILL)
+					t.Errorf("target %d still runs after the capture returned (kill: %v)", pid, err)
+				}
+				if _, err := os.Stat(output); !os.IsNotExist(err) {
+					t.Errorf("partial output %s was not removed (stat: %v)", output, err)
+				}
+			})
+		}
+	}
+}
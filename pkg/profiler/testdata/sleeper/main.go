@@ -0,0 +1,27 @@
+// Command sleeper stands in for a slow profiling target: it creates the
+// profile file it is asked for, records its process ID, and sleeps until it
+// is killed.
+package main
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"time"
+)
+
+func main() {
+	cpuProfile := flag.String("cpuprofile", "", "")
+	memProfile := flag.String("memprofile", "", "")
+	flag.Parse()
+
+	for _, output := range []string{*cpuProfile, *memProfile} {
+		if output != "" {
+			os.WriteFile(output, []byte("partial"), 0644)
+		}
+	}
+	if pidFile := os.Getenv("SLEEPER_PID_FILE"); pidFile != "" {
+		os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644)
+	}
+	time.Sleep(time.Hour)
+}
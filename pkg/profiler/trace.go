@@ -0,0 +1,353 @@
+//go:build go1.21
+
+package profiler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"goforge/pkg/logging"
+
+	"golang.org/x/exp/trace"
+)
+
+// creationStackDepth is the number of frames used to identify where goroutines were created.
+const creationStackDepth = 3
+
+// unknownCreator groups goroutines that already existed when tracing started.
+const unknownCreator = "(created before trace start)"
+
+// TraceReport summarizes goroutine, GC, and scheduler behavior in an execution trace.
+type TraceReport struct {
+	Duration          time.Duration     `json:"duration_ns"`
+	PeakGoroutines    int               `json:"peak_goroutines"`
+	AverageGoroutines float64           `json:"average_goroutines"`
+	BlockThreshold    time.Duration     `json:"block_threshold_ns"`
+	BlockedGroups     []BlockedGroup    `json:"blocked_groups"`
+	GCCycles          int               `json:"gc_cycles"`
+	GCPauseTotal      time.Duration     `json:"gc_pause_total_ns"`
+	GCPauseMax        time.Duration     `json:"gc_pause_max_ns"`
+	Procs             []ProcUtilization `json:"procs"`
+}
+
+// BlockedGroup aggregates long blocking events of goroutines with the same creation stack.
+type BlockedGroup struct {
+	CreationStack string        `json:"creation_stack"`
+	Goroutines    int           `json:"goroutines"`
+	Events        int           `json:"events"`
+	Total         time.Duration `json:"total_ns"`
+	Max           time.Duration `json:"max_ns"`
+	Reasons       []string      `json:"reasons"`
+}
+
+// ProcUtilization reports how much of the trace a proc (P) spent running goroutines.
+type ProcUtilization struct {
+	Proc        int64         `json:"proc"`
+	Busy        time.Duration `json:"busy_ns"`
+	Utilization float64       `json:"utilization_percent"`
+}
+
+// traceState tracks in-flight intervals while events are replayed.
+type traceState struct {
+	alive        map[trace.GoID]bool
+	creator      map[trace.GoID]string
+	blockedSince map[trace.GoID]trace.Time
+	blockReason  map[trace.GoID]string
+	runningSince map[trace.GoID]trace.Time
+	runningOn    map[trace.GoID]trace.ProcID
+	ranges       map[string]trace.Time
+	groups       map[string]*BlockedGroup
+	groupGs      map[string]map[trace.GoID]bool
+	procBusy     map[trace.ProcID]time.Duration
+}
+
+// TraceReportFile parses an execution trace and prints a goroutine and GC report.
+// Goroutines blocked for longer than blockThreshold are grouped by creation stack.
+func TraceReportFile(ctx context.Context, traceFile string, blockThreshold time.Duration, jsonOutput bool) error {
+	if !jsonOutput {
+		logging.Infof("Analyzing execution trace %s...\n", traceFile)
+	}
+
+	file, err := os.Open(traceFile)
+	if err != nil {
+		return fmt.Errorf("trace file not found: %w", err)
+	}
+	defer file.Close()
+
+	report, err := AnalyzeTrace(ctx, bufio.NewReader(file), blockThreshold)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	printTraceReport(report)
+	return nil
+}
+
+// AnalyzeTrace replays the events of an execution trace and builds a report.
+func AnalyzeTrace(ctx context.Context, r io.Reader, blockThreshold time.Duration) (*TraceReport, error) {
+	reader, err := trace.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace (traces from Go 1.11 through 1.26 are supported): %w", err)
+	}
+
+	state := &traceState{
+		alive:        make(map[trace.GoID]bool),
+		creator:      make(map[trace.GoID]string),
+		blockedSince: make(map[trace.GoID]trace.Time),
+		blockReason:  make(map[trace.GoID]string),
+		runningSince: make(map[trace.GoID]trace.Time),
+		runningOn:    make(map[trace.GoID]trace.ProcID),
+		ranges:       make(map[string]trace.Time),
+		groups:       make(map[string]*BlockedGroup),
+		groupGs:      make(map[string]map[trace.GoID]bool),
+		procBusy:     make(map[trace.ProcID]time.Duration),
+	}
+	report := &TraceReport{BlockThreshold: blockThreshold}
+
+	var start, last trace.Time
+	var goroutineArea float64
+	first := true
+
+	for n := 0; ; n++ {
+		if n%10000 == 0 && ctx.Err() != nil {
+			return nil, fmt.Errorf("trace analysis canceled: %w", ctx.Err())
+		}
+
+		event, err := reader.ReadEvent()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trace event: %w", err)
+		}
+
+		now := event.Time()
+		if first {
+			start, last = now, now
+			first = false
+		}
+
+		// Integrate the goroutine count over time for the average
+		if now > last {
+			goroutineArea += float64(len(state.alive)) * float64(now.Sub(last))
+			last = now
+		}
+
+		switch event.Kind() {
+		case trace.EventStateTransition:
+			state.handleTransition(event, report)
+		case trace.EventRangeBegin:
+			state.ranges[rangeKey(event)] = now
+			if event.Range().Name == "GC concurrent mark phase" {
+				report.GCCycles++
+			}
+		case trace.EventRangeEnd:
+			key := rangeKey(event)
+			began, ok := state.ranges[key]
+			if !ok {
+				continue
+			}
+			delete(state.ranges, key)
+
+			// Stop-the-world phases of the collector are the GC pauses
+			name := event.Range().Name
+			if strings.HasPrefix(name, "stop-the-world") && strings.Contains(name, "GC") {
+				pause := now.Sub(began)
+				report.GCPauseTotal += pause
+				if pause > report.GCPauseMax {
+					report.GCPauseMax = pause
+				}
+			}
+		}
+
+		if count := len(state.alive); count > report.PeakGoroutines {
+			report.PeakGoroutines = count
+		}
+	}
+
+	report.Duration = last.Sub(start)
+	if report.Duration > 0 {
+		report.AverageGoroutines = goroutineArea / float64(report.Duration)
+	}
+
+	// Close goroutines still running when the trace ended
+	for goID, since := range state.runningSince {
+		state.procBusy[state.runningOn[goID]] += last.Sub(since)
+	}
+
+	for proc, busy := range state.procBusy {
+		util := ProcUtilization{Proc: int64(proc), Busy: busy}
+		if report.Duration > 0 {
+			util.Utilization = float64(busy) / float64(report.Duration) * 100
+		}
+		report.Procs = append(report.Procs, util)
+	}
+	sort.Slice(report.Procs, func(i, j int) bool { return report.Procs[i].Proc < report.Procs[j].Proc })
+
+	for key, group := range state.groups {
+		group.Goroutines = len(state.groupGs[key])
+		sort.Strings(group.Reasons)
+		report.BlockedGroups = append(report.BlockedGroups, *group)
+	}
+	sort.Slice(report.BlockedGroups, func(i, j int) bool {
+		return report.BlockedGroups[i].Total > report.BlockedGroups[j].Total
+	})
+
+	return report, nil
+}
+
+// handleTransition updates goroutine liveness, blocking, and running intervals.
+func (s *traceState) handleTransition(event trace.Event, report *TraceReport) {
+	transition := event.StateTransition()
+	if transition.Resource.Kind != trace.ResourceGoroutine {
+		return
+	}
+
+	goID := transition.Resource.Goroutine()
+	from, to := transition.Goroutine()
+	now := event.Time()
+
+	// Track liveness and remember who created each goroutine
+	if to == trace.GoNotExist {
+		delete(s.alive, goID)
+	} else {
+		s.alive[goID] = true
+	}
+	if from == trace.GoNotExist && to != trace.GoNotExist {
+		s.creator[goID] = formatStack(event.Stack())
+	}
+
+	// Running intervals are attributed to the proc the goroutine ran on
+	if from == trace.GoRunning {
+		if since, ok := s.runningSince[goID]; ok {
+			s.procBusy[s.runningOn[goID]] += now.Sub(since)
+			delete(s.runningSince, goID)
+		}
+	}
+	if to == trace.GoRunning && event.Proc() != trace.NoProc {
+		s.runningSince[goID] = now
+		s.runningOn[goID] = event.Proc()
+	}
+
+	// Blocking intervals
+	if to == trace.GoWaiting {
+		s.blockedSince[goID] = now
+		s.blockReason[goID] = transition.Reason
+	}
+	if from == trace.GoWaiting {
+		since, ok := s.blockedSince[goID]
+		if !ok {
+			return
+		}
+		delete(s.blockedSince, goID)
+
+		blocked := now.Sub(since)
+		if blocked <= report.BlockThreshold {
+			return
+		}
+
+		key, ok := s.creator[goID]
+		if !ok || key == "" {
+			key = unknownCreator
+		}
+		group, ok := s.groups[key]
+		if !ok {
+			group = &BlockedGroup{CreationStack: key}
+			s.groups[key] = group
+			s.groupGs[key] = make(map[trace.GoID]bool)
+		}
+
+		group.Events++
+		group.Total += blocked
+		if blocked > group.Max {
+			group.Max = blocked
+		}
+		s.groupGs[key][goID] = true
+
+		reason := s.blockReason[goID]
+		if reason == "" {
+			reason = "unknown"
+		}
+		if !containsString(group.Reasons, reason) {
+			group.Reasons = append(group.Reasons, reason)
+		}
+	}
+}
+
+// rangeKey identifies a range by name and the resource it is scoped to.
+func rangeKey(event trace.Event) string {
+	r := event.Range()
+	switch r.Scope.Kind {
+	case trace.ResourceGoroutine:
+		return fmt.Sprintf("%s|g%d", r.Name, event.Goroutine())
+	case trace.ResourceProc:
+		return fmt.Sprintf("%s|p%d", r.Name, event.Proc())
+	default:
+		return r.Name
+	}
+}
+
+// formatStack renders the top frames of a stack as a single line.
+func formatStack(stack trace.Stack) string {
+	var frames []string
+	stack.Frames(func(frame trace.StackFrame) bool {
+		frames = append(frames, fmt.Sprintf("%s (%s:%d)", frame.Func, frame.File, frame.Line))
+		return len(frames) < creationStackDepth
+	})
+	return strings.Join(frames, " <- ")
+}
+
+// containsString reports whether values contains s.
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// printTraceReport prints the trace report in a human-readable format.
+func printTraceReport(report *TraceReport) {
+	fmt.Println("\nTrace Summary:")
+	fmt.Printf("- Duration: %s\n", report.Duration)
+	fmt.Printf("- Goroutines: peak %d, average %.1f\n", report.PeakGoroutines, report.AverageGoroutines)
+
+	fmt.Println("\nGarbage Collection:")
+	fmt.Printf("- GC cycles: %d\n", report.GCCycles)
+	fmt.Printf("- Total GC pause: %s\n", report.GCPauseTotal)
+	fmt.Printf("- Longest GC pause: %s\n", report.GCPauseMax)
+
+	fmt.Printf("\nGoroutines Blocked Longer Than %s:\n", report.BlockThreshold)
+	if len(report.BlockedGroups) == 0 {
+		fmt.Println("- None")
+	}
+	for _, group := range report.BlockedGroups {
+		fmt.Printf("- %d goroutines, %d events, total %s, max %s (%s)\n",
+			group.Goroutines, group.Events, group.Total, group.Max, strings.Join(group.Reasons, ", "))
+		fmt.Printf("    created at: %s\n", group.CreationStack)
+	}
+
+	fmt.Println("\nProc Utilization:")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "proc\tbusy\tutilization\t")
+	for _, proc := range report.Procs {
+		fmt.Fprintf(tw, "P%d\t%s\t%.1f%%\t\n", proc.Proc, proc.Busy, proc.Utilization)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,15 @@
+//go:build !go1.21
+
+package profiler
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TraceReportFile needs the execution trace parser of golang.org/x/exp/trace,
+// which builds with Go 1.21 or newer.
+func TraceReportFile(ctx context.Context, traceFile string, blockThreshold time.Duration, jsonOutput bool) error {
+	return errors.New("trace reports need GoForge built with Go 1.21 or newer")
+}
@@ -0,0 +1,245 @@
+package safewrite
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// UnifiedDiff returns a unified diff of two versions of the file name, or
+// an empty string when they are equal.
+func UnifiedDiff(name string, before []byte, after []byte) string {
+	ops := diffLines(splitLines(string(before)), splitLines(string(after)))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", name, name)
+	hunks := 0
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Grow the hunk until the changes are more than two contexts apart
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				end += diffContext
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = next
+		}
+
+		writeHunk(&b, ops, start, end)
+		hunks++
+		i = end
+	}
+
+	if hunks == 0 {
+		return ""
+	}
+	return b.String()
+}
+
+// writeHunk writes ops[start:end] with its @@ header.
+func writeHunk(b *strings.Builder, ops []diffOp, start int, end int) {
+	// Line numbers of the hunk's first line in each version
+	oldLine, newLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			oldLine++
+		}
+		if op.kind != '-' {
+			newLine++
+		}
+	}
+
+	oldCount, newCount := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+
+	// An empty side starts before its first line, as in "@@ -0,0 +1,3 @@"
+	if oldCount == 0 {
+		oldLine--
+	}
+	if newCount == 0 {
+		newLine--
+	}
+	fmt.Fprintf(b, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+	for _, op := range ops[start:end] {
+		fmt.Fprintf(b, "%c%s\n", op.kind, op.line)
+	}
+}
+
+// diffLines returns an edit script turning a into b with the linear-space
+// variant of Myers' algorithm, so large files need memory proportional to
+// their length rather than to the product of their lengths.
+func diffLines(a []string, b []string) []diffOp {
+	return appendDiff(make([]diffOp, 0, len(a)+len(b)), a, b)
+}
+
+// appendDiff appends an edit script turning a into b to ops. After trimming
+// the common prefix and suffix, it splits both at a point on the middle of
+// a shortest edit script and diffs the halves.
+func appendDiff(ops []diffOp, a []string, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if x, y, ok := middlePoint(midA, midB); ok {
+		ops = appendDiff(ops, midA[:x], midB[:y])
+		ops = appendDiff(ops, midA[x:], midB[y:])
+	} else {
+		for _, line := range midA {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range midB {
+			ops = append(ops, diffOp{'+', line})
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// middlePoint returns where the shortest edit script turning a into b
+// crosses its middle, found by searching forward from the start and
+// backward from the end at once until the two searches overlap. It is false
+// when a or b is empty, or when the point would not split them into two
+// smaller problems, in which case every line changes.
+func middlePoint(a []string, b []string) (x int, y int, ok bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+
+	// forward[offset+k] is how far along a the furthest forward path on
+	// diagonal k = x-y reaches; backward is the same for the backward
+	// search, measured from the ends. -1 marks diagonals not reached yet.
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	forward := make([]int, 2*maxD+1)
+	backward := make([]int, 2*maxD+1)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	// The searches meet on a forward step when the lengths differ by an
+	// odd number of lines, and on a backward step otherwise
+	delta := n - m
+	odd := delta%2 != 0
+	split := func(x, y int) (int, int, bool) {
+		return x, y, x+y > 0 && x+y < n+m
+	}
+
+	// Diagonals trimmed from either end once their paths leave the grid
+	fwdStart, fwdEnd, bwdStart, bwdEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + fwdStart; k <= d-fwdEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -d || (k != d && forward[i-1] < forward[i+1]) {
+				x = forward[i+1]
+			} else {
+				x = forward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[i] = x
+
+			switch {
+			case x > n:
+				fwdEnd += 2
+			case y > m:
+				fwdStart += 2
+			case odd:
+				j := offset + delta - k
+				if j >= 0 && j < len(backward) && backward[j] != -1 && x >= n-backward[j] {
+					return split(x, y)
+				}
+			}
+		}
+
+		for k := -d + bwdStart; k <= d-bwdEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -d || (k != d && backward[i-1] < backward[i+1]) {
+				x = backward[i+1]
+			} else {
+				x = backward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[i] = x
+
+			switch {
+			case x > n:
+				bwdEnd += 2
+			case y > m:
+				bwdStart += 2
+			case !odd:
+				j := offset + delta - k
+				if j >= 0 && j < len(forward) && forward[j] != -1 && forward[j] >= n-x {
+					return split(forward[j], forward[j]-(j-offset))
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// splitLines splits text into lines without their newlines.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,107 @@
+package safewrite
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// lcsLength returns the length of the longest common subsequence of a and b.
+func lcsLength(a []string, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		next := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				next[j+1] = prev[j] + 1
+			case prev[j+1] >= next[j]:
+				next[j+1] = prev[j+1]
+			default:
+				next[j+1] = next[j]
+			}
+		}
+		prev = next
+	}
+	return prev[len(b)]
+}
+
+// checkScript fails the test unless ops turns a into b with as few changes
+// as possible.
+func checkScript(t *testing.T, a []string, b []string, ops []diffOp) {
+	t.Helper()
+	var before, after []string
+	kept := 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			before = append(before, op.line)
+		}
+		if op.kind != '-' {
+			after = append(after, op.line)
+		}
+		if op.kind == ' ' {
+			kept++
+		}
+	}
+	if strings.Join(before, "\n") != strings.Join(a, "\n") || strings.Join(after, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("the script does not turn %q into %q: %q", a, b, ops)
+	}
+	if want := lcsLength(a, b); kept != want {
+		t.Fatalf("the script keeps %d lines of %q and %q, want %d", kept, a, b, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"", ""},
+		{"", "a b"},
+		{"a b", ""},
+		{"a b c", "a b c"},
+		{"a b c", "a x c"},
+		{"a b c a b b a", "c b a b a c"},
+		{"x", "y"},
+		{"a a a", "a"},
+		{"a b", "b a"},
+	}
+	for _, tt := range tests {
+		a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+		checkScript(t, a, b, diffLines(a, b))
+	}
+
+	// Small alphabets give many equal lines and many shortest scripts
+	random := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		lines := make([]string, random.Intn(20))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := lines(), lines()
+		checkScript(t, a, b, diffLines(a, b))
+	}
+}
+
+func TestUnifiedDiffLargeFile(t *testing.T) {
+	var before, after strings.Builder
+	for i := 0; i < 200000; i++ {
+		fmt.Fprintf(&before, "line %d\n", i)
+		if i%1000 == 0 {
+			fmt.Fprintf(&after, "changed %d\n", i)
+			continue
+		}
+		fmt.Fprintf(&after, "line %d\n", i)
+	}
+
+	diff := UnifiedDiff("big.txt", []byte(before.String()), []byte(after.String()))
+	if got := strings.Count(diff, "@@ -"); got != 200 {
+		t.Errorf("got %d hunks, want 200", got)
+	}
+	if got := strings.Count(diff, "\n-line "); got != 200 {
+		t.Errorf("got %d removed lines, want 200", got)
+	}
+}
@@ -0,0 +1,238 @@
+// Package safewrite writes generated files without destroying existing ones:
+// a file that already exists is only replaced with Force, and Diff shows how
+// the files would change without writing anything. The global --dry-run
+// previews every generator's files instead of writing them, and a Collector
+// keeps them in memory for callers that return them.
+package safewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"goforge/pkg/logging"
+)
+
+var dryRun atomic.Bool
+
+// SetDryRun turns the preview of generated files on or off for every
+// Write.
+func SetDryRun(d bool) {
+	dryRun.Store(d)
+}
+
+// DryRun reports whether generated files are previewed instead of written.
+func DryRun() bool {
+	return dryRun.Load()
+}
+
+// Options controls how generated files treat existing ones.
+type Options struct {
+	// Force overwrites existing files.
+	Force bool
+	// Diff prints a unified diff of every file against its current content
+	// instead of writing it.
+	Diff bool
+	// Collect, when set, keeps the files in memory instead of writing them,
+	// whatever exists on disk.
+	Collect *Collector
+}
+
+// File is a generated file waiting to be written.
+type File struct {
+	Path string
+	Data []byte
+}
+
+// Check returns an error for the first path that exists, unless existing
+// files may be overwritten or are only compared or previewed.
+func (o Options) Check(paths ...string) error {
+	if o.Force || o.Diff || o.Collect != nil || DryRun() {
+		return nil
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists (use --force to overwrite it, or --diff to compare)", path)
+		}
+	}
+	return nil
+}
+
+// Write writes files, creating their directories. All of them are checked
+// first, so nothing is written when any would be refused. In diff mode it
+// prints the diffs instead, in a dry run it previews the files, and with
+// Collect it keeps them; all three report that nothing was written.
+func (o Options) Write(files ...File) (bool, error) {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+	if err := o.Check(paths...); err != nil {
+		return false, err
+	}
+
+	writer := o.writer()
+	for _, file := range files {
+		if err := writer.write(file); err != nil {
+			return false, err
+		}
+	}
+	return !o.Diff && o.Collect == nil && !DryRun(), nil
+}
+
+// fileWriter does something with a generated file: writes it to disk or
+// shows it.
+type fileWriter interface {
+	write(file File) error
+}
+
+// writer returns the fileWriter for the options and the --dry-run mode.
+func (o Options) writer() fileWriter {
+	switch {
+	case o.Collect != nil:
+		return o.Collect
+	case DryRun():
+		return previewWriter{force: o.Force}
+	case o.Diff:
+		return diffWriter{}
+	}
+	return diskWriter{}
+}
+
+// Collector gathers generated files instead of writing them, keyed by
+// slash-separated path, relative to the working directory when inside it.
+// It is safe for concurrent use.
+type Collector struct {
+	mu    sync.Mutex
+	files map[string]string
+}
+
+func (c *Collector) write(file File) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files == nil {
+		c.files = make(map[string]string)
+	}
+	name := file.Path
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, file.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+	}
+	c.files[filepath.ToSlash(name)] = string(file.Data)
+	return nil
+}
+
+// Files returns the collected files by path.
+func (c *Collector) Files() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files := make(map[string]string, len(c.files))
+	for path, data := range c.files {
+		files[path] = data
+	}
+	return files
+}
+
+// WriteJSON writes the collected files as indented JSON, as
+// {"files": {"<path>": "<content>"}}.
+func (c *Collector) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Files map[string]string `json:"files"`
+	}{Files: c.Files()})
+}
+
+// CreateDir creates the directory of file and its parents, for commands
+// that write file themselves, such as reports and profiles.
+func CreateDir(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", file, err)
+	}
+	return nil
+}
+
+// diskWriter writes files, creating their directories.
+type diskWriter struct{}
+
+func (diskWriter) write(file File) error {
+	if err := CreateDir(file.Path); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file.Path, file.Data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file.Path, err)
+	}
+	return nil
+}
+
+// diffWriter prints how a file differs from what is on disk; a missing file
+// shows up as entirely added.
+type diffWriter struct{}
+
+func (diffWriter) write(file File) error {
+	current, err := os.ReadFile(file.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", file.Path, err)
+	}
+
+	name := displayName(file.Path)
+	diff := UnifiedDiff(name, current, file.Data)
+	if diff == "" {
+		logging.Infof("%s is up to date\n", name)
+		return nil
+	}
+	fmt.Print(diff)
+	return nil
+}
+
+// previewWriter prints the path and content of a new file, or the diff
+// against an existing one, for --dry-run. force tells whether the real run
+// would be allowed to replace existing files.
+type previewWriter struct {
+	force bool
+}
+
+func (w previewWriter) write(file File) error {
+	current, err := os.ReadFile(file.Path)
+	if os.IsNotExist(err) {
+		fmt.Printf("==> %s (new, %d bytes)\n", file.Path, len(file.Data))
+		fmt.Print(string(file.Data))
+		if len(file.Data) > 0 && !strings.HasSuffix(string(file.Data), "\n") {
+			fmt.Println()
+		}
+		fmt.Println()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file.Path, err)
+	}
+
+	diff := UnifiedDiff(displayName(file.Path), current, file.Data)
+	switch {
+	case diff == "":
+		fmt.Printf("==> %s (unchanged)\n\n", file.Path)
+	case w.force:
+		fmt.Printf("==> %s (changed)\n%s\n", file.Path, diff)
+	default:
+		fmt.Printf("==> %s (changed; exists, so writing it needs --force)\n%s\n", file.Path, diff)
+	}
+	return nil
+}
+
+// displayName returns path relative to the working directory when it is
+// inside it, for readable diff headers, and otherwise without its leading
+// slash so the "a/" and "b/" prefixes stay well-formed.
+func displayName(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
@@ -0,0 +1,223 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"goforge/pkg/gitdiff"
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/proc"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// listedPackage is the part of the 'go list -json' output the selection of
+// changed packages uses.
+type listedPackage struct {
+	ImportPath   string
+	Dir          string
+	Imports      []string
+	TestImports  []string
+	XTestImports []string
+}
+
+// RunChangedTests runs the tests of the packages affected by the changes
+// since the merge base of since and HEAD, like RunTests. A package is
+// affected when one of its Go files or files under its testdata changed,
+// when it imports a package whose Go files changed, directly or not, or
+// when its tests import one. Packages whose files were all deleted are not tested, but the
+// packages still importing them are. A change to go.mod or go.sum affects
+// every package. Why each package was selected is printed before the tests
+// run.
+func RunChangedTests(path string, since string, opts RunOptions) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	root, err := module.FindRoot(absPath)
+	if err != nil {
+		return err
+	}
+	modulePath, err := module.Path(root)
+	if err != nil {
+		return err
+	}
+
+	files, err := gitdiff.ChangedFiles(root, since)
+	if err != nil {
+		return err
+	}
+	logging.Infof("Files changed since %s: %d\n", since, len(files))
+	for _, file := range files {
+		if file == "go.mod" || file == "go.sum" {
+			fmt.Printf("\n%s changed; testing every package\n", file)
+			return runTests(root, path, []string{"./..."}, opts)
+		}
+	}
+
+	packages, err := listPackages(root)
+	if err != nil {
+		return err
+	}
+	selected, deleted := selectChangedPackages(root, modulePath, files, packages)
+
+	if len(deleted) > 0 {
+		fmt.Printf("\nDeleted Packages (%d):\n", len(deleted))
+		for _, pkg := range deleted {
+			fmt.Printf("- %s\n", pkg)
+		}
+	}
+	fmt.Printf("\nPackages to Test (%d):\n", len(selected))
+	if len(selected) == 0 {
+		fmt.Println("- None")
+		return nil
+	}
+	patterns := make([]string, len(selected))
+	for i, pkg := range selected {
+		fmt.Printf("- %s: %s\n", pkg.importPath, pkg.reason)
+		patterns[i] = pkg.importPath
+	}
+	return runTests(root, path, patterns, opts)
+}
+
+// listPackages lists the packages of the module at root with their
+// imports, sorted by import path. Packages with errors, such as imports of
+// deleted packages, are listed too.
+func listPackages(root string) ([]listedPackage, error) {
+	cmd := proc.Command("go", "list", "-e", "-json=ImportPath,Dir,Imports,TestImports,XTestImports", "./...")
+	cmd.Dir = root
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w\nOutput: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var packages []listedPackage
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var pkg listedPackage
+		if err := decoder.Decode(&pkg); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse go list output: %w", err)
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// changedPackage is a package selected for testing and why.
+type changedPackage struct {
+	importPath string
+	reason     string
+}
+
+// selectChangedPackages returns the packages affected by the changed files,
+// slash-separated paths relative to root, in the order they were found:
+// changed packages first, then their importers, nearest first. It also
+// returns the import paths of the packages whose files were all deleted.
+func selectChangedPackages(root string, modulePath string, files []string, packages []listedPackage) ([]changedPackage, []string) {
+	byDir := make(map[string]string)
+	importers := make(map[string][]string)
+	testImporters := make(map[string][]string)
+	for _, pkg := range packages {
+		if rel, err := filepath.Rel(root, pkg.Dir); err == nil {
+			byDir[filepath.ToSlash(rel)] = pkg.ImportPath
+		}
+		for _, imp := range pkg.Imports {
+			importers[imp] = append(importers[imp], pkg.ImportPath)
+		}
+		for _, imp := range append(append([]string{}, pkg.TestImports...), pkg.XTestImports...) {
+			if imp != pkg.ImportPath {
+				testImporters[imp] = append(testImporters[imp], pkg.ImportPath)
+			}
+		}
+	}
+
+	changed := make(map[string][]string)
+	// code holds the packages whose Go files changed, not only fixtures
+	code := make(map[string]bool)
+	gone := make(map[string]bool)
+	for _, file := range files {
+		dir := path.Dir(file)
+		owner, _, fixture := strings.Cut("/"+file, "/testdata/")
+		if fixture {
+			// Test fixtures belong to the package holding testdata
+			dir = strings.TrimPrefix(owner, "/")
+			if dir == "" {
+				dir = "."
+			}
+		} else if !strings.HasSuffix(file, ".go") {
+			continue
+		}
+
+		if pkg, ok := byDir[dir]; ok {
+			changed[pkg] = append(changed[pkg], strings.TrimPrefix(file, dir+"/"))
+			code[pkg] = code[pkg] || !fixture
+			continue
+		}
+		// A package directory without Go files left was deleted; other
+		// files outside the packages, such as those of nested modules,
+		// are ignored
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(file))); os.IsNotExist(err) && strings.HasSuffix(file, ".go") {
+			importPath := modulePath
+			if dir != "." {
+				importPath += "/" + dir
+			}
+			gone[importPath] = true
+		}
+	}
+
+	var selected []changedPackage
+	seen := make(map[string]bool)
+	// queued holds the packages whose importers are affected
+	queued := make(map[string]bool)
+	var queue []string
+	changedPackages := maps.Keys(changed)
+	slices.Sort(changedPackages)
+	for _, pkg := range changedPackages {
+		selected = append(selected, changedPackage{pkg, "changed (" + strings.Join(changed[pkg], ", ") + ")"})
+		seen[pkg] = true
+		if code[pkg] {
+			queued[pkg] = true
+			queue = append(queue, pkg)
+		}
+	}
+	deleted := maps.Keys(gone)
+	slices.Sort(deleted)
+	queue = append(queue, deleted...)
+
+	// The importers of an affected package are affected in turn; a package
+	// whose tests import one is only tested
+	for i := 0; i < len(queue); i++ {
+		for _, importer := range importers[queue[i]] {
+			if !seen[importer] {
+				selected = append(selected, changedPackage{importer, "imports " + queue[i]})
+				seen[importer] = true
+			}
+			if !queued[importer] {
+				queued[importer] = true
+				queue = append(queue, importer)
+			}
+		}
+	}
+	for _, pkg := range queue {
+		for _, importer := range testImporters[pkg] {
+			if !seen[importer] {
+				selected = append(selected, changedPackage{importer, "tests import " + pkg})
+				seen[importer] = true
+			}
+		}
+	}
+	return selected, deleted
+}
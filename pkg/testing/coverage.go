@@ -0,0 +1,337 @@
+package testing
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats of AnalyzeCoverage.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// DefaultLeastCovered is how many of the least-covered functions the
+// coverage report lists by default.
+const DefaultLeastCovered = 10
+
+// CoverageReport is the coverage of a module's statements, as a whole and
+// by package, file, and function.
+type CoverageReport struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	// Total is the percentage of statements the tests ran; with a diff
+	// base, the threshold applies to Diff instead.
+	Total      float64 `json:"total"`
+	Covered    int     `json:"covered"`
+	Statements int     `json:"statements"`
+	Threshold  float64 `json:"threshold"`
+	Passed     bool    `json:"passed"`
+	// Packages and Files are sorted by path.
+	Packages []CoverageEntry `json:"packages"`
+	Files    []CoverageEntry `json:"files"`
+	// PackageThresholds are the per-package thresholds, one per package
+	// with any, sorted by package.
+	PackageThresholds []PackageThreshold `json:"package_thresholds"`
+	// LeastCovered lists the functions with the lowest coverage first.
+	LeastCovered []FunctionCoverage `json:"least_covered"`
+	Diff         *DiffCoverage      `json:"diff,omitempty"`
+	HTMLReport   string             `json:"html_report"`
+}
+
+// CoverageEntry is the coverage of a package, by import path, or a file, by
+// path relative to the module root.
+type CoverageEntry struct {
+	Path       string  `json:"path"`
+	Percent    float64 `json:"percent"`
+	Covered    int     `json:"covered"`
+	Statements int     `json:"statements"`
+}
+
+// PackageThreshold is the coverage a package must reach on its own, and
+// whether it does.
+type PackageThreshold struct {
+	Package string `json:"package"`
+	// Pattern is the configured pattern the threshold comes from; when
+	// several match, the highest threshold applies.
+	Pattern   string  `json:"pattern"`
+	Threshold float64 `json:"threshold"`
+	Percent   float64 `json:"percent"`
+	Passed    bool    `json:"passed"`
+}
+
+// FunctionCoverage is the coverage of a function or method.
+type FunctionCoverage struct {
+	// Function is the name, as Name or (*Type).Name for a method.
+	Function   string  `json:"function"`
+	File       string  `json:"file"`
+	Line       int     `json:"line"`
+	Percent    float64 `json:"percent"`
+	Covered    int     `json:"covered"`
+	Statements int     `json:"statements"`
+}
+
+// coverageCounts sums the statements of profile blocks.
+type coverageCounts struct {
+	covered    int
+	statements int
+}
+
+func (c *coverageCounts) add(block profileBlock) {
+	c.statements += block.statements
+	if block.count > 0 {
+		c.covered += block.statements
+	}
+}
+
+func (c *coverageCounts) percent() float64 {
+	if c.statements == 0 {
+		return 0
+	}
+	return float64(c.covered) * 100 / float64(c.statements)
+}
+
+// buildCoverageReport computes the coverage of the module named modulePath
+// at root from the blocks of its profile, listing the leastCovered
+// functions with the lowest coverage.
+func buildCoverageReport(root string, modulePath string, blocks map[string][]profileBlock, leastCovered int) *CoverageReport {
+	report := &CoverageReport{
+		Packages:          []CoverageEntry{},
+		Files:             []CoverageEntry{},
+		PackageThresholds: []PackageThreshold{},
+		LeastCovered:      []FunctionCoverage{},
+	}
+	var total coverageCounts
+	packages := make(map[string]*coverageCounts)
+	var functions []FunctionCoverage
+
+	for file, fileBlocks := range blocks {
+		importPath := modulePath
+		if dir := path.Dir(file); dir != "." {
+			importPath += "/" + dir
+		}
+		if packages[importPath] == nil {
+			packages[importPath] = &coverageCounts{}
+		}
+
+		var counts coverageCounts
+		for _, block := range fileBlocks {
+			counts.add(block)
+			packages[importPath].add(block)
+			total.add(block)
+		}
+		report.Files = append(report.Files, CoverageEntry{
+			Path:       file,
+			Percent:    counts.percent(),
+			Covered:    counts.covered,
+			Statements: counts.statements,
+		})
+		functions = append(functions, functionCoverage(root, file, fileBlocks)...)
+	}
+
+	for importPath, counts := range packages {
+		report.Packages = append(report.Packages, CoverageEntry{
+			Path:       importPath,
+			Percent:    counts.percent(),
+			Covered:    counts.covered,
+			Statements: counts.statements,
+		})
+	}
+	sort.Slice(report.Packages, func(i, j int) bool { return report.Packages[i].Path < report.Packages[j].Path })
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].Path < report.Files[j].Path })
+
+	// Least covered first, then those with the most statements left to cover
+	sort.Slice(functions, func(i, j int) bool {
+		a, b := functions[i], functions[j]
+		if a.Percent != b.Percent {
+			return a.Percent < b.Percent
+		}
+		if a.Statements-a.Covered != b.Statements-b.Covered {
+			return a.Statements-a.Covered > b.Statements-b.Covered
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	if len(functions) > leastCovered {
+		functions = functions[:leastCovered]
+	}
+	report.LeastCovered = append(report.LeastCovered, functions...)
+
+	report.Total = total.percent()
+	report.Covered, report.Statements = total.covered, total.statements
+	return report
+}
+
+// functionCoverage returns the coverage of each function of a file, given
+// by its path relative to root, with statements. As in go tool cover, a
+// block belongs to the function it starts in. A file that cannot be parsed
+// has no functions.
+func functionCoverage(root string, file string, blocks []profileBlock) []FunctionCoverage {
+	fset := token.NewFileSet()
+	syntax, err := parser.ParseFile(fset, filepath.Join(root, filepath.FromSlash(file)), nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+
+	var functions []FunctionCoverage
+	for _, decl := range syntax.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		start, end := fset.Position(fn.Pos()), fset.Position(fn.End())
+		var counts coverageCounts
+		for _, block := range blocks {
+			if !before(block.startLine, block.startCol, start.Line, start.Column) &&
+				!before(end.Line, end.Column, block.startLine, block.startCol) {
+				counts.add(block)
+			}
+		}
+		if counts.statements == 0 {
+			continue
+		}
+		functions = append(functions, FunctionCoverage{
+			Function:   functionName(fn),
+			File:       file,
+			Line:       start.Line,
+			Percent:    counts.percent(),
+			Covered:    counts.covered,
+			Statements: counts.statements,
+		})
+	}
+	return functions
+}
+
+// applyPackageThresholds checks the packages of the report, of the module
+// named modulePath, against thresholds keyed by package pattern, and returns
+// the patterns that match no package, sorted. A pattern is a package
+// directory relative to the module root, such as ./pkg/auth, or an import
+// path; a pattern ending in "/..." also matches the packages below it.
+func applyPackageThresholds(report *CoverageReport, modulePath string, thresholds map[string]float64) []string {
+	matched := make(map[string]bool)
+	for _, pkg := range report.Packages {
+		var threshold *PackageThreshold
+		for pattern, percent := range thresholds {
+			if !matchesPackage(pkg.Path, modulePath, pattern) {
+				continue
+			}
+			matched[pattern] = true
+			// Prefer the higher threshold, then the pattern sorting first
+			if threshold == nil || percent > threshold.Threshold ||
+				(percent == threshold.Threshold && pattern < threshold.Pattern) {
+				threshold = &PackageThreshold{Package: pkg.Path, Pattern: pattern, Threshold: percent}
+			}
+		}
+		if threshold != nil {
+			threshold.Percent = pkg.Percent
+			threshold.Passed = pkg.Percent >= threshold.Threshold
+			report.PackageThresholds = append(report.PackageThresholds, *threshold)
+		}
+	}
+
+	var unmatched []string
+	for pattern := range thresholds {
+		if !matched[pattern] {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+	sort.Strings(unmatched)
+	return unmatched
+}
+
+// matchesPackage reports whether the package with the import path
+// importPath, in the module named modulePath, matches a package pattern.
+func matchesPackage(importPath string, modulePath string, pattern string) bool {
+	if rel, ok := strings.CutPrefix(pattern, "./"); ok || pattern == "." {
+		pattern = modulePath
+		if ok && rel != "" {
+			pattern += "/" + rel
+		}
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+		return importPath == prefix || strings.HasPrefix(importPath, prefix+"/")
+	}
+	return importPath == strings.TrimSuffix(pattern, "/")
+}
+
+// before reports whether line1.col1 comes before line2.col2.
+func before(line1, col1, line2, col2 int) bool {
+	return line1 < line2 || (line1 == line2 && col1 < col2)
+}
+
+// functionName names a function as Name, or a method as (Type).Name or
+// (*Type).Name.
+func functionName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	typeName, generic := receiverType(fn)
+	if generic {
+		typeName += "[...]"
+	}
+	if _, ok := fn.Recv.List[0].Type.(*ast.StarExpr); ok {
+		typeName = "*" + typeName
+	}
+	return fmt.Sprintf("(%s).%s", typeName, fn.Name.Name)
+}
+
+// printCoverageReport prints the coverage of each package and file and the
+// least-covered functions as tables.
+func printCoverageReport(w io.Writer, report *CoverageReport) {
+	printEntries := func(title string, column string, entries []CoverageEntry) {
+		fmt.Fprintf(w, "\n%s:\n", title)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\tCOVERAGE\tSTATEMENTS\n", column)
+		for _, entry := range entries {
+			fmt.Fprintf(tw, "%s\t%.1f%%\t%d/%d\n", entry.Path, entry.Percent, entry.Covered, entry.Statements)
+		}
+		tw.Flush()
+	}
+	printEntries("Coverage by Package", "PACKAGE", report.Packages)
+	printEntries("Coverage by File", "FILE", report.Files)
+
+	if len(report.PackageThresholds) > 0 {
+		fmt.Fprintf(w, "\nPackage Thresholds (%d):\n", len(report.PackageThresholds))
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PACKAGE\tCOVERAGE\tTHRESHOLD\tSTATUS")
+		for _, threshold := range report.PackageThresholds {
+			status := "ok"
+			if !threshold.Passed {
+				status = "BELOW"
+			}
+			fmt.Fprintf(tw, "%s\t%.1f%%\t%.1f%%\t%s\n", threshold.Package, threshold.Percent, threshold.Threshold, status)
+		}
+		tw.Flush()
+	}
+
+	fmt.Fprintf(w, "\nLeast Covered Functions (%d):\n", len(report.LeastCovered))
+	if len(report.LeastCovered) == 0 {
+		fmt.Fprintln(w, "- None")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FUNCTION\tPOSITION\tCOVERAGE\tSTATEMENTS")
+	for _, function := range report.LeastCovered {
+		fmt.Fprintf(tw, "%s\t%s:%d\t%.1f%%\t%d/%d\n",
+			function.Function, function.File, function.Line, function.Percent, function.Covered, function.Statements)
+	}
+	tw.Flush()
+}
+
+// writeCoverageJSON writes the report as indented JSON.
+func writeCoverageJSON(w io.Writer, report *CoverageReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
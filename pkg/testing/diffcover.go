@@ -0,0 +1,234 @@
+package testing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"goforge/pkg/gitdiff"
+	"goforge/pkg/module"
+	"goforge/pkg/proc"
+)
+
+// DiffCoverage is the coverage of the lines changed since a base ref.
+type DiffCoverage struct {
+	Base  string             `json:"base"`
+	Files []FileDiffCoverage `json:"files"`
+	// Covered and Statements count the changed lines that hold statements.
+	Covered    int `json:"covered"`
+	Statements int `json:"statements"`
+}
+
+// FileDiffCoverage is the coverage of the changed lines of one file.
+type FileDiffCoverage struct {
+	// Path is relative to the module root.
+	Path       string `json:"path"`
+	Covered    int    `json:"covered"`
+	Statements int    `json:"statements"`
+	// Uncovered lists the changed lines whose statements never ran.
+	Uncovered []int `json:"uncovered"`
+}
+
+// Percent returns the share of changed statement lines that ran.
+func (d *DiffCoverage) Percent() float64 {
+	if d.Statements == 0 {
+		return 100
+	}
+	return float64(d.Covered) * 100 / float64(d.Statements)
+}
+
+// MeasureDiffCoverage runs the tests under path with coverage and returns
+// the coverage of the Go lines changed since the merge base of base and
+// HEAD.
+func MeasureDiffCoverage(path string, base string) (*DiffCoverage, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	root, err := module.FindRoot(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := os.CreateTemp("", "goforge-coverage-*.out")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create coverage profile: %w", err)
+	}
+	profile.Close()
+	defer os.Remove(profile.Name())
+
+	cmd := proc.Command("go", "test", "./...", "-covermode="+CoverModeSet, "-coverprofile="+profile.Name())
+	cmd.Dir = absPath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to run tests with coverage: %w\nOutput: %s", err, output)
+	}
+	return computeDiffCoverage(root, base, profile.Name())
+}
+
+// profileBlock is one block of a coverage profile.
+type profileBlock struct {
+	startLine  int
+	startCol   int
+	endLine    int
+	statements int
+	count      int
+}
+
+// computeDiffCoverage intersects the coverage profile at profilePath with
+// the Go lines added or changed since the merge base of base and HEAD in the
+// module at root. Uncommitted changes to tracked files count as changed.
+func computeDiffCoverage(root string, base string, profilePath string) (*DiffCoverage, error) {
+	modulePath, err := module.Path(root)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := gitdiff.ChangedLines(root, base)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := readProfile(profilePath, modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DiffCoverage{Base: base, Files: []FileDiffCoverage{}}
+	for file, lines := range changed {
+		fileCoverage := FileDiffCoverage{Path: file}
+		for _, line := range lines {
+			statement, covered := false, false
+			for _, block := range blocks[file] {
+				if line >= block.startLine && line <= block.endLine {
+					statement = true
+					covered = covered || block.count > 0
+				}
+			}
+			if !statement {
+				// Blank lines, comments, and declarations are not counted
+				continue
+			}
+			fileCoverage.Statements++
+			if covered {
+				fileCoverage.Covered++
+			} else {
+				fileCoverage.Uncovered = append(fileCoverage.Uncovered, line)
+			}
+		}
+
+		if fileCoverage.Statements > 0 {
+			result.Files = append(result.Files, fileCoverage)
+			result.Covered += fileCoverage.Covered
+			result.Statements += fileCoverage.Statements
+		}
+	}
+
+	sort.Slice(result.Files, func(i, j int) bool {
+		return result.Files[i].Path < result.Files[j].Path
+	})
+	return result, nil
+}
+
+// readProfile reads the blocks of a coverage profile, keyed by file path
+// relative to the root of the module named modulePath. Files of other
+// modules are skipped. A block listed more than once, as when several test
+// binaries cover a package, is merged: in set mode it ran if it ran in any,
+// and otherwise its counts add up.
+func readProfile(profilePath string, modulePath string) (map[string][]profileBlock, error) {
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read coverage profile: %w", err)
+	}
+
+	type blockKey struct {
+		file                                 string
+		startLine, startCol, endLine, endCol int
+	}
+	blocks := make(map[string][]profileBlock)
+	index := make(map[blockKey]int)
+	mode := CoverModeSet
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "mode:"); ok {
+			mode = strings.TrimSpace(value)
+			continue
+		}
+
+		// name.go:startLine.startCol,endLine.endCol numStatements count
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			continue
+		}
+		file, ok := strings.CutPrefix(line[:colon], modulePath+"/")
+		if !ok {
+			continue
+		}
+
+		var block profileBlock
+		var endCol int
+		if _, err := fmt.Sscanf(line[colon+1:], "%d.%d,%d.%d %d %d",
+			&block.startLine, &block.startCol, &block.endLine, &endCol, &block.statements, &block.count); err != nil {
+			return nil, fmt.Errorf("malformed coverage profile line %q: %w", line, err)
+		}
+		key := blockKey{file, block.startLine, block.startCol, block.endLine, endCol}
+		// A block ending at column 1 has nothing on its last line
+		if endCol <= 1 && block.endLine > block.startLine {
+			block.endLine--
+		}
+
+		if i, seen := index[key]; seen {
+			merged := &blocks[file][i]
+			if mode == CoverModeSet {
+				if block.count > merged.count {
+					merged.count = block.count
+				}
+			} else {
+				merged.count += block.count
+			}
+			continue
+		}
+		index[key] = len(blocks[file])
+		blocks[file] = append(blocks[file], block)
+	}
+	return blocks, nil
+}
+
+// PrintDiffCoverage prints the coverage of the changed lines of each file
+// and the uncovered ones as ranges.
+func PrintDiffCoverage(coverage *DiffCoverage) {
+	fmt.Printf("\nDiff Coverage (changes since %s):\n", coverage.Base)
+	if coverage.Statements == 0 {
+		fmt.Println("- No changed statements")
+		return
+	}
+
+	for _, file := range coverage.Files {
+		fmt.Printf("- %s: %d/%d changed lines covered\n", file.Path, file.Covered, file.Statements)
+		if len(file.Uncovered) > 0 {
+			fmt.Printf("    Uncovered: %s\n", lineRanges(file.Uncovered))
+		}
+	}
+}
+
+// lineRanges formats sorted line numbers as ranges, e.g. "3-5, 9".
+func lineRanges(lines []int) string {
+	var ranges []string
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(lines[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
@@ -0,0 +1,426 @@
+package testing
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"goforge/pkg/proc"
+)
+
+// ExampleTemplate is the template for example functions. Their output is
+// filled in when they are run; otherwise they are left without an Output
+// comment, so go test only compiles them.
+const ExampleTemplate = `package {{.Package}}
+{{- if .Fmt}}
+
+import "fmt"
+{{- end}}
+{{range .Examples}}
+func {{.Name}}() {
+	{{- if .Note}}
+	// TODO: {{.Note}}
+	{{- end}}
+	{{- range .Setup}}
+	{{.}}
+	{{- end}}
+	{{- if .Print}}
+	{{.Results}} := {{.Call}}
+	fmt.Println({{.Results}})
+	{{- else}}
+	{{- if .Results}}
+	// TODO: Print what the example should show
+	{{- end}}
+	{{.Call}}
+	{{- end}}
+	{{- if .Failed}}
+	// TODO: {{.Failed}}; add an Output comment once it runs
+	{{- else if .Ran}}
+	// Output:
+	{{- range .Output}}
+	//{{if .}} {{.}}{{end}}
+	{{- end}}
+	{{- else}}
+	// TODO: Add an Output comment with what the example prints
+	{{- end}}
+}
+{{end}}`
+
+// ExampleData holds data for the example template.
+type ExampleData struct {
+	Package string
+	// Fmt is set when an example prints its results.
+	Fmt      bool
+	Examples []ExampleFunctionData
+}
+
+// ExampleFunctionData holds data about an example function.
+type ExampleFunctionData struct {
+	// Name is the example's name: Example<Func> or Example<Type>_<Method>.
+	Name string
+	// Note tells what is left to do to construct the receiver, if anything.
+	Note  string
+	Setup []string
+	// Call calls the function and Results names what it returns.
+	Call    string
+	Results string
+	// Print is set when the function returns results that print the same
+	// way on every run.
+	Print bool
+	// Ran is set when the example was run, and Output holds the lines it
+	// prints.
+	Ran    bool
+	Output []string
+	// Failed tells how the example failed when it was run. It is then left
+	// without an Output comment, so go test only compiles it.
+	Failed string
+}
+
+// DefaultExamplePattern places each example file next to its source file.
+const DefaultExamplePattern = "{dir}/{name}_example_test.go"
+
+// exampleTimeout bounds running a single example to fill in its output.
+const exampleTimeout = "10s"
+
+// generateExamplesForFile generates the example file for a single Go file
+// under root without writing it. With RunExamples, the examples are run to
+// fill in their output.
+func generateExamplesForFile(root string, path string, opts GenerateOptions) generatedTest {
+	test := generatedTest{source: path}
+	fail := func(err error) generatedTest {
+		test.err = err
+		return test
+	}
+
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return fail(fmt.Errorf("failed to parse Go file: %w", err))
+	}
+	packageName := node.Name.Name
+	if packageName == "main" {
+		return test
+	}
+	decls, err := parsePackageDecls(filepath.Dir(path), packageName)
+	if err != nil {
+		return fail(err)
+	}
+	outputPath, err := testOutputPath(root, path, packageName, opts)
+	if err != nil {
+		return fail(err)
+	}
+	existing, err := existingExamples(filepath.Dir(path), outputPath)
+	if err != nil {
+		return fail(err)
+	}
+
+	data := ExampleData{Package: packageName}
+	for _, decl := range node.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if reason := opts.filter.skip(fn, packageName); reason != "" {
+			test.skip(reason)
+			continue
+		}
+		example, reason := exampleFor(fn, decls)
+		if reason == "" && existing[example.Name] {
+			reason = fmt.Sprintf("the package already has %s", example.Name)
+		}
+		if reason != "" {
+			test.skipped = append(test.skipped, fmt.Sprintf("%s in %s: %s", fn.Name.Name, path, reason))
+			test.skip(skipUnsupported)
+			continue
+		}
+		data.Fmt = data.Fmt || example.Print
+		data.Examples = append(data.Examples, example)
+	}
+	if len(data.Examples) == 0 {
+		return test
+	}
+	test.covered = len(data.Examples)
+
+	// Running the examples is pointless when the file cannot be written
+	if err := opts.Check(outputPath); err != nil {
+		return fail(err)
+	}
+	if opts.RunExamples {
+		if err := fillExampleOutput(&data, filepath.Dir(path), outputPath, &test); err != nil {
+			return fail(err)
+		}
+	}
+
+	source, err := renderTest(ExampleTemplate, data)
+	if err != nil {
+		return fail(err)
+	}
+	test.output, test.data = outputPath, source
+	return test
+}
+
+// exampleFor returns the example of fn, or why it has none.
+func exampleFor(fn *ast.FuncDecl, decls packageDecls) (ExampleFunctionData, string) {
+	if fn.Type.TypeParams != nil {
+		return ExampleFunctionData{}, "generic functions need type arguments"
+	}
+
+	example := ExampleFunctionData{Name: "Example" + fn.Name.Name}
+	callee := fn.Name.Name
+	declared := make(map[string]bool)
+	if fn.Recv != nil {
+		typeName, generic := receiverType(fn)
+		switch {
+		case typeName == "" || !ast.IsExported(typeName):
+			return ExampleFunctionData{}, "methods of unexported types have no documentation"
+		case generic:
+			return ExampleFunctionData{}, "methods of generic types need type arguments"
+		}
+		receiver := receiverData(fn, typeName, false, decls, examplePanic)
+		example.Name = fmt.Sprintf("Example%s_%s", typeName, fn.Name.Name)
+		example.Note, example.Setup = receiver.Note, receiver.Setup
+		declared[receiver.Var] = true
+		if len(receiver.Setup) > 0 && strings.HasPrefix(receiver.Setup[0], receiver.Var+", err :=") {
+			declared["err"] = true
+		}
+		callee = receiver.Var + "." + fn.Name.Name
+	}
+
+	var args []string
+	for _, field := range fn.Type.Params.List {
+		arg, ok := exampleArg(field.Type, decls)
+		if !ok {
+			return ExampleFunctionData{}, fmt.Sprintf("parameter type %s needs a constructed value", types.ExprString(field.Type))
+		}
+		for k := 0; k < fieldCount(field); k++ {
+			args = append(args, arg)
+		}
+	}
+	example.Call = fmt.Sprintf("%s(%s)", callee, strings.Join(args, ", "))
+
+	results, print := exampleResults(fn, declared)
+	example.Results = strings.Join(results, ", ")
+	example.Print = print && len(results) > 0
+	return example, ""
+}
+
+// examplePanic is how an example handles an error from the constructor of
+// its receiver, having no *testing.T to fail.
+func examplePanic(constructor string) string {
+	return "panic(err)"
+}
+
+// exampleArg returns a plausible argument of a type: a simple literal for
+// the basic types and slices of them, and the zero value of a struct type
+// of the package. Other types need a value the example cannot make up.
+func exampleArg(expr ast.Expr, decls packageDecls) (string, bool) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if seeds, ok := fuzzSeeds[expr.Name]; ok {
+			return seeds[1], true
+		}
+		switch definition := decls.types[expr.Name].(type) {
+		case *ast.StructType:
+			return expr.Name + "{}", true
+		case *ast.Ident:
+			if seeds, ok := fuzzSeeds[definition.Name]; ok {
+				return fmt.Sprintf("%s(%s)", expr.Name, seeds[1]), true
+			}
+		}
+	case *ast.Ellipsis:
+		return exampleArg(expr.Elt, decls)
+	case *ast.ArrayType:
+		if elem, ok := expr.Elt.(*ast.Ident); ok && expr.Len == nil {
+			if seeds, ok := fuzzSeeds[elem.Name]; ok {
+				if elem.Name == "byte" {
+					return fuzzSeeds["[]byte"][1], true
+				}
+				return fmt.Sprintf("[]%s{%s}", elem.Name, seeds[1]), true
+			}
+		}
+	}
+	return "", false
+}
+
+// exampleResults names the results of fn, avoiding the variables the
+// example declares before the call, and reports whether they print the same
+// way on every run: builtin basic types, errors, and slices and maps of them.
+func exampleResults(fn *ast.FuncDecl, declared map[string]bool) ([]string, bool) {
+	var resultTypes []ast.Expr
+	if fn.Type.Results != nil {
+		for _, field := range fn.Type.Results.List {
+			for k := 0; k < fieldCount(field); k++ {
+				resultTypes = append(resultTypes, field.Type)
+			}
+		}
+	}
+
+	names := make([]string, len(resultTypes))
+	print := true
+	for i, expr := range resultTypes {
+		switch {
+		case len(resultTypes) == 1 && types.ExprString(expr) == "error" && !declared["err"]:
+			names[i] = "err"
+		case len(resultTypes) == 1:
+			names[i] = "result"
+		case len(resultTypes) == 2 && types.ExprString(resultTypes[1]) == "error":
+			names[i] = []string{"result", "err"}[i]
+		default:
+			names[i] = fmt.Sprintf("result%d", i+1)
+		}
+		if declared[names[i]] && names[i] != "err" {
+			names[i] += "_"
+		}
+		print = print && printable(expr)
+	}
+	return names, print
+}
+
+// printable reports whether values of a type print the same way on every
+// run; fmt sorts map keys.
+func printable(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		_, basic := fuzzSeeds[expr.Name]
+		return basic || expr.Name == "error"
+	case *ast.ArrayType:
+		return printable(expr.Elt)
+	case *ast.MapType:
+		return printable(expr.Key) && printable(expr.Value)
+	}
+	return false
+}
+
+// existingExamples returns the names of the functions in the test files of
+// the package in dir, other than output, so examples are not declared twice.
+func existingExamples(dir string, output string) (map[string]bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package directory: %w", err)
+	}
+
+	names := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		file := filepath.Join(dir, entry.Name())
+		if !strings.HasSuffix(entry.Name(), "_test.go") || file == output {
+			continue
+		}
+		syntax, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range syntax.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+				names[fn.Name.Name] = true
+			}
+		}
+	}
+	return names, nil
+}
+
+// fillExampleOutput fills in the output of the examples by building the
+// package's tests with the examples added through a go build overlay and
+// running each example on its own. This runs the package's code, which can
+// do anything the user running GoForge can. An example that fails other than by its
+// output, such as by panicking, is reported and marked Failed. When the
+// examples cannot be run, because they do not build or their file is
+// written outside the package, their output is left empty.
+func fillExampleOutput(data *ExampleData, dir string, outputPath string, test *generatedTest) error {
+	warn := func(format string, args ...any) {
+		test.skipped = append(test.skipped, fmt.Sprintf(format, args...))
+	}
+	if filepath.Dir(outputPath) != dir {
+		warn("running the examples of %s: %s is outside the package, so their output is left empty", test.source, outputPath)
+		return nil
+	}
+
+	// With an empty Output comment, go test runs each example and reports
+	// what it printed
+	running := *data
+	running.Examples = make([]ExampleFunctionData, len(data.Examples))
+	for i, example := range data.Examples {
+		example.Ran = true
+		running.Examples[i] = example
+	}
+	source, err := renderTest(ExampleTemplate, running)
+	if err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp("", "goforge-examples-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	exampleFile := filepath.Join(tmpDir, "example_test.go")
+	if err := os.WriteFile(exampleFile, source, 0644); err != nil {
+		return fmt.Errorf("failed to write the examples: %w", err)
+	}
+	overlay, err := json.Marshal(map[string]map[string]string{"Replace": {outputPath: exampleFile}})
+	if err != nil {
+		return err
+	}
+	overlayFile := filepath.Join(tmpDir, "overlay.json")
+	if err := os.WriteFile(overlayFile, overlay, 0644); err != nil {
+		return fmt.Errorf("failed to write the build overlay: %w", err)
+	}
+
+	binary := filepath.Join(tmpDir, "examples.test")
+	build := proc.Command("go", "test", "-c", "-overlay", overlayFile, "-o", binary, ".")
+	build.Dir = dir
+	if output, err := build.CombinedOutput(); err != nil {
+		warn("running the examples of %s: they do not build, so their output is left empty\n%s", test.source, output)
+		return nil
+	}
+
+	for i := range data.Examples {
+		example := &data.Examples[i]
+		run := proc.Command(binary, "-test.run", "^"+example.Name+"$", "-test.timeout", exampleTimeout)
+		run.Dir = dir
+		output, err := run.CombinedOutput()
+		if err == nil {
+			// An example printing nothing passes with the empty output
+			example.Ran = true
+			continue
+		}
+		got, ok := exampleGot(string(output))
+		if !ok {
+			example.Failed = exampleFailure(string(output))
+			warn("the output of %s in %s: %s", example.Name, test.source, example.Failed)
+			continue
+		}
+		example.Ran, example.Output = true, strings.Split(got, "\n")
+	}
+	return nil
+}
+
+// exampleGot returns what a failed example printed, from the got/want
+// report of go test.
+func exampleGot(output string) (string, bool) {
+	_, rest, ok := strings.Cut(output, "\ngot:\n")
+	if !ok {
+		return "", false
+	}
+	got, _, ok := strings.Cut(rest, "\nwant:\n")
+	return got, ok
+}
+
+// exampleFailure returns the first line of the report of an example that
+// failed other than by its output, such as "panic: ...".
+func exampleFailure(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--- FAIL") {
+			line, _, _ = strings.Cut(line, " [recovered")
+			return line
+		}
+	}
+	return "it failed"
+}
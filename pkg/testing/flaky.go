@@ -0,0 +1,190 @@
+package testing
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+)
+
+// DefaultFlakyRuns is how many times test flaky runs each test by default.
+const DefaultFlakyRuns = 10
+
+// TestOutcomes counts how often a test passed and failed across runs.
+type TestOutcomes struct {
+	Package string
+	// Test is the test name, with subtests as Parent/Sub.
+	Test   string
+	Passed int
+	Failed int
+}
+
+// Name returns the test as package.Test.
+func (o TestOutcomes) Name() string {
+	return o.Package + "." + o.Test
+}
+
+// testEvent is a go test -json event.
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+	Elapsed float64
+	// ImportPath names the package of build-output and build-fail events.
+	ImportPath string
+}
+
+// DetectFlaky runs the tests under path runs times and returns the tests
+// that both passed and failed, as package.Test, sorted.
+func DetectFlaky(path string, runs int) ([]string, error) {
+	flaky, _, err := testOutcomes(path, runs)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(flaky))
+	for i, test := range flaky {
+		names[i] = test.Name()
+	}
+	return names, nil
+}
+
+// testOutcomes runs the tests under path runs times with go test -json
+// -count and returns the tests whose outcome varied and those that failed
+// every run, each sorted by package and test.
+func testOutcomes(path string, runs int) (flaky []TestOutcomes, failing []TestOutcomes, err error) {
+	if runs < 2 {
+		return nil, nil, fmt.Errorf("invalid count %d (expected at least 2 runs to compare)", runs)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	// -count also bypasses the test cache, so every run executes
+	cmd := proc.Command("go", "test", "-json", fmt.Sprintf("-count=%d", runs), "./...")
+	cmd.Dir = absPath
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, runErr := cmd.Output()
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		return nil, nil, fmt.Errorf("failed to run tests: %w", runErr)
+	}
+
+	outcomes, buildOutput, err := parseTestEvents(strings.NewReader(string(output)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse go test output: %w", err)
+	}
+	// Failing tests make go test exit 1; without any test results, the
+	// tests did not build
+	if runErr != nil && len(outcomes) == 0 {
+		return nil, nil, fmt.Errorf("failed to run tests: %w\nOutput: %s%s", runErr, buildOutput, stderr.String())
+	}
+	if buildOutput != "" {
+		fmt.Fprintf(os.Stderr, "WARNING: some packages failed to build and were not checked:\n%s", buildOutput)
+	}
+
+	for _, test := range outcomes {
+		switch {
+		case test.Passed > 0 && test.Failed > 0:
+			flaky = append(flaky, *test)
+		case test.Failed > 0:
+			failing = append(failing, *test)
+		}
+	}
+	for _, tests := range [][]TestOutcomes{flaky, failing} {
+		sort.Slice(tests, func(i, j int) bool {
+			if tests[i].Package != tests[j].Package {
+				return tests[i].Package < tests[j].Package
+			}
+			return tests[i].Test < tests[j].Test
+		})
+	}
+	return flaky, failing, nil
+}
+
+// parseTestEvents counts the passes and failures of each test in a go test
+// -json event stream, and returns the output of failed builds. Lines that
+// are not events are skipped; skipped tests are not counted.
+func parseTestEvents(r io.Reader) (map[string]*TestOutcomes, string, error) {
+	outcomes := make(map[string]*TestOutcomes)
+	var buildOutput strings.Builder
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var event testEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, "", err
+		}
+		if event.Action == "build-output" {
+			buildOutput.WriteString(event.Output)
+		}
+		if event.Test == "" || (event.Action != "pass" && event.Action != "fail") {
+			continue
+		}
+		key := event.Package + "\x00" + event.Test
+		test := outcomes[key]
+		if test == nil {
+			test = &TestOutcomes{Package: event.Package, Test: event.Test}
+			outcomes[key] = test
+		}
+		if event.Action == "pass" {
+			test.Passed++
+		} else {
+			test.Failed++
+		}
+	}
+	return outcomes, buildOutput.String(), scanner.Err()
+}
+
+// AnalyzeFlaky runs the tests under path runs times and prints the tests
+// whose outcome varied between runs, with how often each passed and failed,
+// and the tests that failed every run. Flaky tests are a policy failure.
+func AnalyzeFlaky(path string, runs int) error {
+	logging.Infof("Running the tests at %s %d times to find flaky tests...\n", path, runs)
+
+	flaky, failing, err := testOutcomes(path, runs)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nFlaky Tests (%d):\n", len(flaky))
+	if len(flaky) == 0 {
+		fmt.Println("- None")
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TEST\tPACKAGE\tPASSED\tFAILED")
+		for _, test := range flaky {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\n", test.Test, test.Package, test.Passed, test.Failed)
+		}
+		tw.Flush()
+	}
+
+	if len(failing) > 0 {
+		fmt.Printf("\nTests Failing Every Run (%d):\n", len(failing))
+		for _, test := range failing {
+			fmt.Printf("- %s\n", test.Name())
+		}
+	}
+
+	if len(flaky) > 0 {
+		return exitcode.Policyf("%d flaky tests found in %d runs", len(flaky), runs)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package testing
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+)
+
+// FuzzTemplate is the template for Go fuzz tests. A function with an
+// inverse in the package checks that the inverse restores its input.
+const FuzzTemplate = `package {{.Package}}
+
+import (
+{{- if .Bytes}}
+	"bytes"
+{{- end}}
+	"testing"
+)
+{{range .Functions}}
+func Fuzz{{.Name}}(f *testing.F) {
+	{{- range .Seeds}}
+	f.Add({{.}})
+	{{- end}}
+	f.Fuzz(func(t *testing.T, {{.Params}}) {
+		{{- with .RoundTrip}}
+		encoded{{if .EncodeErr}}, err{{end}} := {{.Encoder}}({{.Input}})
+		{{- if .EncodeErr}}
+		if err != nil {
+			return
+		}
+		{{- end}}
+		decoded{{if .DecodeErr}}, err{{end}} := {{.Decoder}}(encoded)
+		{{- if .DecodeErr}}
+		if err != nil {
+			t.Fatalf("{{.Decoder}}({{.Encoder}}(%{{.Verb}})) error = %v", {{.Input}}, err)
+		}
+		{{- end}}
+		if {{if .Bytes}}!bytes.Equal(decoded, {{.Input}}){{else}}decoded != {{.Input}}{{end}} {
+			t.Errorf("{{.Decoder}}({{.Encoder}}(%{{.Verb}})) = %{{.Verb}}, want the input", {{.Input}}, decoded)
+		}
+		{{- else}}
+		// The fuzzer reports a panic as a failure
+		// TODO: Verify properties of the result
+		{{.Name}}({{.Args}})
+		{{- end}}
+	})
+}
+{{end}}`
+
+// FuzzData holds data for the fuzz test template.
+type FuzzData struct {
+	Package string
+	// Bytes is set when a round trip compares byte slices.
+	Bytes     bool
+	Functions []FuzzFunctionData
+}
+
+// FuzzFunctionData holds data about a function to fuzz.
+type FuzzFunctionData struct {
+	Name string
+	// Params declares the fuzz arguments and Args passes them on.
+	Params string
+	Args   string
+	// Seeds are the argument lists of the seed corpus entries.
+	Seeds []string
+	// RoundTrip is set when the package has the function's inverse.
+	RoundTrip *RoundTripData
+}
+
+// RoundTripData describes an encoder and its inverse.
+type RoundTripData struct {
+	Encoder string
+	Decoder string
+	// Input is the name of the encoder's argument.
+	Input string
+	// EncodeErr and DecodeErr are set when the functions also return an
+	// error.
+	EncodeErr bool
+	DecodeErr bool
+	// Bytes compares []byte values; Verb formats them.
+	Bytes bool
+	Verb  string
+}
+
+// DefaultFuzzPattern places each fuzz test file next to its source file.
+const DefaultFuzzPattern = "{dir}/{name}_fuzz_test.go"
+
+// fuzzSeeds maps each type go test can fuzz to a zero and a simple seed
+// value of exactly that type.
+var fuzzSeeds = map[string][2]string{
+	"string":  {`""`, `"hello"`},
+	"[]byte":  {`[]byte("")`, `[]byte("hello")`},
+	"bool":    {"false", "true"},
+	"int":     {"0", "1"},
+	"int8":    {"int8(0)", "int8(1)"},
+	"int16":   {"int16(0)", "int16(1)"},
+	"int32":   {"int32(0)", "int32(1)"},
+	"rune":    {"rune(0)", "'a'"},
+	"int64":   {"int64(0)", "int64(1)"},
+	"uint":    {"uint(0)", "uint(1)"},
+	"uint8":   {"uint8(0)", "uint8(1)"},
+	"byte":    {"byte(0)", "byte('a')"},
+	"uint16":  {"uint16(0)", "uint16(1)"},
+	"uint32":  {"uint32(0)", "uint32(1)"},
+	"uint64":  {"uint64(0)", "uint64(1)"},
+	"float32": {"float32(0)", "float32(1.5)"},
+	"float64": {"0.0", "1.5"},
+}
+
+// inversePrefixes pairs the name prefixes of functions and their inverses.
+var inversePrefixes = [][2]string{
+	{"Encode", "Decode"},
+	{"Marshal", "Unmarshal"},
+	{"Compress", "Decompress"},
+	{"Encrypt", "Decrypt"},
+	{"Escape", "Unescape"},
+	{"Quote", "Unquote"},
+}
+
+// generateFuzzForFile generates the fuzz test file for a single Go file
+// under root without writing it.
+func generateFuzzForFile(root string, path string, opts GenerateOptions) generatedTest {
+	test := generatedTest{source: path}
+	fail := func(err error) generatedTest {
+		test.err = err
+		return test
+	}
+
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return fail(fmt.Errorf("failed to parse Go file: %w", err))
+	}
+	packageName := node.Name.Name
+	// Inverses may be declared in any file of the package
+	decls, err := parsePackageDecls(filepath.Dir(path), packageName)
+	if err != nil {
+		return fail(err)
+	}
+
+	data := FuzzData{Package: packageName}
+	for _, decl := range node.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if reason := opts.filter.skip(fn, packageName); reason != "" {
+			test.skip(reason)
+			continue
+		}
+		target, reason := fuzzTarget(fn, decls)
+		if reason != "" {
+			test.skipped = append(test.skipped, fmt.Sprintf("%s in %s: %s", fn.Name.Name, path, reason))
+			test.skip(skipUnsupported)
+			continue
+		}
+		data.Bytes = data.Bytes || (target.RoundTrip != nil && target.RoundTrip.Bytes)
+		data.Functions = append(data.Functions, target)
+	}
+	if len(data.Functions) == 0 {
+		return test
+	}
+	test.covered = len(data.Functions)
+
+	outputPath, err := testOutputPath(root, path, packageName, opts)
+	if err != nil {
+		return fail(err)
+	}
+	source, err := renderTest(FuzzTemplate, data)
+	if err != nil {
+		return fail(err)
+	}
+	test.output, test.data = outputPath, source
+	return test
+}
+
+// fuzzTarget returns the fuzz test data of fn, or why it cannot be fuzzed.
+func fuzzTarget(fn *ast.FuncDecl, decls packageDecls) (FuzzFunctionData, string) {
+	switch {
+	case fn.Recv != nil:
+		return FuzzFunctionData{}, "methods are not fuzzed"
+	case fn.Type.TypeParams != nil:
+		return FuzzFunctionData{}, "generic functions are not fuzzed"
+	case fn.Type.Params.NumFields() == 0:
+		return FuzzFunctionData{}, "no parameters to fuzz"
+	}
+
+	target := FuzzFunctionData{Name: fn.Name.Name}
+	var params, args, zeros, simple []string
+	for _, field := range fn.Type.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			return FuzzFunctionData{}, "variadic functions are not fuzzed"
+		}
+		typeName := types.ExprString(field.Type)
+		seeds, ok := fuzzSeeds[typeName]
+		if !ok {
+			return FuzzFunctionData{}, fmt.Sprintf("parameter type %s cannot be fuzzed", typeName)
+		}
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{nil}
+		}
+		for _, name := range names {
+			arg := fmt.Sprintf("arg%d", len(args))
+			if name != nil && name.Name != "_" && !reservedVars[name.Name] && name.Name != "f" {
+				arg = name.Name
+			}
+			params = append(params, arg+" "+typeName)
+			args = append(args, arg)
+			zeros = append(zeros, seeds[0])
+			simple = append(simple, seeds[1])
+		}
+	}
+	target.Params = strings.Join(params, ", ")
+	target.Args = strings.Join(args, ", ")
+	target.Seeds = []string{strings.Join(zeros, ", "), strings.Join(simple, ", ")}
+	target.RoundTrip = roundTrip(fn, decls, args)
+	return target, ""
+}
+
+// roundTrip returns the round trip of fn through its inverse: a function
+// named after it with the inverse prefix, taking what fn returns and
+// returning fn's single argument, each optionally with an error.
+func roundTrip(fn *ast.FuncDecl, decls packageDecls, args []string) *RoundTripData {
+	if len(args) != 1 {
+		return nil
+	}
+	for _, prefix := range inversePrefixes {
+		suffix, ok := strings.CutPrefix(fn.Name.Name, prefix[0])
+		if !ok {
+			continue
+		}
+		inverse := decls.funcs[prefix[1]+suffix]
+		if inverse == nil || inverse.Type.Params.NumFields() != 1 {
+			return nil
+		}
+
+		input := types.ExprString(fn.Type.Params.List[0].Type)
+		encoded, encodeErr, ok := resultWithError(fn)
+		if !ok || input == "float32" || input == "float64" {
+			// NaN never equals itself
+			return nil
+		}
+		decoded, decodeErr, ok := resultWithError(inverse)
+		if !ok || decoded != input || types.ExprString(inverse.Type.Params.List[0].Type) != encoded {
+			return nil
+		}
+
+		roundTrip := &RoundTripData{
+			Encoder:   fn.Name.Name,
+			Decoder:   inverse.Name.Name,
+			Input:     args[0],
+			EncodeErr: encodeErr,
+			DecodeErr: decodeErr,
+			Bytes:     input == "[]byte",
+			Verb:      "v",
+		}
+		if input == "string" || input == "[]byte" {
+			roundTrip.Verb = "q"
+		}
+		return roundTrip
+	}
+	return nil
+}
+
+// resultWithError returns the type of a function's single result, which
+// may be followed by an error.
+func resultWithError(fn *ast.FuncDecl) (result string, withErr bool, ok bool) {
+	results := fn.Type.Results
+	switch results.NumFields() {
+	case 1:
+		return types.ExprString(results.List[0].Type), false, true
+	case 2:
+		last := results.List[len(results.List)-1].Type
+		if types.ExprString(last) != "error" || len(results.List[0].Names) > 1 {
+			return "", false, false
+		}
+		return types.ExprString(results.List[0].Type), true, true
+	}
+	return "", false, false
+}
@@ -0,0 +1,100 @@
+package testing_test
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gftesting "goforge/pkg/testing"
+)
+
+// copyFixture copies the module under testdata/name to a temporary
+// directory, so that generated files do not land in the source tree.
+func copyFixture(t *testing.T, name string) string {
+	t.Helper()
+	src := filepath.Join("testdata", name)
+	dst := t.TempDir()
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+	if err != nil {
+		t.Fatalf("failed to copy fixture %s: %v", name, err)
+	}
+	return dst
+}
+
+// goCommand runs the go command in dir and returns its combined output.
+func goCommand(dir string, args ...string) (string, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func TestGenerateTestsCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		opts gftesting.GenerateOptions
+	}{
+		{"std", gftesting.GenerateOptions{Style: gftesting.StyleStd}},
+		{"std table", gftesting.GenerateOptions{Style: gftesting.StyleStd, Table: true}},
+		{"std unexported", gftesting.GenerateOptions{Style: gftesting.StyleStd, IncludeUnexported: true}},
+		{"testify", gftesting.GenerateOptions{Style: gftesting.StyleTestify}},
+		{"testify unexported", gftesting.GenerateOptions{Style: gftesting.StyleTestify, IncludeUnexported: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := copyFixture(t, "generate")
+			if tt.opts.Style == gftesting.StyleTestify {
+				if output, err := goCommand(dir, "mod", "download"); err != nil {
+					t.Skipf("testify is not available: %v\n%s", err, output)
+				}
+			}
+
+			if err := gftesting.GenerateTests(dir, tt.opts); err != nil {
+				t.Fatalf("GenerateTests: %v", err)
+			}
+			generated, err := filepath.Glob(filepath.Join(dir, "*", "*_test.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(generated) != 2 {
+				t.Fatalf("generated %d test files, want 2: %v", len(generated), generated)
+			}
+			if tt.opts.Style == gftesting.StyleTestify {
+				data, err := os.ReadFile(filepath.Join(dir, "text", "text_test.go"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(data), "github.com/stretchr/testify") {
+					t.Errorf("testify tests do not import testify:\n%s", data)
+				}
+			}
+
+			if output, err := goCommand(dir, "vet", "./..."); err != nil {
+				t.Errorf("generated tests do not compile: %v\n%s", err, output)
+			}
+			if output, err := goCommand(dir, "test", "-run", "xxx", "./..."); err != nil {
+				t.Errorf("generated tests do not build: %v\n%s", err, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package testing
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GoldenTemplate is the template for Go tests that compare the output of
+// functions with golden files. Functions without output to compare get the
+// tests of TestTemplate.
+const GoldenTemplate = `package {{.Package}}
+
+import (
+{{- if .Bytes}}
+	"bytes"
+{{- end}}
+	"testing"
+)
+{{range .Functions}}
+{{- if .Golden}}
+func Test{{.TestName}}(t *testing.T) {
+	{{- with .Receiver}}
+	{{- if .Note}}
+	// TODO: {{.Note}}
+	{{- end}}
+	{{- range .Setup}}
+	{{.}}
+	{{- end}}
+	{{- end}}
+	{{- if .Writer}}
+	var buf bytes.Buffer
+	{{- end}}
+	{{- if .Inputs}}
+	// TODO: Pass the inputs whose output the golden file holds
+	{{- end}}
+	{{.Assign}}{{.Call}}
+	{{- if .Err}}
+	if err != nil {
+		t.Fatalf("{{.Qualified}}() error = %v", err)
+	}
+	{{- end}}
+	checkGolden(t, "{{.TestName}}", {{.Output}})
+}
+{{- else}}
+{{- template "function" .FunctionData}}
+{{- end}}
+{{end}}` + testFuncTemplate
+
+// GoldenHelperTemplate is the template of the file declaring the
+// checkGolden helper of golden tests, and the -update flag unless the
+// package's tests declare it already.
+const GoldenHelperTemplate = `package {{.Package}}
+
+import (
+	"bytes"
+{{- if .Flag}}
+	"flag"
+{{- end}}
+	"os"
+	"path/filepath"
+	"testing"
+)
+{{- if .Flag}}
+
+// update rewrites the golden files with the current output: go test -update
+var update = flag.Bool("update", false, "update the golden files in testdata")
+{{- end}}
+
+// checkGolden compares got with the golden file testdata/<name>.golden, or
+// first writes it there when the tests run with -update. Line endings are
+// normalized, so golden files checked out with CRLF line endings match.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	got = bytes.ReplaceAll(got, []byte("\r\n"), []byte("\n"))
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create the golden file directory: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("failed to update the golden file: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the golden file (run go test -update to create it): %v", err)
+	}
+	want = bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n"))
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (run go test -update to accept it)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+`
+
+// GoldenHelperFile is the name of the file GoldenHelperTemplate is written
+// to, next to the generated tests.
+const GoldenHelperFile = "golden_test.go"
+
+// GoldenData holds data for the golden test template.
+type GoldenData struct {
+	Package string
+	// Bytes is set when a test captures output in a bytes.Buffer.
+	Bytes     bool
+	Functions []GoldenFunctionData
+}
+
+// GoldenFunctionData holds data about a function or method whose output a
+// golden test checks.
+type GoldenFunctionData struct {
+	FunctionData
+	// Golden is set when the output is checked against a golden file;
+	// otherwise the test is a stub.
+	Golden bool
+	// Qualified names the function, or the method as Type.Method.
+	Qualified string
+	// Writer is set when the function writes its output to an io.Writer
+	// argument, a bytes.Buffer named buf.
+	Writer bool
+	// Inputs is set when the call passes zero values to fill in.
+	Inputs bool
+	// Assign assigns the results of Call, which returns an error when Err
+	// is set. Output is the output as a []byte.
+	Assign string
+	Call   string
+	Err    bool
+	Output string
+}
+
+// GoldenHelperData holds data for the golden helper template.
+type GoldenHelperData struct {
+	Package string
+	// Flag is set when the package's tests do not declare update yet.
+	Flag bool
+}
+
+// Why functions get a stub instead of a golden test, as the summary counts
+// them.
+const (
+	stubNoOutput = "no []byte or string result and no io.Writer parameter"
+	stubGeneric  = "generic"
+	stubArgs     = "arguments without a simple zero value"
+)
+
+// goldenData returns the template data of the golden tests of functions,
+// declared in file by fns, and counts the stubs in test.
+func goldenData(file *ast.File, functions []FunctionData, fns []*ast.FuncDecl, decls packageDecls, test *generatedTest) GoldenData {
+	data := GoldenData{Package: file.Name.Name}
+	for i, function := range functions {
+		golden, reason := goldenFunction(file, function, fns[i], decls)
+		if reason != "" {
+			if test.stubs == nil {
+				test.stubs = make(map[string]int)
+			}
+			test.stubs[reason]++
+		} else {
+			test.golden++
+		}
+		data.Bytes = data.Bytes || golden.Writer
+		data.Functions = append(data.Functions, golden)
+	}
+	return data
+}
+
+// goldenFunction returns the golden test data of function, declared by fn,
+// or why its test is a stub. A function qualifies when it returns a []byte
+// or string, optionally followed by an error, or takes a single io.Writer,
+// and the rest of its arguments have zero values.
+func goldenFunction(file *ast.File, function FunctionData, fn *ast.FuncDecl, decls packageDecls) (GoldenFunctionData, string) {
+	stub := GoldenFunctionData{FunctionData: function}
+	golden := GoldenFunctionData{FunctionData: function, Golden: true, Qualified: function.Name}
+	callee := function.Name
+	if receiver := function.Receiver; receiver != nil {
+		if len(receiver.Setup) == 0 {
+			return stub, stubGeneric
+		}
+		golden.Qualified = receiver.Type + "." + function.Name
+		callee = receiver.Var + "." + function.Name
+	}
+	if fn.Type.TypeParams != nil {
+		return stub, stubGeneric
+	}
+
+	writer := ioWriterType(file)
+	var args []string
+	for _, field := range fn.Type.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			// Variadic arguments can be left out
+			continue
+		}
+		for k := 0; k < fieldCount(field); k++ {
+			if writer != "" && types.ExprString(field.Type) == writer {
+				if golden.Writer {
+					return stub, stubArgs
+				}
+				golden.Writer = true
+				args = append(args, "&buf")
+				continue
+			}
+			zero, ok := zeroValue(field.Type, decls, 0)
+			if !ok {
+				return stub, stubArgs
+			}
+			golden.Inputs = true
+			args = append(args, zero)
+		}
+	}
+	golden.Call = fmt.Sprintf("%s(%s)", callee, strings.Join(args, ", "))
+
+	var results []string
+	if fn.Type.Results != nil {
+		for _, field := range fn.Type.Results.List {
+			for k := 0; k < fieldCount(field); k++ {
+				results = append(results, types.ExprString(field.Type))
+			}
+		}
+	}
+	if n := len(results); n > 0 && results[n-1] == "error" {
+		golden.Err, results = true, results[:n-1]
+	}
+
+	var names []string
+	switch {
+	case golden.Writer:
+		golden.Output = "buf.Bytes()"
+		for range results {
+			names = append(names, "_")
+		}
+	case len(results) == 1 && results[0] == "[]byte":
+		golden.Output, names = "got", []string{"got"}
+	case len(results) == 1 && results[0] == "string":
+		golden.Output, names = "[]byte(got)", []string{"got"}
+	default:
+		return stub, stubNoOutput
+	}
+	if golden.Err {
+		names = append(names, "err")
+	}
+
+	declares := false
+	for _, name := range names {
+		declares = declares || (name != "_" && name != "err")
+	}
+	switch {
+	case len(names) == 0 || (!golden.Err && !declares):
+	case !declares && declaresErr(function.Receiver):
+		// The receiver's constructor declared err already
+		golden.Assign = strings.Join(names, ", ") + " = "
+	default:
+		golden.Assign = strings.Join(names, ", ") + " := "
+	}
+	return golden, ""
+}
+
+// ioWriterType returns how file refers to io.Writer, or "" when it does
+// not import io.
+func ioWriterType(file *ast.File) string {
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err != nil || path != "io" {
+			continue
+		}
+		switch {
+		case spec.Name == nil:
+			return "io.Writer"
+		case spec.Name.Name != "_" && spec.Name.Name != ".":
+			return spec.Name.Name + ".Writer"
+		}
+	}
+	return ""
+}
+
+// goldenHelpers returns the helper files of the directories the golden
+// tests among tests are written to, except those whose tests declare
+// checkGolden already.
+func goldenHelpers(tests []generatedTest) ([]generatedTest, error) {
+	packages := make(map[string]string)
+	for _, test := range tests {
+		if test.golden > 0 && test.output != "" {
+			packages[filepath.Dir(test.output)] = test.pkg
+		}
+	}
+	dirs := make([]string, 0, len(packages))
+	for dir := range packages {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var helpers []generatedTest
+	for _, dir := range dirs {
+		declared, err := testDecls(dir)
+		if err != nil {
+			return nil, err
+		}
+		if declared["checkGolden"] {
+			continue
+		}
+		data := GoldenHelperData{Package: packages[dir], Flag: !declared["update"]}
+		source, err := renderTest(GoldenHelperTemplate, data)
+		if err != nil {
+			return nil, err
+		}
+		helpers = append(helpers, generatedTest{
+			source: dir,
+			output: filepath.Join(dir, GoldenHelperFile),
+			data:   source,
+		})
+	}
+	return helpers, nil
+}
+
+// testDecls returns the names of the package-level functions and variables
+// the test files in dir declare.
+func testDecls(dir string) (map[string]bool, error) {
+	declared := make(map[string]bool)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return declared, nil
+		}
+		return nil, fmt.Errorf("failed to read test directory: %w", err)
+	}
+
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, entry.Name()), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					declared[decl.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if spec, ok := spec.(*ast.ValueSpec); ok {
+						for _, name := range spec.Names {
+							declared[name.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	return declared, nil
+}
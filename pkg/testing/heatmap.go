@@ -0,0 +1,138 @@
+package testing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"goforge/pkg/module"
+)
+
+// DefaultTerminalFiles is how many of the least-covered files the terminal
+// coverage prints by default.
+const DefaultTerminalFiles = 3
+
+// ANSI colors of covered and uncovered lines.
+const (
+	colorCovered   = "\x1b[32m"
+	colorUncovered = "\x1b[31m"
+	colorReset     = "\x1b[0m"
+)
+
+// PrintTerminalCoverage prints the source of the topN least-covered files
+// of a coverage profile, each line marked + when the tests ran it and -
+// when they did not, and colored green or red on a terminal unless
+// NO_COLOR is set. Lines without statements, such as comments and
+// declarations, are left plain. Fully covered files are not printed. The
+// profile's module is found from the directory holding it, and the source
+// files are read from there.
+func PrintTerminalCoverage(profile string, topN int) error {
+	if topN < 1 {
+		return fmt.Errorf("invalid number of files %d (expected at least 1)", topN)
+	}
+
+	absProfile, err := filepath.Abs(profile)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	root, err := module.FindRoot(filepath.Dir(absProfile))
+	if err != nil {
+		return err
+	}
+	modulePath, err := module.Path(root)
+	if err != nil {
+		return err
+	}
+	blocks, err := readProfile(absProfile, modulePath)
+	if err != nil {
+		return err
+	}
+
+	type fileCoverage struct {
+		path string
+		coverageCounts
+	}
+	var files []fileCoverage
+	for file, fileBlocks := range blocks {
+		entry := fileCoverage{path: file}
+		for _, block := range fileBlocks {
+			entry.add(block)
+		}
+		if entry.statements > 0 && entry.covered < entry.statements {
+			files = append(files, entry)
+		}
+	}
+	// Least covered first, then those with the most statements left to cover
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.percent() != b.percent() {
+			return a.percent() < b.percent()
+		}
+		if a.statements-a.covered != b.statements-b.covered {
+			return a.statements-a.covered > b.statements-b.covered
+		}
+		return a.path < b.path
+	})
+	if len(files) > topN {
+		files = files[:topN]
+	}
+
+	fmt.Printf("\nLeast Covered Files (%d):\n", len(files))
+	if len(files) == 0 {
+		fmt.Println("- None")
+		return nil
+	}
+	color := useColor()
+	for _, file := range files {
+		fmt.Printf("\n== %s: %.1f%% (%d/%d statements) ==\n", file.path, file.percent(), file.covered, file.statements)
+		src, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(file.path)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: cannot show %s: %v\n", file.path, err)
+			continue
+		}
+		printHeatmap(strings.TrimSuffix(string(src), "\n"), blocks[file.path], color)
+	}
+	return nil
+}
+
+// printHeatmap prints the lines of src with their line numbers, marking
+// those that the profile blocks cover.
+func printHeatmap(src string, blocks []profileBlock, color bool) {
+	lines := strings.Split(src, "\n")
+	width := len(fmt.Sprint(len(lines)))
+	for i, line := range lines {
+		number := i + 1
+		statement, covered := false, false
+		for _, block := range blocks {
+			if number >= block.startLine && number <= block.endLine {
+				statement = true
+				covered = covered || block.count > 0
+			}
+		}
+
+		marker, start, end := " ", "", ""
+		switch {
+		case statement && covered:
+			marker, start = "+", colorCovered
+		case statement:
+			marker, start = "-", colorUncovered
+		}
+		if color && start != "" {
+			end = colorReset
+		} else {
+			start = ""
+		}
+		fmt.Printf("%s%*d %s %s%s\n", start, width, number, marker, line, end)
+	}
+}
+
+// useColor reports whether stdout is a terminal that should get colors.
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
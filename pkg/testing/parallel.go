@@ -0,0 +1,650 @@
+package testing
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/safewrite"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// ParallelizeOptions configures Parallelize.
+type ParallelizeOptions struct {
+	// Check reports the tests that could run in parallel without changing
+	// any file, and fails when there are some.
+	Check bool
+}
+
+// parallelTest is a test or subtest Parallelize looked at; reason is why
+// it was left sequential.
+type parallelTest struct {
+	file   string
+	line   int
+	name   string
+	reason string
+}
+
+// parallelFile is what Parallelize found in a test file: the tests it
+// makes parallel, those it skips, and how many run in parallel already.
+type parallelFile struct {
+	tests   []parallelTest
+	skipped []parallelTest
+	already int
+	// out is the rewritten source, nil when nothing changes.
+	out []byte
+}
+
+// stateCalls are the calls that change process-wide state, which parallel
+// tests would share, by the package they are called on; "" stands for the
+// methods of testing.T, which panic in parallel tests.
+var stateCalls = map[string][]string{
+	"os": {"Chdir", "Setenv", "Unsetenv", "Clearenv"},
+	"":   {"Chdir", "Setenv"},
+}
+
+// Parallelize inserts t.Parallel() into the top-level tests and subtests
+// under path that do not call it yet. Tests are skipped, with the reason
+// reported, when they change process-wide state: call t.Setenv, t.Chdir,
+// os.Chdir, or os.Setenv, or assign package-level variables, either of
+// their own package or of an imported one. The check only looks at the
+// test's own body, not at the functions it calls. Subtests of a skipped
+// test are skipped too. In modules before Go 1.22, where loop variables
+// are shared by iterations, a subtest made parallel gets a copy of the
+// loop variables it uses, such as tt := tt.
+func Parallelize(path string, opts ParallelizeOptions) error {
+	logging.Infoln("Parallelizing tests in:", path)
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	fi, err := os.Stat(absPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat path: %w", err)
+	}
+
+	var root string
+	var files []string
+	if fi.IsDir() {
+		root = absPath
+		err := filepath.WalkDir(absPath, func(path string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				name := entry.Name()
+				if path != absPath && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(path, "_test.go") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error walking directory: %w", err)
+		}
+	} else if strings.HasSuffix(absPath, "_test.go") {
+		root = filepath.Dir(absPath)
+		files = []string{absPath}
+	} else {
+		return fmt.Errorf("path must be a directory or a _test.go file")
+	}
+
+	shadow, err := sharesLoopVars(absPath)
+	if err != nil {
+		return err
+	}
+
+	dryRun := safewrite.DryRun()
+	vars := make(map[string]map[string]map[string]bool)
+	var tests, skipped []parallelTest
+	already, changed := 0, 0
+	for _, file := range files {
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			rel = file
+		}
+		dir := filepath.Dir(file)
+		if vars[dir] == nil {
+			vars[dir] = packageVars(dir)
+		}
+
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+		result, err := parallelizeFile(rel, src, vars[dir], shadow)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: skipping %s: %v\n", rel, err)
+			continue
+		}
+		tests = append(tests, result.tests...)
+		skipped = append(skipped, result.skipped...)
+		already += result.already
+		if result.out == nil {
+			continue
+		}
+		changed++
+		if opts.Check {
+			continue
+		}
+		if dryRun {
+			fmt.Print(safewrite.UnifiedDiff(filepath.ToSlash(rel), src, result.out))
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", rel, err)
+		}
+		if err := os.WriteFile(file, result.out, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+		fmt.Printf("Parallelized %s (%d tests)\n", rel, len(result.tests))
+	}
+
+	if opts.Check {
+		fmt.Printf("\nCan run in parallel (%d):\n", len(tests))
+		printParallelTests(tests)
+	}
+	fmt.Printf("\nSkipped (%d):\n", len(skipped))
+	printParallelTests(skipped)
+
+	verb := "made parallel"
+	switch {
+	case opts.Check:
+		verb = "can run in parallel"
+	case dryRun:
+		verb = "would be made parallel"
+	}
+	fmt.Printf("\n%d tests %s in %d files, %d skipped, %d parallel already\n", len(tests), verb, changed, len(skipped), already)
+
+	if opts.Check && len(tests) > 0 {
+		return exitcode.Policyf("%d tests do not call t.Parallel()", len(tests))
+	}
+	return nil
+}
+
+// printParallelTests lists tests as file:line name, with the reason they
+// were skipped.
+func printParallelTests(tests []parallelTest) {
+	if len(tests) == 0 {
+		fmt.Println("- None")
+		return
+	}
+	for _, test := range tests {
+		line := fmt.Sprintf("- %s:%d %s", test.file, test.line, test.name)
+		if test.reason != "" {
+			line += ": " + test.reason
+		}
+		fmt.Println(line)
+	}
+}
+
+// sharesLoopVars reports whether the module of path predates Go 1.22, so
+// that closures capturing a loop variable see its last value. Code outside
+// a module is treated as old.
+func sharesLoopVars(path string) (bool, error) {
+	root, err := module.FindRoot(path)
+	if err != nil {
+		return true, nil
+	}
+	goVersion, _, err := module.GoVersion(root)
+	if err != nil {
+		return false, err
+	}
+	// A go.mod without a go directive means Go 1.16
+	return goVersion == "" || module.CompareGoVersions(goVersion, "1.22") < 0, nil
+}
+
+// packageVars returns the names of the package-level variables the Go files
+// in dir declare, by package name, so that the test files of a package and
+// of its external _test package are told apart.
+func packageVars(dir string) map[string]map[string]bool {
+	vars := make(map[string]map[string]bool)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return vars
+	}
+
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, entry.Name()), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		if vars[file.Name.Name] == nil {
+			vars[file.Name.Name] = make(map[string]bool)
+		}
+		for _, decl := range file.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.VAR {
+				for _, spec := range gen.Specs {
+					for _, name := range spec.(*ast.ValueSpec).Names {
+						vars[file.Name.Name][name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	return vars
+}
+
+// parallelizer finds the tests of a file that can run in parallel and the
+// insertions that make them.
+type parallelizer struct {
+	file *ast.File
+	fset *token.FileSet
+	rel  string
+	// testing is the name the file imports the testing package as, imports
+	// the names of all its imports, and vars the package-level variables
+	// of its package.
+	testing string
+	imports map[string]bool
+	vars    map[string]bool
+	shadow  bool
+
+	result parallelFile
+	// inserts are the statements to insert after the opening brace at each
+	// offset.
+	inserts map[int][]string
+}
+
+// parallelizeFile finds the tests in src, the test file rel, that can run
+// in parallel and returns the file with t.Parallel() inserted into them,
+// formatted like gofmt. Inserting text rather than printing a rewritten
+// syntax tree keeps the comments where they are.
+func parallelizeFile(rel string, src []byte, vars map[string]map[string]bool, shadow bool) (parallelFile, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, rel, src, parser.ParseComments)
+	if err != nil {
+		return parallelFile{}, err
+	}
+
+	p := &parallelizer{
+		file:    file,
+		fset:    fset,
+		rel:     filepath.ToSlash(rel),
+		imports: make(map[string]bool),
+		vars:    vars[file.Name.Name],
+		shadow:  shadow,
+		inserts: make(map[int][]string),
+	}
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := importName(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		p.imports[name] = true
+		if importPath == "testing" {
+			p.testing = name
+		}
+	}
+	if p.testing == "" {
+		return p.result, nil
+	}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Body == nil || !strings.HasPrefix(fn.Name.Name, "Test") || fn.Name.Name == "TestMain" {
+			continue
+		}
+		if _, ok := p.testParam(fn.Type); ok {
+			p.visitTest(fn.Name.Name, fn.Type, fn.Body, "", nil)
+		}
+	}
+	if len(p.inserts) == 0 {
+		return p.result, nil
+	}
+
+	offsets := make([]int, 0, len(p.inserts))
+	for offset := range p.inserts {
+		offsets = append(offsets, offset)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	out := slices.Clone(src)
+	for _, offset := range offsets {
+		// The semicolon ends the statement even before code on the same
+		// line as the brace; gofmt drops it
+		text := "\n" + strings.Join(p.inserts[offset], "\n") + ";"
+		out = slices.Insert(out, offset, []byte(text)...)
+	}
+	if p.result.out, err = format.Source(out); err != nil {
+		return parallelFile{}, fmt.Errorf("failed to format the rewritten file: %w", err)
+	}
+	return p.result, nil
+}
+
+// testParam returns the name of the *testing.T parameter of a test or
+// subtest function, and whether fn takes one.
+func (p *parallelizer) testParam(fn *ast.FuncType) (string, bool) {
+	if len(fn.Params.List) != 1 || len(fn.Params.List[0].Names) > 1 {
+		return "", false
+	}
+	param := fn.Params.List[0]
+	if types.ExprString(param.Type) != "*"+p.testing+".T" {
+		return "", false
+	}
+	if len(param.Names) == 0 {
+		return "", true
+	}
+	return param.Names[0].Name, true
+}
+
+// visitTest makes the test name, with the signature fn and body, parallel
+// when it is safe, then visits its subtests. parentReason is why the
+// enclosing test was skipped, and loops are the loops of the enclosing
+// test around a subtest.
+func (p *parallelizer) visitTest(name string, fn *ast.FuncType, body *ast.BlockStmt, parentReason string, loops []ast.Stmt) {
+	t, _ := p.testParam(fn)
+	test := parallelTest{file: p.rel, line: p.fset.Position(body.Pos()).Line, name: name}
+	if t == "" || t == "_" {
+		test.reason = "its *testing.T parameter is unnamed"
+		p.result.skipped = append(p.result.skipped, test)
+		return
+	}
+
+	// Subtests are skipped for the same reason as their parent
+	reason := p.unsafe(body)
+	if reason == "" {
+		reason = parentReason
+	}
+	switch {
+	case p.callsParallel(body, t):
+		p.result.already++
+	case reason != "":
+		test.reason = reason
+		if reason == parentReason {
+			test.reason = "its parent test " + reason
+		}
+		p.result.skipped = append(p.result.skipped, test)
+	default:
+		p.result.tests = append(p.result.tests, test)
+		p.insert(body.Lbrace+1, t+".Parallel()")
+		if p.shadow {
+			p.shadowLoopVars(body, loops)
+		}
+	}
+
+	preorderStack(body, func(n ast.Node, stack []ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 2 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Run" {
+			return true
+		}
+		if recv, ok := sel.X.(*ast.Ident); !ok || recv.Name != t {
+			return true
+		}
+		lit, ok := call.Args[1].(*ast.FuncLit)
+		if !ok {
+			return true
+		}
+		if _, ok := p.testParam(lit.Type); !ok {
+			return true
+		}
+
+		var inner []ast.Stmt
+		for _, node := range stack {
+			switch node.(type) {
+			case *ast.RangeStmt, *ast.ForStmt:
+				inner = append(inner, node.(ast.Stmt))
+			}
+		}
+		p.visitTest(name+"/"+subtestName(call.Args[0]), lit.Type, lit.Body, reason, inner)
+		return false
+	})
+}
+
+// subtestName returns the name a subtest is run with: the string itself
+// when it is a literal, or the expression, such as tt.name.
+func subtestName(arg ast.Expr) string {
+	if lit, ok := arg.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+		if name, err := strconv.Unquote(lit.Value); err == nil {
+			return strings.ReplaceAll(name, " ", "_")
+		}
+	}
+	return types.ExprString(arg)
+}
+
+// callsParallel reports whether body calls t.Parallel() as one of its
+// statements.
+func (p *parallelizer) callsParallel(body *ast.BlockStmt, t string) bool {
+	for _, stmt := range body.List {
+		expr, ok := stmt.(*ast.ExprStmt)
+		if !ok {
+			continue
+		}
+		call, ok := expr.X.(*ast.CallExpr)
+		if !ok {
+			continue
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Parallel" {
+			if recv, ok := sel.X.(*ast.Ident); ok && recv.Name == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unsafe returns why the test body cannot run in parallel with other
+// tests, or "" when nothing in it changes process-wide state.
+func (p *parallelizer) unsafe(body *ast.BlockStmt) string {
+	reason := ""
+	ast.Inspect(body, func(n ast.Node) bool {
+		if reason != "" {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			reason = p.stateCall(n)
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				return true
+			}
+			for _, lhs := range n.Lhs {
+				if reason = p.packageAssign(lhs); reason != "" {
+					break
+				}
+			}
+		case *ast.IncDecStmt:
+			reason = p.packageAssign(n.X)
+		case *ast.RangeStmt:
+			if n.Tok == token.ASSIGN {
+				for _, lhs := range []ast.Expr{n.Key, n.Value} {
+					if reason == "" && lhs != nil {
+						reason = p.packageAssign(lhs)
+					}
+				}
+			}
+		}
+		return reason == ""
+	})
+	return reason
+}
+
+// stateCall returns the reason a call makes a test unsafe to run in
+// parallel, or "" when it does not change process-wide state.
+func (p *parallelizer) stateCall(call *ast.CallExpr) string {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	recv, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	pkg := ""
+	if p.isImport(recv) {
+		pkg = recv.Name
+		if pkg != "os" {
+			return ""
+		}
+	}
+	if slices.Contains(stateCalls[pkg], sel.Sel.Name) {
+		return "calls " + types.ExprString(call.Fun)
+	}
+	return ""
+}
+
+// packageAssign returns the reason assigning lhs makes a test unsafe to run
+// in parallel: lhs is, or is part of, a package-level variable.
+func (p *parallelizer) packageAssign(lhs ast.Expr) string {
+	expr := lhs
+	for {
+		switch e := astutil.Unparen(expr).(type) {
+		case *ast.SelectorExpr:
+			if ident, ok := e.X.(*ast.Ident); ok && p.isImport(ident) {
+				return "assigns package-level variable " + types.ExprString(lhs)
+			}
+			expr = e.X
+			continue
+		case *ast.IndexExpr:
+			expr = e.X
+			continue
+		case *ast.StarExpr:
+			expr = e.X
+			continue
+		case *ast.Ident:
+			if p.isPackageVar(e) {
+				return "assigns package-level variable " + e.Name
+			}
+		}
+		return ""
+	}
+}
+
+// isImport reports whether ident refers to an imported package rather than
+// a local variable.
+func (p *parallelizer) isImport(ident *ast.Ident) bool {
+	return ident.Obj == nil && p.imports[ident.Name]
+}
+
+// isPackageVar reports whether ident refers to a package-level variable:
+// one declared in this file, or unresolved here and declared by another
+// file of the package.
+func (p *parallelizer) isPackageVar(ident *ast.Ident) bool {
+	if ident.Obj == nil {
+		return p.vars[ident.Name]
+	}
+	return ident.Obj.Kind == ast.Var && p.file.Scope.Lookup(ident.Name) == ident.Obj
+}
+
+// shadowLoopVars inserts a copy of each loop variable of loops that the
+// subtest body uses, unless the loop body copies it already.
+func (p *parallelizer) shadowLoopVars(body *ast.BlockStmt, loops []ast.Stmt) {
+	for _, loop := range loops {
+		var vars []*ast.Ident
+		var loopBody *ast.BlockStmt
+		switch loop := loop.(type) {
+		case *ast.RangeStmt:
+			if loop.Tok == token.DEFINE {
+				for _, expr := range []ast.Expr{loop.Key, loop.Value} {
+					if ident, ok := expr.(*ast.Ident); ok {
+						vars = append(vars, ident)
+					}
+				}
+			}
+			loopBody = loop.Body
+		case *ast.ForStmt:
+			if init, ok := loop.Init.(*ast.AssignStmt); ok && init.Tok == token.DEFINE {
+				for _, expr := range init.Lhs {
+					if ident, ok := expr.(*ast.Ident); ok {
+						vars = append(vars, ident)
+					}
+				}
+			}
+			loopBody = loop.Body
+		}
+
+		for _, v := range vars {
+			if v.Name == "_" || v.Obj == nil || !usesObject(body, v.Obj) || copiesVar(loopBody, v.Name) {
+				continue
+			}
+			p.insert(loopBody.Lbrace+1, v.Name+" := "+v.Name)
+		}
+	}
+}
+
+// usesObject reports whether node refers to obj.
+func usesObject(node ast.Node, obj *ast.Object) bool {
+	uses := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Obj == obj {
+			uses = true
+		}
+		return !uses
+	})
+	return uses
+}
+
+// copiesVar reports whether body starts a new copy of the variable name,
+// as in name := name.
+func copiesVar(body *ast.BlockStmt, name string) bool {
+	for _, stmt := range body.List {
+		assign, ok := stmt.(*ast.AssignStmt)
+		if !ok || assign.Tok != token.DEFINE || len(assign.Lhs) != len(assign.Rhs) {
+			continue
+		}
+		for i, lhs := range assign.Lhs {
+			l, lok := lhs.(*ast.Ident)
+			r, rok := assign.Rhs[i].(*ast.Ident)
+			if lok && rok && l.Name == name && r.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// insert adds stmt at the offset of pos, once.
+func (p *parallelizer) insert(pos token.Pos, stmt string) {
+	offset := p.fset.Position(pos).Offset
+	if !slices.Contains(p.inserts[offset], stmt) {
+		p.inserts[offset] = append(p.inserts[offset], stmt)
+	}
+}
+
+// preorderStack walks the tree rooted at root like ast.Inspect, passing f
+// the enclosing nodes of each node, outermost first. The children of a node
+// are skipped when f returns false.
+func preorderStack(root ast.Node, f func(n ast.Node, stack []ast.Node) bool) {
+	var stack []ast.Node
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if !f(n, stack) {
+			return false
+		}
+		stack = append(stack, n)
+		return true
+	})
+}
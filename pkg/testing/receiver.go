@@ -0,0 +1,247 @@
+package testing
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ReceiverData describes how a generated method test gets its receiver.
+type ReceiverData struct {
+	// Type is the name of the receiver's base type.
+	Type string
+	// Var is the variable holding the receiver.
+	Var string
+	// Setup holds the statements that declare Var and construct the
+	// receiver; it is empty when the receiver cannot be constructed, such
+	// as for a generic type.
+	Setup []string
+	// Note tells what is left to do to construct the receiver, if anything.
+	Note string
+}
+
+// reservedVars are the names the generated tests use themselves.
+var reservedVars = map[string]bool{"t": true, "tt": true, "tests": true, "err": true}
+
+// packageDecls are the declarations of a package that method tests build
+// their receivers from.
+type packageDecls struct {
+	// constructors maps a type name to the function named New<Type>.
+	constructors map[string]*ast.FuncDecl
+	// types maps the name of each non-generic type to its definition.
+	types map[string]ast.Expr
+	// funcs maps the name of each function to its declaration.
+	funcs map[string]*ast.FuncDecl
+}
+
+// parsePackageDecls collects the declarations of the non-test files of
+// package name in dir.
+func parsePackageDecls(dir string, name string) (packageDecls, error) {
+	decls := packageDecls{
+		constructors: make(map[string]*ast.FuncDecl),
+		types:        make(map[string]ast.Expr),
+		funcs:        make(map[string]*ast.FuncDecl),
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return decls, fmt.Errorf("failed to read package directory: %w", err)
+	}
+
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, entry.Name()), nil, parser.SkipObjectResolution)
+		if err != nil || file.Name.Name != name {
+			// The file being generated for reports its own parse errors
+			continue
+		}
+
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					decls.funcs[decl.Name.Name] = decl
+				}
+				if decl.Recv == nil && strings.HasPrefix(decl.Name.Name, "New") && decl.Type.TypeParams == nil {
+					decls.constructors[strings.TrimPrefix(decl.Name.Name, "New")] = decl
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if spec, ok := spec.(*ast.TypeSpec); ok && spec.TypeParams == nil {
+						decls.types[spec.Name.Name] = spec.Type
+					}
+				}
+			}
+		}
+	}
+	return decls, nil
+}
+
+// receiverType returns the name of the base type of a method's receiver
+// and whether the type is generic.
+func receiverType(fn *ast.FuncDecl) (name string, generic bool) {
+	expr := fn.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch index := expr.(type) {
+	case *ast.IndexExpr:
+		expr, generic = index.X, true
+	case *ast.IndexListExpr:
+		expr, generic = index.X, true
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name, generic
+	}
+	return "", false
+}
+
+// receiverData returns how the test of method fn constructs its receiver:
+// with the type's New<Type> function when the package has one that can be
+// called with zero values, and as the zero value otherwise. onErr returns
+// the statement run when the constructor returns an error.
+func receiverData(fn *ast.FuncDecl, typeName string, generic bool, decls packageDecls, onErr func(constructor string) string) ReceiverData {
+	receiver := ReceiverData{Type: typeName, Var: receiverVar(fn.Recv.List[0], typeName)}
+	if generic {
+		receiver.Note = fmt.Sprintf("Instantiate %s and call %s", typeName, fn.Name.Name)
+		return receiver
+	}
+
+	if constructor := decls.constructors[typeName]; constructor != nil {
+		if setup, ok := constructorCall(constructor, typeName, receiver.Var, decls, onErr); ok {
+			receiver.Setup = setup
+			if constructor.Type.Params.NumFields() > 0 {
+				receiver.Note = fmt.Sprintf("Pass real arguments to %s", constructor.Name.Name)
+			}
+			return receiver
+		}
+		receiver.Note = fmt.Sprintf("Construct %s with %s", receiver.Var, constructor.Name.Name)
+	}
+	receiver.Setup = []string{fmt.Sprintf("var %s %s", receiver.Var, typeName)}
+	return receiver
+}
+
+// receiverVar names the receiver variable as the method does, or after the
+// first letter of its type.
+func receiverVar(field *ast.Field, typeName string) string {
+	if len(field.Names) > 0 && field.Names[0].Name != "_" && !reservedVars[field.Names[0].Name] {
+		return field.Names[0].Name
+	}
+	first, _ := utf8.DecodeRuneInString(typeName)
+	if name := string(unicode.ToLower(first)); !reservedVars[name] {
+		return name
+	}
+	return "recv"
+}
+
+// testFatal is how a test handles an error from the constructor of its
+// receiver.
+func testFatal(constructor string) string {
+	return fmt.Sprintf("t.Fatalf(\"%s() error = %%v\", err)", constructor)
+}
+
+// constructorCall returns the statements assigning the result of
+// constructor, called with zero values, to name, running onErr's statement
+// if it returns an error. It fails when the
+// constructor does not return typeName or a pointer to it, optionally
+// followed by an error, or takes arguments whose zero value needs an
+// import.
+func constructorCall(constructor *ast.FuncDecl, typeName string, name string, decls packageDecls, onErr func(constructor string) string) ([]string, bool) {
+	results := constructor.Type.Results
+	if results.NumFields() == 0 || results.NumFields() > 2 {
+		return nil, false
+	}
+	result := results.List[0].Type
+	if star, ok := result.(*ast.StarExpr); ok {
+		result = star.X
+	}
+	if ident, ok := result.(*ast.Ident); !ok || ident.Name != typeName {
+		return nil, false
+	}
+	withErr := results.NumFields() == 2
+	if last := results.List[len(results.List)-1].Type; withErr && types.ExprString(last) != "error" {
+		return nil, false
+	}
+
+	var args []string
+	for _, param := range constructor.Type.Params.List {
+		if _, ok := param.Type.(*ast.Ellipsis); ok {
+			// Variadic arguments can be left out
+			continue
+		}
+		zero, ok := zeroValue(param.Type, decls, 0)
+		if !ok {
+			return nil, false
+		}
+		for k := 0; k < fieldCount(param); k++ {
+			args = append(args, zero)
+		}
+	}
+
+	call := fmt.Sprintf("%s(%s)", constructor.Name.Name, strings.Join(args, ", "))
+	if !withErr {
+		return []string{fmt.Sprintf("%s := %s", name, call)}, true
+	}
+	return []string{
+		fmt.Sprintf("%s, err := %s", name, call),
+		"if err != nil {",
+		onErr(constructor.Name.Name),
+		"}",
+	}, true
+}
+
+// maxTypeDepth bounds following named types to their definitions.
+const maxTypeDepth = 8
+
+// zeroValue returns an expression for the zero value of a type declared in
+// the package, or fails when the type comes from another package.
+func zeroValue(expr ast.Expr, decls packageDecls, depth int) (string, bool) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		switch expr.Name {
+		case "string":
+			return `""`, true
+		case "bool":
+			return "false", true
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+			"float32", "float64", "complex64", "complex128", "byte", "rune":
+			return "0", true
+		case "error", "any":
+			return "nil", true
+		}
+		definition, ok := decls.types[expr.Name]
+		if !ok || depth >= maxTypeDepth {
+			return "", false
+		}
+		if _, ok := definition.(*ast.StructType); ok {
+			return expr.Name + "{}", true
+		}
+		// Untyped constants and nil convert to the named type
+		return zeroValue(definition, decls, depth+1)
+	case *ast.StarExpr, *ast.MapType, *ast.FuncType, *ast.ChanType, *ast.InterfaceType:
+		return "nil", true
+	case *ast.ArrayType:
+		if expr.Len == nil {
+			return "nil", true
+		}
+	}
+	return "", false
+}
+
+// fieldCount returns how many parameters or results field declares: one
+// for each name, or one when they are unnamed.
+func fieldCount(field *ast.Field) int {
+	if len(field.Names) == 0 {
+		return 1
+	}
+	return len(field.Names)
+}
@@ -0,0 +1,356 @@
+package testing
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+	"goforge/pkg/proc"
+)
+
+// slowestPackages is how many of the slowest packages the summary lists.
+const slowestPackages = 5
+
+// RunOptions configures RunTests.
+type RunOptions struct {
+	// Race runs the tests with the race detector.
+	Race bool
+	// Vet runs go vet before the tests and includes its findings.
+	Vet bool
+	// Timeout is the go test -timeout of each package's test binary; zero
+	// keeps go test's default.
+	Timeout time.Duration
+	// Verbose streams the output of every test instead of only that of
+	// failing tests.
+	Verbose bool
+}
+
+// packageResult is the outcome of the tests of one package.
+type packageResult struct {
+	pkg     string
+	action  string
+	passed  int
+	failed  int
+	skipped int
+	elapsed time.Duration
+	// output is the package output not attributed to a test, printed when
+	// the package fails without a failing test, e.g. on a timeout.
+	output strings.Builder
+}
+
+// testRun follows a go test -json event stream, printing each package as
+// it finishes and the output of failing tests as they fail.
+type testRun struct {
+	w        io.Writer
+	verbose  bool
+	packages map[string]*packageResult
+	// outputs holds the running tests, keyed by package and test, with
+	// their output until they pass or fail.
+	outputs     map[string]*strings.Builder
+	buildFailed map[string]bool
+}
+
+// RunTests runs the tests under path, optionally after go vet and with the
+// race detector, streaming the result of each package as it finishes and
+// the output of failing tests, and then prints a summary of every package
+// and the slowest ones. Failing tests and vet findings are a policy
+// failure; packages that do not build are an error.
+func RunTests(path string, opts RunOptions) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return runTests(absPath, path, []string{"./..."}, opts)
+}
+
+// runTests runs the tests of the packages matching patterns in absPath,
+// given as path, like RunTests.
+func runTests(absPath string, path string, patterns []string, opts RunOptions) error {
+	if opts.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+
+	vetFindings := 0
+	if opts.Vet {
+		logging.Infof("Running go vet in %s\n", path)
+		var err error
+		if vetFindings, err = runVet(absPath, patterns); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"test", "-json"}
+	if opts.Race {
+		args = append(args, "-race")
+	}
+	if opts.Timeout > 0 {
+		args = append(args, "-timeout="+opts.Timeout.String())
+	}
+	args = append(args, patterns...)
+	if len(patterns) == 1 {
+		logging.Infof("\nRunning go %s in %s\n", strings.Join(args, " "), path)
+	} else {
+		logging.Infof("\nRunning go %s on %d packages in %s\n", strings.Join(args[:len(args)-len(patterns)], " "), len(patterns), path)
+	}
+
+	cmd := proc.Command("go", args...)
+	cmd.Dir = absPath
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to run tests: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run tests: %w", err)
+	}
+
+	run := &testRun{
+		w:           os.Stdout,
+		verbose:     opts.Verbose,
+		packages:    make(map[string]*packageResult),
+		outputs:     make(map[string]*strings.Builder),
+		buildFailed: make(map[string]bool),
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		run.handle(scanner.Bytes())
+	}
+	scanErr := scanner.Err()
+	waitErr := cmd.Wait()
+	if scanErr != nil {
+		return fmt.Errorf("failed to read go test output: %w", scanErr)
+	}
+	var exitErr *exec.ExitError
+	if waitErr != nil && !errors.As(waitErr, &exitErr) {
+		return fmt.Errorf("failed to run tests: %w", waitErr)
+	}
+
+	failedTests, failedPackages := run.printSummary()
+	switch {
+	case len(run.buildFailed) > 0:
+		return fmt.Errorf("%d packages failed to build or failed the vet checks of go test", len(run.buildFailed))
+	case waitErr != nil && failedPackages == 0:
+		// go test failed before running any package, e.g. on a bad pattern
+		return fmt.Errorf("failed to run tests: %w\nOutput: %s", waitErr, stderr.String())
+	}
+
+	var problems []string
+	if failedPackages > 0 {
+		problems = append(problems, fmt.Sprintf("%d tests failed in %d packages", failedTests, failedPackages))
+	}
+	if vetFindings > 0 {
+		problems = append(problems, fmt.Sprintf("go vet reported %d findings", vetFindings))
+	}
+	if len(problems) > 0 {
+		return exitcode.Policyf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// runVet runs go vet on the packages matching patterns in dir, prints its
+// findings, and returns how many there are.
+func runVet(dir string, patterns []string) (int, error) {
+	cmd := proc.Command("go", append([]string{"vet"}, patterns...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return 0, fmt.Errorf("failed to run go vet: %w", err)
+	}
+
+	var findings []string
+	for _, line := range strings.Split(string(output), "\n") {
+		// Findings are grouped under "# package" headers
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			findings = append(findings, line)
+		}
+	}
+	fmt.Printf("\nVet Findings (%d):\n", len(findings))
+	if len(findings) == 0 {
+		fmt.Println("- None")
+	}
+	for _, finding := range findings {
+		fmt.Printf("- %s\n", finding)
+	}
+	return len(findings), nil
+}
+
+// handle processes one line of go test -json output.
+func (r *testRun) handle(line []byte) {
+	var event testEvent
+	if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &event) != nil {
+		// Not an event; go test only prints these for problems
+		fmt.Fprintf(r.w, "%s\n", line)
+		return
+	}
+
+	switch event.Action {
+	case "build-output":
+		fmt.Fprint(r.w, event.Output)
+		return
+	case "build-fail":
+		r.buildFailed[event.ImportPath] = true
+		return
+	}
+	if event.Package == "" {
+		return
+	}
+	pkg := r.packages[event.Package]
+	if pkg == nil {
+		pkg = &packageResult{pkg: event.Package}
+		r.packages[event.Package] = pkg
+	}
+
+	if event.Test == "" {
+		r.handlePackage(pkg, event)
+		return
+	}
+	key := event.Package + "\x00" + event.Test
+	switch event.Action {
+	case "run":
+		r.outputs[key] = &strings.Builder{}
+	case "output":
+		if r.verbose {
+			fmt.Fprint(r.w, event.Output)
+			return
+		}
+		if r.outputs[key] == nil {
+			r.outputs[key] = &strings.Builder{}
+		}
+		r.outputs[key].WriteString(event.Output)
+	case "pass":
+		pkg.passed++
+		delete(r.outputs, key)
+	case "skip":
+		pkg.skipped++
+		delete(r.outputs, key)
+	case "fail":
+		pkg.failed++
+		if output := r.outputs[key]; output != nil && !r.verbose {
+			fmt.Fprint(r.w, output.String())
+		}
+		delete(r.outputs, key)
+	}
+}
+
+// handlePackage processes an event of a package as a whole.
+func (r *testRun) handlePackage(pkg *packageResult, event testEvent) {
+	switch event.Action {
+	case "output":
+		if r.verbose {
+			fmt.Fprint(r.w, event.Output)
+		} else if !isResultLine(event.Output) {
+			pkg.output.WriteString(event.Output)
+		}
+		return
+	case "pass", "fail", "skip":
+	default:
+		return
+	}
+
+	pkg.action = event.Action
+	pkg.elapsed = time.Duration(event.Elapsed * float64(time.Second))
+
+	// Tests still running when the package ends were cut short, by a
+	// timeout or a crash, and fail with it
+	var unfinished []string
+	for key := range r.outputs {
+		if strings.HasPrefix(key, pkg.pkg+"\x00") {
+			unfinished = append(unfinished, key)
+		}
+	}
+	sort.Strings(unfinished)
+	for _, key := range unfinished {
+		pkg.failed++
+		if !r.verbose {
+			fmt.Fprint(r.w, r.outputs[key].String())
+		}
+		delete(r.outputs, key)
+	}
+	switch {
+	case event.Action == "skip":
+		logging.Infof("?     %s [no test files]\n", pkg.pkg)
+	case event.Action == "pass":
+		logging.Infof("ok    %s %.2fs (%d passed, %d skipped)\n", pkg.pkg, event.Elapsed, pkg.passed, pkg.skipped)
+	default:
+		if !r.verbose && !r.buildFailed[pkg.pkg] {
+			// Output outside tests, such as a panic in TestMain
+			fmt.Fprint(r.w, pkg.output.String())
+		}
+		fmt.Fprintf(r.w, "FAIL  %s %.2fs (%d passed, %d failed, %d skipped)\n", pkg.pkg, event.Elapsed, pkg.passed, pkg.failed, pkg.skipped)
+	}
+}
+
+// isResultLine reports whether a line of package output is one of the
+// result lines go test ends a package with, which the summary replaces.
+func isResultLine(line string) bool {
+	line = strings.TrimSuffix(line, "\n")
+	return line == "PASS" || line == "FAIL" || strings.HasPrefix(line, "ok  \t") || strings.HasPrefix(line, "FAIL\t")
+}
+
+// printSummary prints the results of the packages with tests and the
+// slowest of them, and returns the number of failed tests and packages.
+func (r *testRun) printSummary() (int, int) {
+	var results []*packageResult
+	noTests := 0
+	passed, failed, skipped, failedPackages := 0, 0, 0, 0
+	for _, pkg := range r.packages {
+		switch pkg.action {
+		case "skip":
+			noTests++
+			continue
+		case "fail":
+			failedPackages++
+		case "":
+			// The package never finished, e.g. as the run was killed
+			continue
+		}
+		results = append(results, pkg)
+		passed, failed, skipped = passed+pkg.passed, failed+pkg.failed, skipped+pkg.skipped
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].pkg < results[j].pkg })
+
+	fmt.Fprintf(r.w, "\nTest Summary (%d packages", len(results))
+	if noTests > 0 {
+		fmt.Fprintf(r.w, ", %d without tests", noTests)
+	}
+	fmt.Fprintln(r.w, "):")
+	tw := tabwriter.NewWriter(r.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tSTATUS\tPASSED\tFAILED\tSKIPPED\tTIME")
+	for _, pkg := range results {
+		status := "ok"
+		if pkg.action == "fail" {
+			status = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%.2fs\n", pkg.pkg, status, pkg.passed, pkg.failed, pkg.skipped, pkg.elapsed.Seconds())
+	}
+	tw.Flush()
+
+	slowest := append([]*packageResult(nil), results...)
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].elapsed > slowest[j].elapsed })
+	if len(slowest) > slowestPackages {
+		slowest = slowest[:slowestPackages]
+	}
+	if len(slowest) > 0 {
+		fmt.Fprintf(r.w, "\nSlowest Packages (%d):\n", len(slowest))
+		for _, pkg := range slowest {
+			fmt.Fprintf(r.w, "- %s: %.2fs\n", pkg.pkg, pkg.elapsed.Seconds())
+		}
+	}
+
+	fmt.Fprintf(r.w, "\nTests: %d passed, %d failed, %d skipped\n", passed, failed, skipped)
+	return failed, failedPackages
+}
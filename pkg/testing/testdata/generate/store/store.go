@@ -0,0 +1,85 @@
+// Package store is a fixture for test generation: constructors, methods with
+// pointer and value receivers, generics, and errors.
+package store
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// ErrNotFound is returned for missing keys.
+var ErrNotFound = errors.New("not found")
+
+// Store is a key-value store.
+type Store struct {
+	items map[string]string
+}
+
+// NewStore returns an empty store.
+func NewStore() (*Store, error) {
+	return &Store{items: make(map[string]string)}, nil
+}
+
+// Get returns the value of key.
+func (s *Store) Get(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	value, ok := s.items[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Put sets the value of key.
+func (s *Store) Put(key, value string) {
+	s.items[key] = value
+}
+
+// Len returns the number of keys.
+func (s *Store) Len() int {
+	return len(s.items)
+}
+
+// Close releases the store.
+func (s *Store) Close() error {
+	return nil
+}
+
+// Box holds a value of any type.
+type Box[T any] struct {
+	value T
+}
+
+// Value returns the boxed value.
+func (b Box[T]) Value() T {
+	return b.value
+}
+
+// Identity returns k.
+func Identity[K comparable](k K) K {
+	return k
+}
+
+// Host returns the host of u and how long until timeout.
+func Host(u *url.URL, timeout time.Duration) (host string, left time.Duration) {
+	return u.Host, timeout
+}
+
+// Sum adds xs.
+func Sum(name string, xs ...int) int {
+	total := 0
+	for _, x := range xs {
+		total += x
+	}
+	return total
+}
+
+// lookup is unexported.
+func lookup(s *Store, key string) bool {
+	_, ok := s.items[key]
+	return ok
+}
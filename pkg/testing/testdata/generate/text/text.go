@@ -0,0 +1,39 @@
+// Package text is a fixture for test generation: plain functions over
+// strings, slices, readers, and writers.
+package text
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Parse parses a decimal number.
+func Parse(s string) (int, error) {
+	return strconv.Atoi(strings.TrimSpace(s))
+}
+
+// Words splits s into words.
+func Words(s string) []string {
+	return strings.Fields(s)
+}
+
+// Greet writes a greeting for name to w.
+func Greet(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "Hello, %s!\n", name)
+	return err
+}
+
+// Copy copies r to w.
+func Copy(w io.Writer, r io.Reader) (int64, error) {
+	return io.Copy(w, r)
+}
+
+// Upper returns s in upper case.
+func Upper(s string) string {
+	return strings.ToUpper(s)
+}
+
+// Noop does nothing.
+func Noop() {}
@@ -0,0 +1,363 @@
+package testing
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Styles of generated unit tests.
+const (
+	// StyleStd writes tests with the standard library only.
+	StyleStd = "std"
+	// StyleTestify calls the function under test and checks its results
+	// with github.com/stretchr/testify.
+	StyleTestify = "testify"
+)
+
+// Styles lists the supported test styles.
+var Styles = []string{StyleStd, StyleTestify}
+
+// testifyModule is the module the testify style imports.
+const testifyModule = "github.com/stretchr/testify"
+
+// TestifyTemplate is the template for Go tests in the testify style. Each
+// test calls the function with the inputs of its test cases, requires that
+// it returns no error, and asserts that the other results are as wanted.
+// Functions that cannot be called without more information, such as
+// generic ones, get a stub to fill in.
+const TestifyTemplate = `package {{.Package}}
+
+import (
+	"testing"
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+{{- if .ThirdParty}}
+{{range .ThirdParty}}
+	{{.}}
+{{- end}}
+{{- end}}
+)
+{{range .Functions}}
+func Test{{.TestName}}(t *testing.T) {
+	{{- if not .Call}}
+	{{- with .Receiver}}
+	{{- if .Note}}
+	// TODO: {{.Note}}
+	{{- end}}
+	{{- range .Setup}}
+	{{.}}
+	{{- end}}
+	{{- if .Setup}}
+	_ = {{.Var}}
+	{{- end}}
+	{{- end}}
+	// TODO: Write test for {{.Qualified}}
+	{{- else if .TableDriven}}
+	tests := []struct {
+		name string
+		{{- range .Params}}
+		{{.Name}} {{.Type}}
+		{{- end}}
+		{{- range .Results}}
+		{{.Want}} {{.Type}}
+		{{- end}}
+	}{
+		// TODO: Add test case inputs and expected results
+		{
+			name: "test case 1",
+		},
+		{
+			name: "test case 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			{{- template "call" .}}
+		})
+	}
+	{{- else}}
+	{{- if or .Params .Results}}
+	// TODO: Set the inputs and expected results
+	{{- end}}
+	{{- range .Params}}
+	var {{.Name}} {{.Type}}
+	{{- end}}
+	{{- range .Results}}
+	var {{.Want}} {{.Type}}
+	{{- end}}
+	{{- template "call" .}}
+	{{- end}}
+}
+{{end}}
+{{- define "call"}}
+{{- with .Receiver}}
+{{- if .Note}}
+// TODO: {{.Note}}
+{{- end}}
+{{- range .Setup}}
+{{.}}
+{{- end}}
+{{- end}}
+{{.Assign}}{{.Call}}
+{{- if .Err}}
+require.NoError(t, err)
+{{- end}}
+{{- range .Results}}
+assert.Equal(t, {{if $.TableDriven}}tt.{{end}}{{.Want}}, {{.Got}})
+{{- end}}
+{{- if not (or .Err .Results)}}
+// TODO: Verify the effects of {{.Qualified}}
+{{- end}}
+{{- end}}
+`
+
+// TestifyData holds data for the testify test template.
+type TestifyData struct {
+	Package string
+	// Imports are the import specs of the standard library packages the
+	// parameter and result types refer to, and ThirdParty those of the
+	// other packages, including the testify packages the tests use.
+	Imports    []string
+	ThirdParty []string
+	Functions  []TestifyFunctionData
+}
+
+// TestifyFunctionData holds data about a function or method to test in the
+// testify style.
+type TestifyFunctionData struct {
+	FunctionData
+	// Qualified names the function, or the method as Type.Method.
+	Qualified string
+	// Params are the inputs of each test case, and Results the results
+	// other than a final error, which Err reports.
+	Params  []TestifyParam
+	Results []TestifyResult
+	Err     bool
+	// Assign assigns the results, such as "got, err := ", and Call calls
+	// the function with the inputs. Call is empty when the function cannot
+	// be called, and the test is a stub.
+	Assign string
+	Call   string
+}
+
+// TestifyParam is an input of the function under test.
+type TestifyParam struct {
+	Name string
+	Type string
+}
+
+// TestifyResult is a result of the function under test: Got holds it and
+// Want the expected value.
+type TestifyResult struct {
+	Got  string
+	Want string
+	Type string
+}
+
+// testifyReserved are the names testify tests use themselves.
+var testifyReserved = regexp.MustCompile(`^(t|tt|tests|name|err|testing|require|assert|(got|want)[0-9]*)$`)
+
+// testifyData returns the template data of the testify tests of functions,
+// declared in file by decls.
+func testifyData(file *ast.File, functions []FunctionData, decls []*ast.FuncDecl) TestifyData {
+	data := TestifyData{Package: file.Name.Name}
+	imports := make(map[string]bool)
+	usesRequire, usesAssert := false, false
+	for i, function := range functions {
+		test := testifyFunction(file, function, decls[i], imports)
+		usesRequire = usesRequire || test.Err
+		usesAssert = usesAssert || len(test.Results) > 0
+		data.Functions = append(data.Functions, test)
+	}
+
+	if usesAssert {
+		imports[strconv.Quote(testifyModule+"/assert")] = true
+	}
+	if usesRequire {
+		imports[strconv.Quote(testifyModule+"/require")] = true
+	}
+	for spec := range imports {
+		// Standard library paths have no dot in their first element
+		importPath := spec[strings.IndexByte(spec, '"'):]
+		if first, _, _ := strings.Cut(importPath, "/"); strings.Contains(first, ".") {
+			data.ThirdParty = append(data.ThirdParty, spec)
+		} else {
+			data.Imports = append(data.Imports, spec)
+		}
+	}
+	return data
+}
+
+// testifyFunction returns the test data of function, declared by fn, and
+// adds the imports its types need to imports.
+func testifyFunction(file *ast.File, function FunctionData, fn *ast.FuncDecl, imports map[string]bool) TestifyFunctionData {
+	test := TestifyFunctionData{FunctionData: function, Qualified: function.Name}
+	callee := function.Name
+	if receiver := function.Receiver; receiver != nil {
+		test.Qualified = receiver.Type + "." + function.Name
+		if len(receiver.Setup) == 0 || fn.Type.TypeParams != nil {
+			// Generic receivers need type arguments
+			return test
+		}
+		callee = receiver.Var + "." + function.Name
+	}
+	if fn.Type.TypeParams != nil {
+		return test
+	}
+
+	specs, ok := typeImports(file, fn.Type)
+	if !ok {
+		return test
+	}
+	taken := func(name string) bool {
+		return testifyReserved.MatchString(name) || specs[name] != "" ||
+			(function.Receiver != nil && name == function.Receiver.Var) ||
+			slices.ContainsFunc(test.Params, func(param TestifyParam) bool { return param.Name == name })
+	}
+
+	var args []string
+	for i, field := range fn.Type.Params.List {
+		typ, variadic := field.Type, false
+		if ellipsis, ok := typ.(*ast.Ellipsis); ok {
+			typ, variadic = &ast.ArrayType{Elt: ellipsis.Elt}, true
+		}
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{nil}
+		}
+		for _, ident := range names {
+			name := fmt.Sprintf("arg%d", len(test.Params))
+			if ident != nil && ident.Name != "_" {
+				name = ident.Name
+			}
+			for taken(name) {
+				name += "Arg"
+			}
+			test.Params = append(test.Params, TestifyParam{Name: name, Type: types.ExprString(typ)})
+
+			arg := name
+			if function.TableDriven {
+				arg = "tt." + name
+			}
+			if variadic && i == len(fn.Type.Params.List)-1 {
+				arg += "..."
+			}
+			args = append(args, arg)
+		}
+	}
+
+	var results []string
+	if fn.Type.Results != nil {
+		fields := fn.Type.Results.List
+		if last := fields[len(fields)-1]; types.ExprString(last.Type) == "error" && len(last.Names) <= 1 {
+			test.Err, fields = true, fields[:len(fields)-1]
+		}
+		for _, field := range fields {
+			for k := 0; k < fieldCount(field); k++ {
+				suffix := ""
+				if n := len(test.Results); n > 0 {
+					suffix = strconv.Itoa(n)
+				}
+				test.Results = append(test.Results, TestifyResult{
+					Got:  "got" + suffix,
+					Want: "want" + suffix,
+					Type: types.ExprString(field.Type),
+				})
+				results = append(results, "got"+suffix)
+			}
+		}
+	}
+	if test.Err {
+		results = append(results, "err")
+	}
+
+	switch {
+	case len(results) == 0:
+	case len(test.Results) == 0 && declaresErr(function.Receiver):
+		// The receiver's constructor declared err in the same scope
+		test.Assign = "err = "
+	default:
+		test.Assign = strings.Join(results, ", ") + " := "
+	}
+	test.Call = fmt.Sprintf("%s(%s)", callee, strings.Join(args, ", "))
+	for _, spec := range specs {
+		imports[spec] = true
+	}
+	return test
+}
+
+// declaresErr reports whether the setup of receiver declares err.
+func declaresErr(receiver *ReceiverData) bool {
+	return receiver != nil && len(receiver.Setup) > 0 && strings.HasPrefix(receiver.Setup[0], receiver.Var+", err :=")
+}
+
+// typeImports returns the import specs of the packages the parameter and
+// result types of fn refer to, by package name, resolved against the
+// imports of file. It fails when a package cannot be told apart, such as
+// through a dot import.
+func typeImports(file *ast.File, fn *ast.FuncType) (map[string]string, bool) {
+	names := make(map[string]bool)
+	var fields []*ast.Field
+	fields = append(fields, fn.Params.List...)
+	if fn.Results != nil {
+		fields = append(fields, fn.Results.List...)
+	}
+	for _, field := range fields {
+		ast.Inspect(field.Type, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok {
+					names[ident.Name] = true
+				}
+				return false
+			}
+			return true
+		})
+	}
+
+	specs := make(map[string]string)
+	for name := range names {
+		for _, spec := range file.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			switch {
+			case spec.Name != nil && spec.Name.Name == name:
+				specs[name] = spec.Name.Name + " " + spec.Path.Value
+			case spec.Name == nil && importName(importPath) == name:
+				specs[name] = spec.Path.Value
+			}
+		}
+		if specs[name] == "" {
+			return nil, false
+		}
+	}
+	return specs, true
+}
+
+// majorVersion matches the major version suffix of an import path.
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// importName guesses the package name of an import path from its last
+// element, without a major version suffix, a gopkg.in version, or a go-
+// prefix.
+func importName(importPath string) string {
+	name := path.Base(importPath)
+	if majorVersion.MatchString(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	return strings.ReplaceAll(name, "-", "_")
+}
@@ -1,27 +1,50 @@
+// Package testing generates tests for Go code, such as table-driven, golden,
+// fuzz, and example tests, and runs them: only those affected by a change,
+// repeatedly to find flaky ones, or with coverage of the changed lines.
 package testing
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/token"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"text/template"
+
+	"goforge/pkg/exitcode"
+	"goforge/pkg/logging"
+	"goforge/pkg/module"
+	"goforge/pkg/proc"
+	"goforge/pkg/safewrite"
+	"goforge/pkg/workerpool"
+
+	"golang.org/x/exp/slices"
 )
 
-// TestTemplate is a basic template for Go tests.
+// TestTemplate is a basic template for Go tests. A method's test first
+// constructs the receiver.
 const TestTemplate = `package {{.Package}}
 
 import (
 	"testing"
 )
-
 {{range .Functions}}
-func Test{{.Name}}(t *testing.T) {
-	{{if .TableDriven}}
+{{- template "function" .}}
+{{end}}` + testFuncTemplate
+
+// testFuncTemplate defines the "function" template, which renders the test of
+// a FunctionData, for the templates of files holding such tests.
+const testFuncTemplate = `
+{{- define "function"}}
+func Test{{.TestName}}(t *testing.T) {
+	{{- if .TableDriven}}
 	tests := []struct {
 		name string
 		// TODO: Add test case inputs and expected outputs
@@ -33,17 +56,41 @@ func Test{{.Name}}(t *testing.T) {
 			name: "test case 2",
 		},
 	}
-	
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// TODO: Call {{.Name}} with the test case inputs and verify outputs
+			{{- template "body" .}}
 		})
 	}
-	{{else}}
-	// TODO: Write test for {{.Name}}
-	{{end}}
+	{{- else}}
+	{{- template "body" .}}
+	{{- end}}
 }
-{{end}}
+{{- end}}
+{{- define "body"}}
+{{- with .Receiver}}
+{{- if .Note}}
+// TODO: {{.Note}}
+{{- end}}
+{{- range .Setup}}
+{{.}}
+{{- end}}
+{{- if $.TableDriven}}
+// TODO: Call {{.Var}}.{{$.Name}} with the test case inputs and verify outputs
+{{- else}}
+// TODO: Write test for {{.Type}}.{{$.Name}}
+{{- end}}
+{{- if .Setup}}
+_ = {{.Var}}
+{{- end}}
+{{- else}}
+{{- if $.TableDriven}}
+// TODO: Call {{$.Name}} with the test case inputs and verify outputs
+{{- else}}
+// TODO: Write test for {{$.Name}}
+{{- end}}
+{{- end}}
+{{- end}}
 `
 
 // TestData holds data for the test template.
@@ -52,15 +99,136 @@ type TestData struct {
 	Functions []FunctionData
 }
 
-// FunctionData holds data about a function to test.
+// FunctionData holds data about a function or method to test.
 type FunctionData struct {
-	Name        string
+	Name string
+	// TestName is what follows Test in the test's name: Name, or
+	// Type_Name for a method (_type_Name for an unexported type).
+	TestName    string
 	TableDriven bool
+	// Receiver is set for methods.
+	Receiver *ReceiverData
+}
+
+// DefaultPattern places each test file next to its source file.
+const DefaultPattern = "{dir}/{name}_test.go"
+
+// GenerateOptions controls where and how test files are generated.
+type GenerateOptions struct {
+	// OutputDir, when set, is the base directory for generated files instead
+	// of the source tree.
+	OutputDir string
+	// Pattern is the output path relative to the base directory. The
+	// placeholders {dir}, {name}, and {pkg} expand to the source file's
+	// directory relative to the input path, its base name without .go,
+	// and its package name.
+	Pattern string
+	// Options decides whether existing test files are replaced or diffed.
+	safewrite.Options
+	// Table generates table-driven tests.
+	Table bool
+	// IncludeUnexported also generates unit tests for unexported functions
+	// and methods and the methods of unexported types, which tests in the
+	// same package can call.
+	IncludeUnexported bool
+	// Only, when set, is a regular expression limiting generation to the
+	// functions whose names match; methods are matched as Type.Method.
+	Only string
+	// Exclude, when set, is a regular expression of the function names to
+	// leave out, matched like Only.
+	Exclude string
+	// Fuzz generates fuzz tests for the exported functions whose
+	// parameters go test can fuzz instead of unit tests.
+	Fuzz bool
+	// Examples generates example functions for the exported functions and
+	// methods instead of unit tests.
+	Examples bool
+	// RunExamples builds and runs the generated examples to fill in their
+	// Output comments. It executes the package's code.
+	RunExamples bool
+	// Style is the style of unit tests, StyleStd by default or
+	// StyleTestify.
+	Style string
+	// Golden generates unit tests that compare the output of functions
+	// returning a []byte or string, or writing to an io.Writer, with
+	// golden files in testdata, and stubs for the other functions.
+	Golden bool
+
+	// filter is compiled from the fields above by GenerateTests.
+	filter functionFilter
+}
+
+// Why functions are left out of the generated tests, as the summary
+// counts them.
+const (
+	skipUnexported  = "unexported"
+	skipOnly        = "not matched by --only"
+	skipExcluded    = "matched by --exclude"
+	skipNotCallable = "init or main, which tests cannot call"
+	skipUnsupported = "not supported, as listed above"
+)
+
+// functionFilter selects the functions and methods to generate tests for.
+type functionFilter struct {
+	includeUnexported bool
+	only              *regexp.Regexp
+	exclude           *regexp.Regexp
+}
+
+// newFunctionFilter compiles the function filters of opts. Unexported
+// functions only get unit tests: fuzz tests stick to the exported API and
+// examples document it.
+func newFunctionFilter(opts GenerateOptions) (functionFilter, error) {
+	filter := functionFilter{includeUnexported: opts.IncludeUnexported && !opts.Fuzz && !opts.Examples}
+	for _, pattern := range []struct {
+		name string
+		expr string
+		re   **regexp.Regexp
+	}{
+		{"only", opts.Only, &filter.only},
+		{"exclude", opts.Exclude, &filter.exclude},
+	} {
+		if pattern.expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern.expr)
+		if err != nil {
+			return functionFilter{}, fmt.Errorf("invalid %s pattern %q: %w", pattern.name, pattern.expr, err)
+		}
+		*pattern.re = re
+	}
+	return filter, nil
+}
+
+// skip returns why fn, declared in package packageName, is left out, or ""
+// when it gets a test.
+func (f functionFilter) skip(fn *ast.FuncDecl, packageName string) string {
+	name, exported := fn.Name.Name, ast.IsExported(fn.Name.Name)
+	if fn.Recv == nil {
+		if name == "init" || (name == "main" && packageName == "main") {
+			return skipNotCallable
+		}
+	} else {
+		typeName, _ := receiverType(fn)
+		if typeName == "" {
+			return skipUnsupported
+		}
+		name, exported = typeName+"."+name, exported && ast.IsExported(typeName)
+	}
+	switch {
+	case !exported && !f.includeUnexported:
+		return skipUnexported
+	case f.only != nil && !f.only.MatchString(name):
+		return skipOnly
+	case f.exclude != nil && f.exclude.MatchString(name):
+		return skipExcluded
+	}
+	return ""
 }
 
 // GenerateTests creates test files for Go functions.
-func GenerateTests(path string, outputDir string, tableTests bool) error {
-	fmt.Println("Generating tests for:", path)
+func GenerateTests(path string, opts GenerateOptions) error {
+	logging.Infoln("Generating tests for:", path)
 
 	// Get absolute path
 	absPath, err := filepath.Abs(path)
@@ -74,112 +242,486 @@ func GenerateTests(path string, outputDir string, tableTests bool) error {
 		return fmt.Errorf("failed to stat path: %w", err)
 	}
 
+	if opts.Fuzz && opts.Examples {
+		return fmt.Errorf("fuzz tests and examples are generated separately; pass one of them")
+	}
+	if opts.RunExamples && !opts.Examples {
+		return fmt.Errorf("only generated examples are run; pass --examples too")
+	}
+	if opts.Golden && (opts.Fuzz || opts.Examples) {
+		return fmt.Errorf("golden tests are unit tests and cannot be combined with fuzz tests or examples")
+	}
+	if opts.filter, err = newFunctionFilter(opts); err != nil {
+		return err
+	}
+	if opts.OutputDir != "" {
+		if opts.OutputDir, err = module.ResolveOutput(absPath, opts.OutputDir); err != nil {
+			return err
+		}
+	}
+	if opts.Style == "" {
+		opts.Style = StyleStd
+	}
+	if !slices.Contains(Styles, opts.Style) {
+		return fmt.Errorf("invalid style %q (expected %s)", opts.Style, strings.Join(Styles, " or "))
+	}
+	if opts.Style == StyleTestify && !opts.Fuzz && !opts.Examples && !opts.Golden {
+		warnMissingTestify(absPath)
+	}
+	if opts.Pattern == "" {
+		opts.Pattern = DefaultPattern
+		if opts.Fuzz {
+			opts.Pattern = DefaultFuzzPattern
+		}
+		if opts.Examples {
+			opts.Pattern = DefaultExamplePattern
+		}
+		if opts.OutputDir != "" {
+			opts.Pattern = strings.TrimPrefix(opts.Pattern, "{dir}/")
+		}
+	}
+
+	var root string
+	var sources []string
 	if fi.IsDir() {
 		// If it's a directory, process all Go files
-		return filepath.Walk(absPath, func(path string, info os.FileInfo, err error) error {
+		root = absPath
+		err := filepath.Walk(absPath, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
 
 			if !info.IsDir() && strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go") {
-				return generateTestForFile(path, outputDir, tableTests)
+				sources = append(sources, path)
 			}
 
 			return nil
 		})
+		if err != nil {
+			return err
+		}
 	} else if strings.HasSuffix(absPath, ".go") && !strings.HasSuffix(absPath, "_test.go") {
 		// If it's a single Go file, process it
-		return generateTestForFile(absPath, outputDir, tableTests)
+		root = filepath.Dir(absPath)
+		sources = []string{absPath}
 	} else {
 		return fmt.Errorf("path must be a directory or a Go file")
 	}
+
+	// Generate the tests concurrently, then write them in order
+	tests := make([]generatedTest, len(sources))
+	generate := generateTestForFile
+	if opts.Fuzz {
+		generate = generateFuzzForFile
+	}
+	if opts.Examples {
+		generate = generateExamplesForFile
+	}
+	workerpool.Run(len(sources), func(i int) {
+		tests[i] = generate(root, sources[i], opts)
+	})
+	if opts.Golden {
+		helpers, err := goldenHelpers(tests)
+		if err != nil {
+			return err
+		}
+		tests = append(tests, helpers...)
+	}
+
+	summary := generateSummary{skipped: make(map[string]int), stubs: make(map[string]int)}
+	for _, test := range tests {
+		if err := test.write(opts); err != nil {
+			return err
+		}
+		summary.add(test)
+	}
+	summary.print(opts.Golden)
+	return nil
+}
+
+// warnMissingTestify warns when the module of path does not require
+// testify, which the generated tests import.
+func warnMissingTestify(path string) {
+	root, err := module.FindRoot(path)
+	if err != nil {
+		return
+	}
+	requires, err := module.DirectRequires(root)
+	if err == nil && !requires[testifyModule] {
+		fmt.Fprintf(os.Stderr, "WARNING: %s does not require %s; run 'go get %s' for the generated tests to build\n",
+			filepath.Join(root, "go.mod"), testifyModule, testifyModule)
+	}
+}
+
+// generateSummary counts the functions tests were generated for.
+type generateSummary struct {
+	covered int
+	// golden counts the functions with golden tests, and stubs those
+	// covered by stubs instead, by reason.
+	golden  int
+	stubs   map[string]int
+	skipped map[string]int
+}
+
+// add counts the functions of test.
+func (s *generateSummary) add(test generatedTest) {
+	s.covered += test.covered
+	s.golden += test.golden
+	for reason, count := range test.stubs {
+		s.stubs[reason] += count
+	}
+	for reason, count := range test.skips {
+		s.skipped[reason] += count
+	}
+}
+
+// print prints how many functions got tests and how many were skipped for
+// each reason, and with golden tests, how many got stubs and why.
+func (s *generateSummary) print(golden bool) {
+	fmt.Printf("\nFunctions covered: %d, skipped: %d\n", s.covered, countReasons(s.skipped))
+	printReasons(s.skipped)
+	if golden {
+		fmt.Printf("\nGolden tests: %d, stubs: %d\n", s.golden, countReasons(s.stubs))
+		printReasons(s.stubs)
+	}
+}
+
+// countReasons returns the number of functions counted in reasons.
+func countReasons(reasons map[string]int) int {
+	total := 0
+	for _, count := range reasons {
+		total += count
+	}
+	return total
+}
+
+// printReasons lists the number of functions of each reason.
+func printReasons(reasons map[string]int) {
+	keys := make([]string, 0, len(reasons))
+	for reason := range reasons {
+		keys = append(keys, reason)
+	}
+	sort.Strings(keys)
+	for _, reason := range keys {
+		fmt.Printf("- %d %s\n", reasons[reason], reason)
+	}
+}
+
+// generatedTest is the test file generated for one source file.
+type generatedTest struct {
+	source string
+	// output is empty when the source file has nothing to test.
+	output string
+	data   []byte
+	// skipped lists the functions left out of fuzz tests or examples and
+	// why.
+	skipped []string
+	// covered counts the functions the file tests, and skips those left
+	// out by reason.
+	covered int
+	skips   map[string]int
+	// golden counts the functions with golden tests, stubs those that got
+	// stubs instead by reason, and pkg is their package.
+	golden int
+	stubs  map[string]int
+	pkg    string
+	err    error
+}
+
+// skip counts a function left out of the test for reason.
+func (test *generatedTest) skip(reason string) {
+	if test.skips == nil {
+		test.skips = make(map[string]int)
+	}
+	test.skips[reason]++
+}
+
+// write writes the test file, unless generating it failed.
+func (test *generatedTest) write(opts GenerateOptions) error {
+	if test.err != nil {
+		return test.err
+	}
+	for _, reason := range test.skipped {
+		fmt.Printf("Skipped %s\n", reason)
+	}
+	if test.output == "" {
+		if opts.Fuzz {
+			logging.Infof("No fuzzable functions found in %s, skipping\n", test.source)
+		} else if opts.Examples {
+			logging.Infof("No functions or methods to make examples of found in %s, skipping\n", test.source)
+		} else {
+			logging.Infof("No functions or methods to test found in %s, skipping\n", test.source)
+		}
+		return nil
+	}
+
+	// Check if test file already exists
+	if err := opts.Check(test.output); err != nil {
+		return err
+	}
+
+	written, err := opts.Write(safewrite.File{Path: test.output, Data: test.data})
+	if err != nil || !written {
+		return err
+	}
+
+	fmt.Printf("Generated test file: %s\n", test.output)
+	return nil
+}
+
+// testOutputPath expands the output pattern for a source file under root.
+func testOutputPath(root string, path string, packageName string, opts GenerateOptions) (string, error) {
+	relDir, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve source directory: %w", err)
+	}
+
+	replacer := strings.NewReplacer(
+		"{dir}", filepath.ToSlash(relDir),
+		"{name}", strings.TrimSuffix(filepath.Base(path), ".go"),
+		"{pkg}", packageName,
+	)
+	outputPath := filepath.FromSlash(replacer.Replace(opts.Pattern))
+
+	if !strings.HasSuffix(outputPath, "_test.go") {
+		return "", fmt.Errorf("output pattern %q must produce a _test.go file", opts.Pattern)
+	}
+	if filepath.IsAbs(outputPath) {
+		return filepath.Clean(outputPath), nil
+	}
+
+	base := root
+	if opts.OutputDir != "" {
+		base = opts.OutputDir
+	}
+	return filepath.Join(base, outputPath), nil
 }
 
-// generateTestForFile creates a test file for a single Go file.
-func generateTestForFile(path string, outputDir string, tableTests bool) error {
+// generateTestForFile generates the test file for a single Go file under
+// root without writing it.
+func generateTestForFile(root string, path string, opts GenerateOptions) generatedTest {
+	test := generatedTest{source: path}
+	fail := func(err error) generatedTest {
+		test.err = err
+		return test
+	}
+
 	// Parse the Go file
 	fset := token.NewFileSet()
 	node, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
 	if err != nil {
-		return fmt.Errorf("failed to parse Go file: %w", err)
+		return fail(fmt.Errorf("failed to parse Go file: %w", err))
 	}
 
 	// Get package name
 	packageName := node.Name.Name
 
-	// Find exported functions
+	// Find the functions and methods to test
 	var functions []FunctionData
+	var funcDecls []*ast.FuncDecl
+	var decls *packageDecls
 	for _, decl := range node.Decls {
-		if fn, ok := decl.(*ast.FuncDecl); ok && ast.IsExported(fn.Name.Name) {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if reason := opts.filter.skip(fn, packageName); reason != "" {
+			test.skip(reason)
+			continue
+		}
+		if fn.Recv == nil {
+			testName := fn.Name.Name
+			if !ast.IsExported(testName) {
+				testName = "_" + testName
+			}
 			functions = append(functions, FunctionData{
 				Name:        fn.Name.Name,
-				TableDriven: tableTests,
+				TestName:    testName,
+				TableDriven: opts.Table,
 			})
+			funcDecls = append(funcDecls, fn)
+			continue
 		}
+
+		typeName, generic := receiverType(fn)
+		if decls == nil {
+			// Constructors may be declared in any file of the package
+			parsed, err := parsePackageDecls(filepath.Dir(path), packageName)
+			if err != nil {
+				return fail(err)
+			}
+			decls = &parsed
+		}
+		receiver := receiverData(fn, typeName, generic, *decls, testFatal)
+		testName := typeName + "_" + fn.Name.Name
+		if !ast.IsExported(typeName) {
+			// go vet rejects test names continuing in lowercase
+			testName = "_" + testName
+		}
+		functions = append(functions, FunctionData{
+			Name:        fn.Name.Name,
+			TestName:    testName,
+			TableDriven: opts.Table,
+			Receiver:    &receiver,
+		})
+		funcDecls = append(funcDecls, fn)
 	}
 
 	if len(functions) == 0 {
-		fmt.Printf("No exported functions found in %s, skipping\n", path)
-		return nil
+		return test
 	}
+	test.covered = len(functions)
 
-	// Prepare output directory
-	var outputPath string
-	if outputDir == "" {
-		// Use same directory as source file
-		dir := filepath.Dir(path)
-		baseName := filepath.Base(path)
-		fileName := strings.TrimSuffix(baseName, ".go") + "_test.go"
-		outputPath = filepath.Join(dir, fileName)
-	} else {
-		// Create output directory if it doesn't exist
-		err = os.MkdirAll(outputDir, 0755)
-		if err != nil {
-			return fmt.Errorf("failed to create output directory: %w", err)
-		}
-
-		baseName := filepath.Base(path)
-		fileName := strings.TrimSuffix(baseName, ".go") + "_test.go"
-		outputPath = filepath.Join(outputDir, fileName)
+	outputPath, err := testOutputPath(root, path, packageName, opts)
+	if err != nil {
+		return fail(err)
 	}
 
-	// Check if test file already exists
-	if _, err := os.Stat(outputPath); err == nil {
-		return fmt.Errorf("test file already exists: %s", outputPath)
+	var source []byte
+	switch {
+	case opts.Golden:
+		if decls == nil {
+			// Arguments may be of types declared in any file of the package
+			parsed, err := parsePackageDecls(filepath.Dir(path), packageName)
+			if err != nil {
+				return fail(err)
+			}
+			decls = &parsed
+		}
+		test.pkg = packageName
+		source, err = renderTest(GoldenTemplate, goldenData(node, functions, funcDecls, *decls, &test))
+	case opts.Style == StyleTestify:
+		source, err = renderTest(TestifyTemplate, testifyData(node, functions, funcDecls))
+	default:
+		source, err = renderTest(TestTemplate, TestData{Package: packageName, Functions: functions})
 	}
-
-	// Create template data
-	data := TestData{
-		Package:   packageName,
-		Functions: functions,
+	if err != nil {
+		return fail(err)
 	}
 
+	test.output, test.data = outputPath, source
+	return test
+}
+
+// renderTest executes a test template and formats the result.
+func renderTest(text string, data any) ([]byte, error) {
 	// Parse and execute the template
-	tmpl, err := template.New("test").Parse(TestTemplate)
+	tmpl, err := template.New("test").Parse(text)
 	if err != nil {
-		return fmt.Errorf("failed to parse test template: %w", err)
+		return nil, fmt.Errorf("failed to parse test template: %w", err)
 	}
 
-	// Create output file
-	file, err := os.Create(outputPath)
+	// Execute the template
+	var content bytes.Buffer
+	err = tmpl.Execute(&content, data)
 	if err != nil {
-		return fmt.Errorf("failed to create test file: %w", err)
+		return nil, fmt.Errorf("failed to execute test template: %w", err)
 	}
-	defer file.Close()
 
-	// Execute the template
-	err = tmpl.Execute(file, data)
+	// The template leaves indentation to gofmt
+	source, err := format.Source(content.Bytes())
 	if err != nil {
-		return fmt.Errorf("failed to execute test template: %w", err)
+		return nil, fmt.Errorf("failed to format generated test: %w", err)
 	}
+	return source, nil
+}
 
-	fmt.Printf("Generated test file: %s\n", outputPath)
-	return nil
+// Coverage profile modes of go test -covermode.
+const (
+	CoverModeSet    = "set"
+	CoverModeCount  = "count"
+	CoverModeAtomic = "atomic"
+)
+
+// CoverModes lists the supported coverage profile modes.
+var CoverModes = []string{CoverModeSet, CoverModeCount, CoverModeAtomic}
+
+// CoverageOptions configures AnalyzeCoverage.
+type CoverageOptions struct {
+	// Threshold is the lowest passing coverage percentage.
+	Threshold float64
+	// Output is the path of the HTML report.
+	Output string
+	// DiffBase, when set, applies the threshold to the lines changed since
+	// the merge base of this git ref and HEAD instead of the total.
+	DiffBase string
+	// Race runs the tests with the race detector.
+	Race bool
+	// CoverMode is the go test -covermode; empty means atomic with Race,
+	// the only mode go test accepts with it, and set otherwise.
+	CoverMode string
+	// Exclude lists the files and packages left out of the coverage, such
+	// as generated code or main packages. See excludedFromCoverage.
+	Exclude []string
+	// Format is FormatText, the default, or FormatJSON.
+	Format string
+	// LeastCovered is how many of the least-covered functions to list;
+	// zero means DefaultLeastCovered.
+	LeastCovered int
+	// PackageThresholds maps package patterns to the coverage each matching
+	// package must reach on its own. See applyPackageThresholds.
+	PackageThresholds map[string]float64
+	// Soft reports missed thresholds as warnings instead of failing.
+	Soft bool
+	// Terminal, when above zero, prints the source of this many of the
+	// least-covered files with their covered and uncovered lines. See
+	// PrintTerminalCoverage.
+	Terminal int
 }
 
-// AnalyzeCoverage analyzes test coverage for a Go project.
-func AnalyzeCoverage(path string, threshold float64, outputFile string) error {
-	fmt.Printf("Analyzing test coverage for %s (threshold: %.1f%%)\n", path, threshold)
+// coverMode validates opts.CoverMode and returns the mode to use.
+func (opts CoverageOptions) coverMode() (string, error) {
+	switch {
+	case opts.CoverMode == "" && opts.Race:
+		return CoverModeAtomic, nil
+	case opts.CoverMode == "":
+		return CoverModeSet, nil
+	case !slices.Contains(CoverModes, opts.CoverMode):
+		return "", fmt.Errorf("invalid cover mode %q (expected %s)", opts.CoverMode, strings.Join(CoverModes, ", "))
+	case opts.Race && opts.CoverMode != CoverModeAtomic:
+		return "", fmt.Errorf("cover mode %s cannot be used with the race detector; use atomic", opts.CoverMode)
+	}
+	return opts.CoverMode, nil
+}
+
+// AnalyzeCoverage runs the tests of a Go project with coverage and reports
+// the coverage by package, file, and least-covered function, as text or
+// JSON, along with an HTML report.
+func AnalyzeCoverage(path string, opts CoverageOptions) error {
+	threshold, outputFile := opts.Threshold, opts.Output
+	coverMode, err := opts.coverMode()
+	if err != nil {
+		return err
+	}
+	if err := checkExcludePatterns(opts.Exclude); err != nil {
+		return err
+	}
+	format := opts.Format
+	if format == "" {
+		format = FormatText
+	}
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("invalid format %q (expected %s or %s)", format, FormatText, FormatJSON)
+	}
+	leastCovered := opts.LeastCovered
+	if leastCovered == 0 {
+		leastCovered = DefaultLeastCovered
+	}
+	if leastCovered < 0 {
+		return fmt.Errorf("number of least-covered functions cannot be negative")
+	}
+	for pattern, percent := range opts.PackageThresholds {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("invalid threshold %v for package %q (expected 0 to 100)", percent, pattern)
+		}
+	}
+	jsonOutput := format == FormatJSON
+	if jsonOutput && opts.Terminal > 0 {
+		return fmt.Errorf("terminal coverage is printed as text; it cannot be combined with the %s format", FormatJSON)
+	}
+	if !jsonOutput {
+		logging.Infof("Analyzing test coverage for %s (threshold: %.1f%%, cover mode: %s)\n", path, threshold, coverMode)
+	}
 
 	// Get absolute paths
 	absPath, err := filepath.Abs(path)
@@ -187,9 +729,18 @@ func AnalyzeCoverage(path string, threshold float64, outputFile string) error {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	absOutput, err := filepath.Abs(outputFile)
+	absOutput, err := module.ResolveOutput(absPath, outputFile)
+	if err != nil {
+		return err
+	}
+
+	root, err := module.FindRoot(absPath)
+	if err != nil {
+		return err
+	}
+	modulePath, err := module.Path(root)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for output: %w", err)
+		return err
 	}
 
 	// Change to project directory
@@ -206,7 +757,11 @@ func AnalyzeCoverage(path string, threshold float64, outputFile string) error {
 
 	// Run tests with coverage
 	coverProfilePath := "coverage.out"
-	coverCmd := exec.Command("go", "test", "./...", "-coverprofile="+coverProfilePath)
+	testArgs := []string{"test", "./...", "-covermode=" + coverMode, "-coverprofile=" + coverProfilePath}
+	if opts.Race {
+		testArgs = append(testArgs, "-race")
+	}
+	coverCmd := proc.Command("go", testArgs...)
 	coverOutput, err := coverCmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to run tests with coverage: %w\nOutput: %s", err, coverOutput)
@@ -217,47 +772,170 @@ func AnalyzeCoverage(path string, threshold float64, outputFile string) error {
 		return fmt.Errorf("coverage file was not created, ensure tests exist")
 	}
 
-	// Get coverage percentage
-	funcCmd := exec.Command("go", "tool", "cover", "-func="+coverProfilePath)
-	funcOutput, err := funcCmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to analyze coverage: %w\nOutput: %s", err, funcOutput)
+	if len(opts.Exclude) > 0 {
+		excluded, err := excludeFromProfile(coverProfilePath, modulePath, opts.Exclude)
+		if err != nil {
+			return err
+		}
+		if !jsonOutput {
+			logging.Infof("Excluded %d files from the coverage\n", excluded)
+		}
 	}
 
-	// Display coverage results
-	fmt.Println("\nCoverage Results:")
-	fmt.Println(string(funcOutput))
+	blocks, err := readProfile(coverProfilePath, modulePath)
+	if err != nil {
+		return err
+	}
+	report := buildCoverageReport(root, modulePath, blocks, leastCovered)
+	report.Path, report.Mode, report.Threshold, report.HTMLReport = path, coverMode, threshold, absOutput
 
 	// Generate HTML report
-	htmlCmd := exec.Command("go", "tool", "cover", "-html="+coverProfilePath, "-o", absOutput)
+	if err := safewrite.CreateDir(absOutput); err != nil {
+		return err
+	}
+	htmlCmd := proc.Command("go", "tool", "cover", "-html="+coverProfilePath, "-o", absOutput)
 	htmlOutput, err := htmlCmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to generate HTML report: %w\nOutput: %s", err, htmlOutput)
 	}
 
-	// Extract total coverage percentage from output
-	outputLines := strings.Split(string(funcOutput), "\n")
-	var totalCoverage float64
-	for _, line := range outputLines {
-		if strings.Contains(line, "total:") {
-			parts := strings.Fields(line)
-			if len(parts) >= 3 {
-				percentStr := strings.TrimSuffix(parts[len(parts)-1], "%")
-				fmt.Sscanf(percentStr, "%f", &totalCoverage)
-				break
+	// The threshold applies to the changed lines on a branch
+	percent, subject := report.Total, "coverage"
+	if opts.DiffBase != "" {
+		if report.Diff, err = computeDiffCoverage(root, opts.DiffBase, coverProfilePath); err != nil {
+			return err
+		}
+		percent, subject = report.Diff.Percent(), "diff coverage"
+	}
+	unmatched := applyPackageThresholds(report, modulePath, opts.PackageThresholds)
+	var failures []string
+	if percent < threshold {
+		failures = append(failures, fmt.Sprintf("%s (%.1f%%) is below threshold (%.1f%%)", subject, percent, threshold))
+	}
+	for _, pkg := range report.PackageThresholds {
+		if !pkg.Passed {
+			failures = append(failures, fmt.Sprintf("coverage of %s (%.1f%%) is below its threshold (%.1f%%)", pkg.Package, pkg.Percent, pkg.Threshold))
+		}
+	}
+	report.Passed = len(failures) == 0
+
+	if jsonOutput {
+		if err := writeCoverageJSON(os.Stdout, report); err != nil {
+			return err
+		}
+	} else {
+		for _, pattern := range unmatched {
+			fmt.Fprintf(os.Stderr, "WARNING: package threshold %q matches no package with statements\n", pattern)
+		}
+		printCoverageReport(os.Stdout, report)
+		if opts.Terminal > 0 {
+			if err := PrintTerminalCoverage(coverProfilePath, opts.Terminal); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("\nTotal coverage: %.1f%% (%d/%d statements)\n", report.Total, report.Covered, report.Statements)
+		fmt.Printf("Coverage HTML report generated at: %s\n", absOutput)
+		if report.Diff != nil {
+			PrintDiffCoverage(report.Diff)
+			if report.Diff.Statements == 0 && report.Passed {
+				fmt.Println("\nSUCCESS: No changed statements to cover")
+				return nil
+			}
+			fmt.Printf("\nDiff coverage: %.1f%% (%d/%d changed lines)\n", percent, report.Diff.Covered, report.Diff.Statements)
+		}
+	}
+
+	if !report.Passed {
+		if opts.Soft {
+			if !jsonOutput {
+				fmt.Fprintln(os.Stderr)
+				for _, failure := range failures {
+					fmt.Fprintf(os.Stderr, "WARNING: %s\n", failure)
+				}
 			}
+			return nil
 		}
+		return exitcode.Policyf("%s", strings.Join(failures, "; "))
+	}
+	if !jsonOutput {
+		fmt.Printf("\nSUCCESS: %s%s (%.1f%%) meets or exceeds threshold (%.1f%%)\n",
+			strings.ToUpper(subject[:1]), subject[1:], percent, threshold)
 	}
+	return nil
+}
 
-	// Check if coverage meets threshold
-	fmt.Printf("\nTotal coverage: %.1f%%\n", totalCoverage)
-	fmt.Printf("Coverage HTML report generated at: %s\n", absOutput)
+// excludeFromProfile rewrites the coverage profile at profilePath without
+// the blocks of the files of the module named modulePath that match the
+// exclude patterns, and returns how many files it left out.
+func excludeFromProfile(profilePath string, modulePath string, patterns []string) (int, error) {
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read coverage profile: %w", err)
+	}
 
-	if totalCoverage < threshold {
-		fmt.Printf("\nWARNING: Coverage (%.1f%%) is below threshold (%.1f%%)\n", totalCoverage, threshold)
-	} else {
-		fmt.Printf("\nSUCCESS: Coverage (%.1f%%) meets or exceeds threshold (%.1f%%)\n", totalCoverage, threshold)
+	var kept strings.Builder
+	excluded := make(map[string]bool)
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		colon := strings.LastIndex(line, ":")
+		if colon >= 0 && !strings.HasPrefix(line, "mode:") {
+			file, ok := strings.CutPrefix(line[:colon], modulePath+"/")
+			if ok && excludedFromCoverage(file, patterns) {
+				excluded[file] = true
+				continue
+			}
+		}
+		kept.WriteString(line)
+	}
+
+	if err := os.WriteFile(profilePath, []byte(kept.String()), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write coverage profile: %w", err)
 	}
+	return len(excluded), nil
+}
 
+// checkExcludePatterns fails on the first malformed exclude pattern.
+func checkExcludePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.TrimPrefix(pattern, "./"), ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
 	return nil
 }
+
+// excludedFromCoverage reports whether a file, given by its slash-separated
+// path relative to the module root, matches an exclude pattern. A pattern
+// ending in "/..." matches the files of a package and the packages below
+// it, e.g. ./cmd/...; one ending in "/" the files below a directory. Other
+// patterns are globs, matched against the base name when they have no slash
+// and against the whole path otherwise. A leading "./" is ignored.
+func excludedFromCoverage(file string, patterns []string) bool {
+	dir := path.Dir(file)
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(pattern, "./")
+		if pattern == "..." {
+			return true
+		}
+		if pkg, ok := strings.CutSuffix(pattern, "/..."); ok {
+			if dir == pkg || strings.HasPrefix(dir, pkg+"/") {
+				return true
+			}
+			continue
+		}
+		if dirPattern, ok := strings.CutSuffix(pattern, "/"); ok {
+			if strings.HasPrefix(file, dirPattern+"/") {
+				return true
+			}
+			continue
+		}
+
+		target := file
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(file)
+		}
+		if matched, _ := path.Match(pattern, target); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+// Package workerpool bounds how much work GoForge does at once. The global
+// --jobs flag sets the size of every pool, GOMAXPROCS by default, so heavy
+// commands don't oversubscribe a CI runner; one job runs everything in
+// order on the calling goroutine, which makes a run deterministic.
+package workerpool
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+var jobs atomic.Int64
+
+// SetJobs sets how many tasks a pool runs at once; zero or less restores
+// the default of GOMAXPROCS.
+func SetJobs(n int) {
+	jobs.Store(int64(n))
+}
+
+// Jobs returns how many tasks a pool runs at once.
+func Jobs() int {
+	if n := jobs.Load(); n > 0 {
+		return int(n)
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// Run calls task for every index from 0 to n-1, at most Jobs at a time, and
+// returns once all calls have returned. Tasks report their results by
+// index, so callers can use them in order however the tasks were
+// scheduled.
+func Run(n int, task func(i int)) {
+	workers := Jobs()
+	if n < workers {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			task(i)
+		}
+		return
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				task(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}